@@ -1,13 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"vancouver-trip-planner/internal/domain"
 	"vancouver-trip-planner/internal/handler"
 	"vancouver-trip-planner/internal/repository"
 	"vancouver-trip-planner/internal/service"
@@ -31,19 +37,189 @@ func main() {
 		port = "8080"
 	}
 
+	// Straight-line distances, walks and estimates are all measured on one Earth
+	var earth maps.Earth
+	if model := os.Getenv("DISTANCE_MODEL"); model != "" {
+		distanceModel, err := maps.ParseDistanceModel(model)
+		if err != nil {
+			log.Fatalf("DISTANCE_MODEL must be spherical or ellipsoidal: %v", err)
+		}
+		earth.Model = distanceModel
+	}
+	if radius := os.Getenv("EARTH_RADIUS_KM"); radius != "" {
+		radiusKm, err := strconv.ParseFloat(radius, 64)
+		if err != nil || !(radiusKm > 0) || math.IsInf(radiusKm, 0) {
+			log.Fatalf("EARTH_RADIUS_KM must be a positive radius in kilometres, got %q", radius)
+		}
+		earth.RadiusKm = radiusKm
+	}
+
 	// Initialize services
-	parkingRepo := repository.NewVancouverParkingRepository()
-	pricingService := service.NewPricingService()
+	repoOpts := []repository.RepositoryOption{repository.WithEarth(earth)}
+	if policyName := os.Getenv("MISSING_EVENING_RATE"); policyName != "" {
+		policy, err := repository.ParseMissingEveningRatePolicy(policyName)
+		if err != nil {
+			log.Fatalf("MISSING_EVENING_RATE must be free, inherit or exclude: %v", err)
+		}
+		repoOpts = append(repoOpts, repository.WithMissingEveningRatePolicy(policy))
+	}
+	if assumedRate := os.Getenv("ASSUMED_METER_RATE"); assumedRate != "" {
+		rate, err := strconv.ParseFloat(assumedRate, 64)
+		if err != nil || rate < 0 {
+			log.Fatalf("ASSUMED_METER_RATE must be a non-negative hourly rate in dollars, got %q", assumedRate)
+		}
+		repoOpts = append(repoOpts, repository.WithAssumedRate(rate))
+	}
+	if os.Getenv("PARKING_API_MAX_ATTEMPTS") != "" {
+		retry := repository.DefaultRetryPolicy()
+		retry.MaxAttempts = envInt("PARKING_API_MAX_ATTEMPTS", retry.MaxAttempts)
+		repoOpts = append(repoOpts, repository.WithRetryPolicy(retry))
+	}
+	if ttl := os.Getenv("PARKING_DATASET_TTL"); ttl != "" {
+		datasetTTL, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("PARKING_DATASET_TTL must be a duration such as 6h, got %q", ttl)
+		}
+		repoOpts = append(repoOpts, repository.WithDatasetCache(datasetTTL))
+	}
+	var parkingRepo repository.ParkingRepository = repository.NewVancouverParkingRepository(repoOpts...)
+	parkingCacheTTL := repository.DefaultParkingCacheTTL
+	if ttl := os.Getenv("PARKING_CACHE_TTL"); ttl != "" {
+		var err error
+		parkingCacheTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("PARKING_CACHE_TTL must be a duration such as 10m, got %q", ttl)
+		}
+	}
+	if parkingCacheTTL > 0 {
+		parkingRepo = repository.NewCachedParkingRepository(parkingRepo, parkingCacheTTL)
+	}
+	var pricingOpts []service.PricingOption
+	if os.Getenv("FREE_PARKING_ON_HOLIDAYS") == "true" {
+		pricingOpts = append(pricingOpts, service.WithFreeHolidays())
+	}
+	if rounding := os.Getenv("PARKING_ROUNDING"); rounding != "" {
+		policies, err := service.ParseRoundingPolicies(rounding)
+		if err != nil {
+			log.Fatalf("PARKING_ROUNDING must list none, ceil_to_increment(minutes) or minimum_purchase(minutes): %v", err)
+		}
+		pricingOpts = append(pricingOpts, service.WithRounding(policies...))
+	}
+	pricingService := service.NewPricingService(pricingOpts...)
 
-	mapsService, err := maps.NewGoogleMapsService(googleMapsAPIKey)
+	// Stop orders share legs, so driving times are remembered across plans
+	googleMaps, err := maps.NewGoogleMapsServiceWithCache(googleMapsAPIKey, envInt("TRAVEL_CACHE_SIZE", travelCacheSize))
 	if err != nil {
 		log.Fatalf("Failed to initialize Google Maps service: %v", err)
 	}
 
-	routingService := service.NewRoutingService(parkingRepo, mapsService, pricingService)
+	// Optionally fall back to Nominatim when Google can't geocode an address
+	var fallback maps.Geocoder
+	dataSources := []domain.Attributor{googleMaps}
+	if attributed, ok := parkingRepo.(domain.Attributor); ok {
+		dataSources = append(dataSources, attributed)
+	}
+	if os.Getenv("GEOCODER_FALLBACK") == "nominatim" {
+		nominatim := maps.NewNominatimGeocoder("", "vancouver-trip-planner")
+		fallback = nominatim
+		dataSources = append(dataSources, nominatim)
+	}
+	mapsService := geocodingMapsService(googleMaps, fallback)
+
+	routingOpts := []service.RoutingOption{service.WithEarth(earth)}
+	if leadMinutes := os.Getenv("PARKING_LEAD_MINUTES"); leadMinutes != "" {
+		minutes, err := strconv.Atoi(leadMinutes)
+		if err != nil || minutes < 0 {
+			log.Fatalf("PARKING_LEAD_MINUTES must be a non-negative integer, got %q", leadMinutes)
+		}
+		routingOpts = append(routingOpts, service.WithParkingLeadTime(minutes))
+	}
+
+	if searchMinutes := parkingSearchMinutes(); len(searchMinutes) > 0 {
+		routingOpts = append(routingOpts, service.WithParkingSearchTime(searchMinutes))
+	}
+
+	// Walks are traced with Google even when geocoding goes through a chain
+	routingOpts = append(routingOpts, service.WithWalkingRouter(googleMaps))
+
+	// Snapping to roads also costs a lookup per coordinate-only stop
+	if os.Getenv("SNAP_TO_ROAD") == "true" {
+		routingOpts = append(routingOpts, service.WithRoadSnapping(googleMaps))
+	}
+
+	// Reverse geocoding costs a Google lookup per new coordinate-only stop
+	if os.Getenv("REVERSE_GEOCODE") == "true" {
+		routingOpts = append(routingOpts, service.WithReverseGeocoding(googleMaps))
+	}
+
+	// Catch driving times from routing glitches, flagging them unless told otherwise
+	if bounds, ok := travelTimeBounds(); ok {
+		routingOpts = append(routingOpts, service.WithTravelTimeBounds(bounds))
+	}
+
+	// Trying every stop order is factorial, so larger trips are ordered
+	// heuristically. Beyond the default, the orders outnumber the candidates a
+	// plan keeps and only a spread of them is tried.
+	exactMaxStops := envInt("EXACT_PLANNING_MAX_STOPS", service.DefaultExactPlanningMaxStops)
+	if exactMaxStops <= 0 || exactMaxStops > service.DefaultExactPlanningMaxStops {
+		log.Printf("Warning: EXACT_PLANNING_MAX_STOPS=%d lets trips have more stop orders than the %d candidates kept per plan; not every order will be tried", exactMaxStops, service.DefaultMaxCandidates)
+	}
+	routingOpts = append(routingOpts, service.WithExactPlanningLimit(exactMaxStops))
+
+	routingMaps := routingMapsService(mapsService)
+	routingService := service.NewRoutingService(parkingRepo, routingMaps, pricingService, routingOpts...)
+
+	// Optionally fetch popular areas' meters and common addresses in the
+	// background, so the first plans find them cached
+	if warmup, ok := warmupConfig(); ok {
+		go func() {
+			result := service.Warmup(parkingRepo, routingMaps, warmup)
+			log.Printf("Warmup cached meters for %d areas and %d addresses", result.Cells, result.Addresses)
+			for _, err := range result.Errors {
+				log.Printf("Warning: %v", err)
+			}
+		}()
+	}
 
 	// Initialize handlers
-	tripHandler := handler.NewTripHandler(routingService)
+	handlerOpts := []handler.HandlerOption{handler.WithEarth(earth)}
+	if maxAddressLength := os.Getenv("MAX_ADDRESS_LENGTH"); maxAddressLength != "" {
+		length, err := strconv.Atoi(maxAddressLength)
+		if err != nil || length <= 0 {
+			log.Fatalf("MAX_ADDRESS_LENGTH must be a positive integer, got %q", maxAddressLength)
+		}
+		handlerOpts = append(handlerOpts, handler.WithMaxAddressLength(length))
+	}
+	planCacheTTL := handler.DefaultPlanCacheTTL
+	if ttl := os.Getenv("PLAN_CACHE_TTL"); ttl != "" {
+		planCacheTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("PLAN_CACHE_TTL must be a duration such as 30s, got %q", ttl)
+		}
+	}
+	if planCacheTTL > 0 {
+		handlerOpts = append(handlerOpts, handler.WithPlanCache(planCacheTTL))
+	}
+	if os.Getenv("PLAN_DEDUP") != "false" {
+		handlerOpts = append(handlerOpts, handler.WithInFlightDedup())
+	}
+	maxConcurrentPlans := envInt("MAX_CONCURRENT_PLANS", handler.DefaultMaxConcurrentPlans)
+	planQueueSize := envInt("PLAN_QUEUE_SIZE", handler.DefaultPlanQueueSize)
+	if maxConcurrentPlans > 0 {
+		handlerOpts = append(handlerOpts, handler.WithConcurrencyLimit(maxConcurrentPlans, planQueueSize))
+	}
+	if maxStops := envInt("MAX_STOPS", handler.DefaultMaxStops); maxStops > 0 {
+		handlerOpts = append(handlerOpts, handler.WithMaxStops(maxStops))
+	}
+	if jobConcurrency := envInt("JOB_CONCURRENCY", handler.DefaultJobConcurrency); jobConcurrency > 0 {
+		handlerOpts = append(handlerOpts, handler.WithJobConcurrency(jobConcurrency))
+	}
+	handlerOpts = append(handlerOpts, handler.WithParkingInfo(parkingRepo, pricingService))
+	handlerOpts = append(handlerOpts, handler.WithDataSources(dataSources...))
+	if geocoder, ok := mapsService.(maps.DetailedGeocoder); ok {
+		handlerOpts = append(handlerOpts, handler.WithGeocoder(geocoder))
+	}
+	tripHandler := handler.NewTripHandler(routingService, handlerOpts...)
 
 	// Setup Gin router
 	router := setupRouter(tripHandler)
@@ -55,6 +231,110 @@ func main() {
 	}
 }
 
+// geocodeCacheSize bounds how many addresses planning remembers the location of
+const geocodeCacheSize = 5000
+
+// geocodingMapsService is Google, geocoding through a chain that falls back
+// to fallback when one is given
+func geocodingMapsService(googleMaps *maps.GoogleMapsService, fallback maps.Geocoder) maps.MapsService {
+	if fallback == nil {
+		return googleMaps
+	}
+	return maps.WithGeocoderChain(googleMaps, maps.NewGeocoderChain(
+		maps.GeocoderBackend{Name: "google", Geocoder: googleMaps},
+		maps.GeocoderBackend{Name: "nominatim", Geocoder: fallback},
+	))
+}
+
+// routingMapsService is the maps service plans are made with. Stops repeat
+// across plans, so planning remembers where addresses geocode to.
+func routingMapsService(mapsService maps.MapsService) maps.MapsService {
+	return maps.WithGeocodeCache(mapsService, geocodeCacheSize)
+}
+
+// travelCacheSize bounds how many driving times are remembered, unless
+// TRAVEL_CACHE_SIZE says otherwise; 0 turns the cache off
+const travelCacheSize = 10000
+
+// warmupConfig reads the areas and addresses to warm from WARMUP_CELLS, a
+// semicolon-separated list of lat,lng points, and WARMUP_ADDRESSES, a
+// semicolon-separated list of addresses. It reports false when neither is set.
+func warmupConfig() (service.WarmupConfig, bool) {
+	var config service.WarmupConfig
+	for _, cell := range splitList(os.Getenv("WARMUP_CELLS")) {
+		var lat, lng float64
+		if _, err := fmt.Sscanf(cell, "%f,%f", &lat, &lng); err != nil {
+			log.Fatalf("WARMUP_CELLS must be lat,lng points separated by semicolons, got %q", cell)
+		}
+		config.Cells = append(config.Cells, domain.Location{Lat: lat, Lng: lng})
+	}
+	config.Addresses = splitList(os.Getenv("WARMUP_ADDRESSES"))
+	return config, len(config.Cells) > 0 || len(config.Addresses) > 0
+}
+
+// parkingSearchMinutes reads the circling time for a spot in each local area
+// from PARKING_SEARCH_MINUTES, a semicolon-separated list of area=minutes
+// entries such as "Downtown=8;West End=5"
+func parkingSearchMinutes() map[string]int {
+	minutesByArea := make(map[string]int)
+	for _, entry := range splitList(os.Getenv("PARKING_SEARCH_MINUTES")) {
+		area, value, ok := strings.Cut(entry, "=")
+		minutes, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || minutes < 0 {
+			log.Fatalf("PARKING_SEARCH_MINUTES must be area=minutes entries separated by semicolons, got %q", entry)
+		}
+		minutesByArea[strings.TrimSpace(area)] = minutes
+	}
+	return minutesByArea
+}
+
+// splitList splits a semicolon-separated setting, dropping blank entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// travelTimeBounds reads how implausible driving times are handled:
+// IMPLAUSIBLE_TRAVEL_TIME is flag (the default), estimate, reject or off, and
+// TRAVEL_SPEED_MIN_KMH and TRAVEL_SPEED_MAX_KMH override the plausible speeds
+func travelTimeBounds() (service.TravelTimeBounds, bool) {
+	bounds := service.DefaultTravelTimeBounds
+	if policyName := os.Getenv("IMPLAUSIBLE_TRAVEL_TIME"); policyName != "" {
+		if policyName == "off" {
+			return bounds, false
+		}
+		policy, err := service.ParseImplausibleTravelPolicy(policyName)
+		if err != nil {
+			log.Fatalf("IMPLAUSIBLE_TRAVEL_TIME must be flag, estimate, reject or off: %v", err)
+		}
+		bounds.Policy = policy
+	}
+	bounds.MinSpeedKmh = float64(envInt("TRAVEL_SPEED_MIN_KMH", int(bounds.MinSpeedKmh)))
+	bounds.MaxSpeedKmh = float64(envInt("TRAVEL_SPEED_MAX_KMH", int(bounds.MaxSpeedKmh)))
+	if bounds.MaxSpeedKmh < bounds.MinSpeedKmh {
+		log.Fatalf("TRAVEL_SPEED_MAX_KMH must be at least TRAVEL_SPEED_MIN_KMH")
+	}
+	return bounds, true
+}
+
+// envInt reads a non-negative integer setting, using fallback when it is unset
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("%s must be a non-negative integer, got %q", name, value)
+	}
+	return n
+}
+
 func setupRouter(tripHandler *handler.TripHandler) *gin.Engine {
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") == "release" {
@@ -64,7 +344,11 @@ func setupRouter(tripHandler *handler.TripHandler) *gin.Engine {
 	router := gin.New()
 
 	// Middleware
-	router.Use(gin.Logger())
+	if os.Getenv("LOG_FORMAT") == "json" {
+		router.Use(jsonLoggerMiddleware(os.Stdout))
+	} else {
+		router.Use(gin.Logger())
+	}
 	router.Use(gin.Recovery())
 	router.Use(corsMiddleware())
 	router.Use(requestIDMiddleware())
@@ -75,14 +359,37 @@ func setupRouter(tripHandler *handler.TripHandler) *gin.Engine {
 	// API routes
 	v1 := router.Group("/api/v1")
 	{
+		v1.GET("/meta", tripHandler.GetMeta)
+
 		trips := v1.Group("/trips")
 		{
 			trips.POST("/plan", tripHandler.PlanTrip)
+			trips.POST("/plan/window", tripHandler.PlanWindow)
+			trips.POST("/compare_modes", tripHandler.CompareModes)
+			trips.GET("/:id/itinerary.ics", tripHandler.Itinerary)
 		}
 
 		parking := v1.Group("/parking")
 		{
 			parking.GET("/info", tripHandler.GetParkingInfo)
+			parking.POST("/best", tripHandler.GetBestParking)
+			parking.POST("/estimate", tripHandler.EstimateParkingCost)
+		}
+
+		jobs := v1.Group("/jobs")
+		{
+			jobs.POST("/plan", tripHandler.SubmitPlanJob)
+			jobs.GET("/:id", tripHandler.GetPlanJob)
+		}
+
+		v1.GET("/geocode", tripHandler.Geocode)
+
+		// Optimizer introspection, only exposed when explicitly enabled
+		if os.Getenv("DEBUG_ENDPOINTS") == "true" {
+			debug := v1.Group("/debug")
+			{
+				debug.POST("/candidates", tripHandler.DebugCandidates)
+			}
 		}
 	}
 
@@ -111,7 +418,51 @@ func requestIDMiddleware() gin.HandlerFunc {
 			requestID = generateRequestID()
 		}
 		c.Header("X-Request-ID", requestID)
+		c.Set(requestIDKey, requestID)
+		c.Next()
+	}
+}
+
+// requestIDKey is the gin context key holding the current request ID
+const requestIDKey = "request_id"
+
+// accessLogEntry is a single structured access log line
+type accessLogEntry struct {
+	Time      string  `json:"time"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	RequestID string  `json:"request_id"`
+	ClientIP  string  `json:"client_ip"`
+	UserAgent string  `json:"user_agent"`
+}
+
+// jsonLoggerMiddleware writes one JSON object per request to out, for log aggregators
+func jsonLoggerMiddleware(out io.Writer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+
 		c.Next()
+
+		entry := accessLogEntry{
+			Time:      start.UTC().Format(time.RFC3339Nano),
+			Method:    c.Request.Method,
+			Path:      path,
+			Status:    c.Writer.Status(),
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000.0,
+			RequestID: c.GetString(requestIDKey),
+			ClientIP:  c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		}
+
+		line, err := json.Marshal(entry)
+		if err != nil {
+			log.Printf("Failed to encode access log entry: %v", err)
+			return
+		}
+		out.Write(append(line, '\n'))
 	}
 }
 
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/repository"
+	"vancouver-trip-planner/internal/service"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+func TestJSONLoggerMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var out bytes.Buffer
+	router := gin.New()
+	router.Use(jsonLoggerMiddleware(&out))
+	router.Use(requestIDMiddleware())
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Request-ID", "req_test")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(out.Bytes()), &entry), out.String())
+
+	for _, key := range []string{"time", "method", "path", "status", "latency_ms", "request_id", "client_ip"} {
+		assert.Contains(t, entry, key)
+	}
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/health", entry["path"])
+	assert.Equal(t, float64(http.StatusOK), entry["status"])
+	assert.Equal(t, "req_test", entry["request_id"])
+}
+
+func TestRoutingMapsService_RouteOptions(t *testing.T) {
+	googleMaps, err := maps.NewGoogleMapsServiceWithCache("test-key", 10)
+	require.NoError(t, err)
+
+	fallbacks := map[string]maps.Geocoder{
+		"Google only":        nil,
+		"Nominatim fallback": maps.NewNominatimGeocoder("", "vancouver-trip-planner-test"),
+	}
+	for name, fallback := range fallbacks {
+		t.Run(name, func(t *testing.T) {
+			routingMaps := routingMapsService(geocodingMapsService(googleMaps, fallback))
+			routing := service.NewRoutingService(repository.NewVancouverParkingRepository(), routingMaps, service.NewPricingService())
+			assert.Equal(t, []string{maps.TravelModeDriving, maps.TravelModeBicycling, maps.TravelModeTransit}, routing.TravelModes())
+
+			router, ok := routingMaps.(maps.ModeRouter)
+			require.True(t, ok)
+			_, err := router.WithTravelMode(maps.TravelModeTransit)
+			require.NoError(t, err)
+
+			shaper, ok := routingMaps.(maps.RouteShaper)
+			require.True(t, ok)
+			_, err = shaper.WithAvoid([]string{maps.AvoidTolls})
+			require.NoError(t, err)
+
+			// Mode comparisons time transit rides with Google rather than estimating
+			_, ok = routingMaps.(maps.TransitRouter)
+			assert.True(t, ok)
+		})
+	}
+}
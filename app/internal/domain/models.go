@@ -15,6 +15,9 @@ type ParkingMeter struct {
 	LocalArea  string  `json:"local_area"`
 	CreditCard bool    `json:"credit_card"`
 
+	// PayByPhoneZone is the number drivers enter in the PayByPhone app, if known
+	PayByPhoneZone string `json:"pay_by_phone_zone,omitempty"`
+
 	// Time-dependent rates (hourly)
 	RateMF9A6P float64 `json:"rate_mf_9a_6p"` // Mon-Fri 9AM-6PM
 	RateMF6P10 float64 `json:"rate_mf_6p_10"` // Mon-Fri 6PM-10PM
@@ -30,6 +33,92 @@ type ParkingMeter struct {
 	TimeLimitSA6P10 int `json:"time_limit_sa_6p_10"`
 	TimeLimitSU9A6P int `json:"time_limit_su_9a_6p"`
 	TimeLimitSU6P10 int `json:"time_limit_su_6p_10"`
+
+	// FreeGraceMinutes is an initial period of metered time that isn't charged
+	FreeGraceMinutes int `json:"free_grace_minutes,omitempty"`
+
+	// RateAssumed marks rates filled in with an assumed rate because the
+	// dataset listed time limits but no rates for the meter
+	RateAssumed bool `json:"rate_assumed,omitempty"`
+
+	// schedule caches the rate windows above for direct lookup during pricing
+	schedule *RateSchedule
+}
+
+// DayType identifies which set of rate columns applies on a given day
+type DayType int
+
+const (
+	Weekday DayType = iota
+	Saturday
+	Sunday
+)
+
+// RatePeriod identifies the metered window within a day
+type RatePeriod int
+
+const (
+	Daytime RatePeriod = iota // 9 AM - 6 PM
+	Evening                   // 6 PM - 10 PM
+)
+
+// RateWindow is the hourly rate and time limit in force during one metered window
+type RateWindow struct {
+	Rate      float64
+	TimeLimit int
+}
+
+// RateSchedule holds a meter's rate windows indexed by day type and period
+type RateSchedule [3][2]RateWindow
+
+// NewRateSchedule builds the schedule for a meter from its rate and time-limit fields
+func NewRateSchedule(m *ParkingMeter) RateSchedule {
+	return RateSchedule{
+		Weekday: {
+			Daytime: {Rate: m.RateMF9A6P, TimeLimit: m.TimeLimitMF9A6P},
+			Evening: {Rate: m.RateMF6P10, TimeLimit: m.TimeLimitMF6P10},
+		},
+		Saturday: {
+			Daytime: {Rate: m.RateSA9A6P, TimeLimit: m.TimeLimitSA9A6P},
+			Evening: {Rate: m.RateSA6P10, TimeLimit: m.TimeLimitSA6P10},
+		},
+		Sunday: {
+			Daytime: {Rate: m.RateSU9A6P, TimeLimit: m.TimeLimitSU9A6P},
+			Evening: {Rate: m.RateSU6P10, TimeLimit: m.TimeLimitSU6P10},
+		},
+	}
+}
+
+// PrecomputeSchedule caches the meter's rate schedule. It should be called once
+// the rate fields are final; later changes to them are not reflected.
+func (m *ParkingMeter) PrecomputeSchedule() {
+	schedule := NewRateSchedule(m)
+	m.schedule = &schedule
+}
+
+// RateWindowAt returns the rate window for a day type and period, using the
+// precomputed schedule when available
+func (m *ParkingMeter) RateWindowAt(dayType DayType, period RatePeriod) RateWindow {
+	if m.schedule != nil {
+		return m.schedule[dayType][period]
+	}
+	schedule := NewRateSchedule(m)
+	return schedule[dayType][period]
+}
+
+// coveredMeterTypes are meter type keywords marking parking under cover
+var coveredMeterTypes = []string{"garage", "parkade", "covered", "underground"}
+
+// IsCovered reports whether the meter is in a garage or otherwise covered,
+// judged from its meter type. Street meters in the city dataset are not.
+func (m *ParkingMeter) IsCovered() bool {
+	meterType := strings.ToLower(m.MeterType)
+	for _, keyword := range coveredMeterTypes {
+		if strings.Contains(meterType, keyword) {
+			return true
+		}
+	}
+	return false
 }
 
 // Stop represents a destination in the trip
@@ -41,6 +130,30 @@ type Stop struct {
 	Duration      int       `json:"duration_minutes"`
 	ArrivalTime   time.Time `json:"arrival_time"`
 	DepartureTime time.Time `json:"departure_time"`
+
+	// IsOrigin marks the trip's starting point, which is driven from but never parked at
+	IsOrigin bool `json:"is_origin,omitempty"`
+
+	// FixedArrival pins the arrival at this stop to an exact wall-clock time, such
+	// as an appointment. Arriving early means waiting; arriving late is infeasible.
+	FixedArrival time.Time `json:"fixed_arrival,omitempty"`
+
+	// LatestDeparture is when the visit must end, such as closing time. A late
+	// arrival shortens the visit to fit; arriving after it leaves no visit at all.
+	LatestDeparture time.Time `json:"latest_departure,omitempty"`
+
+	// Optional marks a stop the planner may skip when that gives a better plan
+	Optional bool `json:"optional,omitempty"`
+
+	// FreeParking marks a stop with its own parking, such as home or an office
+	// garage. Like the origin, no meter is chosen there; the visit is made
+	// without paying or walking.
+	FreeParking bool `json:"free_parking,omitempty"`
+
+	// Note and Tags are the client's own details for the stop, such as "pick up
+	// dry cleaning". Planning ignores them; they are echoed back on the plan.
+	Note string            `json:"note,omitempty"`
+	Tags map[string]string `json:"tags,omitempty"`
 }
 
 // RouteSegment represents a segment of the trip route
@@ -51,29 +164,208 @@ type RouteSegment struct {
 	TravelTime   int           `json:"travel_time_minutes"`
 	ParkingCost  float64       `json:"parking_cost"`
 	WalkingTime  int           `json:"walking_time_minutes"`
+	ArrivalTime  time.Time     `json:"arrival_time"`
+
+	// WalkingPolyline is the walk to the stop as an encoded polyline, when requested
+	WalkingPolyline string `json:"walking_polyline,omitempty"`
+
+	// Sittings lists each separate park when a visit is split across meters
+	// because it outlasts their time limits. ParkingMeter is the first sitting's meter.
+	Sittings []ParkingSitting `json:"sittings,omitempty"`
+
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// MeterAlternative is a runner-up meter suggested as a backup for a segment
+type MeterAlternative struct {
+	MeterID     string  `json:"meter_id"`
+	Lat         float64 `json:"lat"`
+	Lng         float64 `json:"lng"`
+	ParkingCost float64 `json:"parking_cost"`
+	WalkingTime int     `json:"walking_time_minutes"`
+}
+
+// ParkingSitting is one continuous park at a single meter
+type ParkingSitting struct {
+	ParkingMeter *ParkingMeter `json:"parking_meter"`
+	StartTime    time.Time     `json:"start_time"`
+	Minutes      int           `json:"minutes"`
+	Cost         float64       `json:"cost"`
 }
 
 // TripPlan represents a complete trip plan
 type TripPlan struct {
-	Type      string                 `json:"type"` // "cheapest", "fastest", "hybrid"
+	ID        string                 `json:"id,omitempty"` // set when the plan is stored for later retrieval
+	Type      string                 `json:"type"`         // "cheapest", "fastest", "hybrid"
 	TotalCost float64                `json:"total_cost"`
 	TotalTime int                    `json:"total_time_minutes"`
 	Route     []RouteSegment         `json:"route"`
 	Metadata  map[string]interface{} `json:"metadata"`
 }
 
+// In renders every time in the plan in loc. Stops shared between segments are
+// converted in place, which is safe to repeat.
+func (p *TripPlan) In(loc *time.Location) {
+	for i := range p.Route {
+		segment := &p.Route[i]
+		segment.ArrivalTime = timeIn(segment.ArrivalTime, loc)
+		for _, stop := range []*Stop{segment.FromStop, segment.ToStop} {
+			if stop == nil {
+				continue
+			}
+			stop.ArrivalTime = timeIn(stop.ArrivalTime, loc)
+			stop.DepartureTime = timeIn(stop.DepartureTime, loc)
+			stop.FixedArrival = timeIn(stop.FixedArrival, loc)
+			stop.LatestDeparture = timeIn(stop.LatestDeparture, loc)
+		}
+		for j := range segment.Sittings {
+			segment.Sittings[j].StartTime = timeIn(segment.Sittings[j].StartTime, loc)
+		}
+	}
+}
+
+// timeIn converts t to loc, leaving unset times as the zero value
+func timeIn(t time.Time, loc *time.Location) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.In(loc)
+}
+
 // TripRequest represents the input for trip planning
 type TripRequest struct {
 	Stops       []Stop      `json:"stops"`
 	StartTime   time.Time   `json:"start_time"`
 	Timezone    string      `json:"timezone"`
 	Preferences Preferences `json:"preferences"`
+
+	// Origin is where the trip starts when it is not itself one of the stops.
+	// When nil, the first stop is the starting point.
+	Origin *Origin `json:"origin,omitempty"`
+
+	// TravelTimeVariance is the fractional uncertainty applied to every travel
+	// leg (e.g. 0.15 for ±15%) when estimating cost and time ranges. Zero disables it.
+	TravelTimeVariance float64 `json:"travel_time_variance"`
+
+	// Strategy selects the route generation algorithm; empty uses the service default
+	Strategy string `json:"strategy"`
+
+	// AllowOverstay considers meters whose time limit is shorter than the stay,
+	// scoring them with OverstayPenalty (dollars) instead of skipping them
+	AllowOverstay   bool    `json:"allow_overstay"`
+	OverstayPenalty float64 `json:"overstay_penalty"`
+
+	// MaxDetourRatio rejects routes whose total travel time exceeds the most direct
+	// ordering's by more than this factor (e.g. 1.3 = at most 30% longer). Zero disables it.
+	MaxDetourRatio float64 `json:"max_detour_ratio"`
+
+	// MaxMapCalls caps upstream maps API calls for this plan; beyond it travel
+	// times are estimated from straight-line distance. Zero means unlimited.
+	MaxMapCalls int `json:"max_map_calls"`
+
+	// Locale controls how cost strings in plan metadata are formatted (e.g. "fr-CA")
+	Locale string `json:"locale"`
+
+	// AllowSplitVisit lets a stop that outlasts every meter's time limit be split
+	// into several sittings, moving the car between them
+	AllowSplitVisit bool `json:"allow_split_visit"`
+
+	// ParkingSearchRadiusKm overrides how far from each stop to look for meters;
+	// zero uses the default
+	ParkingSearchRadiusKm float64 `json:"parking_search_radius_km"`
+
+	// CardMeterBonus is a score bonus, in dollars, for meters that accept credit cards
+	CardMeterBonus float64 `json:"card_meter_bonus"`
+
+	// PreferCovered favours covered parking by CoveredBonus dollars (or the
+	// default bonus when zero) when choosing meters
+	PreferCovered bool    `json:"prefer_covered"`
+	CoveredBonus  float64 `json:"covered_bonus"`
+
+	// AvoidZones are areas, such as construction, where no meter may be chosen
+	AvoidZones []Circle `json:"avoid_zones,omitempty"`
+
+	// MaxPerStopCost caps any single parking charge, in dollars; meters that
+	// would charge more are never chosen. Zero disables it.
+	MaxPerStopCost float64 `json:"max_per_stop_cost"`
+
+	// ReentryPenalty is what paying again at a meter already paid for earlier in
+	// the trip is considered to cost, in dollars, on top of the new payment. The
+	// earlier session is kept running through the gap instead whenever that is
+	// cheaper than paying again plus this penalty.
+	ReentryPenalty float64 `json:"reentry_penalty"`
+
+	// SpreadLoad picks at random among meters nearly as good as the best, so
+	// drivers planning the same trip don't all converge on one meter
+	SpreadLoad bool `json:"spread_load"`
+
+	// MinParkingMinutes is the least parking bought for any visit, e.g. always
+	// 30 minutes to be safe. Only metered time is charged. Zero disables it.
+	MinParkingMinutes int `json:"min_parking_minutes"`
+
+	// Avoid lists route features driving legs should avoid ("tolls",
+	// "highways", "ferries") where the maps provider supports it
+	Avoid []string `json:"avoid,omitempty"`
+
+	// TravelMode is how the trip gets between stops: "driving" (the default),
+	// "bicycling" or "transit". Only driving trips park.
+	TravelMode string `json:"travel_mode,omitempty"`
+
+	// IncludeWalkingRoutes traces each segment's walk as an encoded polyline.
+	// It is off by default since every walk traced is a paid maps call.
+	IncludeWalkingRoutes bool `json:"include_walking_routes,omitempty"`
+
+	// StartTimeMeaning says what StartTime is the time of: leaving the origin
+	// (the default) or arriving at the first stop after it
+	StartTimeMeaning string `json:"start_time_meaning,omitempty"`
+}
+
+// StartTimeMeaning values
+const (
+	StartTimeDepartOrigin    = "depart_origin"
+	StartTimeArriveFirstStop = "arrive_first_stop"
+)
+
+// Origin is a trip starting point that is not a destination. Either the
+// address or the coordinates must be set.
+type Origin struct {
+	Address string  `json:"address"`
+	Lat     float64 `json:"lat"`
+	Lng     float64 `json:"lng"`
+}
+
+// Circle is a circular area given by its centre and radius
+type Circle struct {
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+	RadiusKm float64 `json:"radius_km"`
+}
+
+// BoundingBox is a rectangular area between two corners
+type BoundingBox struct {
+	MinLat float64 `json:"min_lat"`
+	MinLng float64 `json:"min_lng"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLng float64 `json:"max_lng"`
+}
+
+// Contains reports whether the point lies inside the box, edges included
+func (b BoundingBox) Contains(lat, lng float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
 }
 
 // Preferences for trip optimization
 type Preferences struct {
 	CostWeight float64 `json:"cost_weight"`
 	TimeWeight float64 `json:"time_weight"`
+
+	// MaxWalkingMinutes is the longest walk from a meter to its stop; zero
+	// uses the planner's default
+	MaxWalkingMinutes int `json:"max_walking_minutes,omitempty"`
+
+	// MaxTotalWalkingMinutes caps the walking summed across the whole trip;
+	// zero means no cap
+	MaxTotalWalkingMinutes int `json:"max_total_walking_minutes,omitempty"`
 }
 
 // Location represents a geographical point
@@ -117,3 +409,15 @@ func ParseTimeLimit(timeLimitStr string) int {
 
 	return hours
 }
+
+// DataSource credits a provider of data used to make plans, as its license requires
+type DataSource struct {
+	Name    string `json:"name"`
+	License string `json:"license"`
+	URL     string `json:"url"`
+}
+
+// Attributor is implemented by data providers that must be credited
+type Attributor interface {
+	Attribution() DataSource
+}
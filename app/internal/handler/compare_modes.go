@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"vancouver-trip-planner/internal/service"
+)
+
+// CompareModes handles POST /api/v1/trips/compare_modes
+func (h *TripHandler) CompareModes(c *gin.Context) {
+	comparer, ok := h.routingService.(service.ModeComparer)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, ErrorResponse{
+			Error:   "not_supported",
+			Message: "the routing service does not compare travel modes",
+			Code:    http.StatusNotImplemented,
+		})
+		return
+	}
+
+	domainReq, ok := h.bindTripRequest(c)
+	if !ok {
+		return
+	}
+
+	release, ok := h.acquirePlanSlot(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	comparison, err := comparer.CompareModes(domainReq)
+	if err != nil {
+		writePlanningError(c, err)
+		return
+	}
+
+	loc := requestLocation(domainReq)
+	comparison.Driving.In(loc)
+	comparison.Transit.In(loc)
+
+	c.JSON(http.StatusOK, comparison)
+}
@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"vancouver-trip-planner/internal/domain"
+)
+
+// Planned trips stay available as itineraries for a day, up to a bounded number
+const (
+	DefaultItineraryTTL  = 24 * time.Hour
+	maxStoredItineraries = 10000
+)
+
+// icsTimeFormat is the iCalendar UTC date-time form, e.g. 20240115T183000Z
+const icsTimeFormat = "20060102T150405Z"
+
+// planStore keeps recently returned plans by ID so they can be fetched again,
+// e.g. as a calendar itinerary
+type planStore struct {
+	ttl   time.Duration
+	now   func() time.Time
+	newID func() (string, error)
+
+	mu      sync.Mutex
+	entries map[string]planStoreEntry
+}
+
+type planStoreEntry struct {
+	plan      *domain.TripPlan
+	expiresAt time.Time
+}
+
+func newPlanStore(ttl time.Duration) *planStore {
+	return &planStore{
+		ttl:     ttl,
+		now:     time.Now,
+		newID:   newPlanID,
+		entries: make(map[string]planStoreEntry),
+	}
+}
+
+// add gives each plan an ID and remembers it. When the store is full, expired
+// plans are dropped first and then the ones closest to expiring. If IDs can't
+// be generated, neither the plans nor the store are changed.
+func (s *planStore) add(plans []*domain.TripPlan) error {
+	ids := make([]string, len(plans))
+	for i := range plans {
+		id, err := s.newID()
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if len(s.entries)+len(plans) > maxStoredItineraries {
+		for id, entry := range s.entries {
+			if now.After(entry.expiresAt) {
+				delete(s.entries, id)
+			}
+		}
+	}
+	for len(s.entries) > 0 && len(s.entries)+len(plans) > maxStoredItineraries {
+		var oldest string
+		for id, entry := range s.entries {
+			if oldest == "" || entry.expiresAt.Before(s.entries[oldest].expiresAt) {
+				oldest = id
+			}
+		}
+		delete(s.entries, oldest)
+	}
+
+	for i, plan := range plans {
+		plan.ID = ids[i]
+		s.entries[plan.ID] = planStoreEntry{plan: plan, expiresAt: now.Add(s.ttl)}
+	}
+	return nil
+}
+
+// get returns the plan with the given ID, if present and not expired
+func (s *planStore) get(id string) (*domain.TripPlan, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return nil, false
+	}
+	if s.now().After(entry.expiresAt) {
+		delete(s.entries, id)
+		return nil, false
+	}
+	return entry.plan, true
+}
+
+// newPlanID returns a random, unguessable plan ID
+func newPlanID() (string, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate plan ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// Itinerary handles GET /api/v1/trips/:id/itinerary.ics
+func (h *TripHandler) Itinerary(c *gin.Context) {
+	plan, ok := h.planStore.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "itinerary_not_found",
+			Message: "no recent trip plan has this ID",
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="itinerary.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(planICS(plan, time.Now())))
+}
+
+// planICS renders a plan as an iCalendar with one event per stop, running from
+// the walk in from the meter to the end of the visit
+func planICS(plan *domain.TripPlan, stamp time.Time) string {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Vancouver Trip Planner//Itinerary//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+	}
+
+	for _, segment := range plan.Route {
+		stop := segment.ToStop
+		if stop == nil {
+			continue
+		}
+		start := segment.ArrivalTime.Add(time.Duration(segment.WalkingTime) * time.Minute)
+		end := start.Add(time.Duration(stop.Duration) * time.Minute)
+
+		summary := stop.Address
+		if summary == "" {
+			summary = fmt.Sprintf("Stop %s", stop.ID)
+		}
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:%s-%s@vancouver-trip-planner", plan.ID, stop.ID),
+			"DTSTAMP:"+stamp.UTC().Format(icsTimeFormat),
+			"DTSTART:"+start.UTC().Format(icsTimeFormat),
+			"DTEND:"+end.UTC().Format(icsTimeFormat),
+			"SUMMARY:"+icsEscape(summary),
+			fmt.Sprintf("GEO:%.6f;%.6f", stop.Lat, stop.Lng),
+			"DESCRIPTION:"+icsEscape(parkingDescription(segment)),
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	var ics strings.Builder
+	for _, line := range lines {
+		ics.WriteString(icsFold(line))
+		ics.WriteString("\r\n")
+	}
+	return ics.String()
+}
+
+// parkingDescription describes where to park for a segment and what it costs
+func parkingDescription(segment domain.RouteSegment) string {
+	if walkLinked, _ := segment.Metadata["walk_linked"].(bool); walkLinked && segment.ParkingMeter != nil {
+		return fmt.Sprintf("Walk from the previous stop; the car stays at meter %s (+$%.2f)", segment.ParkingMeter.MeterID, segment.ParkingCost)
+	}
+	if freeParking, _ := segment.Metadata["free_parking"].(bool); freeParking {
+		return "Park on site (free)"
+	}
+	if mode, _ := segment.Metadata["travel_mode"].(string); mode != "" {
+		return fmt.Sprintf("No parking needed (%s)", mode)
+	}
+	if segment.ParkingMeter == nil {
+		return fmt.Sprintf("Parking: $%.2f", segment.ParkingCost)
+	}
+	description := fmt.Sprintf("Park at meter %s ($%.2f)", segment.ParkingMeter.MeterID, segment.ParkingCost)
+	if segment.ParkingMeter.PayByPhoneZone != "" {
+		description += fmt.Sprintf("\nPayByPhone zone %s", segment.ParkingMeter.PayByPhoneZone)
+	}
+	if len(segment.Sittings) > 1 {
+		description += fmt.Sprintf("\nMove the car %d times during the visit", len(segment.Sittings)-1)
+	}
+	return description
+}
+
+// icsEscape escapes text for an iCalendar TEXT value
+func icsEscape(text string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(text)
+}
+
+// icsFold splits a content line into 75-octet pieces, continuing each on a line
+// starting with a space, without breaking a UTF-8 character
+func icsFold(line string) string {
+	const maxOctets = 75
+
+	var folded strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > maxOctets {
+			folded.WriteString("\r\n ")
+			width = 1
+		}
+		folded.WriteRune(r)
+		width += size
+	}
+	return folded.String()
+}
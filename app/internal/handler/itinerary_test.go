@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/service"
+)
+
+// parseICSEvents unfolds an iCalendar document and returns each VEVENT's properties
+func parseICSEvents(t *testing.T, ics string) []map[string]string {
+	t.Helper()
+
+	var events []map[string]string
+	var event map[string]string
+	for _, line := range strings.Split(strings.ReplaceAll(ics, "\r\n ", ""), "\r\n") {
+		switch {
+		case line == "BEGIN:VEVENT":
+			event = make(map[string]string)
+		case line == "END:VEVENT":
+			events = append(events, event)
+			event = nil
+		case event != nil:
+			name, value, ok := strings.Cut(line, ":")
+			require.True(t, ok, "malformed line %q", line)
+			event[name] = value
+		}
+	}
+	return events
+}
+
+func TestItinerary(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+		"stops":      downtownStops(),
+		"start_time": "2024-01-15T10:00:00-08:00",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response struct {
+		Plans []*domain.TripPlan `json:"plans"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotEmpty(t, response.Plans)
+	plan := response.Plans[0]
+	require.NotEmpty(t, plan.ID)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/trips/"+plan.ID+"/itinerary.ics", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/calendar"))
+
+	ics := w.Body.String()
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(ics, "END:VCALENDAR\r\n"))
+
+	events := parseICSEvents(t, ics)
+	require.Len(t, events, len(plan.Route))
+	require.Len(t, events, 2)
+
+	for i, segment := range plan.Route {
+		start := segment.ArrivalTime.Add(time.Duration(segment.WalkingTime) * time.Minute)
+		end := start.Add(time.Duration(segment.ToStop.Duration) * time.Minute)
+
+		event := events[i]
+		assert.Equal(t, start.UTC().Format("20060102T150405Z"), event["DTSTART"])
+		assert.Equal(t, end.UTC().Format("20060102T150405Z"), event["DTEND"])
+		assert.Equal(t, segment.ToStop.Address, event["SUMMARY"])
+		assert.Contains(t, event["DESCRIPTION"], segment.ParkingMeter.MeterID)
+	}
+
+	t.Run("Unknown plan", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/trips/unknown/itinerary.ics", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestItinerary_PlanIDFailure(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	tripHandler := NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService()))
+	tripHandler.planStore.newID = func() (string, error) {
+		return "", errors.New("failed to generate plan ID: entropy unavailable")
+	}
+	router := newTestRouter(tripHandler)
+
+	// Plans that can't be given IDs aren't returned or kept
+	w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+		"stops":      downtownStops(),
+		"start_time": "2024-01-15T10:00:00-08:00",
+	})
+	assert.Equal(t, http.StatusInternalServerError, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "planning_failed")
+	assert.Empty(t, tripHandler.planStore.entries)
+}
+
+func TestICSEscapeAndFold(t *testing.T) {
+	assert.Equal(t, `800 Robson St\, Vancouver\; BC\nCanada`, icsEscape("800 Robson St, Vancouver; BC\nCanada"))
+
+	long := "DESCRIPTION:" + strings.Repeat("é", 60)
+	folded := icsFold(long)
+	for _, line := range strings.Split(folded, "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+	assert.Equal(t, long, strings.ReplaceAll(folded, "\r\n ", ""))
+}
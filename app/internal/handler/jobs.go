@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"vancouver-trip-planner/internal/domain"
+)
+
+// Batch job limits: trips in one job, trips planned at once across all jobs,
+// jobs kept at once, and how long a finished job's results stay available
+const (
+	MaxJobTrips           = 500
+	DefaultJobConcurrency = 4
+	maxStoredJobs         = 1000
+	DefaultJobTTL         = time.Hour
+)
+
+// errJobStoreFull is returned when no more jobs can be kept
+var errJobStoreFull = errors.New("job store full")
+
+// Job statuses, in the order a job moves through them
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+)
+
+// WithJobConcurrency sets how many trips batch jobs plan at once, across all jobs
+func WithJobConcurrency(n int) HandlerOption {
+	return func(h *TripHandler) {
+		h.jobStore = newJobStore(n, DefaultJobTTL)
+	}
+}
+
+// JobPlanRequest is a batch of trips to plan in the background
+type JobPlanRequest struct {
+	Trips []TripPlanRequest `json:"trips" binding:"required,min=1,dive"`
+}
+
+// JobSubmitResponse acknowledges a submitted job
+type JobSubmitResponse struct {
+	JobID  string `json:"job_id"`
+	Status string `json:"status"`
+	Trips  int    `json:"trips"`
+}
+
+// JobResponse is a job's progress, and its results once it is done
+type JobResponse struct {
+	JobID       string          `json:"job_id"`
+	Status      string          `json:"status"`
+	Trips       int             `json:"trips"`
+	Completed   int             `json:"completed"`
+	SubmittedAt time.Time       `json:"submitted_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	Results     []JobTripResult `json:"results,omitempty"`
+}
+
+// JobTripResult is the outcome of one trip in a job, in submission order:
+// its plans, or why it couldn't be planned
+type JobTripResult struct {
+	Plans []*domain.TripPlan `json:"plans,omitempty"`
+	Error *ErrorResponse     `json:"error,omitempty"`
+}
+
+// planJob is a batch of trips being planned in the background
+type planJob struct {
+	id          string
+	requests    []*domain.TripRequest
+	submittedAt time.Time
+
+	// Guarded by the job store's lock
+	status     string
+	completed  int
+	finishedAt time.Time
+	results    []JobTripResult
+}
+
+// jobStore keeps batch jobs in memory and bounds how many of their trips are
+// planned at once
+type jobStore struct {
+	slots chan struct{}
+	ttl   time.Duration
+	now   func() time.Time
+	newID func() (string, error)
+
+	mu   sync.Mutex
+	jobs map[string]*planJob
+}
+
+func newJobStore(concurrency int, ttl time.Duration) *jobStore {
+	return &jobStore{
+		slots: make(chan struct{}, max(concurrency, 1)),
+		ttl:   ttl,
+		now:   time.Now,
+		newID: newPlanID,
+		jobs:  make(map[string]*planJob),
+	}
+}
+
+// add stores a new queued job, dropping expired ones first. It returns
+// errJobStoreFull if the store is full of jobs that are unfinished or still
+// being collected.
+func (s *jobStore) add(requests []*domain.TripRequest) (*planJob, error) {
+	id, err := s.newID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if len(s.jobs) >= maxStoredJobs {
+		for id, job := range s.jobs {
+			if job.status == JobDone && now.After(job.finishedAt.Add(s.ttl)) {
+				delete(s.jobs, id)
+			}
+		}
+	}
+	if len(s.jobs) >= maxStoredJobs {
+		return nil, errJobStoreFull
+	}
+
+	job := &planJob{
+		id:          id,
+		requests:    requests,
+		submittedAt: now,
+		status:      JobQueued,
+		results:     make([]JobTripResult, len(requests)),
+	}
+	s.jobs[job.id] = job
+	return job, nil
+}
+
+// get returns a snapshot of the job with the given ID, if present and not expired
+func (s *jobStore) get(id string) (JobResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return JobResponse{}, false
+	}
+	if job.status == JobDone && s.now().After(job.finishedAt.Add(s.ttl)) {
+		delete(s.jobs, id)
+		return JobResponse{}, false
+	}
+
+	response := JobResponse{
+		JobID:       job.id,
+		Status:      job.status,
+		Trips:       len(job.requests),
+		Completed:   job.completed,
+		SubmittedAt: job.submittedAt,
+	}
+	if job.status == JobDone {
+		finishedAt := job.finishedAt
+		response.FinishedAt = &finishedAt
+		response.Results = job.results
+	}
+	return response, true
+}
+
+// run plans every trip in the job, holding a slot for each trip while it plans
+func (s *jobStore) run(job *planJob, plan func(*domain.TripRequest) JobTripResult) {
+	var wg sync.WaitGroup
+	for i, request := range job.requests {
+		s.slots <- struct{}{}
+		s.mu.Lock()
+		job.status = JobRunning
+		s.mu.Unlock()
+
+		wg.Add(1)
+		go func(i int, request *domain.TripRequest) {
+			defer wg.Done()
+			defer func() { <-s.slots }()
+
+			result := plan(request)
+			s.mu.Lock()
+			job.results[i] = result
+			job.completed++
+			s.mu.Unlock()
+		}(i, request)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	job.status = JobDone
+	job.finishedAt = s.now()
+	s.mu.Unlock()
+}
+
+// SubmitPlanJob handles POST /api/v1/jobs/plan. Every trip is validated up
+// front; the job is then planned in the background and polled by its ID.
+func (h *TripHandler) SubmitPlanJob(c *gin.Context) {
+	var req JobPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if len(req.Trips) > MaxJobTrips {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: fmt.Sprintf("a job can plan at most %d trips, got %d", MaxJobTrips, len(req.Trips)),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	requests := make([]*domain.TripRequest, len(req.Trips))
+	for i := range req.Trips {
+		domainReq, ok := h.convertTripRequest(c, &req.Trips[i])
+		if !ok {
+			return
+		}
+		requests[i] = domainReq
+	}
+
+	job, err := h.jobStore.add(requests)
+	if errors.Is(err, errJobStoreFull) {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Error:   "job_store_full",
+			Message: "too many jobs are in progress, please retry later",
+			Code:    http.StatusServiceUnavailable,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "job_submission_failed",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	go h.jobStore.run(job, h.planJobTrip)
+
+	c.JSON(http.StatusAccepted, JobSubmitResponse{
+		JobID:  job.id,
+		Status: JobQueued,
+		Trips:  len(requests),
+	})
+}
+
+// GetPlanJob handles GET /api/v1/jobs/:id
+func (h *TripHandler) GetPlanJob(c *gin.Context) {
+	job, ok := h.jobStore.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "job_not_found",
+			Message: "no job with this ID; finished jobs are kept for an hour",
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// planJobTrip plans one trip of a batch job the way PlanTrip would
+func (h *TripHandler) planJobTrip(request *domain.TripRequest) JobTripResult {
+	plans, err := h.routingService.PlanTrip(request)
+	if err != nil {
+		response := planningErrorResponse(err)
+		return JobTripResult{Error: &response}
+	}
+	if len(plans) == 0 {
+		return JobTripResult{Error: &ErrorResponse{
+			Error:   "no_routes_found",
+			Message: "No valid routes could be found for the given stops",
+			Code:    http.StatusNotFound,
+		}}
+	}
+
+	loc := requestLocation(request)
+	for _, plan := range plans {
+		plan.In(loc)
+	}
+	if err := h.planStore.add(plans); err != nil {
+		response := planningErrorResponse(err)
+		return JobTripResult{Error: &response}
+	}
+	return JobTripResult{Plans: plans}
+}
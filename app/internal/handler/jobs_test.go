@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/service"
+)
+
+func getJob(t *testing.T, router *gin.Engine, id string) JobResponse {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/jobs/"+id, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var job JobResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	return job
+}
+
+// pollJob polls the job until it is done
+func pollJob(t *testing.T, router *gin.Engine, id string) JobResponse {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job := getJob(t, router, id)
+		if job.Status == JobDone {
+			return job
+		}
+		require.True(t, time.Now().Before(deadline), "timed out waiting for job %s, last status %s", id, job.Status)
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func submitJob(t *testing.T, router *gin.Engine, trips []map[string]interface{}) JobSubmitResponse {
+	t.Helper()
+	w := postJSON(router, "/api/v1/jobs/plan", map[string]interface{}{"trips": trips})
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	var submitted JobSubmitResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &submitted))
+	require.NotEmpty(t, submitted.JobID)
+	assert.Equal(t, JobQueued, submitted.Status)
+	return submitted
+}
+
+func TestPlanJob_SubmitThenPoll(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	tripHandler := NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService()), WithJobConcurrency(1))
+	router := newTestRouter(tripHandler)
+
+	trip := map[string]interface{}{
+		"stops":      downtownStops(),
+		"start_time": "2024-01-15T10:00:00-08:00",
+	}
+	unknown := map[string]interface{}{
+		"stops": []StopRequest{
+			{Address: "800 Robson St", DurationMinutes: 60},
+			{Address: "Nowhere In Particular", DurationMinutes: 30},
+		},
+		"start_time": "2024-01-15T10:00:00-08:00",
+	}
+
+	submitted := submitJob(t, router, []map[string]interface{}{trip, unknown, trip})
+	assert.Equal(t, 3, submitted.Trips)
+
+	job := pollJob(t, router, submitted.JobID)
+	assert.Equal(t, 3, job.Trips)
+	assert.Equal(t, 3, job.Completed)
+	require.NotNil(t, job.FinishedAt)
+	require.Len(t, job.Results, 3)
+
+	// Results keep submission order, and a failed trip doesn't fail the others
+	for _, i := range []int{0, 2} {
+		assert.Nil(t, job.Results[i].Error)
+		require.NotEmpty(t, job.Results[i].Plans)
+		for _, plan := range job.Results[i].Plans {
+			assert.NotEmpty(t, plan.ID, "job plans can be fetched as itineraries")
+		}
+	}
+	assert.Empty(t, job.Results[1].Plans)
+	require.NotNil(t, job.Results[1].Error)
+	assert.Equal(t, "planning_failed", job.Results[1].Error.Error)
+}
+
+func TestPlanJob_StatusWhileRunning(t *testing.T) {
+	routing := &blockingRoutingService{unblock: make(chan struct{})}
+	router := newTestRouter(NewTripHandler(routing, WithJobConcurrency(2)))
+
+	trip := map[string]interface{}{
+		"stops":      downtownStops(),
+		"start_time": "2024-01-15T10:00:00-08:00",
+	}
+	submitted := submitJob(t, router, []map[string]interface{}{trip, trip, trip})
+
+	// Two trips hold the slots and the third waits; nothing finishes yet
+	require.Eventually(t, func() bool {
+		return getJob(t, router, submitted.JobID).Status == JobRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	job := getJob(t, router, submitted.JobID)
+	assert.Equal(t, 0, job.Completed)
+	assert.Nil(t, job.Results)
+	assert.Nil(t, job.FinishedAt)
+
+	close(routing.unblock)
+	job = pollJob(t, router, submitted.JobID)
+	assert.Equal(t, 3, job.Completed)
+	require.Len(t, job.Results, 3)
+	for _, result := range job.Results {
+		assert.Len(t, result.Plans, 1)
+	}
+}
+
+func TestPlanJob_InvalidRequests(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	t.Run("No trips", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/jobs/plan", map[string]interface{}{"trips": []interface{}{}})
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	})
+
+	t.Run("One invalid trip rejects the job", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/jobs/plan", map[string]interface{}{
+			"trips": []map[string]interface{}{
+				{"stops": downtownStops(), "start_time": "2024-01-15T10:00:00-08:00"},
+				{"stops": downtownStops(), "start_time": "not a time"},
+			},
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	})
+
+	t.Run("Job ID failure", func(t *testing.T) {
+		tripHandler := NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService()))
+		tripHandler.jobStore.newID = func() (string, error) {
+			return "", errors.New("failed to generate plan ID: entropy unavailable")
+		}
+		w := postJSON(newTestRouter(tripHandler), "/api/v1/jobs/plan", map[string]interface{}{
+			"trips": []map[string]interface{}{
+				{"stops": downtownStops(), "start_time": "2024-01-15T10:00:00-08:00"},
+			},
+		})
+		assert.Equal(t, http.StatusInternalServerError, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), "job_submission_failed")
+		assert.Empty(t, tripHandler.jobStore.jobs)
+	})
+
+	t.Run("Unknown job", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/jobs/missing", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "job_not_found")
+	})
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/service"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// Travel modes a trip can be planned in
+const (
+	TravelModeDriving   = maps.TravelModeDriving
+	TravelModeBicycling = maps.TravelModeBicycling
+	TravelModeTransit   = maps.TravelModeTransit
+)
+
+// MetaResponse describes what the server accepts, so clients can build forms
+// from its configuration
+type MetaResponse struct {
+	DefaultTimezone string `json:"default_timezone"`
+
+	// Coverage is the area stops must fall in; absent when any will do
+	Coverage *domain.BoundingBox `json:"coverage,omitempty"`
+
+	TravelModes []string `json:"travel_modes"`
+	Objectives  []string `json:"objectives"`
+	MaxStops    int      `json:"max_stops,omitempty"`
+}
+
+// GetMeta handles GET /api/v1/meta
+func (h *TripHandler) GetMeta(c *gin.Context) {
+	meta := MetaResponse{
+		DefaultTimezone: DefaultTimezone,
+		TravelModes:     []string{TravelModeDriving},
+		Objectives:      service.PlanTypes,
+		MaxStops:        h.maxStops,
+	}
+	if reporter, ok := h.routingService.(service.CoverageReporter); ok {
+		meta.Coverage = reporter.CoverageArea()
+	}
+	if reporter, ok := h.routingService.(service.TravelModeReporter); ok {
+		meta.TravelModes = reporter.TravelModes()
+	}
+	if _, ok := h.routingService.(service.ModeComparer); ok && !slices.Contains(meta.TravelModes, TravelModeTransit) {
+		meta.TravelModes = append(meta.TravelModes, TravelModeTransit)
+	}
+	c.JSON(http.StatusOK, meta)
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/service"
+)
+
+func TestGetMeta(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	coverage := &domain.BoundingBox{MinLat: 49.0, MinLng: -124.0, MaxLat: 50.0, MaxLng: -122.0}
+	routing := service.NewRoutingService(repo, mapsService, service.NewPricingService(), service.WithCoverageArea(coverage))
+	router := newTestRouter(NewTripHandler(routing, WithMaxStops(3)))
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/meta", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var meta MetaResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &meta))
+	assert.Equal(t, 3, meta.MaxStops)
+	assert.Equal(t, DefaultTimezone, meta.DefaultTimezone)
+	assert.Equal(t, coverage, meta.Coverage)
+	assert.Equal(t, []string{TravelModeDriving, TravelModeTransit}, meta.TravelModes)
+	assert.Equal(t, service.PlanTypes, meta.Objectives)
+
+	// The advertised limit is the one enforced
+	stops := []StopRequest{
+		{Address: "800 Robson St", DurationMinutes: 30},
+		{Address: "1055 Canada Pl", DurationMinutes: 30},
+		{Address: "800 Robson St", DurationMinutes: 30},
+		{Address: "1055 Canada Pl", DurationMinutes: 30},
+	}
+	w = postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+		"stops":      stops,
+		"start_time": "2024-01-15T10:00:00-08:00",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "too_many_stops")
+}
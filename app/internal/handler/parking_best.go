@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/service"
+)
+
+// BestParkingRequest asks for the best meter for a single visit
+type BestParkingRequest struct {
+	Lat             float64 `json:"lat" binding:"required,min=-90,max=90"`
+	Lng             float64 `json:"lng" binding:"required,min=-180,max=180"`
+	ArrivalTime     string  `json:"arrival_time" binding:"required"` // RFC3339 format
+	DurationMinutes int     `json:"duration_minutes" binding:"required,min=1"`
+
+	// RadiusKm is how far from the location meters are considered, the same
+	// default and maximum as trip planning
+	RadiusKm float64 `json:"radius_km" binding:"omitempty,gt=0"`
+}
+
+// BestParkingResponse is the best meter for the visit
+type BestParkingResponse struct {
+	ParkingMeter   *domain.ParkingMeter `json:"parking_meter"`
+	ParkingCost    float64              `json:"parking_cost"`
+	DistanceKm     float64              `json:"distance_km"`
+	WalkingMinutes int                  `json:"walking_minutes"`
+	ArrivalTime    time.Time            `json:"arrival_time"`
+	MetersChecked  int                  `json:"meters_checked"`
+}
+
+// GetBestParking handles POST /api/v1/parking/best. It prices the meters near
+// one location for a single visit without any routing, so it makes no maps calls.
+func (h *TripHandler) GetBestParking(c *gin.Context) {
+	if h.parkingRepo == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Error:   "parking_info_unavailable",
+			Message: "parking lookup is not configured",
+			Code:    http.StatusServiceUnavailable,
+		})
+		return
+	}
+
+	var req BestParkingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	arrival, err := time.Parse(time.RFC3339, req.ArrivalTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_arrival_time",
+			Message: "arrival_time must be in RFC3339 format (e.g., '2024-01-15T14:30:00-08:00')",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	radiusKm := service.DefaultParkingSearchRadiusKm
+	if req.RadiusKm > 0 {
+		radiusKm = math.Min(req.RadiusKm, service.MaxParkingSearchRadiusKm)
+	}
+
+	meters, err := h.parkingRepo.GetParkingMetersNear(req.Lat, req.Lng, radiusKm)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, ErrorResponse{
+			Error:   "parking_lookup_failed",
+			Message: err.Error(),
+			Code:    http.StatusBadGateway,
+		})
+		return
+	}
+
+	// Selection keeps the first of equally good meters, so offer the nearest first
+	point := &domain.Location{Lat: req.Lat, Lng: req.Lng}
+	distanceTo := func(meter *domain.ParkingMeter) float64 {
+		return h.earth.Distance(point, &domain.Location{Lat: meter.Lat, Lng: meter.Lng})
+	}
+	sort.SliceStable(meters, func(i, j int) bool { return distanceTo(meters[i]) < distanceTo(meters[j]) })
+
+	meter, cost, err := h.pricing.GetOptimalParkingMeter(meters, arrival, req.DurationMinutes,
+		service.WithWalkingLimit(point, service.DefaultMaxWalkingMinutes, h.earth.WalkingTime))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "pricing_failed",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	if meter == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "no_parking_found",
+			Message: fmt.Sprintf("none of the %d meters within %.2f km allow a %d-minute stay within a %d-minute walk", len(meters), radiusKm, req.DurationMinutes, service.DefaultMaxWalkingMinutes),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, BestParkingResponse{
+		ParkingMeter:   meter,
+		ParkingCost:    math.Round(cost*100) / 100,
+		DistanceKm:     distanceTo(meter),
+		WalkingMinutes: h.earth.WalkingTime(&domain.Location{Lat: meter.Lat, Lng: meter.Lng}, point),
+		ArrivalTime:    arrival,
+		MetersChecked:  len(meters),
+	})
+}
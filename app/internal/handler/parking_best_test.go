@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/service"
+)
+
+func TestGetBestParking(t *testing.T) {
+	// Three meters around a downtown point: the nearest is the priciest
+	repo := &fakeParkingRepository{meters: []*domain.ParkingMeter{
+		{MeterID: "NEAR", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 6.00, TimeLimitMF9A6P: 2},
+		{MeterID: "CHEAP", Lat: 49.2840, Lng: -123.1190, RateMF9A6P: 2.00, TimeLimitMF9A6P: 2},
+		{MeterID: "SHORT", Lat: 49.2830, Lng: -123.1200, RateMF9A6P: 1.00, TimeLimitMF9A6P: 1},
+	}}
+	mapsService := &fakeMapsService{travelMinutes: 10}
+	pricing := service.NewPricingService()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, pricing), WithParkingInfo(repo, pricing)))
+
+	t.Run("Returns the cheapest meter that allows the stay", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/parking/best", map[string]interface{}{
+			"lat":              49.2827,
+			"lng":              -123.1207,
+			"arrival_time":     "2024-01-15T10:00:00-08:00",
+			"duration_minutes": 90,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response BestParkingResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotNil(t, response.ParkingMeter)
+		// SHORT is cheaper but its one-hour limit can't hold a 90-minute stay
+		assert.Equal(t, "CHEAP", response.ParkingMeter.MeterID)
+		assert.Equal(t, 3.00, response.ParkingCost)
+		assert.Greater(t, response.DistanceKm, 0.0)
+		assert.Greater(t, response.WalkingMinutes, 0)
+		assert.Equal(t, 3, response.MetersChecked)
+		assert.Zero(t, mapsService.travelCalls)
+	})
+
+	t.Run("No meter allows the stay", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/parking/best", map[string]interface{}{
+			"lat":              49.2827,
+			"lng":              -123.1207,
+			"arrival_time":     "2024-01-15T10:00:00-08:00",
+			"duration_minutes": 180,
+		})
+		assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+	})
+
+	tests := []struct {
+		name      string
+		body      map[string]interface{}
+		errorCode string
+	}{
+		{
+			name:      "Missing duration",
+			body:      map[string]interface{}{"lat": 49.2827, "lng": -123.1207, "arrival_time": "2024-01-15T10:00:00-08:00"},
+			errorCode: "invalid_request",
+		},
+		{
+			name:      "Latitude out of range",
+			body:      map[string]interface{}{"lat": 123.0, "lng": -123.1207, "arrival_time": "2024-01-15T10:00:00-08:00", "duration_minutes": 60},
+			errorCode: "invalid_request",
+		},
+		{
+			name:      "Arrival time not RFC3339",
+			body:      map[string]interface{}{"lat": 49.2827, "lng": -123.1207, "arrival_time": "tomorrow at 10", "duration_minutes": 60},
+			errorCode: "invalid_arrival_time",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, "/api/v1/parking/best", tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var response ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.errorCode, response.Error)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/repository"
+	"vancouver-trip-planner/internal/service"
+)
+
+// EstimateParkingRequest prices a single stay at one meter, given either the
+// ID of a meter in the parking data or the meter's rates inline
+type EstimateParkingRequest struct {
+	MeterID         string               `json:"meter_id"`
+	Meter           *domain.ParkingMeter `json:"meter"`
+	ArrivalTime     string               `json:"arrival_time" binding:"required"` // RFC3339 format
+	DurationMinutes int                  `json:"duration_minutes" binding:"required,min=1"`
+}
+
+// EstimatePeriod is the part of the stay spent in one metered rate window
+type EstimatePeriod struct {
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	Rate           float64   `json:"rate"`
+	TimeLimitHours int       `json:"time_limit_hours,omitempty"`
+	ChargedMinutes float64   `json:"charged_minutes"`
+	Cost           float64   `json:"cost"`
+}
+
+// EstimateParkingResponse is what the stay costs and how that is made up
+type EstimateParkingResponse struct {
+	MeterID         string    `json:"meter_id,omitempty"`
+	ArrivalTime     time.Time `json:"arrival_time"`
+	DurationMinutes int       `json:"duration_minutes"`
+	ParkingCost     float64   `json:"parking_cost"`
+
+	// Periods lists the metered windows the stay falls in; time outside
+	// metered hours is free and not listed
+	Periods []EstimatePeriod `json:"periods,omitempty"`
+}
+
+// EstimateParkingCost handles POST /api/v1/parking/estimate. It prices a stay
+// at a known meter without searching for one.
+func (h *TripHandler) EstimateParkingCost(c *gin.Context) {
+	if h.pricing == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Error:   "parking_info_unavailable",
+			Message: "parking pricing is not configured",
+			Code:    http.StatusServiceUnavailable,
+		})
+		return
+	}
+
+	var req EstimateParkingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if (req.MeterID == "") == (req.Meter == nil) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: "give either meter_id or an inline meter",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	arrival, err := time.Parse(time.RFC3339, req.ArrivalTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_arrival_time",
+			Message: "arrival_time must be in RFC3339 format (e.g., '2024-01-15T14:30:00-08:00')",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	meter := req.Meter
+	if meter == nil {
+		finder, ok := h.parkingRepo.(repository.MeterFinder)
+		if !ok {
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+				Error:   "parking_info_unavailable",
+				Message: "meters can't be looked up by ID; give the meter inline",
+				Code:    http.StatusServiceUnavailable,
+			})
+			return
+		}
+		meter, err = finder.GetParkingMeter(req.MeterID)
+		if errors.Is(err, repository.ErrMeterNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{
+				Error:   "meter_not_found",
+				Message: err.Error(),
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadGateway, ErrorResponse{
+				Error:   "parking_lookup_failed",
+				Message: err.Error(),
+				Code:    http.StatusBadGateway,
+			})
+			return
+		}
+	}
+
+	cost, err := h.pricing.CalculateParkingCost(meter, arrival, req.DurationMinutes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "pricing_failed",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	response := EstimateParkingResponse{
+		MeterID:         meter.MeterID,
+		ArrivalTime:     arrival,
+		DurationMinutes: req.DurationMinutes,
+		ParkingCost:     math.Round(cost*100) / 100,
+	}
+	if reporter, ok := h.pricing.(service.CostBreakdownReporter); ok {
+		periods, err := reporter.ParkingCostBreakdown(meter, arrival, req.DurationMinutes)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Error:   "pricing_failed",
+				Message: err.Error(),
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+		for _, period := range periods {
+			response.Periods = append(response.Periods, EstimatePeriod{
+				Start:          period.Start,
+				End:            period.End,
+				Rate:           period.Rate,
+				TimeLimitHours: period.TimeLimit,
+				ChargedMinutes: period.ChargedMinutes,
+				Cost:           math.Round(period.Cost*100) / 100,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/service"
+)
+
+func TestEstimateParkingCost(t *testing.T) {
+	repo := &fakeParkingRepository{meters: []*domain.ParkingMeter{
+		{MeterID: "DT1", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 4.00, RateMF6P10: 2.00, TimeLimitMF9A6P: 2, TimeLimitMF6P10: 4},
+	}}
+	pricing := service.NewPricingService()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, &fakeMapsService{}, pricing), WithParkingInfo(repo, pricing)))
+
+	t.Run("Prices a stay at a meter by ID", func(t *testing.T) {
+		// An hour of daytime at $4 and half an hour of evening at $2
+		w := postJSON(router, "/api/v1/parking/estimate", map[string]interface{}{
+			"meter_id":         "DT1",
+			"arrival_time":     "2024-01-15T17:00:00-08:00",
+			"duration_minutes": 90,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response EstimateParkingResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "DT1", response.MeterID)
+		assert.Equal(t, 5.00, response.ParkingCost)
+		require.Len(t, response.Periods, 2)
+		assert.Equal(t, 4.00, response.Periods[0].Rate)
+		assert.Equal(t, 60.0, response.Periods[0].ChargedMinutes)
+		assert.Equal(t, 4.00, response.Periods[0].Cost)
+		assert.Equal(t, 2, response.Periods[0].TimeLimitHours)
+		assert.Equal(t, 2.00, response.Periods[1].Rate)
+		assert.Equal(t, 1.00, response.Periods[1].Cost)
+		assert.True(t, response.Periods[1].Start.Equal(response.Periods[0].End))
+	})
+
+	t.Run("Prices an inline meter", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/parking/estimate", map[string]interface{}{
+			"meter": map[string]interface{}{
+				"meter_id":           "CUSTOM",
+				"rate_mf_9a_6p":      3.00,
+				"free_grace_minutes": 15,
+			},
+			"arrival_time":     "2024-01-15T10:00:00-08:00",
+			"duration_minutes": 75,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response EstimateParkingResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 3.00, response.ParkingCost)
+		require.Len(t, response.Periods, 1)
+		assert.Equal(t, 60.0, response.Periods[0].ChargedMinutes)
+	})
+
+	t.Run("Unknown meter", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/parking/estimate", map[string]interface{}{
+			"meter_id":         "NOPE",
+			"arrival_time":     "2024-01-15T10:00:00-08:00",
+			"duration_minutes": 60,
+		})
+		assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+	})
+
+	tests := []struct {
+		name      string
+		body      map[string]interface{}
+		errorCode string
+	}{
+		{
+			name:      "Neither meter_id nor meter",
+			body:      map[string]interface{}{"arrival_time": "2024-01-15T10:00:00-08:00", "duration_minutes": 60},
+			errorCode: "invalid_request",
+		},
+		{
+			name:      "Both meter_id and meter",
+			body:      map[string]interface{}{"meter_id": "DT1", "meter": map[string]interface{}{"rate_mf_9a_6p": 3.00}, "arrival_time": "2024-01-15T10:00:00-08:00", "duration_minutes": 60},
+			errorCode: "invalid_request",
+		},
+		{
+			name:      "Duration not positive",
+			body:      map[string]interface{}{"meter_id": "DT1", "arrival_time": "2024-01-15T10:00:00-08:00", "duration_minutes": -30},
+			errorCode: "invalid_request",
+		},
+		{
+			name:      "Arrival time not RFC3339",
+			body:      map[string]interface{}{"meter_id": "DT1", "arrival_time": "2024-01-15 10:00", "duration_minutes": 60},
+			errorCode: "invalid_arrival_time",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, "/api/v1/parking/estimate", tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var response ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.errorCode, response.Error)
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/repository"
+	"vancouver-trip-planner/internal/service"
+)
+
+// Parking info returns the first 10 meters in the sort order by default, and
+// at most 100, ranking every meter the repository finds within the radius
+const (
+	DefaultParkingInfoLimit = 10
+	maxParkingInfoLimit     = 100
+)
+
+// parkingInfoRadiusKm is how far from the query point meters are looked up
+// unless radius_km says otherwise. Overrides go from 100 m up to the trip
+// planner's maximum search radius.
+const (
+	parkingInfoRadiusKm    = 0.5
+	minParkingInfoRadiusKm = 0.1
+)
+
+// parkingInfoSorts orders nearby meters for each accepted sort key. Ties keep
+// the nearer meter first.
+var parkingInfoSorts = map[string]func(a, b NearbyMeter) bool{
+	"distance": func(a, b NearbyMeter) bool { return a.DistanceKm < b.DistanceKm },
+	"rate":     func(a, b NearbyMeter) bool { return a.CurrentRate < b.CurrentRate },
+	"walk":     func(a, b NearbyMeter) bool { return a.WalkingMinutes < b.WalkingMinutes },
+}
+
+// WithParkingInfo enables GET /api/v1/parking/info and POST /api/v1/parking/best,
+// looking meters up in repo and pricing them with pricing
+func WithParkingInfo(repo repository.ParkingRepository, pricing service.PricingService) HandlerOption {
+	return func(h *TripHandler) {
+		h.parkingRepo = repo
+		h.pricing = pricing
+	}
+}
+
+// NearbyMeter is a meter near the queried location
+type NearbyMeter struct {
+	domain.ParkingMeter
+	DistanceKm     float64 `json:"distance_km"`
+	WalkingMinutes int     `json:"walking_minutes"`
+
+	// CurrentRate is the hourly rate in effect now, zero outside metered hours
+	CurrentRate float64 `json:"current_rate"`
+}
+
+// ParkingInfoResponse lists the meters near a location
+type ParkingInfoResponse struct {
+	Lat      float64       `json:"lat"`
+	Lng      float64       `json:"lng"`
+	RadiusKm float64       `json:"radius_km"`
+	Sort     string        `json:"sort"`
+	Count    int           `json:"count"`
+	Meters   []NearbyMeter `json:"meters"`
+}
+
+// GetParkingInfo handles GET /api/v1/parking/info
+func (h *TripHandler) GetParkingInfo(c *gin.Context) {
+	if h.parkingRepo == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Error:   "parking_info_unavailable",
+			Message: "parking lookup is not configured",
+			Code:    http.StatusServiceUnavailable,
+		})
+		return
+	}
+
+	if c.Query("lat") == "" || c.Query("lng") == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "missing_coordinates",
+			Message: "lat and lng query parameters are required",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	lat, latErr := parseFiniteFloat(c.Query("lat"))
+	lng, lngErr := parseFiniteFloat(c.Query("lng"))
+	if latErr != nil || lngErr != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_coordinates",
+			Message: "lat and lng must be numbers within -90..90 and -180..180",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	sortKey := c.DefaultQuery("sort", "distance")
+	less, ok := parkingInfoSorts[sortKey]
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_sort",
+			Message: fmt.Sprintf("unknown sort %q; use distance, rate or walk", sortKey),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	limit := DefaultParkingInfoLimit
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxParkingInfoLimit {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_limit",
+				Message: fmt.Sprintf("limit must be a whole number from 1 to %d", maxParkingInfoLimit),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+
+	radiusKm := parkingInfoRadiusKm
+	if value := c.Query("radius_km"); value != "" {
+		var err error
+		radiusKm, err = parseFiniteFloat(value)
+		if err != nil || radiusKm < minParkingInfoRadiusKm || radiusKm > service.MaxParkingSearchRadiusKm {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_radius",
+				Message: fmt.Sprintf("radius_km must be a number from %.1f to %.1f", minParkingInfoRadiusKm, service.MaxParkingSearchRadiusKm),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+
+	meters, err := h.parkingRepo.GetParkingMetersNear(lat, lng, radiusKm)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, ErrorResponse{
+			Error:   "parking_lookup_failed",
+			Message: err.Error(),
+			Code:    http.StatusBadGateway,
+		})
+		return
+	}
+
+	now := service.MeterLocalTime(h.now())
+	point := &domain.Location{Lat: lat, Lng: lng}
+
+	nearby := make([]NearbyMeter, len(meters))
+	for i, meter := range meters {
+		location := &domain.Location{Lat: meter.Lat, Lng: meter.Lng}
+		rate, _ := h.pricing.GetParkingRateAtTime(meter, now)
+		nearby[i] = NearbyMeter{
+			ParkingMeter:   *meter,
+			DistanceKm:     h.earth.Distance(point, location),
+			WalkingMinutes: h.earth.WalkingTime(location, point),
+			CurrentRate:    rate,
+		}
+	}
+
+	// Order by distance first so other keys break ties toward the nearer meter
+	sort.SliceStable(nearby, func(i, j int) bool { return nearby[i].DistanceKm < nearby[j].DistanceKm })
+	sort.SliceStable(nearby, func(i, j int) bool { return less(nearby[i], nearby[j]) })
+	if len(nearby) > limit {
+		nearby = nearby[:limit]
+	}
+
+	c.JSON(http.StatusOK, ParkingInfoResponse{
+		Lat:      lat,
+		Lng:      lng,
+		RadiusKm: radiusKm,
+		Sort:     sortKey,
+		Count:    len(nearby),
+		Meters:   nearby,
+	})
+}
+
+// parseFiniteFloat parses a query value as a number, rejecting NaN and the
+// infinities. NaN compares false against any bound, so range checks alone
+// would let it through.
+func parseFiniteFloat(value string) (float64, error) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", value)
+	}
+	return number, nil
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/repository"
+	"vancouver-trip-planner/internal/service"
+)
+
+func getParkingInfo(t *testing.T, router http.Handler, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/parking/info?"+query, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func meterIDs(meters []NearbyMeter) []string {
+	ids := make([]string, len(meters))
+	for i, meter := range meters {
+		ids[i] = meter.MeterID
+	}
+	return ids
+}
+
+func TestGetParkingInfo(t *testing.T) {
+	// Five meters heading east from the query point, pricier the closer they are
+	repo := &fakeParkingRepository{}
+	for i, id := range []string{"M1", "M2", "M3", "M4", "M5"} {
+		repo.meters = append(repo.meters, &domain.ParkingMeter{
+			MeterID:         id,
+			Lat:             49.2827,
+			Lng:             -123.1207 + float64(i)*0.0005,
+			RateMF9A6P:      float64(6 - i),
+			TimeLimitMF9A6P: 2,
+		})
+	}
+	_, mapsService := downtownFixture()
+	pricing := service.NewPricingService()
+
+	tripHandler := NewTripHandler(service.NewRoutingService(repo, mapsService, pricing), WithParkingInfo(repo, pricing))
+	tripHandler.now = func() time.Time {
+		return time.Date(2024, 1, 15, 10, 0, 0, 0, time.FixedZone("PST", -8*60*60)) // a Monday morning
+	}
+	router := newTestRouter(tripHandler)
+
+	t.Run("Nearest first by default", func(t *testing.T) {
+		w := getParkingInfo(t, router, "lat=49.2827&lng=-123.1207")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response ParkingInfoResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "distance", response.Sort)
+		assert.Equal(t, []string{"M1", "M2", "M3", "M4", "M5"}, meterIDs(response.Meters))
+		assert.Equal(t, 5, response.Count)
+		assert.Equal(t, 6.0, response.Meters[0].CurrentRate)
+		assert.Equal(t, 0.5, response.RadiusKm)
+		assert.Equal(t, 0.5, repo.radii[len(repo.radii)-1])
+	})
+
+	t.Run("Radius override", func(t *testing.T) {
+		// The meters are about 36 m apart, so 100 m takes in the first three
+		w := getParkingInfo(t, router, "lat=49.2827&lng=-123.1207&radius_km=0.1")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response ParkingInfoResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 0.1, response.RadiusKm)
+		assert.Equal(t, 0.1, repo.radii[len(repo.radii)-1])
+		assert.Equal(t, []string{"M1", "M2", "M3"}, meterIDs(response.Meters))
+		assert.Equal(t, 3, response.Count)
+	})
+
+	t.Run("Sort by rate", func(t *testing.T) {
+		w := getParkingInfo(t, router, "lat=49.2827&lng=-123.1207&sort=rate")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response ParkingInfoResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "rate", response.Sort)
+		assert.Equal(t, []string{"M5", "M4", "M3", "M2", "M1"}, meterIDs(response.Meters))
+		for i := 1; i < len(response.Meters); i++ {
+			assert.LessOrEqual(t, response.Meters[i-1].CurrentRate, response.Meters[i].CurrentRate)
+		}
+	})
+
+	t.Run("Limit of 3", func(t *testing.T) {
+		w := getParkingInfo(t, router, "lat=49.2827&lng=-123.1207&limit=3")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response ParkingInfoResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 3, response.Count)
+		assert.Equal(t, []string{"M1", "M2", "M3"}, meterIDs(response.Meters))
+	})
+
+	t.Run("Invalid parameters", func(t *testing.T) {
+		tests := []struct {
+			query string
+			error string
+		}{
+			{"lng=-123.1207", "missing_coordinates"},
+			{"lat=north&lng=-123.1207", "invalid_coordinates"},
+			{"lat=49.2827&lng=-123.1207&sort=price", "invalid_sort"},
+			{"lat=49.2827&lng=-123.1207&limit=0", "invalid_limit"},
+			{"lat=49.2827&lng=-123.1207&limit=ten", "invalid_limit"},
+			{"lat=49.2827&lng=-123.1207&radius_km=0.05", "invalid_radius"},
+			{"lat=49.2827&lng=-123.1207&radius_km=10", "invalid_radius"},
+			{"lat=49.2827&lng=-123.1207&radius_km=wide", "invalid_radius"},
+			{"lat=NaN&lng=-123.1207", "invalid_coordinates"},
+			{"lat=49.2827&lng=nan", "invalid_coordinates"},
+			{"lat=Inf&lng=-123.1207", "invalid_coordinates"},
+			{"lat=49.2827&lng=-123.1207&radius_km=NaN", "invalid_radius"},
+			{"lat=49.2827&lng=-123.1207&radius_km=-Inf", "invalid_radius"},
+		}
+		for _, tt := range tests {
+			w := getParkingInfo(t, router, tt.query)
+			require.Equal(t, http.StatusBadRequest, w.Code, tt.query)
+
+			var response ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.error, response.Error, tt.query)
+		}
+	})
+}
+
+func TestGetParkingInfo_RanksEveryMeterInRadius(t *testing.T) {
+	// Twelve meters heading east from the query point, the farthest cheapest
+	var records []string
+	for i := 0; i < 12; i++ {
+		records = append(records, fmt.Sprintf(`{"meterid": "M%02d", "r_mf_9a_6p": "$%d.00", "geo_point_2d": {"lat": 49.2827, "lon": %f}}`,
+			i, 13-i, -123.1207+float64(i)*0.0002))
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"total_count": %d, "results": [%s]}`, len(records), strings.Join(records, ","))
+	}))
+	defer server.Close()
+
+	dataset := repository.VancouverDataset()
+	dataset.BaseURL = server.URL
+	repo := repository.NewVancouverParkingRepository(repository.WithDataset(dataset))
+	_, mapsService := downtownFixture()
+	pricing := service.NewPricingService()
+
+	tripHandler := NewTripHandler(service.NewRoutingService(repo, mapsService, pricing), WithParkingInfo(repo, pricing))
+	tripHandler.now = func() time.Time {
+		return time.Date(2024, 1, 15, 10, 0, 0, 0, time.FixedZone("PST", -8*60*60)) // a Monday morning
+	}
+	router := newTestRouter(tripHandler)
+
+	w := getParkingInfo(t, router, "lat=49.2827&lng=-123.1207&sort=rate&limit=1")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response ParkingInfoResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []string{"M11"}, meterIDs(response.Meters))
+
+	w = getParkingInfo(t, router, "lat=49.2827&lng=-123.1207&limit=100")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 12, response.Count)
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// DefaultPlanCacheTTL is how long identical plan requests are answered from cache
+const DefaultPlanCacheTTL = 30 * time.Second
+
+// planCache holds recent trip plan responses keyed by a hash of the normalized request
+type planCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]planCacheEntry
+}
+
+type planCacheEntry struct {
+	plans     []*domain.TripPlan
+	expiresAt time.Time
+}
+
+func newPlanCache(ttl time.Duration) *planCache {
+	return &planCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]planCacheEntry),
+	}
+}
+
+// get returns the cached plans for key, if present and not expired
+func (c *planCache) get(key string) ([]*domain.TripPlan, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if c.now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.plans, true
+}
+
+// set stores plans under key, dropping any entries that have expired
+func (c *planCache) set(key string, plans []*domain.TripPlan) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = planCacheEntry{plans: plans, expiresAt: now.Add(c.ttl)}
+}
+
+// planCacheKey hashes the parts of a request that affect its plans. Addresses are
+// compared case-insensitively, times in UTC, and the stops after the first are
+// sorted since every ordering of them is explored anyway. With a separate origin
+// all stops are reorderable.
+func planCacheKey(request *domain.TripRequest) (string, error) {
+	normalized := *request
+	normalized.StartTime = request.StartTime.UTC()
+
+	normalized.Stops = make([]domain.Stop, len(request.Stops))
+	for i, stop := range request.Stops {
+		stop.Address = strings.ToLower(stop.Address)
+		stop.FixedArrival = stop.FixedArrival.UTC()
+		stop.LatestDeparture = stop.LatestDeparture.UTC()
+		normalized.Stops[i] = stop
+	}
+
+	reorderable := normalized.Stops
+	if request.Origin == nil && len(reorderable) > 0 {
+		reorderable = reorderable[1:]
+	}
+	sort.Slice(reorderable, func(i, j int) bool {
+		if reorderable[i].ID != reorderable[j].ID {
+			return reorderable[i].ID < reorderable[j].ID
+		}
+		return reorderable[i].Address < reorderable[j].Address
+	})
+
+	encoded, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
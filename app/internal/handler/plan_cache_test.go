@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+)
+
+func TestPlanCacheKey(t *testing.T) {
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	request := func(origin *domain.Origin, ids ...string) *domain.TripRequest {
+		stops := make([]domain.Stop, len(ids))
+		for i, id := range ids {
+			stops[i] = domain.Stop{ID: id, Address: "Stop " + id, Duration: 30}
+		}
+		return &domain.TripRequest{StartTime: start, Stops: stops, Origin: origin}
+	}
+	key := func(r *domain.TripRequest) string {
+		k, err := planCacheKey(r)
+		require.NoError(t, err)
+		return k
+	}
+
+	// The first stop is where the trip starts, so only the rest are order-insensitive
+	assert.Equal(t, key(request(nil, "a", "b", "c")), key(request(nil, "a", "c", "b")))
+	assert.NotEqual(t, key(request(nil, "a", "b", "c")), key(request(nil, "b", "a", "c")))
+
+	// With a separate origin every stop can be reordered
+	origin := &domain.Origin{Lat: 49.28, Lng: -123.12}
+	assert.Equal(t, key(request(origin, "a", "b", "c")), key(request(origin, "b", "c", "a")))
+
+	// Addresses are compared case-insensitively
+	upper := request(nil, "a", "b")
+	upper.Stops[1].Address = "STOP B"
+	assert.Equal(t, key(request(nil, "a", "b")), key(upper))
+
+	// Normalizing doesn't modify the caller's request
+	original := request(nil, "a", "c", "b")
+	key(original)
+	assert.Equal(t, "c", original.Stops[1].ID)
+}
+
+func TestPlanCache_Expiry(t *testing.T) {
+	cache := newPlanCache(time.Minute)
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	plans := []*domain.TripPlan{{Type: "cheapest"}}
+	cache.set("key", plans)
+
+	cached, ok := cache.get("key")
+	require.True(t, ok)
+	assert.Equal(t, plans, cached)
+
+	now = now.Add(2 * time.Minute)
+	_, ok = cache.get("key")
+	assert.False(t, ok)
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// errPlannerBusy is returned to every request sharing a plan when the one
+// planning it couldn't get a planning slot
+var errPlannerBusy = errors.New("planner busy")
+
+// WithInFlightDedup makes concurrent identical plan requests, such as a double
+// submit or several open tabs, share one computation and its maps calls. Each
+// receives the same plans.
+func WithInFlightDedup() HandlerOption {
+	return func(h *TripHandler) {
+		h.planFlights = newPlanFlights()
+	}
+}
+
+// planFlight is a plan being computed for one or more identical requests
+type planFlight struct {
+	done  chan struct{}
+	plans []*domain.TripPlan
+	err   error
+
+	// waiting counts the requests sharing the plan besides the one computing it
+	waiting int
+}
+
+// planFlights tracks the plans in progress by request key
+type planFlights struct {
+	mu      sync.Mutex
+	flights map[string]*planFlight
+}
+
+func newPlanFlights() *planFlights {
+	return &planFlights{flights: make(map[string]*planFlight)}
+}
+
+// do returns the result of plan for key. The first caller runs plan; callers
+// arriving while it runs wait for and share its result instead.
+func (f *planFlights) do(key string, plan func() ([]*domain.TripPlan, error)) ([]*domain.TripPlan, error) {
+	f.mu.Lock()
+	if flight, ok := f.flights[key]; ok {
+		flight.waiting++
+		f.mu.Unlock()
+		<-flight.done
+		return flight.plans, flight.err
+	}
+	flight := &planFlight{done: make(chan struct{})}
+	f.flights[key] = flight
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.flights, key)
+		if flight.waiting > 0 {
+			fmt.Printf("[DEBUG] Shared a plan with %d identical requests\n", flight.waiting)
+		}
+		f.mu.Unlock()
+		close(flight.done)
+	}()
+	flight.plans, flight.err = plan()
+	return flight.plans, flight.err
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+)
+
+// countingRoutingService counts plans and holds each until unblock is closed
+type countingRoutingService struct {
+	blockingRoutingService
+	calls atomic.Int32
+}
+
+func (s *countingRoutingService) PlanTrip(request *domain.TripRequest) ([]*domain.TripPlan, error) {
+	s.calls.Add(1)
+	return s.blockingRoutingService.PlanTrip(request)
+}
+
+// flightWaiting returns how many requests are waiting on other requests' plans
+func flightWaiting(h *TripHandler) int {
+	h.planFlights.mu.Lock()
+	defer h.planFlights.mu.Unlock()
+	waiting := 0
+	for _, flight := range h.planFlights.flights {
+		waiting += flight.waiting
+	}
+	return waiting
+}
+
+func TestPlanTrip_InFlightDedup(t *testing.T) {
+	routing := &countingRoutingService{blockingRoutingService: blockingRoutingService{unblock: make(chan struct{})}}
+	tripHandler := NewTripHandler(routing, WithInFlightDedup(), WithConcurrencyLimit(1, 0))
+	router := newTestRouter(tripHandler)
+
+	body := map[string]interface{}{
+		"stops":      downtownStops(),
+		"start_time": "2024-01-15T10:00:00-08:00",
+	}
+
+	// However many identical requests arrive, one plans and the rest wait for it,
+	// without taking planning slots of their own
+	const requests = 8
+	responses := make(chan *httptest.ResponseRecorder, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			responses <- postJSON(router, "/api/v1/trips/plan", body)
+		}()
+	}
+	require.Eventually(t, func() bool {
+		return flightWaiting(tripHandler) == requests-1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(routing.unblock)
+	var planIDs []string
+	for i := 0; i < requests; i++ {
+		w := <-responses
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response TripPlanResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Plans, 1)
+		planIDs = append(planIDs, response.Plans[0].ID)
+	}
+	assert.Equal(t, int32(1), routing.calls.Load())
+	for _, id := range planIDs {
+		assert.Equal(t, planIDs[0], id, "every request gets the same plans")
+	}
+
+	// Once done, the next identical request plans afresh
+	w := postJSON(router, "/api/v1/trips/plan", body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, int32(2), routing.calls.Load())
+}
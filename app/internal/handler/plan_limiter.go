@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"time"
+)
+
+// Default planning concurrency: plans running at once and plans waiting for a slot
+const (
+	DefaultMaxConcurrentPlans = 8
+	DefaultPlanQueueSize      = 16
+)
+
+// planRetryAfter is the wait suggested to clients turned away by a full queue
+const planRetryAfter = 5 * time.Second
+
+// planLimiter bounds the trip plans in flight, letting a limited number of
+// extra requests wait for a free slot and turning the rest away
+type planLimiter struct {
+	slots    chan struct{} // held while a plan runs
+	admitted chan struct{} // held while a plan runs or waits
+}
+
+func newPlanLimiter(maxConcurrent, maxQueued int) *planLimiter {
+	return &planLimiter{
+		slots:    make(chan struct{}, maxConcurrent),
+		admitted: make(chan struct{}, maxConcurrent+maxQueued),
+	}
+}
+
+// acquire waits for a planning slot. It returns false without waiting if the
+// queue is already full, or if ctx is done before a slot frees up.
+func (l *planLimiter) acquire(ctx context.Context) bool {
+	select {
+	case l.admitted <- struct{}{}:
+	default:
+		return false
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		<-l.admitted
+		return false
+	}
+}
+
+// release frees a slot taken by a successful acquire
+func (l *planLimiter) release() {
+	<-l.slots
+	<-l.admitted
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// planTokenVersion prefixes tokens so their encoding can change without
+// misreading old links
+const planTokenVersion = "v1"
+
+// Plan token limits: the longest token accepted, and the most JSON one may
+// decompress to
+const (
+	MaxPlanTokenLength = 4096
+	maxPlanTokenJSON   = 64 * 1024
+)
+
+// ErrInvalidPlanToken is returned for a plan token that can't be decoded
+var ErrInvalidPlanToken = errors.New("invalid plan token")
+
+// planToken is the part of a plan request a token carries: enough to plan
+// the same trip again, from the same place and travelled the same way.
+// Fields added since v1 are optional, so older tokens still decode.
+type planToken struct {
+	Stops       []StopRequest   `json:"stops"`
+	StartTime   string          `json:"start_time"`
+	Timezone    string          `json:"timezone,omitempty"`
+	Preferences json.RawMessage `json:"preferences,omitempty"`
+
+	Origin           *OriginRequest     `json:"origin,omitempty"`
+	CurrentLocation  *OriginRequest     `json:"current_location,omitempty"`
+	StartTimeMeaning string             `json:"start_time_meaning,omitempty"`
+	TravelMode       string             `json:"travel_mode,omitempty"`
+	Avoid            []string           `json:"avoid,omitempty"`
+	AvoidZones       []AvoidZoneRequest `json:"avoid_zones,omitempty"`
+	Strategy         string             `json:"strategy,omitempty"`
+}
+
+// tokenPreferences encodes preferences, leaving out weights that weren't
+// given so they still mean the defaults when the token is decoded
+func tokenPreferences(p *PreferencesRequest) (json.RawMessage, error) {
+	if p == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if !p.costWeightGiven {
+		delete(fields, "cost_weight")
+	}
+	if !p.timeWeightGiven {
+		delete(fields, "time_weight")
+	}
+	return json.Marshal(fields)
+}
+
+// EncodePlanToken encodes a plan request's stops, start time, preferences,
+// origin and how the trip is travelled as a compact, URL-safe token, so the
+// plan can be shared as a link and recomputed without storing it
+func EncodePlanToken(req *TripPlanRequest) (string, error) {
+	preferences, err := tokenPreferences(req.Preferences)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(planToken{
+		Stops:       req.Stops,
+		StartTime:   req.StartTime,
+		Timezone:    req.Timezone,
+		Preferences: preferences,
+
+		Origin:           req.Origin,
+		CurrentLocation:  req.CurrentLocation,
+		StartTimeMeaning: req.StartTimeMeaning,
+		TravelMode:       req.TravelMode,
+		Avoid:            req.Avoid,
+		AvoidZones:       req.AvoidZones,
+		Strategy:         req.Strategy,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(data); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return planTokenVersion + "." + base64.RawURLEncoding.EncodeToString(compressed.Bytes()), nil
+}
+
+// DecodePlanToken decodes a token made by EncodePlanToken into a plan request.
+// The request still needs validating like any other.
+func DecodePlanToken(token string) (*TripPlanRequest, error) {
+	if len(token) > MaxPlanTokenLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalidPlanToken, MaxPlanTokenLength)
+	}
+	version, payload, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing version", ErrInvalidPlanToken)
+	}
+	if version != planTokenVersion {
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrInvalidPlanToken, version)
+	}
+
+	compressed, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlanToken, err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlanToken, err)
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, maxPlanTokenJSON+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlanToken, err)
+	}
+	if len(data) > maxPlanTokenJSON {
+		return nil, fmt.Errorf("%w: decodes to more than %d bytes", ErrInvalidPlanToken, maxPlanTokenJSON)
+	}
+
+	var decoded planToken
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlanToken, err)
+	}
+	req := &TripPlanRequest{
+		Stops:     decoded.Stops,
+		StartTime: decoded.StartTime,
+		Timezone:  decoded.Timezone,
+
+		Origin:           decoded.Origin,
+		CurrentLocation:  decoded.CurrentLocation,
+		StartTimeMeaning: decoded.StartTimeMeaning,
+		TravelMode:       decoded.TravelMode,
+		Avoid:            decoded.Avoid,
+		AvoidZones:       decoded.AvoidZones,
+		Strategy:         decoded.Strategy,
+	}
+	if len(decoded.Preferences) > 0 {
+		if err := json.Unmarshal(decoded.Preferences, &req.Preferences); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPlanToken, err)
+		}
+	}
+	return req, nil
+}
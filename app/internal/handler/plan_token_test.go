@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/service"
+)
+
+func TestPlanToken_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"Without preferences", `{"stops": [{"address": "800 Robson St", "duration_minutes": 60}, {"lat": 49.2888, "lng": -123.1111, "duration_minutes": 45, "optional": true}], "start_time": "2024-01-15T10:00:00-08:00"}`},
+		{"With weights", `{"stops": [{"address": "800 Robson St", "duration_minutes": 60}, {"address": "1055 Canada Pl", "duration_minutes": 45}], "start_time": "2024-01-15T10:00:00-08:00", "timezone": "America/Toronto", "preferences": {"cost_weight": 0.7, "time_weight": 0.3}}`},
+		{"Preferences without weights", `{"stops": [{"address": "800 Robson St", "duration_minutes": 60}, {"address": "1055 Canada Pl", "duration_minutes": 45}], "start_time": "2024-01-15T10:00:00-08:00", "preferences": {"max_walking_minutes": 5}}`},
+		{"From an origin, travelled a way", `{"stops": [{"address": "800 Robson St", "duration_minutes": 60}, {"address": "1055 Canada Pl", "duration_minutes": 45}], "start_time": "2024-01-15T10:00:00-08:00", "origin": {"address": "1 Main St", "lat": 49.2800, "lng": -123.1150}, "start_time_meaning": "arrive_first_stop", "travel_mode": "transit", "avoid": ["tolls", "ferries"], "avoid_zones": [{"lat": 49.2850, "lng": -123.1200, "radius_km": 0.2}], "strategy": "two_opt"}`},
+		{"From the current location", `{"stops": [{"address": "800 Robson St", "duration_minutes": 60}, {"address": "1055 Canada Pl", "duration_minutes": 45}], "start_time": "2024-01-15T10:00:00-08:00", "current_location": {"lat": 49.2800, "lng": -123.1150}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req TripPlanRequest
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &req))
+
+			token, err := EncodePlanToken(&req)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(token, "v1."))
+			assert.Equal(t, token, url.QueryEscape(token), "tokens need no escaping in a URL")
+
+			decoded, err := DecodePlanToken(token)
+			require.NoError(t, err)
+			assert.Equal(t, req.Stops, decoded.Stops)
+			assert.Equal(t, req.StartTime, decoded.StartTime)
+			assert.Equal(t, req.Timezone, decoded.Timezone)
+			assert.Equal(t, req.Preferences, decoded.Preferences)
+			assert.Equal(t, req.Origin, decoded.Origin)
+			assert.Equal(t, req.CurrentLocation, decoded.CurrentLocation)
+			assert.Equal(t, req.StartTimeMeaning, decoded.StartTimeMeaning)
+			assert.Equal(t, req.TravelMode, decoded.TravelMode)
+			assert.Equal(t, req.Avoid, decoded.Avoid)
+			assert.Equal(t, req.AvoidZones, decoded.AvoidZones)
+			assert.Equal(t, req.Strategy, decoded.Strategy)
+		})
+	}
+
+	t.Run("Invalid tokens", func(t *testing.T) {
+		for _, token := range []string{
+			"not-a-token",
+			"v2.H4sIAAAAAAAA",
+			"v1.!!!",
+			"v1.bm90IGd6aXA",
+			"v1." + strings.Repeat("A", MaxPlanTokenLength),
+		} {
+			_, err := DecodePlanToken(token)
+			assert.ErrorIs(t, err, ErrInvalidPlanToken, token)
+		}
+	})
+}
+
+func TestPlanTrip_FromPlanToken(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+		"stops":      downtownStops(),
+		"start_time": "2024-01-15T10:00:00-08:00",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var planned TripPlanResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &planned))
+	token, ok := planned.Metadata["plan_token"].(string)
+	require.True(t, ok)
+
+	// The token alone plans the same trip again
+	w = postJSON(router, "/api/v1/trips/plan?plan="+token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var replanned TripPlanResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &replanned))
+	require.Len(t, replanned.Plans, len(planned.Plans))
+	for i, plan := range replanned.Plans {
+		assert.Equal(t, planned.Plans[i].Type, plan.Type)
+		assert.Equal(t, planned.Plans[i].TotalCost, plan.TotalCost)
+		assert.Equal(t, planned.Plans[i].TotalTime, plan.TotalTime)
+	}
+	assert.Equal(t, token, replanned.Metadata["plan_token"])
+
+	t.Run("Carries the origin", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      downtownStops(),
+			"start_time": "2024-01-15T10:00:00-08:00",
+			"origin":     map[string]float64{"lat": 49.2700, "lng": -123.1000},
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var fromOrigin TripPlanResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fromOrigin))
+		token := fromOrigin.Metadata["plan_token"].(string)
+
+		w = postJSON(router, "/api/v1/trips/plan?plan="+token, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var replanned TripPlanResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &replanned))
+		require.Len(t, replanned.Plans, len(fromOrigin.Plans))
+		for i, plan := range replanned.Plans {
+			assert.Equal(t, fromOrigin.Plans[i].TotalTime, plan.TotalTime)
+			require.NotEmpty(t, plan.Route)
+			assert.NotNil(t, plan.Route[0].FromStop, "the first leg leaves the origin")
+		}
+	})
+
+	t.Run("Bad token", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/trips/plan?plan=v9.abc", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid_plan_token")
+	})
+
+	t.Run("Token failing validation", func(t *testing.T) {
+		token, err := EncodePlanToken(&TripPlanRequest{
+			Stops:     []StopRequest{{Address: "800 Robson St", DurationMinutes: 60}},
+			StartTime: "2024-01-15T10:00:00-08:00",
+		})
+		require.NoError(t, err)
+		w := postJSON(router, "/api/v1/trips/plan?plan="+token, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid_plan_token")
+	})
+}
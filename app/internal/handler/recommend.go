@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"fmt"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// DominantWeight is the share of the preferences a weight needs for the
+// recommendation to follow it instead of the balanced hybrid plan
+const DominantWeight = 0.7
+
+// Recommendation names the plan the server suggests and why
+type Recommendation struct {
+	PlanID string `json:"plan_id"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// recommendPlan picks the plan to suggest: the cheapest or fastest when the
+// request's cost or time weight dominates, otherwise the hybrid plan. If the
+// wanted plan wasn't returned, the first plan is suggested.
+func recommendPlan(plans []*domain.TripPlan, prefs domain.Preferences) *Recommendation {
+	if len(plans) == 0 {
+		return nil
+	}
+	byType := make(map[string]*domain.TripPlan, len(plans))
+	for _, plan := range plans {
+		byType[plan.Type] = plan
+	}
+	cheapest, fastest := byType["cheapest"], byType["fastest"]
+
+	wanted := "hybrid"
+	switch {
+	case prefs.CostWeight >= DominantWeight:
+		wanted = "cheapest"
+	case prefs.TimeWeight >= DominantWeight:
+		wanted = "fastest"
+	}
+	plan, ok := byType[wanted]
+	if !ok {
+		plan = plans[0]
+	}
+
+	var reason string
+	switch {
+	case plan.Type == "cheapest" && wanted == "cheapest" && fastest != nil:
+		reason = fmt.Sprintf("cost weight %.2f favours the lowest cost; it costs $%.2f less than the fastest plan", prefs.CostWeight, fastest.TotalCost-plan.TotalCost)
+	case plan.Type == "fastest" && wanted == "fastest" && cheapest != nil:
+		reason = fmt.Sprintf("time weight %.2f favours the shortest trip; it takes %d minutes less than the cheapest plan", prefs.TimeWeight, cheapest.TotalTime-plan.TotalTime)
+	case plan.Type == "hybrid":
+		reason = fmt.Sprintf("best balance of cost and time for weights of %.2f cost and %.2f time", prefs.CostWeight, prefs.TimeWeight)
+	case plan.Type == wanted:
+		reason = fmt.Sprintf("best %s plan for the request's preferences", plan.Type)
+	default:
+		reason = fmt.Sprintf("no %s plan was found, so the %s plan is suggested", wanted, plan.Type)
+	}
+
+	return &Recommendation{PlanID: plan.ID, Type: plan.Type, Reason: reason}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/service"
+)
+
+func TestPlanTrip_Recommended(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	plan := func(t *testing.T, preferences map[string]interface{}) TripPlanResponse {
+		body := map[string]interface{}{
+			"stops":      downtownStops(),
+			"start_time": "2024-01-15T10:00:00-08:00",
+		}
+		if preferences != nil {
+			body["preferences"] = preferences
+		}
+		w := postJSON(router, "/api/v1/trips/plan", body)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response TripPlanResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotNil(t, response.Recommended)
+		return response
+	}
+	planOfType := func(response TripPlanResponse, planType string) *domain.TripPlan {
+		for _, plan := range response.Plans {
+			if plan.Type == planType {
+				return plan
+			}
+		}
+		return nil
+	}
+
+	t.Run("Hybrid by default", func(t *testing.T) {
+		response := plan(t, nil)
+		hybrid := planOfType(response, "hybrid")
+		require.NotNil(t, hybrid)
+		assert.Equal(t, "hybrid", response.Recommended.Type)
+		assert.Equal(t, hybrid.ID, response.Recommended.PlanID)
+		assert.Contains(t, response.Recommended.Reason, "balance")
+	})
+
+	t.Run("Cheapest when cost dominates", func(t *testing.T) {
+		response := plan(t, map[string]interface{}{"cost_weight": 0.9, "time_weight": 0.1})
+		cheapest := planOfType(response, "cheapest")
+		require.NotNil(t, cheapest)
+		assert.Equal(t, "cheapest", response.Recommended.Type)
+		assert.Equal(t, cheapest.ID, response.Recommended.PlanID)
+		assert.Contains(t, response.Recommended.Reason, "cost weight 0.90")
+	})
+}
+
+func TestRecommendPlan_MissingType(t *testing.T) {
+	plans := []*domain.TripPlan{{ID: "a", Type: "cheapest"}, {ID: "b", Type: "fastest"}}
+
+	recommended := recommendPlan(plans, domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5})
+	require.NotNil(t, recommended)
+	assert.Equal(t, "a", recommended.PlanID)
+	assert.Equal(t, "no hybrid plan was found, so the cheapest plan is suggested", recommended.Reason)
+
+	assert.Nil(t, recommendPlan(nil, domain.Preferences{}))
+}
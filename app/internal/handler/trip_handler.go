@@ -1,53 +1,313 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/repository"
 	"vancouver-trip-planner/internal/service"
+	"vancouver-trip-planner/pkg/maps"
 )
 
+// geocodeCacheSize bounds how many validated addresses are remembered
+const geocodeCacheSize = 1000
+
+// DefaultMaxAddressLength is the longest address, in characters, accepted by default
+const DefaultMaxAddressLength = 200
+
+// DefaultMaxStops is the most stops a trip may have by default
+const DefaultMaxStops = 25
+
+// DefaultTimezone is the timezone plans are rendered in when a request gives none
+const DefaultTimezone = "America/Vancouver"
+
 // TripHandler handles trip planning HTTP requests
 type TripHandler struct {
-	routingService service.RoutingService
+	routingService   service.RoutingService
+	geocoder         maps.DetailedGeocoder
+	planCache        *planCache
+	planStore        *planStore
+	planLimiter      *planLimiter
+	planFlights      *planFlights
+	jobStore         *jobStore
+	maxAddressLength int
+	maxStops         int
+
+	// parkingRepo and pricing back GET /api/v1/parking/info when configured
+	parkingRepo repository.ParkingRepository
+	pricing     service.PricingService
+	now         func() time.Time
+
+	// earth measures meters' distances and walks, and is reported by the health check
+	earth maps.Earth
+
+	// dataSources are credited in every plan response
+	dataSources []domain.DataSource
+}
+
+// HandlerOption configures a TripHandler
+type HandlerOption func(*TripHandler)
+
+// WithMaxAddressLength sets the longest address, in characters, a request may contain
+func WithMaxAddressLength(length int) HandlerOption {
+	return func(h *TripHandler) {
+		h.maxAddressLength = length
+	}
+}
+
+// WithMaxStops sets the most stops a trip may have
+func WithMaxStops(n int) HandlerOption {
+	return func(h *TripHandler) {
+		h.maxStops = n
+	}
+}
+
+// WithGeocoder enables address validation through GET /api/v1/geocode,
+// caching results from the given geocoder
+func WithGeocoder(geocoder maps.DetailedGeocoder) HandlerOption {
+	return func(h *TripHandler) {
+		h.geocoder = maps.NewCachedGeocoder(geocoder, geocodeCacheSize)
+	}
+}
+
+// WithDataSources credits each provider's data source in plan response
+// metadata, as their licenses require. Providers that name no source are skipped.
+func WithDataSources(providers ...domain.Attributor) HandlerOption {
+	return func(h *TripHandler) {
+		for _, provider := range providers {
+			if source := provider.Attribution(); source.Name != "" {
+				h.dataSources = append(h.dataSources, source)
+			}
+		}
+	}
+}
+
+// WithEarth sets the model the distances and walking times of nearby meters
+// are measured with, as the routing service's WithEarth does for plans
+func WithEarth(earth maps.Earth) HandlerOption {
+	return func(h *TripHandler) {
+		h.earth = earth
+	}
+}
+
+// WithPlanCache answers repeated identical plan requests from a cache for ttl,
+// so UI retries and polling don't repeat the planning work or maps calls
+func WithPlanCache(ttl time.Duration) HandlerOption {
+	return func(h *TripHandler) {
+		h.planCache = newPlanCache(ttl)
+	}
+}
+
+// WithConcurrencyLimit bounds the trip plans computed at once to maxConcurrent,
+// queuing up to maxQueued more and rejecting the rest with 503 Service Unavailable
+func WithConcurrencyLimit(maxConcurrent, maxQueued int) HandlerOption {
+	return func(h *TripHandler) {
+		h.planLimiter = newPlanLimiter(maxConcurrent, maxQueued)
+	}
 }
 
 // NewTripHandler creates a new trip handler
-func NewTripHandler(routingService service.RoutingService) *TripHandler {
-	return &TripHandler{
-		routingService: routingService,
+func NewTripHandler(routingService service.RoutingService, opts ...HandlerOption) *TripHandler {
+	h := &TripHandler{
+		routingService:   routingService,
+		planStore:        newPlanStore(DefaultItineraryTTL),
+		jobStore:         newJobStore(DefaultJobConcurrency, DefaultJobTTL),
+		maxAddressLength: DefaultMaxAddressLength,
+		maxStops:         DefaultMaxStops,
+		now:              time.Now,
 	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
 }
 
 // TripPlanRequest represents the HTTP request body for trip planning
 type TripPlanRequest struct {
 	Stops       []StopRequest       `json:"stops" binding:"required,min=2"`
-	StartTime   string              `json:"start_time" binding:"required"` // RFC3339 format
+	StartTime   string              `json:"start_time"` // RFC3339 format, required
 	Timezone    string              `json:"timezone"`
 	Preferences *PreferencesRequest `json:"preferences"`
+
+	// Origin is a starting point that is not itself a stop (no parking or dwell)
+	Origin *OriginRequest `json:"origin"`
+
+	// CurrentLocation is a convenience for planning from the device's GPS position;
+	// it is used as the origin
+	CurrentLocation *OriginRequest `json:"current_location"`
+
+	// TravelTimeVariance requests cost/time ranges for ±variance on travel legs (e.g. 0.15)
+	TravelTimeVariance float64 `json:"travel_time_variance" binding:"min=0,max=1"`
+
+	// Strategy overrides the route generation algorithm
+	Strategy string `json:"strategy" binding:"omitempty,oneof=exhaustive nearest_neighbor two_opt"`
+
+	// AllowOverstay accepts meters with too-short time limits at an overstay_penalty (dollars)
+	AllowOverstay   bool    `json:"allow_overstay"`
+	OverstayPenalty float64 `json:"overstay_penalty" binding:"min=0"`
+
+	// MaxDetourRatio caps total travel relative to the most direct ordering (e.g. 1.3)
+	MaxDetourRatio float64 `json:"max_detour_ratio" binding:"omitempty,min=1"`
+
+	// MaxMapCalls caps Google Maps calls for this plan; extra lookups are estimated
+	MaxMapCalls int `json:"max_map_calls" binding:"min=0"`
+
+	// Locale formats cost strings in metadata (e.g. "en-CA", "fr-CA")
+	Locale string `json:"locale"`
+
+	// AllowSplitVisit re-parks partway through a visit that outlasts every meter's time limit
+	AllowSplitVisit bool `json:"allow_split_visit"`
+
+	// ParkingSearchRadiusKm widens or narrows the meter search around each stop
+	// (default 1km when unset), e.g. tighter in dense downtown cores
+	ParkingSearchRadiusKm float64 `json:"parking_search_radius_km" binding:"omitempty,min=0.1,max=5"`
+
+	// CardMeterBonus favours card-accepting meters by this many dollars when ranking
+	CardMeterBonus float64 `json:"card_meter_bonus" binding:"min=0"`
+
+	// PreferCovered favours garage/covered meters by covered_bonus dollars (default 2)
+	PreferCovered bool    `json:"prefer_covered"`
+	CoveredBonus  float64 `json:"covered_bonus" binding:"min=0"`
+
+	// AvoidZones are circles, such as construction areas, where no meter is chosen
+	AvoidZones []AvoidZoneRequest `json:"avoid_zones" binding:"max=20,dive"`
+
+	// Avoid lists route features to keep driving legs off: "tolls", "highways", "ferries"
+	Avoid []string `json:"avoid" binding:"max=3"`
+
+	// TravelMode is "driving" (the default), "bicycling" or "transit"; trips
+	// that don't drive skip parking altogether
+	TravelMode string `json:"travel_mode" binding:"omitempty,oneof=driving bicycling transit"`
+
+	// MaxPerStopCost caps any single parking charge in dollars, e.g. an expense limit
+	MaxPerStopCost float64 `json:"max_per_stop_cost" binding:"min=0"`
+
+	// ReentryPenalty is the dollar cost of paying again at a meter paid for earlier in the trip
+	ReentryPenalty float64 `json:"reentry_penalty" binding:"min=0"`
+
+	// SpreadLoad picks among nearly equivalent meters at random
+	SpreadLoad bool `json:"spread_load"`
+
+	// MinParkingMinutes is the least parking bought for any visit
+	MinParkingMinutes int `json:"min_parking_minutes" binding:"min=0,max=240"`
+
+	// NormalizeWeights scales preference weights that don't sum to 1 instead of rejecting them
+	NormalizeWeights bool `json:"normalize_weights"`
+
+	// IncludeWalkingRoutes adds each segment's walk as an encoded polyline
+	IncludeWalkingRoutes bool `json:"include_walking_routes"`
+
+	// StartTimeMeaning says whether start_time is when the trip leaves the
+	// origin or when it reaches the first stop
+	StartTimeMeaning string `json:"start_time_meaning" binding:"omitempty,oneof=depart_origin arrive_first_stop"`
+}
+
+// weightsNormalizedKey is the context key under which convertTripRequest
+// records weights it scaled, for the response metadata
+const weightsNormalizedKey = "weights_normalized"
+
+// WeightsNormalization describes preference weights that were scaled to sum to 1
+type WeightsNormalization struct {
+	Requested map[string]float64 `json:"requested"`
+	Note      string             `json:"note"`
+}
+
+// AvoidZoneRequest is a circular area to keep parking out of
+type AvoidZoneRequest struct {
+	Lat      float64 `json:"lat" binding:"min=-90,max=90"`
+	Lng      float64 `json:"lng" binding:"min=-180,max=180"`
+	RadiusKm float64 `json:"radius_km" binding:"gt=0,max=5"`
 }
 
 // StopRequest represents a stop in the request
 type StopRequest struct {
 	ID              string  `json:"id"`
-	Address         string  `json:"address" binding:"required"`
+	Address         string  `json:"address"` // required unless lat and lng are given
 	Lat             float64 `json:"lat"`
 	Lng             float64 `json:"lng"`
 	DurationMinutes int     `json:"duration_minutes" binding:"required,min=1"`
+
+	// FixedArrival is an RFC3339 time the stop must be reached at exactly, such as an appointment
+	FixedArrival string `json:"fixed_arrival"`
+
+	// LatestDeparture is an RFC3339 time the visit must end by, such as closing time
+	LatestDeparture string `json:"latest_departure"`
+
+	// Optional lets the planner skip the stop ("if time permits")
+	Optional bool `json:"optional"`
+
+	// FreeParking marks a stop with its own parking, such as home, so no meter is chosen
+	FreeParking bool `json:"free_parking"`
+
+	// Note and Tags are echoed back on the stop in each plan, for display
+	Note string            `json:"note" binding:"max=500"`
+	Tags map[string]string `json:"tags" binding:"max=20"`
+}
+
+// OriginRequest represents a trip starting point given by address and/or coordinates
+type OriginRequest struct {
+	Address string  `json:"address"`
+	Lat     float64 `json:"lat"`
+	Lng     float64 `json:"lng"`
 }
 
 // PreferencesRequest represents optimization preferences
 type PreferencesRequest struct {
 	CostWeight float64 `json:"cost_weight" binding:"min=0,max=1"`
 	TimeWeight float64 `json:"time_weight" binding:"min=0,max=1"`
+
+	// MaxWalkingMinutes is the longest walk from a meter to its stop
+	MaxWalkingMinutes int `json:"max_walking_minutes" binding:"min=0,max=60"`
+
+	// MaxTotalWalkingMinutes caps the walking summed across the trip
+	MaxTotalWalkingMinutes int `json:"max_total_walking_minutes" binding:"min=0,max=600"`
+
+	// Which weights the request gave, so that giving neither can mean the
+	// defaults while giving only one is an error
+	costWeightGiven bool
+	timeWeightGiven bool
+}
+
+// UnmarshalJSON decodes the preferences, noting which weights were given
+func (p *PreferencesRequest) UnmarshalJSON(data []byte) error {
+	type plain PreferencesRequest
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	given := func(name string) bool {
+		raw, ok := fields[name]
+		return ok && string(raw) != "null"
+	}
+	p.costWeightGiven = given("cost_weight")
+	p.timeWeightGiven = given("time_weight")
+	return nil
 }
 
 // TripPlanResponse represents the HTTP response
 type TripPlanResponse struct {
-	Plans    []*domain.TripPlan     `json:"plans"`
+	Plans []*domain.TripPlan `json:"plans"`
+
+	// Recommended names the plan the server suggests for the request's preferences
+	Recommended *Recommendation `json:"recommended,omitempty"`
+
 	Metadata map[string]interface{} `json:"metadata"`
 }
 
@@ -60,7 +320,133 @@ type ErrorResponse struct {
 
 // PlanTrip handles POST /api/v1/trips/plan
 func (h *TripHandler) PlanTrip(c *gin.Context) {
-	var req TripPlanRequest
+	req, ok := h.bindPlanRequest(c)
+	if !ok {
+		return
+	}
+	// Encoded before conversion, which may rewrite the request
+	token, err := EncodePlanToken(req)
+	if err != nil {
+		fmt.Printf("[DEBUG] Failed to encode plan token: %v\n", err)
+	}
+	domainReq, ok := h.convertTripRequest(c, req)
+	if !ok {
+		return
+	}
+
+	// Serve identical recent requests from the cache, and share the work of
+	// identical ones in progress, except plans that spread load, which are
+	// drawn afresh each time
+	var cacheKey string
+	if (h.planCache != nil || h.planFlights != nil) && !domainReq.SpreadLoad {
+		var err error
+		cacheKey, err = planCacheKey(domainReq)
+		if err != nil {
+			fmt.Printf("[DEBUG] Failed to compute plan cache key: %v\n", err)
+		}
+	}
+	if h.planCache != nil && cacheKey != "" {
+		if plans, ok := h.planCache.get(cacheKey); ok {
+			response := h.planResponse(c, plans, domainReq)
+			response.Metadata["cached"] = true
+			if token != "" {
+				response.Metadata["plan_token"] = token
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+	}
+
+	plans, err := h.planShared(c, cacheKey, domainReq)
+	if errors.Is(err, errPlannerBusy) {
+		writePlannerBusy(c)
+		return
+	}
+	if err != nil {
+		writePlanningError(c, err)
+		return
+	}
+
+	if len(plans) == 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "no_routes_found",
+			Message: "No valid routes could be found for the given stops",
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	response := h.planResponse(c, plans, domainReq)
+	if token != "" {
+		response.Metadata["plan_token"] = token
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// writePlanningError writes the response for a failed trip plan, reporting
+// infeasible requests as 422s and anything else as a planning failure
+func writePlanningError(c *gin.Context, err error) {
+	if errors.Is(err, maps.ErrRateLimited) {
+		geocoderRateLimited(c, err)
+		return
+	}
+	response := planningErrorResponse(err)
+	c.JSON(response.Code, response)
+}
+
+// planningErrorResponse describes why a trip couldn't be planned
+func planningErrorResponse(err error) ErrorResponse {
+	switch {
+	case errors.Is(err, service.ErrFixedArrivalInfeasible):
+		return ErrorResponse{Error: "fixed_arrival_infeasible", Message: err.Error(), Code: http.StatusUnprocessableEntity}
+	case errors.Is(err, service.ErrOutsideCoverage):
+		return ErrorResponse{Error: "outside_coverage", Message: err.Error(), Code: http.StatusUnprocessableEntity}
+	case errors.Is(err, service.ErrParkingInAvoidZone):
+		return ErrorResponse{Error: "parking_in_avoid_zone", Message: err.Error(), Code: http.StatusUnprocessableEntity}
+	case errors.Is(err, service.ErrWalkingLimitExceeded):
+		return ErrorResponse{Error: "walking_limit_exceeded", Message: err.Error(), Code: http.StatusUnprocessableEntity}
+	case errors.Is(err, service.ErrTravelModeUnsupported):
+		return ErrorResponse{Error: "travel_mode_unsupported", Message: err.Error(), Code: http.StatusUnprocessableEntity}
+	case errors.Is(err, service.ErrDuplicateStopID):
+		return ErrorResponse{Error: "duplicate_stop_id", Message: err.Error(), Code: http.StatusBadRequest}
+	case errors.Is(err, service.ErrInvalidTimezone):
+		return ErrorResponse{Error: "invalid_timezone", Message: err.Error(), Code: http.StatusBadRequest}
+	case errors.Is(err, maps.ErrRateLimited):
+		return ErrorResponse{Error: "geocoder_rate_limited", Message: err.Error(), Code: http.StatusServiceUnavailable}
+	}
+	return ErrorResponse{Error: "planning_failed", Message: err.Error(), Code: http.StatusInternalServerError}
+}
+
+// PlanWindowRequest asks for the cheapest start time between two bounds. The
+// trip fields are the same as a plan request; start_time is ignored.
+type PlanWindowRequest struct {
+	TripPlanRequest
+
+	EarliestStart   string `json:"earliest_start" binding:"required"` // RFC3339 format
+	LatestStart     string `json:"latest_start" binding:"required"`   // RFC3339 format
+	IntervalMinutes int    `json:"interval_minutes" binding:"omitempty,min=5"`
+}
+
+// PlanWindowResponse is the cheapest start time in the window and its plan
+type PlanWindowResponse struct {
+	StartTime time.Time             `json:"start_time"`
+	Plan      *domain.TripPlan      `json:"plan"`
+	Starts    []service.WindowStart `json:"starts"`
+}
+
+// PlanWindow handles POST /api/v1/trips/plan/window
+func (h *TripHandler) PlanWindow(c *gin.Context) {
+	planner, ok := h.routingService.(service.WindowPlanner)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, ErrorResponse{
+			Error:   "not_supported",
+			Message: "the routing service does not plan across start windows",
+			Code:    http.StatusNotImplemented,
+		})
+		return
+	}
+
+	var req PlanWindowRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
 			Error:   "invalid_request",
@@ -70,16 +456,318 @@ func (h *TripHandler) PlanTrip(c *gin.Context) {
 		return
 	}
 
-	// Validate preferences weights sum to approximately 1
-	if req.Preferences != nil {
+	req.StartTime = req.EarliestStart
+	domainReq, ok := h.convertTripRequest(c, &req.TripPlanRequest)
+	if !ok {
+		return
+	}
+
+	latest, err := time.Parse(time.RFC3339, req.LatestStart)
+	if err != nil || latest.Before(domainReq.StartTime) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_window",
+			Message: "latest_start must be an RFC3339 time no earlier than earliest_start",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	interval := service.DefaultWindowInterval
+	if req.IntervalMinutes > 0 {
+		interval = time.Duration(req.IntervalMinutes) * time.Minute
+	}
+	if starts := int(latest.Sub(domainReq.StartTime)/interval) + 1; starts > service.MaxWindowStarts {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_window",
+			Message: fmt.Sprintf("the window covers %d start times; widen interval_minutes or narrow the window to at most %d", starts, service.MaxWindowStarts),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	release, ok := h.acquirePlanSlot(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	window, err := planner.PlanTripWindow(domainReq, domainReq.StartTime, latest, interval)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "planning_failed",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	loc := requestLocation(domainReq)
+	window.Plan.In(loc)
+	for i := range window.Starts {
+		window.Starts[i].StartTime = window.Starts[i].StartTime.In(loc)
+	}
+
+	c.JSON(http.StatusOK, PlanWindowResponse{
+		StartTime: window.StartTime.In(loc),
+		Plan:      window.Plan,
+		Starts:    window.Starts,
+	})
+}
+
+// CandidateSummary describes one evaluated route candidate
+type CandidateSummary struct {
+	Order        []string `json:"order"`
+	Meters       []string `json:"meters"`
+	TotalCost    float64  `json:"total_cost"`
+	TotalTime    int      `json:"total_time_minutes"`
+	TransitTime  int      `json:"transit_time_minutes"`
+	HybridScore  float64  `json:"hybrid_score"`
+	DroppedStops []string `json:"dropped_stops,omitempty"`
+}
+
+// CandidatesResponse lists every candidate the plan selection chose from
+type CandidatesResponse struct {
+	Count      int                `json:"count"`
+	Candidates []CandidateSummary `json:"candidates"`
+}
+
+// DebugCandidates handles POST /api/v1/debug/candidates
+func (h *TripHandler) DebugCandidates(c *gin.Context) {
+	evaluator, ok := h.routingService.(service.CandidateEvaluator)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, ErrorResponse{
+			Error:   "not_supported",
+			Message: "the routing service does not expose its candidates",
+			Code:    http.StatusNotImplemented,
+		})
+		return
+	}
+
+	domainReq, ok := h.bindTripRequest(c)
+	if !ok {
+		return
+	}
+
+	release, ok := h.acquirePlanSlot(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	candidates, err := evaluator.EvaluateCandidates(domainReq)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error:   "planning_failed",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	response := CandidatesResponse{
+		Count:      len(candidates),
+		Candidates: make([]CandidateSummary, len(candidates)),
+	}
+	for i, candidate := range candidates {
+		summary := CandidateSummary{
+			TotalCost:    candidate.TotalCost,
+			TotalTime:    candidate.TotalTime,
+			TransitTime:  candidate.TransitTime(),
+			HybridScore:  candidate.HybridScore,
+			DroppedStops: candidate.DroppedStops,
+		}
+		for _, stop := range candidate.Stops {
+			summary.Order = append(summary.Order, stop.ID)
+		}
+		for _, segment := range candidate.Segments {
+			meterID := "" // stops with their own parking use no meter
+			if segment.ParkingMeter != nil {
+				meterID = segment.ParkingMeter.MeterID
+			}
+			summary.Meters = append(summary.Meters, meterID)
+		}
+		response.Candidates[i] = summary
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// planShared plans the trip, sharing the computation with identical requests
+// in progress when in-flight dedup is on and the request has a key. The plans
+// are shown in the request's timezone, kept as itineraries and cached.
+func (h *TripHandler) planShared(c *gin.Context, key string, request *domain.TripRequest) ([]*domain.TripPlan, error) {
+	ctx := c.Request.Context()
+	plan := func() ([]*domain.TripPlan, error) {
+		if h.planLimiter != nil {
+			if !h.planLimiter.acquire(ctx) {
+				return nil, errPlannerBusy
+			}
+			defer h.planLimiter.release()
+		}
+
+		plans, err := h.routingService.PlanTrip(request)
+		if err != nil || len(plans) == 0 {
+			return plans, err
+		}
+
+		// Show times in the request's timezone; this happens before caching,
+		// as cached and shared plans are seen by other requests
+		loc := requestLocation(request)
+		for _, plan := range plans {
+			plan.In(loc)
+		}
+
+		// Keep the plans so they can be fetched as itineraries by ID
+		if err := h.planStore.add(plans); err != nil {
+			return nil, err
+		}
+
+		if h.planCache != nil && key != "" {
+			h.planCache.set(key, plans)
+		}
+		return plans, nil
+	}
+
+	if h.planFlights == nil || key == "" {
+		return plan()
+	}
+	return h.planFlights.do(key, plan)
+}
+
+// acquirePlanSlot waits for a free planning slot when concurrency is limited,
+// returning the function that frees it. If the queue is full it writes a 503
+// response and returns false.
+func (h *TripHandler) acquirePlanSlot(c *gin.Context) (func(), bool) {
+	if h.planLimiter == nil {
+		return func() {}, true
+	}
+
+	if !h.planLimiter.acquire(c.Request.Context()) {
+		writePlannerBusy(c)
+		return nil, false
+	}
+	return h.planLimiter.release, true
+}
+
+// writePlannerBusy writes the 503 response for a request turned away because
+// too many plans are in progress
+func writePlannerBusy(c *gin.Context) {
+	c.Header("Retry-After", strconv.Itoa(int(planRetryAfter.Seconds())))
+	c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+		Error:   "planner_busy",
+		Message: "too many trip plans are in progress, please retry shortly",
+		Code:    http.StatusServiceUnavailable,
+	})
+}
+
+// bindTripRequest parses and validates a trip planning request body, writing an
+// error response and returning false if it is invalid
+func (h *TripHandler) bindTripRequest(c *gin.Context) (*domain.TripRequest, bool) {
+	var req TripPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return nil, false
+	}
+
+	return h.convertTripRequest(c, &req)
+}
+
+// bindPlanRequest binds a plan request from the body, or from the plan token
+// in the plan query parameter when one is given, writing an error response
+// and returning false if it can't
+func (h *TripHandler) bindPlanRequest(c *gin.Context) (*TripPlanRequest, bool) {
+	token := c.Query("plan")
+	if token == "" {
+		var req TripPlanRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return nil, false
+		}
+		return &req, true
+	}
+
+	req, err := DecodePlanToken(token)
+	if err == nil {
+		err = binding.Validator.ValidateStruct(req)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_plan_token",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return nil, false
+	}
+	return req, true
+}
+
+// convertTripRequest validates a bound trip planning request and converts it to
+// a domain request, writing an error response and returning false if it is invalid
+func (h *TripHandler) convertTripRequest(c *gin.Context, req *TripPlanRequest) (*domain.TripRequest, bool) {
+	if h.maxStops > 0 && len(req.Stops) > h.maxStops {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "too_many_stops",
+			Message: fmt.Sprintf("a trip can have at most %d stops, got %d", h.maxStops, len(req.Stops)),
+			Code:    http.StatusBadRequest,
+		})
+		return nil, false
+	}
+
+	// Clean up addresses before they reach the geocoder or the logs
+	if err := h.sanitizeAddresses(req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_address",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return nil, false
+	}
+
+	// Weights come as a pair: give both, or neither to use the defaults
+	if req.Preferences != nil && req.Preferences.costWeightGiven != req.Preferences.timeWeightGiven {
+		missing, given := "time_weight", "cost_weight"
+		if !req.Preferences.costWeightGiven {
+			missing, given = given, missing
+		}
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_preferences",
+			Message: fmt.Sprintf("preferences gives %s without %s; give both weights, or neither to use the defaults of 0.5 each", given, missing),
+			Code:    http.StatusBadRequest,
+		})
+		return nil, false
+	}
+
+	// Validate preferences weights sum to approximately 1, scaling them to
+	// sum to exactly 1 instead when the client asked for normalization
+	if req.Preferences != nil && req.Preferences.costWeightGiven {
 		totalWeight := req.Preferences.CostWeight + req.Preferences.TimeWeight
-		if totalWeight < 0.9 || totalWeight > 1.1 {
+		if req.NormalizeWeights && totalWeight > 0 {
+			if totalWeight != 1 {
+				c.Set(weightsNormalizedKey, WeightsNormalization{
+					Requested: map[string]float64{
+						"cost": req.Preferences.CostWeight,
+						"time": req.Preferences.TimeWeight,
+					},
+					Note: fmt.Sprintf("cost_weight and time_weight summed to %.2f and were scaled to sum to 1", totalWeight),
+				})
+				req.Preferences.CostWeight /= totalWeight
+				req.Preferences.TimeWeight /= totalWeight
+			}
+		} else if totalWeight < 0.9 || totalWeight > 1.1 {
 			c.JSON(http.StatusBadRequest, ErrorResponse{
 				Error:   "invalid_preferences",
 				Message: "cost_weight and time_weight must sum to approximately 1.0",
 				Code:    http.StatusBadRequest,
 			})
-			return
+			return nil, false
 		}
 	}
 
@@ -91,13 +779,52 @@ func (h *TripHandler) PlanTrip(c *gin.Context) {
 			Message: "start_time must be in RFC3339 format (e.g., '2024-01-15T14:30:00-08:00')",
 			Code:    http.StatusBadRequest,
 		})
-		return
+		return nil, false
+	}
+
+	if err := maps.ValidateAvoid(req.Avoid); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_avoid",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return nil, false
+	}
+
+	if !service.SupportedLocale(req.Locale) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_locale",
+			Message: fmt.Sprintf("locale %q is not supported", req.Locale),
+			Code:    http.StatusBadRequest,
+		})
+		return nil, false
+	}
+
+	// Resolve the separate origin, if any
+	origin, err := resolveOriginRequest(req.Origin, req.CurrentLocation)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_origin",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return nil, false
 	}
 
 	// Set default timezone if not provided
 	timezone := req.Timezone
 	if timezone == "" {
-		timezone = "America/Vancouver"
+		timezone = DefaultTimezone
+	}
+	// Validated the way pricing loads it, so Pacific timezones are accepted
+	// even without tzdata
+	if _, err := service.TimezoneAt(timezone, startTime); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_timezone",
+			Message: fmt.Sprintf("timezone %q is not a known IANA timezone", timezone),
+			Code:    http.StatusBadRequest,
+		})
+		return nil, false
 	}
 
 	// Convert to domain request
@@ -109,66 +836,227 @@ func (h *TripHandler) PlanTrip(c *gin.Context) {
 			CostWeight: 0.5, // Default equal weight
 			TimeWeight: 0.5,
 		},
+		Origin:             origin,
+		TravelTimeVariance: req.TravelTimeVariance,
+		Strategy:           req.Strategy,
+		AllowOverstay:      req.AllowOverstay,
+		OverstayPenalty:    req.OverstayPenalty,
+		MaxDetourRatio:     req.MaxDetourRatio,
+		MaxMapCalls:        req.MaxMapCalls,
+		Locale:             req.Locale,
+		AllowSplitVisit:    req.AllowSplitVisit,
+
+		ParkingSearchRadiusKm: req.ParkingSearchRadiusKm,
+		CardMeterBonus:        req.CardMeterBonus,
+		PreferCovered:         req.PreferCovered,
+		CoveredBonus:          req.CoveredBonus,
+		Avoid:                 req.Avoid,
+		MaxPerStopCost:        req.MaxPerStopCost,
+		ReentryPenalty:        req.ReentryPenalty,
+		MinParkingMinutes:     req.MinParkingMinutes,
+		SpreadLoad:            req.SpreadLoad,
+		IncludeWalkingRoutes:  req.IncludeWalkingRoutes,
+		StartTimeMeaning:      req.StartTimeMeaning,
+		TravelMode:            req.TravelMode,
+	}
+
+	for _, zone := range req.AvoidZones {
+		domainReq.AvoidZones = append(domainReq.AvoidZones, domain.Circle{
+			Lat:      zone.Lat,
+			Lng:      zone.Lng,
+			RadiusKm: zone.RadiusKm,
+		})
 	}
 
 	// Set preferences if provided
 	if req.Preferences != nil {
-		domainReq.Preferences.CostWeight = req.Preferences.CostWeight
-		domainReq.Preferences.TimeWeight = req.Preferences.TimeWeight
+		if req.Preferences.costWeightGiven {
+			domainReq.Preferences.CostWeight = req.Preferences.CostWeight
+			domainReq.Preferences.TimeWeight = req.Preferences.TimeWeight
+		}
+		domainReq.Preferences.MaxWalkingMinutes = req.Preferences.MaxWalkingMinutes
+		domainReq.Preferences.MaxTotalWalkingMinutes = req.Preferences.MaxTotalWalkingMinutes
+	}
+
+	// Stop IDs key parking options and results, so they must be unique
+	usedIDs := make(map[string]bool, len(req.Stops)+1)
+	if origin != nil {
+		usedIDs[service.OriginStopID] = true
+	}
+	for i, stop := range req.Stops {
+		if stop.ID == "" {
+			continue
+		}
+		if usedIDs[stop.ID] {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "duplicate_stop_id",
+				Message: fmt.Sprintf("stop %d has id %q, which is already in use; stop ids must be unique", i+1, stop.ID),
+				Code:    http.StatusBadRequest,
+			})
+			return nil, false
+		}
+		usedIDs[stop.ID] = true
 	}
 
 	// Convert stops
 	for i, stop := range req.Stops {
 		domainReq.Stops[i] = domain.Stop{
-			ID:       stop.ID,
-			Address:  stop.Address,
-			Lat:      stop.Lat,
-			Lng:      stop.Lng,
-			Duration: stop.DurationMinutes,
+			ID:          stop.ID,
+			Address:     stop.Address,
+			Lat:         stop.Lat,
+			Lng:         stop.Lng,
+			Duration:    stop.DurationMinutes,
+			Optional:    stop.Optional,
+			FreeParking: stop.FreeParking,
+			Note:        stop.Note,
+			Tags:        stop.Tags,
 		}
 
-		// Generate ID if not provided
-		if domainReq.Stops[i].ID == "" {
-			domainReq.Stops[i].ID = generateStopID(i)
+		if stop.FixedArrival != "" {
+			fixedArrival, err := time.Parse(time.RFC3339, stop.FixedArrival)
+			if err != nil || fixedArrival.Before(startTime) {
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Error:   "invalid_fixed_arrival",
+					Message: fmt.Sprintf("fixed_arrival for stop %d must be an RFC3339 time no earlier than start_time", i+1),
+					Code:    http.StatusBadRequest,
+				})
+				return nil, false
+			}
+			domainReq.Stops[i].FixedArrival = fixedArrival
 		}
-	}
 
-	// Plan the trip
-	plans, err := h.routingService.PlanTrip(domainReq)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Error:   "planning_failed",
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError,
-		})
-		return
-	}
+		if stop.LatestDeparture != "" {
+			latestDeparture, err := time.Parse(time.RFC3339, stop.LatestDeparture)
+			if err != nil || latestDeparture.Before(startTime) || latestDeparture.Before(domainReq.Stops[i].FixedArrival) {
+				c.JSON(http.StatusBadRequest, ErrorResponse{
+					Error:   "invalid_latest_departure",
+					Message: fmt.Sprintf("latest_departure for stop %d must be an RFC3339 time no earlier than start_time or its fixed_arrival", i+1),
+					Code:    http.StatusBadRequest,
+				})
+				return nil, false
+			}
+			domainReq.Stops[i].LatestDeparture = latestDeparture
+		}
 
-	if len(plans) == 0 {
-		c.JSON(http.StatusNotFound, ErrorResponse{
-			Error:   "no_routes_found",
-			Message: "No valid routes could be found for the given stops",
-			Code:    http.StatusNotFound,
-		})
-		return
+		// Generate ID if not provided, skipping any a client already chose
+		if domainReq.Stops[i].ID == "" {
+			id := generateStopID(i)
+			for n := len(req.Stops); usedIDs[id]; n++ {
+				id = generateStopID(n)
+			}
+			domainReq.Stops[i].ID = id
+			usedIDs[id] = true
+		}
 	}
 
-	// Build response
+	return domainReq, true
+}
+
+// planResponse wraps plans with the request's response metadata
+func (h *TripHandler) planResponse(c *gin.Context, plans []*domain.TripPlan, domainReq *domain.TripRequest) TripPlanResponse {
+	loc := requestLocation(domainReq)
+	now := time.Now()
 	response := TripPlanResponse{
-		Plans: plans,
+		Plans:       plans,
+		Recommended: recommendPlan(plans, domainReq.Preferences),
 		Metadata: map[string]interface{}{
-			"request_id":   c.GetHeader("X-Request-ID"),
-			"generated_at": time.Now().UTC(),
-			"stops_count":  len(req.Stops),
-			"timezone":     timezone,
+			"request_id":       c.GetHeader("X-Request-ID"),
+			"generated_at":     now.In(loc),
+			"generated_at_utc": now.UTC(),
+			"stops_count":      len(domainReq.Stops),
+			"timezone":         domainReq.Timezone,
 			"optimization_weights": map[string]float64{
 				"cost": domainReq.Preferences.CostWeight,
 				"time": domainReq.Preferences.TimeWeight,
 			},
+			"summary": summarizePlans(plans),
 		},
 	}
+	if normalization, ok := c.Get(weightsNormalizedKey); ok {
+		response.Metadata["weights_normalized"] = normalization
+	}
+	if len(h.dataSources) > 0 {
+		response.Metadata["data_sources"] = h.dataSources
+	}
 
-	c.JSON(http.StatusOK, response)
+	return response
+}
+
+// requestLocation returns the request's timezone, in which user-facing times are
+// rendered. Without tzdata, Pacific timezones are the fixed offset in effect at
+// the start. Timezones are validated when the request is bound, so an unknown
+// one only reaches here from callers that skipped that and falls back to UTC.
+func requestLocation(request *domain.TripRequest) *time.Location {
+	loc, err := service.TimezoneAt(request.Timezone, request.StartTime)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// PlanSummary aggregates cost and time across the returned plans
+type PlanSummary struct {
+	CostRange CostRange `json:"cost_range"`
+	TimeRange TimeRange `json:"time_range"`
+
+	// CostSpread is how much more the fastest plan costs than the cheapest
+	CostSpread float64 `json:"cost_spread"`
+	// TimeSpread is how many minutes longer the cheapest plan takes than the fastest
+	TimeSpread int `json:"time_spread_minutes"`
+}
+
+// CostRange is the lowest, highest and mean total cost across plans
+type CostRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Avg float64 `json:"avg"`
+}
+
+// TimeRange is the lowest, highest and mean total time, in minutes, across plans
+type TimeRange struct {
+	Min int     `json:"min"`
+	Max int     `json:"max"`
+	Avg float64 `json:"avg"`
+}
+
+// summarizePlans computes the summary for a non-empty set of plans
+func summarizePlans(plans []*domain.TripPlan) PlanSummary {
+	summary := PlanSummary{
+		CostRange: CostRange{Min: plans[0].TotalCost, Max: plans[0].TotalCost},
+		TimeRange: TimeRange{Min: plans[0].TotalTime, Max: plans[0].TotalTime},
+	}
+
+	totalCost := 0.0
+	totalTime := 0
+	var cheapest, fastest *domain.TripPlan
+	for _, plan := range plans {
+		summary.CostRange.Min = math.Min(summary.CostRange.Min, plan.TotalCost)
+		summary.CostRange.Max = math.Max(summary.CostRange.Max, plan.TotalCost)
+		if plan.TotalTime < summary.TimeRange.Min {
+			summary.TimeRange.Min = plan.TotalTime
+		}
+		if plan.TotalTime > summary.TimeRange.Max {
+			summary.TimeRange.Max = plan.TotalTime
+		}
+		totalCost += plan.TotalCost
+		totalTime += plan.TotalTime
+
+		switch plan.Type {
+		case "cheapest":
+			cheapest = plan
+		case "fastest":
+			fastest = plan
+		}
+	}
+	summary.CostRange.Avg = totalCost / float64(len(plans))
+	summary.TimeRange.Avg = float64(totalTime) / float64(len(plans))
+
+	if cheapest != nil && fastest != nil {
+		summary.CostSpread = fastest.TotalCost - cheapest.TotalCost
+		summary.TimeSpread = cheapest.TotalTime - fastest.TotalTime
+	}
+
+	return summary
 }
 
 // HealthCheck handles GET /health
@@ -177,31 +1065,181 @@ func (h *TripHandler) HealthCheck(c *gin.Context) {
 		"status":    "healthy",
 		"timestamp": time.Now().UTC(),
 		"service":   "vancouver-trip-planner",
+
+		// The Earth model behind straight-line distances and walking times
+		"distance_model": h.earth.Model.String(),
 	})
 }
 
-// GetParkingInfo handles GET /api/v1/parking/info
-func (h *TripHandler) GetParkingInfo(c *gin.Context) {
-	lat := c.Query("lat")
-	lng := c.Query("lng")
+// GeocodeResponse is the normalized form of a validated address
+type GeocodeResponse struct {
+	Query            string  `json:"query"`
+	FormattedAddress string  `json:"formatted_address"`
+	Lat              float64 `json:"lat"`
+	Lng              float64 `json:"lng"`
+	Confidence       float64 `json:"confidence"`
+}
+
+// Geocode handles GET /api/v1/geocode
+func (h *TripHandler) Geocode(c *gin.Context) {
+	if h.geocoder == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+			Error:   "geocoding_unavailable",
+			Message: "address validation is not configured",
+			Code:    http.StatusServiceUnavailable,
+		})
+		return
+	}
 
-	if lat == "" || lng == "" {
+	address, err := sanitizeAddress(c.Query("address"), h.maxAddressLength)
+	if err == nil && address == "" {
+		err = fmt.Errorf("address query parameter is required")
+	}
+	if err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "missing_coordinates",
-			Message: "lat and lng query parameters are required",
+			Error:   "invalid_address",
+			Message: err.Error(),
 			Code:    http.StatusBadRequest,
 		})
 		return
 	}
 
-	// This would be implemented to return parking information
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Parking info endpoint - to be implemented",
-		"lat":     lat,
-		"lng":     lng,
+	result, err := h.geocoder.GeocodeDetails(address)
+	if errors.Is(err, maps.ErrRateLimited) {
+		geocoderRateLimited(c, err)
+		return
+	}
+	if errors.Is(err, maps.ErrNoResults) {
+		c.JSON(http.StatusNotFound, ErrorResponse{
+			Error:   "address_not_found",
+			Message: fmt.Sprintf("no location found for address %q", address),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, ErrorResponse{
+			Error:   "geocoding_failed",
+			Message: err.Error(),
+			Code:    http.StatusBadGateway,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, GeocodeResponse{
+		Query:            address,
+		FormattedAddress: result.FormattedAddress,
+		Lat:              result.Lat,
+		Lng:              result.Lng,
+		Confidence:       result.Confidence,
 	})
 }
 
+// geocoderRetryAfter is the wait suggested to clients when the geocoder is over quota
+const geocoderRetryAfter = 30 * time.Second
+
+// geocoderRateLimited writes a 503 response for a geocoder that stayed over its
+// quota through every retry
+func geocoderRateLimited(c *gin.Context, err error) {
+	c.Header("Retry-After", strconv.Itoa(int(geocoderRetryAfter.Seconds())))
+	c.JSON(http.StatusServiceUnavailable, ErrorResponse{
+		Error:   "geocoder_rate_limited",
+		Message: err.Error(),
+		Code:    http.StatusServiceUnavailable,
+	})
+}
+
+// sanitizeAddresses cleans every address in the request in place
+func (h *TripHandler) sanitizeAddresses(req *TripPlanRequest) error {
+	for i := range req.Stops {
+		address, err := sanitizeAddress(req.Stops[i].Address, h.maxAddressLength)
+		if err != nil {
+			return fmt.Errorf("stop %d: %w", i+1, err)
+		}
+		if address == "" && req.Stops[i].Lat == 0 && req.Stops[i].Lng == 0 {
+			return fmt.Errorf("stop %d: address or coordinates are required", i+1)
+		}
+		req.Stops[i].Address = address
+	}
+
+	for _, origin := range []*OriginRequest{req.Origin, req.CurrentLocation} {
+		if origin == nil {
+			continue
+		}
+		address, err := sanitizeAddress(origin.Address, h.maxAddressLength)
+		if err != nil {
+			return fmt.Errorf("origin: %w", err)
+		}
+		origin.Address = address
+	}
+
+	return nil
+}
+
+// sanitizeAddress replaces control characters (including newlines) with spaces,
+// collapses runs of whitespace and trims the result, rejecting it if it is
+// longer than maxLength characters
+func sanitizeAddress(address string, maxLength int) (string, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, address)
+	cleaned = strings.Join(strings.Fields(cleaned), " ")
+
+	if maxLength > 0 && utf8.RuneCountInString(cleaned) > maxLength {
+		return "", fmt.Errorf("address must be at most %d characters", maxLength)
+	}
+
+	return cleaned, nil
+}
+
+// resolveOriginRequest validates the origin fields and converts them to the domain origin
+func resolveOriginRequest(origin, currentLocation *OriginRequest) (*domain.Origin, error) {
+	if origin != nil && currentLocation != nil {
+		return nil, fmt.Errorf("origin and current_location cannot both be provided")
+	}
+
+	if currentLocation != nil {
+		if currentLocation.Lat == 0 && currentLocation.Lng == 0 {
+			return nil, fmt.Errorf("current_location requires lat and lng")
+		}
+		origin = currentLocation
+	}
+
+	if origin == nil {
+		return nil, nil
+	}
+
+	hasCoordinates := origin.Lat != 0 || origin.Lng != 0
+	if !hasCoordinates && origin.Address == "" {
+		return nil, fmt.Errorf("origin requires an address or lat/lng coordinates")
+	}
+	if hasCoordinates {
+		if err := validateCoordinates(origin.Lat, origin.Lng); err != nil {
+			return nil, err
+		}
+	}
+
+	return &domain.Origin{
+		Address: origin.Address,
+		Lat:     origin.Lat,
+		Lng:     origin.Lng,
+	}, nil
+}
+
+// validateCoordinates checks that a latitude/longitude pair is on the globe
+func validateCoordinates(lat, lng float64) error {
+	if lat < -90 || lat > 90 {
+		return fmt.Errorf("latitude %.6f is out of range [-90, 90]", lat)
+	}
+	if lng < -180 || lng > 180 {
+		return fmt.Errorf("longitude %.6f is out of range [-180, 180]", lng)
+	}
+	return nil
+}
+
 // generateStopID creates a unique ID for a stop
 func generateStopID(index int) string {
 	return fmt.Sprintf("stop_%d", index+1)
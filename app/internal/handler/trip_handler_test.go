@@ -0,0 +1,1120 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/repository"
+	"vancouver-trip-planner/internal/service"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// fakeParkingRepository returns the configured meters that fall within the radius
+type fakeParkingRepository struct {
+	meters []*domain.ParkingMeter
+	radii  []float64 // the radius of each lookup
+}
+
+func (r *fakeParkingRepository) GetParkingMetersNear(lat, lng, radiusKm float64) ([]*domain.ParkingMeter, error) {
+	r.radii = append(r.radii, radiusKm)
+	var nearby []*domain.ParkingMeter
+	for _, meter := range r.meters {
+		distance := maps.CalculateDistance(
+			&domain.Location{Lat: lat, Lng: lng},
+			&domain.Location{Lat: meter.Lat, Lng: meter.Lng},
+		)
+		if distance <= radiusKm {
+			nearby = append(nearby, meter)
+		}
+	}
+	return nearby, nil
+}
+
+func (r *fakeParkingRepository) GetAllParkingMeters() ([]*domain.ParkingMeter, error) {
+	return r.meters, nil
+}
+
+func (r *fakeParkingRepository) GetParkingMeter(meterID string) (*domain.ParkingMeter, error) {
+	for _, meter := range r.meters {
+		if meter.MeterID == meterID {
+			return meter, nil
+		}
+	}
+	return nil, repository.ErrMeterNotFound
+}
+
+// fakeMapsService returns a fixed travel time and geocodes from a lookup table
+type fakeMapsService struct {
+	travelMinutes int
+	locations     map[string]*domain.Location
+	travelCalls   int
+	geocodeCalls  int
+
+	// geocodeErr, when set, fails every geocode
+	geocodeErr error
+}
+
+func (m *fakeMapsService) GetTravelTime(from, to *domain.Location, departureTime time.Time) (int, error) {
+	m.travelCalls++
+	return m.travelMinutes, nil
+}
+
+func (m *fakeMapsService) GetTravelTimeMatrix(locations []*domain.Location, departureTime time.Time) ([][]int, error) {
+	matrix := make([][]int, len(locations))
+	for i := range locations {
+		matrix[i] = make([]int, len(locations))
+		for j := range locations {
+			if i != j {
+				matrix[i][j] = m.travelMinutes
+			}
+		}
+	}
+	return matrix, nil
+}
+
+func (m *fakeMapsService) GeocodeAddress(address string) (*domain.Location, error) {
+	result, err := m.GeocodeDetails(address)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Location{Lat: result.Lat, Lng: result.Lng}, nil
+}
+
+func (m *fakeMapsService) GeocodeDetails(address string) (*maps.GeocodeResult, error) {
+	m.geocodeCalls++
+	if m.geocodeErr != nil {
+		return nil, m.geocodeErr
+	}
+	if location, ok := m.locations[address]; ok {
+		return &maps.GeocodeResult{
+			FormattedAddress: address + ", Vancouver, BC, Canada",
+			Lat:              location.Lat,
+			Lng:              location.Lng,
+			Confidence:       1.0,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w for address: %s", maps.ErrNoResults, address)
+}
+
+// downtownFixture has a meter beside each of two downtown stops
+func downtownFixture() (*fakeParkingRepository, *fakeMapsService) {
+	repo := &fakeParkingRepository{
+		meters: []*domain.ParkingMeter{
+			{MeterID: "ROBSON", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 3.00, TimeLimitMF9A6P: 3},
+			{MeterID: "CANADA_PL", Lat: 49.2889, Lng: -123.1111, RateMF9A6P: 4.00, TimeLimitMF9A6P: 3},
+		},
+	}
+	mapsService := &fakeMapsService{
+		travelMinutes: 10,
+		locations: map[string]*domain.Location{
+			"800 Robson St":   {Lat: 49.2827, Lng: -123.1207},
+			"1055 Canada Pl":  {Lat: 49.2888, Lng: -123.1111},
+			"Vancouver Hotel": {Lat: 49.2838, Lng: -123.1190},
+		},
+	}
+	return repo, mapsService
+}
+
+func newTestRouter(tripHandler *TripHandler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/v1/trips/plan", tripHandler.PlanTrip)
+	router.POST("/api/v1/trips/plan/window", tripHandler.PlanWindow)
+	router.POST("/api/v1/trips/compare_modes", tripHandler.CompareModes)
+	router.GET("/api/v1/trips/:id/itinerary.ics", tripHandler.Itinerary)
+	router.GET("/api/v1/parking/info", tripHandler.GetParkingInfo)
+	router.POST("/api/v1/parking/best", tripHandler.GetBestParking)
+	router.POST("/api/v1/parking/estimate", tripHandler.EstimateParkingCost)
+	router.POST("/api/v1/jobs/plan", tripHandler.SubmitPlanJob)
+	router.GET("/api/v1/jobs/:id", tripHandler.GetPlanJob)
+	router.GET("/api/v1/geocode", tripHandler.Geocode)
+	router.GET("/api/v1/meta", tripHandler.GetMeta)
+	router.POST("/api/v1/debug/candidates", tripHandler.DebugCandidates)
+	router.GET("/health", tripHandler.HealthCheck)
+	return router
+}
+
+func postJSON(router *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func downtownStops() []StopRequest {
+	return []StopRequest{
+		{Address: "800 Robson St", DurationMinutes: 60},
+		{Address: "1055 Canada Pl", DurationMinutes: 45},
+	}
+}
+
+func TestPlanTrip_FromCoordinatesOnlyOrigin(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	for _, field := range []string{"origin", "current_location"} {
+		t.Run(field, func(t *testing.T) {
+			mapsService.geocodeCalls = 0
+			body := map[string]interface{}{
+				"stops":      downtownStops(),
+				"start_time": "2024-01-15T10:00:00-08:00",
+				field:        map[string]float64{"lat": 49.2800, "lng": -123.1150},
+			}
+
+			w := postJSON(router, "/api/v1/trips/plan", body)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			var response TripPlanResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.NotEmpty(t, response.Plans)
+
+			for _, plan := range response.Plans {
+				// Both stops get a parked segment; the origin is only driven from
+				require.Len(t, plan.Route, 2)
+				first := plan.Route[0]
+				require.NotNil(t, first.FromStop)
+				assert.True(t, first.FromStop.IsOrigin)
+				assert.Equal(t, 49.2800, first.FromStop.Lat)
+				assert.Equal(t, 10, first.TravelTime)
+				for _, segment := range plan.Route {
+					assert.False(t, segment.ToStop.IsOrigin)
+					assert.NotNil(t, segment.ParkingMeter)
+				}
+			}
+
+			// Only the two stop addresses are geocoded, never the origin
+			assert.Equal(t, 2, mapsService.geocodeCalls)
+		})
+	}
+}
+
+func TestPlanTrip_StopNotes(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	stops := downtownStops()
+	stops[0].ID = "robson"
+	stops[0].Note = "pick up dry cleaning"
+	stops[1].ID = "canada-place"
+	stops[1].Tags = map[string]string{"colour": "blue", "ticket": "A12"}
+
+	w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+		"stops":      stops,
+		"start_time": "2024-01-15T10:00:00-08:00",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response TripPlanResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotEmpty(t, response.Plans)
+
+	// Whatever order a plan visits them in, each stop keeps its own details
+	for _, plan := range response.Plans {
+		require.Len(t, plan.Route, 2)
+		for _, segment := range plan.Route {
+			switch segment.ToStop.ID {
+			case "robson":
+				assert.Equal(t, "pick up dry cleaning", segment.ToStop.Note)
+				assert.Empty(t, segment.ToStop.Tags)
+			case "canada-place":
+				assert.Empty(t, segment.ToStop.Note)
+				assert.Equal(t, map[string]string{"colour": "blue", "ticket": "A12"}, segment.ToStop.Tags)
+			default:
+				t.Errorf("unexpected stop %q", segment.ToStop.ID)
+			}
+		}
+	}
+}
+
+func TestPlanTrip_InvalidOrigin(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{
+			name: "Latitude out of range",
+			body: map[string]interface{}{"origin": map[string]float64{"lat": 123.0, "lng": -123.1}},
+		},
+		{
+			name: "Empty origin",
+			body: map[string]interface{}{"origin": map[string]interface{}{}},
+		},
+		{
+			name: "Both origin and current location",
+			body: map[string]interface{}{
+				"origin":           map[string]string{"address": "Vancouver Hotel"},
+				"current_location": map[string]float64{"lat": 49.28, "lng": -123.11},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.body["stops"] = downtownStops()
+			tt.body["start_time"] = "2024-01-15T10:00:00-08:00"
+
+			w := postJSON(router, "/api/v1/trips/plan", tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var response ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "invalid_origin", response.Error)
+		})
+	}
+}
+
+func TestPlanTrip_DuplicateStopIDs(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	t.Run("Rejects two stops with the same id", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops": []StopRequest{
+				{ID: "x", Address: "800 Robson St", DurationMinutes: 60},
+				{ID: "x", Address: "1055 Canada Pl", DurationMinutes: 45},
+			},
+			"start_time": "2024-01-15T10:00:00-08:00",
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var response ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "duplicate_stop_id", response.Error)
+		assert.Contains(t, response.Message, `"x"`)
+	})
+
+	t.Run("Generated ids skip ids already chosen", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops": []StopRequest{
+				{Address: "800 Robson St", DurationMinutes: 60},
+				{ID: "stop_1", Address: "1055 Canada Pl", DurationMinutes: 45},
+			},
+			"start_time": "2024-01-15T10:00:00-08:00",
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response TripPlanResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotEmpty(t, response.Plans)
+		ids := make(map[string]string)
+		for _, segment := range response.Plans[0].Route {
+			ids[segment.ToStop.Address] = segment.ToStop.ID
+		}
+		assert.Equal(t, "stop_1", ids["1055 Canada Pl"])
+		assert.Equal(t, "stop_3", ids["800 Robson St"])
+	})
+}
+
+func TestPlanTrip_AddressSanitization(t *testing.T) {
+	t.Run("Over-long address is rejected before geocoding", func(t *testing.T) {
+		repo, mapsService := downtownFixture()
+		router := newTestRouter(NewTripHandler(
+			service.NewRoutingService(repo, mapsService, service.NewPricingService()),
+			WithMaxAddressLength(50),
+		))
+
+		stops := downtownStops()
+		stops[1].Address = strings.Repeat("Canada Place ", 10)
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      stops,
+			"start_time": "2024-01-15T10:00:00-08:00",
+		})
+		require.Equal(t, http.StatusBadRequest, w.Code)
+
+		var response ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "invalid_address", response.Error)
+		assert.Contains(t, response.Message, "50 characters")
+		assert.Equal(t, 0, mapsService.geocodeCalls)
+	})
+
+	t.Run("Newlines are stripped from the address", func(t *testing.T) {
+		repo, mapsService := downtownFixture()
+		router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+		stops := downtownStops()
+		stops[0].Address = "  800 Robson\n\rSt\t"
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      stops,
+			"start_time": "2024-01-15T10:00:00-08:00",
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response TripPlanResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotEmpty(t, response.Plans)
+		for _, segment := range response.Plans[0].Route {
+			assert.NotContains(t, segment.ToStop.Address, "\n")
+		}
+		assert.Equal(t, "800 Robson St", response.Plans[0].Route[0].ToStop.Address)
+	})
+
+	t.Run("Address of only control characters is rejected", func(t *testing.T) {
+		repo, mapsService := downtownFixture()
+		router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+		stops := downtownStops()
+		stops[0].Address = "\n\n\r"
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      stops,
+			"start_time": "2024-01-15T10:00:00-08:00",
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Coordinate-only stop needs no address", func(t *testing.T) {
+		repo, mapsService := downtownFixture()
+		router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+		stops := downtownStops()
+		stops[1] = StopRequest{Lat: 49.2888, Lng: -123.1111, DurationMinutes: 45}
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      stops,
+			"start_time": "2024-01-15T10:00:00-08:00",
+		})
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	})
+}
+
+func TestGeocode(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(
+		service.NewRoutingService(repo, mapsService, service.NewPricingService()),
+		WithGeocoder(mapsService),
+	))
+
+	t.Run("Resolvable address", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/geocode?address="+url.QueryEscape("800 Robson St"), nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			var response GeocodeResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "800 Robson St", response.Query)
+			assert.Equal(t, "800 Robson St, Vancouver, BC, Canada", response.FormattedAddress)
+			assert.Equal(t, 49.2827, response.Lat)
+			assert.Equal(t, -123.1207, response.Lng)
+			assert.Equal(t, 1.0, response.Confidence)
+		}
+
+		// The second lookup is served from the cache
+		assert.Equal(t, 1, mapsService.geocodeCalls)
+	})
+
+	t.Run("Unresolvable address", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/geocode?address="+url.QueryEscape("1 Nowhere Rd"), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusNotFound, w.Code)
+
+		var response ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "address_not_found", response.Error)
+	})
+
+	t.Run("Missing address", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/geocode", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Rate limited", func(t *testing.T) {
+		limited := &fakeMapsService{geocodeErr: fmt.Errorf("failed to geocode address: %w", maps.ErrRateLimited)}
+		router := newTestRouter(NewTripHandler(
+			service.NewRoutingService(repo, limited, service.NewPricingService()),
+			WithGeocoder(limited),
+		))
+
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/geocode?address="+url.QueryEscape("800 Robson St"), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+		var response ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "geocoder_rate_limited", response.Error)
+
+		// Planning reports the same error rather than a generic failure
+		w = postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      downtownStops(),
+			"start_time": "2024-01-15T10:00:00-08:00",
+		})
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, w.Body.String())
+	})
+}
+
+func TestPlanTrip_ParkingSearchRadius(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	// A cheap meter about 1.5km south of Robson St, beyond the default radius
+	repo.meters = append(repo.meters, &domain.ParkingMeter{
+		MeterID: "FALSE_CREEK", Lat: 49.2692, Lng: -123.1207, RateMF9A6P: 1.00, TimeLimitMF9A6P: 3,
+	})
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	tests := []struct {
+		name          string
+		radiusKm      float64
+		maxWalking    int
+		expectedMeter string
+	}{
+		{name: "Default radius", radiusKm: 0, expectedMeter: "ROBSON"},
+		{name: "Wider radius finds the cheaper meter", radiusKm: 2, maxWalking: 20, expectedMeter: "FALSE_CREEK"},
+		{name: "Cheaper meter is too far to walk by default", radiusKm: 2, expectedMeter: "ROBSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+				"stops":                    downtownStops(),
+				"start_time":               "2024-01-15T10:00:00-08:00",
+				"parking_search_radius_km": tt.radiusKm,
+				"preferences": map[string]interface{}{
+					"cost_weight":         0.5,
+					"time_weight":         0.5,
+					"max_walking_minutes": tt.maxWalking,
+				},
+			})
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			var response TripPlanResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+			var cheapest *domain.TripPlan
+			for _, plan := range response.Plans {
+				if plan.Type == "cheapest" {
+					cheapest = plan
+				}
+			}
+			require.NotNil(t, cheapest)
+			require.Equal(t, "800 Robson St", cheapest.Route[0].ToStop.Address)
+			assert.Equal(t, tt.expectedMeter, cheapest.Route[0].ParkingMeter.MeterID)
+		})
+	}
+
+	t.Run("Radius above the maximum is rejected", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":                    downtownStops(),
+			"start_time":               "2024-01-15T10:00:00-08:00",
+			"parking_search_radius_km": 50,
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Radius below the minimum is rejected", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":                    downtownStops(),
+			"start_time":               "2024-01-15T10:00:00-08:00",
+			"parking_search_radius_km": 0.05,
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Radius is passed to the repository", func(t *testing.T) {
+		for _, radiusKm := range []float64{0.3, 0} {
+			repo.radii = nil
+			w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+				"stops":                    downtownStops(),
+				"start_time":               "2024-01-15T10:00:00-08:00",
+				"parking_search_radius_km": radiusKm,
+			})
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			expected := radiusKm
+			if radiusKm == 0 {
+				expected = service.DefaultParkingSearchRadiusKm
+			}
+			require.Len(t, repo.radii, len(downtownStops()))
+			for _, radius := range repo.radii {
+				assert.Equal(t, expected, radius)
+			}
+		}
+	})
+}
+
+func TestPlanTrip_PlanCache(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(
+		service.NewRoutingService(repo, mapsService, service.NewPricingService()),
+		WithPlanCache(time.Minute),
+	))
+
+	body := map[string]interface{}{
+		"stops":      downtownStops(),
+		"start_time": "2024-01-15T10:00:00-08:00",
+	}
+
+	first := postJSON(router, "/api/v1/trips/plan", body)
+	require.Equal(t, http.StatusOK, first.Code, first.Body.String())
+	require.Greater(t, mapsService.travelCalls+mapsService.geocodeCalls, 0)
+
+	t.Run("Identical request issues no upstream calls", func(t *testing.T) {
+		mapsService.travelCalls, mapsService.geocodeCalls = 0, 0
+
+		second := postJSON(router, "/api/v1/trips/plan", body)
+		require.Equal(t, http.StatusOK, second.Code)
+		assert.Equal(t, 0, mapsService.travelCalls)
+		assert.Equal(t, 0, mapsService.geocodeCalls)
+
+		var firstResponse, secondResponse TripPlanResponse
+		require.NoError(t, json.Unmarshal(first.Body.Bytes(), &firstResponse))
+		require.NoError(t, json.Unmarshal(second.Body.Bytes(), &secondResponse))
+		assert.Equal(t, firstResponse.Plans, secondResponse.Plans)
+		assert.Equal(t, true, secondResponse.Metadata["cached"])
+	})
+
+	t.Run("Same start time in another offset is a hit", func(t *testing.T) {
+		mapsService.travelCalls, mapsService.geocodeCalls = 0, 0
+
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      downtownStops(),
+			"start_time": "2024-01-15T18:00:00Z",
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 0, mapsService.travelCalls+mapsService.geocodeCalls)
+	})
+
+	t.Run("Different start time is planned again", func(t *testing.T) {
+		mapsService.travelCalls, mapsService.geocodeCalls = 0, 0
+
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      downtownStops(),
+			"start_time": "2024-01-15T11:00:00-08:00",
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Greater(t, mapsService.travelCalls+mapsService.geocodeCalls, 0)
+	})
+}
+
+func TestDebugCandidates(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	stops := append(downtownStops(), StopRequest{Address: "Vancouver Hotel", DurationMinutes: 30})
+	w := postJSON(router, "/api/v1/debug/candidates", map[string]interface{}{
+		"stops":      stops,
+		"start_time": "2024-01-15T10:00:00-08:00",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response CandidatesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	// The first stop is fixed, so the other two give 2! orderings
+	require.Equal(t, 2, response.Count)
+	require.Len(t, response.Candidates, 2)
+
+	orders := make(map[string]bool)
+	for _, candidate := range response.Candidates {
+		require.Len(t, candidate.Order, 3)
+		assert.Equal(t, "stop_1", candidate.Order[0])
+		assert.Len(t, candidate.Meters, 3)
+		assert.Greater(t, candidate.TotalCost, 0.0)
+		assert.Greater(t, candidate.TotalTime, candidate.TransitTime)
+		orders[strings.Join(candidate.Order, ",")] = true
+	}
+	assert.True(t, orders["stop_1,stop_2,stop_3"])
+	assert.True(t, orders["stop_1,stop_3,stop_2"])
+}
+
+func TestPlanWindow(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	t.Run("Returns the cheapest start", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/trips/plan/window", map[string]interface{}{
+			"stops":            downtownStops(),
+			"earliest_start":   "2024-01-15T17:00:00-08:00",
+			"latest_start":     "2024-01-15T18:30:00-08:00",
+			"interval_minutes": 30,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response PlanWindowResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+		// The fixture's meters are free after 6 PM
+		assert.True(t, response.StartTime.Equal(time.Date(2024, 1, 16, 2, 0, 0, 0, time.UTC)), response.StartTime)
+		require.NotNil(t, response.Plan)
+		assert.Equal(t, 0.0, response.Plan.TotalCost)
+		require.Len(t, response.Starts, 4)
+		assert.Greater(t, response.Starts[0].TotalCost, 0.0)
+	})
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{
+			name: "Latest before earliest",
+			body: map[string]interface{}{
+				"stops":          downtownStops(),
+				"earliest_start": "2024-01-15T18:00:00-08:00",
+				"latest_start":   "2024-01-15T17:00:00-08:00",
+			},
+		},
+		{
+			name: "Too many start times",
+			body: map[string]interface{}{
+				"stops":            downtownStops(),
+				"earliest_start":   "2024-01-15T06:00:00-08:00",
+				"latest_start":     "2024-01-15T22:00:00-08:00",
+				"interval_minutes": 5,
+			},
+		},
+		{
+			name: "Missing latest start",
+			body: map[string]interface{}{
+				"stops":          downtownStops(),
+				"earliest_start": "2024-01-15T17:00:00-08:00",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, "/api/v1/trips/plan/window", tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestCompareModes(t *testing.T) {
+	repo, mapsService := downtownFixture()
+
+	t.Run("Returns driving and transit plans", func(t *testing.T) {
+		router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+		w := postJSON(router, "/api/v1/trips/compare_modes", map[string]interface{}{
+			"stops":      downtownStops(),
+			"start_time": "2024-01-15T10:00:00-08:00",
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response service.ModeComparison
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotNil(t, response.Driving)
+		require.NotNil(t, response.Transit)
+		assert.Equal(t, "hybrid", response.Driving.Type)
+		assert.Equal(t, service.TransitPlanType, response.Transit.Type)
+		assert.Greater(t, response.Transit.TotalCost, 0.0)
+		for _, segment := range response.Transit.Route {
+			assert.Nil(t, segment.ParkingMeter)
+		}
+	})
+
+	t.Run("Routing service can't compare modes", func(t *testing.T) {
+		router := newTestRouter(NewTripHandler(&blockingRoutingService{}))
+		w := postJSON(router, "/api/v1/trips/compare_modes", map[string]interface{}{
+			"stops":      downtownStops(),
+			"start_time": "2024-01-15T10:00:00-08:00",
+		})
+		assert.Equal(t, http.StatusNotImplemented, w.Code, w.Body.String())
+	})
+}
+
+// blockingRoutingService holds every plan until unblock is closed
+type blockingRoutingService struct {
+	unblock chan struct{}
+}
+
+func (s *blockingRoutingService) PlanTrip(request *domain.TripRequest) ([]*domain.TripPlan, error) {
+	<-s.unblock
+	return []*domain.TripPlan{{Type: "cheapest", Metadata: map[string]interface{}{}}}, nil
+}
+
+func TestPlanTrip_ConcurrencyLimit(t *testing.T) {
+	routing := &blockingRoutingService{unblock: make(chan struct{})}
+	router := newTestRouter(NewTripHandler(routing, WithConcurrencyLimit(1, 2)))
+
+	body := map[string]interface{}{
+		"stops":      downtownStops(),
+		"start_time": "2024-01-15T10:00:00-08:00",
+	}
+
+	// One plan runs and two wait; everything else is turned away straight away
+	const requests = 10
+	responses := make(chan *httptest.ResponseRecorder, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			responses <- postJSON(router, "/api/v1/trips/plan", body)
+		}()
+	}
+
+	for i := 0; i < requests-3; i++ {
+		select {
+		case w := <-responses:
+			require.Equal(t, http.StatusServiceUnavailable, w.Code)
+			assert.Equal(t, "5", w.Header().Get("Retry-After"))
+			assert.Contains(t, w.Body.String(), "planner_busy")
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for rejected requests")
+		}
+	}
+
+	close(routing.unblock)
+	for i := 0; i < 3; i++ {
+		w := <-responses
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestPlanTrip_NormalizeWeights(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	body := map[string]interface{}{
+		"stops":       downtownStops(),
+		"start_time":  "2024-01-15T10:00:00-08:00",
+		"preferences": PreferencesRequest{CostWeight: 0.7, TimeWeight: 0.7},
+	}
+
+	t.Run("Rejected by default", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/trips/plan", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid_preferences")
+	})
+
+	t.Run("Scaled to sum to 1 when requested", func(t *testing.T) {
+		body["normalize_weights"] = true
+		w := postJSON(router, "/api/v1/trips/plan", body)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response struct {
+			Metadata struct {
+				Weights    map[string]float64    `json:"optimization_weights"`
+				Normalized *WeightsNormalization `json:"weights_normalized"`
+			} `json:"metadata"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+		assert.InDelta(t, 0.5, response.Metadata.Weights["cost"], 1e-9)
+		assert.InDelta(t, 0.5, response.Metadata.Weights["time"], 1e-9)
+		require.NotNil(t, response.Metadata.Normalized)
+		assert.Equal(t, map[string]float64{"cost": 0.7, "time": 0.7}, response.Metadata.Normalized.Requested)
+		assert.Contains(t, response.Metadata.Normalized.Note, "1.40")
+	})
+
+	t.Run("Weights already summing to 1 are left alone", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":             downtownStops(),
+			"start_time":        "2024-01-15T10:00:00-08:00",
+			"preferences":       PreferencesRequest{CostWeight: 0.25, TimeWeight: 0.75},
+			"normalize_weights": true,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NotContains(t, w.Body.String(), "weights_normalized")
+	})
+
+	t.Run("Zero weights still rejected", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":             downtownStops(),
+			"start_time":        "2024-01-15T10:00:00-08:00",
+			"preferences":       PreferencesRequest{},
+			"normalize_weights": true,
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestPlanTrip_PartialPreferences(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	tests := []struct {
+		name        string
+		preferences map[string]interface{}
+		wantStatus  int
+		wantMessage string
+		wantWeights map[string]float64
+	}{
+		{
+			name:        "Only cost_weight",
+			preferences: map[string]interface{}{"cost_weight": 0.5},
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "preferences gives cost_weight without time_weight",
+		},
+		{
+			name:        "Only time_weight",
+			preferences: map[string]interface{}{"time_weight": 1.0},
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "preferences gives time_weight without cost_weight",
+		},
+		{
+			name:        "Null counts as left out",
+			preferences: map[string]interface{}{"cost_weight": 1.0, "time_weight": nil},
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "without time_weight",
+		},
+		{
+			name:        "Both weights",
+			preferences: map[string]interface{}{"cost_weight": 0.8, "time_weight": 0.2},
+			wantStatus:  http.StatusOK,
+			wantWeights: map[string]float64{"cost": 0.8, "time": 0.2},
+		},
+		{
+			name:        "Neither weight uses the defaults",
+			preferences: map[string]interface{}{"max_walking_minutes": 10},
+			wantStatus:  http.StatusOK,
+			wantWeights: map[string]float64{"cost": 0.5, "time": 0.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+				"stops":       downtownStops(),
+				"start_time":  "2024-01-15T10:00:00-08:00",
+				"preferences": tt.preferences,
+			})
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+
+			if tt.wantStatus != http.StatusOK {
+				var response ErrorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, "invalid_preferences", response.Error)
+				assert.Contains(t, response.Message, tt.wantMessage)
+				return
+			}
+
+			var response struct {
+				Metadata struct {
+					Weights map[string]float64 `json:"optimization_weights"`
+				} `json:"metadata"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantWeights, response.Metadata.Weights)
+		})
+	}
+}
+
+func TestPlanTrip_Timezone(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	t.Run("Times carry the request timezone's offset", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      downtownStops(),
+			"start_time": "2024-01-15T18:00:00Z",
+			"timezone":   "America/Vancouver",
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response struct {
+			Plans []struct {
+				Route []struct {
+					ArrivalTime string `json:"arrival_time"`
+				} `json:"route"`
+			} `json:"plans"`
+			Metadata struct {
+				GeneratedAt    string `json:"generated_at"`
+				GeneratedAtUTC string `json:"generated_at_utc"`
+			} `json:"metadata"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotEmpty(t, response.Plans)
+		require.NotEmpty(t, response.Plans[0].Route)
+
+		// 18:00 UTC in January is 10:00 PST
+		segment := response.Plans[0].Route[0]
+		assert.True(t, strings.HasPrefix(segment.ArrivalTime, "2024-01-15T10:"), segment.ArrivalTime)
+		assert.True(t, strings.HasSuffix(segment.ArrivalTime, "-08:00"), segment.ArrivalTime)
+
+		vancouver, err := time.LoadLocation("America/Vancouver")
+		require.NoError(t, err)
+		_, offset := time.Now().In(vancouver).Zone()
+		generatedAt, err := time.Parse(time.RFC3339, response.Metadata.GeneratedAt)
+		require.NoError(t, err)
+		_, generatedOffset := generatedAt.Zone()
+		assert.Equal(t, offset, generatedOffset)
+		assert.True(t, strings.HasSuffix(response.Metadata.GeneratedAtUTC, "Z"), response.Metadata.GeneratedAtUTC)
+	})
+
+	t.Run("Unknown timezone", func(t *testing.T) {
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      downtownStops(),
+			"start_time": "2024-01-15T18:00:00Z",
+			"timezone":   "Mars/Olympus_Mons",
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid_timezone")
+	})
+
+	t.Run("Plans without tzdata", func(t *testing.T) {
+		withTzdata := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      downtownStops(),
+			"start_time": "2024-01-15T18:00:00Z",
+		})
+		require.Equal(t, http.StatusOK, withTzdata.Code, withTzdata.Body.String())
+
+		defer service.SetLocationLoader(func(name string) (*time.Location, error) {
+			return nil, fmt.Errorf("unknown time zone %s", name)
+		})()
+
+		// The default timezone is still accepted, priced and shown in fixed PST
+		w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      downtownStops(),
+			"start_time": "2024-01-15T18:00:00Z",
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		type plansResponse struct {
+			Plans []struct {
+				TotalCost float64 `json:"total_cost"`
+				Route     []struct {
+					ArrivalTime string `json:"arrival_time"`
+				} `json:"route"`
+			} `json:"plans"`
+		}
+		var want, got plansResponse
+		require.NoError(t, json.Unmarshal(withTzdata.Body.Bytes(), &want))
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		require.NotEmpty(t, got.Plans)
+		require.NotEmpty(t, got.Plans[0].Route)
+		assert.True(t, strings.HasSuffix(got.Plans[0].Route[0].ArrivalTime, "-08:00"), got.Plans[0].Route[0].ArrivalTime)
+		require.Len(t, got.Plans, len(want.Plans))
+		for i := range want.Plans {
+			assert.InDelta(t, want.Plans[i].TotalCost, got.Plans[i].TotalCost, 0.001)
+		}
+
+		// Other timezones can't be used without tzdata
+		w = postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+			"stops":      downtownStops(),
+			"start_time": "2024-01-15T18:00:00Z",
+			"timezone":   "America/Toronto",
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid_timezone")
+	})
+}
+
+func TestRequestLocation_WithoutTzdata(t *testing.T) {
+	defer service.SetLocationLoader(func(name string) (*time.Location, error) {
+		return nil, fmt.Errorf("unknown time zone %s", name)
+	})()
+
+	offset := func(timezone, start string) int {
+		startTime, err := time.Parse(time.RFC3339, start)
+		require.NoError(t, err)
+		request := &domain.TripRequest{Timezone: timezone, StartTime: startTime}
+		_, offset := request.StartTime.In(requestLocation(request)).Zone()
+		return offset
+	}
+	assert.Equal(t, -8*60*60, offset("America/Vancouver", "2024-01-15T18:00:00Z"))
+	assert.Equal(t, -7*60*60, offset("America/Vancouver", "2024-07-15T18:00:00Z"))
+	assert.Equal(t, 0, offset("America/Toronto", "2024-01-15T18:00:00Z"))
+}
+
+// staticAttributor credits a fixed data source
+type staticAttributor domain.DataSource
+
+func (a staticAttributor) Attribution() domain.DataSource { return domain.DataSource(a) }
+
+func TestPlanTrip_DataSources(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	vancouver := domain.DataSource{Name: "City of Vancouver Open Data", License: "Open Government Licence – Vancouver", URL: "https://opendata.vancouver.ca/pages/licence/"}
+	google := domain.DataSource{Name: "Google Maps", License: "Google Maps Platform Terms of Service", URL: "https://cloud.google.com/maps-platform/terms"}
+	router := newTestRouter(NewTripHandler(
+		service.NewRoutingService(repo, mapsService, service.NewPricingService()),
+		WithDataSources(staticAttributor(vancouver), staticAttributor(google), staticAttributor{}),
+	))
+
+	w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+		"stops":      downtownStops(),
+		"start_time": "2024-01-15T10:00:00-08:00",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response struct {
+		Metadata struct {
+			DataSources []domain.DataSource `json:"data_sources"`
+		} `json:"metadata"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []domain.DataSource{vancouver, google}, response.Metadata.DataSources)
+}
+
+func TestPlanTrip_Summary(t *testing.T) {
+	repo, mapsService := downtownFixture()
+	router := newTestRouter(NewTripHandler(service.NewRoutingService(repo, mapsService, service.NewPricingService())))
+
+	w := postJSON(router, "/api/v1/trips/plan", map[string]interface{}{
+		"stops":      downtownStops(),
+		"start_time": "2024-01-15T10:00:00-08:00",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response struct {
+		Plans    []*domain.TripPlan `json:"plans"`
+		Metadata struct {
+			Summary PlanSummary `json:"summary"`
+		} `json:"metadata"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Plans, 3)
+
+	costs := map[string]float64{}
+	times := map[string]int{}
+	minCost, maxCost, sumCost := response.Plans[0].TotalCost, response.Plans[0].TotalCost, 0.0
+	minTime, maxTime, sumTime := response.Plans[0].TotalTime, response.Plans[0].TotalTime, 0
+	for _, plan := range response.Plans {
+		costs[plan.Type] = plan.TotalCost
+		times[plan.Type] = plan.TotalTime
+		if plan.TotalCost < minCost {
+			minCost = plan.TotalCost
+		}
+		if plan.TotalCost > maxCost {
+			maxCost = plan.TotalCost
+		}
+		if plan.TotalTime < minTime {
+			minTime = plan.TotalTime
+		}
+		if plan.TotalTime > maxTime {
+			maxTime = plan.TotalTime
+		}
+		sumCost += plan.TotalCost
+		sumTime += plan.TotalTime
+	}
+
+	summary := response.Metadata.Summary
+	assert.InDelta(t, minCost, summary.CostRange.Min, 0.001)
+	assert.InDelta(t, maxCost, summary.CostRange.Max, 0.001)
+	assert.InDelta(t, sumCost/3, summary.CostRange.Avg, 0.001)
+	assert.Equal(t, minTime, summary.TimeRange.Min)
+	assert.Equal(t, maxTime, summary.TimeRange.Max)
+	assert.InDelta(t, float64(sumTime)/3, summary.TimeRange.Avg, 0.001)
+	assert.InDelta(t, costs["fastest"]-costs["cheapest"], summary.CostSpread, 0.001)
+	assert.Equal(t, times["cheapest"]-times["fastest"], summary.TimeSpread)
+}
+
+func TestSummarizePlans(t *testing.T) {
+	summary := summarizePlans([]*domain.TripPlan{
+		{Type: "cheapest", TotalCost: 12.50, TotalTime: 180},
+		{Type: "fastest", TotalCost: 15.75, TotalTime: 150},
+		{Type: "hybrid", TotalCost: 13.75, TotalTime: 165},
+	})
+
+	assert.Equal(t, CostRange{Min: 12.50, Max: 15.75, Avg: 14.00}, summary.CostRange)
+	assert.Equal(t, TimeRange{Min: 150, Max: 180, Avg: 165}, summary.TimeRange)
+	assert.InDelta(t, 3.25, summary.CostSpread, 0.001)
+	assert.Equal(t, 30, summary.TimeSpread)
+}
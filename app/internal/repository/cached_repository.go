@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// DefaultParkingCacheTTL is how long meters fetched for a grid cell are reused
+const DefaultParkingCacheTTL = 10 * time.Minute
+
+// parkingCacheCellDegrees is the side of the grid cells lookups are cached by,
+// about 110 m north-south and 70 m east-west in Vancouver
+const parkingCacheCellDegrees = 0.001
+
+// maxCachedParkingCells bounds how many cells' meters are held at once
+const maxCachedParkingCells = 5000
+
+// CachedParkingRepository remembers the meters near each grid cell, so stops
+// close to one another, or to a warmed-up cell, share a single upstream fetch.
+// Each cell's meters are fetched from its centre wide enough to cover any
+// point in it, then filtered to the requested radius.
+type CachedParkingRepository struct {
+	next ParkingRepository
+	ttl  time.Duration
+	now  func() time.Time
+
+	// earth is next's, so the cache filters to the radius as next would
+	earth maps.Earth
+
+	mu    sync.Mutex
+	cells map[string]parkingCacheEntry
+}
+
+type parkingCacheEntry struct {
+	meters    []*domain.ParkingMeter
+	expiresAt time.Time
+}
+
+// NewCachedParkingRepository wraps next with a cache keeping each cell's meters for ttl
+func NewCachedParkingRepository(next ParkingRepository, ttl time.Duration) *CachedParkingRepository {
+	r := &CachedParkingRepository{
+		next:  next,
+		ttl:   ttl,
+		now:   time.Now,
+		cells: make(map[string]parkingCacheEntry),
+	}
+	if measured, ok := next.(interface{ Earth() maps.Earth }); ok {
+		r.earth = measured.Earth()
+	}
+	return r
+}
+
+// GetParkingMetersNear returns the meters within radiusKm of the location,
+// fetching its cell's meters on a miss. Meters without coordinates are never
+// returned, whatever the wrapped repository hands back.
+func (r *CachedParkingRepository) GetParkingMetersNear(lat, lng, radiusKm float64) ([]*domain.ParkingMeter, error) {
+	meters, err := r.cellMeters(lat, lng, radiusKm)
+	if err != nil {
+		return nil, err
+	}
+
+	point := &domain.Location{Lat: lat, Lng: lng}
+	var nearby []*domain.ParkingMeter
+	for _, meter := range meters {
+		if !hasCoordinates(meter.Lat, meter.Lng) {
+			continue
+		}
+		if r.earth.Distance(point, &domain.Location{Lat: meter.Lat, Lng: meter.Lng}) <= radiusKm {
+			nearby = append(nearby, meter)
+		}
+	}
+	return nearby, nil
+}
+
+// GetAllParkingMeters is passed through uncached
+func (r *CachedParkingRepository) GetAllParkingMeters() ([]*domain.ParkingMeter, error) {
+	return r.next.GetAllParkingMeters()
+}
+
+// Attribution credits the wrapped repository's data source, if it names one
+func (r *CachedParkingRepository) Attribution() domain.DataSource {
+	if attributed, ok := r.next.(domain.Attributor); ok {
+		return attributed.Attribution()
+	}
+	return domain.DataSource{}
+}
+
+// Cached reports whether meters for the location's cell and radius are held and fresh
+func (r *CachedParkingRepository) Cached(lat, lng, radiusKm float64) bool {
+	key, _ := parkingCell(lat, lng, radiusKm)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.cells[key]
+	return ok && r.now().Before(entry.expiresAt)
+}
+
+// cellMeters returns every meter that may be within radiusKm of a point in the
+// location's cell
+func (r *CachedParkingRepository) cellMeters(lat, lng, radiusKm float64) ([]*domain.ParkingMeter, error) {
+	key, centre := parkingCell(lat, lng, radiusKm)
+
+	r.mu.Lock()
+	entry, ok := r.cells[key]
+	r.mu.Unlock()
+	if ok && r.now().Before(entry.expiresAt) {
+		return entry.meters, nil
+	}
+
+	// Reach the cell's corners as well as its centre
+	corner := &domain.Location{Lat: centre.Lat + parkingCacheCellDegrees/2, Lng: centre.Lng + parkingCacheCellDegrees/2}
+	meters, err := r.next.GetParkingMetersNear(centre.Lat, centre.Lng, radiusKm+r.earth.Distance(centre, corner))
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cells) >= maxCachedParkingCells {
+		now := r.now()
+		for cell, cached := range r.cells {
+			if !now.Before(cached.expiresAt) {
+				delete(r.cells, cell)
+			}
+		}
+		if len(r.cells) >= maxCachedParkingCells {
+			r.cells = make(map[string]parkingCacheEntry)
+		}
+	}
+	r.cells[key] = parkingCacheEntry{meters: meters, expiresAt: r.now().Add(r.ttl)}
+
+	return meters, nil
+}
+
+// parkingCell returns the cache key and centre of the grid cell holding the location
+func parkingCell(lat, lng, radiusKm float64) (string, *domain.Location) {
+	row := math.Floor(lat / parkingCacheCellDegrees)
+	col := math.Floor(lng / parkingCacheCellDegrees)
+	centre := &domain.Location{
+		Lat: (row + 0.5) * parkingCacheCellDegrees,
+		Lng: (col + 0.5) * parkingCacheCellDegrees,
+	}
+	return fmt.Sprintf("%.0f,%.0f,%.3f", row, col, radiusKm), centre
+}
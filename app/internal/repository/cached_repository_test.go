@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// stubRepository returns its meters within the radius and counts lookups
+type stubRepository struct {
+	meters []*domain.ParkingMeter
+	calls  int
+}
+
+func (r *stubRepository) GetParkingMetersNear(lat, lng, radiusKm float64) ([]*domain.ParkingMeter, error) {
+	r.calls++
+	var nearby []*domain.ParkingMeter
+	for _, meter := range r.meters {
+		if maps.CalculateDistance(&domain.Location{Lat: lat, Lng: lng}, &domain.Location{Lat: meter.Lat, Lng: meter.Lng}) <= radiusKm {
+			nearby = append(nearby, meter)
+		}
+	}
+	return nearby, nil
+}
+
+func (r *stubRepository) GetAllParkingMeters() ([]*domain.ParkingMeter, error) {
+	return r.meters, nil
+}
+
+func TestCachedParkingRepository(t *testing.T) {
+	stub := &stubRepository{meters: []*domain.ParkingMeter{
+		{MeterID: "NEAR", Lat: 49.28280, Lng: -123.12070},
+		{MeterID: "EDGE", Lat: 49.28280, Lng: -123.11400}, // about 490 m east
+	}}
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	repo := NewCachedParkingRepository(stub, time.Minute)
+	repo.now = func() time.Time { return now }
+
+	ids := func(meters []*domain.ParkingMeter) []string {
+		var ids []string
+		for _, meter := range meters {
+			ids = append(ids, meter.MeterID)
+		}
+		return ids
+	}
+
+	// Two points in the same cell share one fetch, each filtered to its own radius
+	west, err := repo.GetParkingMetersNear(49.28210, -123.12090, 0.5)
+	require.NoError(t, err)
+	east, err := repo.GetParkingMetersNear(49.28290, -123.12010, 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stub.calls)
+	assert.Equal(t, []string{"NEAR"}, ids(west))
+	assert.Equal(t, []string{"NEAR", "EDGE"}, ids(east))
+
+	// A different radius is a separate entry
+	_, err = repo.GetParkingMetersNear(49.28210, -123.12090, 1.0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stub.calls)
+	assert.True(t, repo.Cached(49.28250, -123.12050, 0.5))
+
+	// Entries are fetched again once they expire
+	now = now.Add(2 * time.Minute)
+	assert.False(t, repo.Cached(49.28250, -123.12050, 0.5))
+	_, err = repo.GetParkingMetersNear(49.28210, -123.12090, 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stub.calls)
+}
+
+func TestCachedParkingRepository_Attribution(t *testing.T) {
+	cached := NewCachedParkingRepository(NewVancouverParkingRepository(), time.Minute)
+	source := cached.Attribution()
+	assert.Equal(t, "City of Vancouver Open Data", source.Name)
+	assert.NotEmpty(t, source.URL)
+
+	assert.Empty(t, NewCachedParkingRepository(&stubRepository{}, time.Minute).Attribution().Name)
+}
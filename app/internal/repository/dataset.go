@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// DatasetFields names the record fields that hold each meter attribute. Fields
+// left empty are treated as absent from the dataset.
+type DatasetFields struct {
+	MeterID    string
+	MeterHead  string
+	LocalArea  string
+	CreditCard string
+	PayPhone   string
+
+	RateMF9A6P string
+	RateMF6P10 string
+	RateSA9A6P string
+	RateSA6P10 string
+	RateSU9A6P string
+	RateSU6P10 string
+
+	TimeMF9A6P string
+	TimeMF6P10 string
+	TimeSA9A6P string
+	TimeSA6P10 string
+	TimeSU9A6P string
+	TimeSU6P10 string
+
+	// GeoPoint is the geo_point field used for spatial queries, holding an
+	// object with the GeoLat and GeoLng keys or a "lat,lon" string
+	GeoPoint string
+	GeoLat   string
+	GeoLng   string
+}
+
+// DatasetConfig describes an Opendatasoft parking meter dataset: where its
+// records live, what its fields are called and the units its values use
+type DatasetConfig struct {
+	BaseURL string
+	Fields  DatasetFields
+
+	// RateMultiplier converts listed rates to dollars per hour, e.g. 0.01 for
+	// rates published in cents. Zero means rates are already in dollars.
+	RateMultiplier float64
+
+	// TimeLimitUnit is the unit of listed time limits. Zero means hours.
+	TimeLimitUnit time.Duration
+
+	// Attribution credits the dataset's publisher under its license
+	Attribution domain.DataSource
+}
+
+// VancouverDataset returns the configuration for the City of Vancouver's
+// parking meter dataset, the repository's default
+func VancouverDataset() DatasetConfig {
+	return DatasetConfig{
+		BaseURL: "https://opendata.vancouver.ca/api/explore/v2.1/catalog/datasets/parking-meters/records",
+		Fields: DatasetFields{
+			MeterID:    "meterid",
+			MeterHead:  "meterhead",
+			LocalArea:  "geo_local_area",
+			CreditCard: "creditcard",
+			PayPhone:   "pay_phone",
+			RateMF9A6P: "r_mf_9a_6p",
+			RateMF6P10: "r_mf_6p_10",
+			RateSA9A6P: "r_sa_9a_6p",
+			RateSA6P10: "r_sa_6p_10",
+			RateSU9A6P: "r_su_9a_6p",
+			RateSU6P10: "r_su_6p_10",
+			TimeMF9A6P: "t_mf_9a_6p",
+			TimeMF6P10: "t_mf_6p_10",
+			TimeSA9A6P: "t_sa_9a_6p",
+			TimeSA6P10: "t_sa_6p_10",
+			TimeSU9A6P: "t_su_9a_6p",
+			TimeSU6P10: "t_su_6p_10",
+			GeoPoint:   "geo_point_2d",
+			GeoLat:     "lat",
+			GeoLng:     "lon",
+		},
+		Attribution: domain.DataSource{
+			Name:    "City of Vancouver Open Data",
+			License: "Open Government Licence – Vancouver",
+			URL:     "https://opendata.vancouver.ca/pages/licence/",
+		},
+	}
+}
+
+// Attribution credits the publisher of the repository's dataset
+func (r *VancouverParkingRepository) Attribution() domain.DataSource {
+	return r.dataset.Attribution
+}
+
+// WithDataset points the repository at a different Opendatasoft dataset
+func WithDataset(dataset DatasetConfig) RepositoryOption {
+	return func(r *VancouverParkingRepository) {
+		r.dataset = dataset
+	}
+}
+
+// datasetResponse is a page of raw records from an Opendatasoft dataset
+type datasetResponse struct {
+	TotalCount int                          `json:"total_count"`
+	Results    []map[string]json.RawMessage `json:"results"`
+}
+
+// decodeRecord maps a raw record onto the Vancouver field layout using the
+// dataset's field names
+func (d DatasetConfig) decodeRecord(record map[string]json.RawMessage) (VancouverParkingData, error) {
+	var data VancouverParkingData
+	fields := d.Fields
+
+	targets := []struct {
+		name   string
+		target *FlexString
+	}{
+		{fields.RateMF9A6P, &data.RateMF9A6P},
+		{fields.RateMF6P10, &data.RateMF6P10},
+		{fields.RateSA9A6P, &data.RateSA9A6P},
+		{fields.RateSA6P10, &data.RateSA6P10},
+		{fields.RateSU9A6P, &data.RateSU9A6P},
+		{fields.RateSU6P10, &data.RateSU6P10},
+		{fields.TimeMF9A6P, &data.TimeMF9A6P},
+		{fields.TimeMF6P10, &data.TimeMF6P10},
+		{fields.TimeSA9A6P, &data.TimeSA9A6P},
+		{fields.TimeSA6P10, &data.TimeSA6P10},
+		{fields.TimeSU9A6P, &data.TimeSU9A6P},
+		{fields.TimeSU6P10, &data.TimeSU6P10},
+		{fields.PayPhone, &data.PayPhone},
+	}
+	for _, field := range targets {
+		if err := decodeField(record, field.name, field.target); err != nil {
+			return data, err
+		}
+	}
+
+	text := []struct {
+		name   string
+		target *string
+	}{
+		{fields.MeterID, &data.MeterID},
+		{fields.MeterHead, &data.MeterHead},
+		{fields.LocalArea, &data.LocalArea},
+		{fields.CreditCard, &data.CreditCard},
+	}
+	for _, field := range text {
+		var value FlexString
+		if err := decodeField(record, field.name, &value); err != nil {
+			return data, err
+		}
+		*field.target = string(value)
+	}
+
+	if raw, ok := record[fields.GeoPoint]; ok {
+		lat, lng, err := parseGeoPoint(raw, fields.GeoLat, fields.GeoLng)
+		if err != nil {
+			return data, fmt.Errorf("field %s: %w", fields.GeoPoint, err)
+		}
+		data.GeoPoint2D = GeoPoint{Lat: lat, Lng: lng}
+	}
+
+	return data, nil
+}
+
+// decodeField reads the named field into target, leaving it empty if the
+// dataset has no such field
+func decodeField(record map[string]json.RawMessage, name string, target *FlexString) error {
+	raw, ok := record[name]
+	if name == "" || !ok {
+		return nil
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return fmt.Errorf("field %s: %w", name, err)
+	}
+	return nil
+}
+
+// rate converts a listed rate to dollars per hour
+func (d DatasetConfig) rate(listed float64) float64 {
+	if d.RateMultiplier == 0 {
+		return listed
+	}
+	return listed * d.RateMultiplier
+}
+
+// timeLimit converts a listed time limit to whole hours
+func (d DatasetConfig) timeLimit(listed int) int {
+	if d.TimeLimitUnit == 0 {
+		return listed
+	}
+	return int(time.Duration(listed) * d.TimeLimitUnit / time.Hour)
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// WithDatasetCache keeps the whole meter dataset in memory for ttl once it has
+// been fetched, so meters near a stop are found locally rather than with an
+// API call per stop. Meters rarely move, so the TTL can be long; it is off by
+// default.
+func WithDatasetCache(ttl time.Duration) RepositoryOption {
+	return func(r *VancouverParkingRepository) {
+		if ttl <= 0 {
+			r.datasetCache = nil
+			return
+		}
+		r.datasetCache = &datasetCache{ttl: ttl, now: time.Now}
+	}
+}
+
+// datasetCache holds every meter in the dataset until it expires. Callers
+// share one fetch: the lock is held while the dataset is refetched.
+type datasetCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	all       []*domain.ParkingMeter
+	expiresAt time.Time
+}
+
+// meters returns the cached dataset, calling fetch to refill it when it is
+// empty or has expired
+func (c *datasetCache) meters(fetch func() ([]*domain.ParkingMeter, error)) ([]*domain.ParkingMeter, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.all != nil && c.now().Before(c.expiresAt) {
+		return c.all, nil
+	}
+
+	fmt.Printf("[DEBUG] Fetching the full meter dataset for the cache\n")
+	meters, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	if meters == nil {
+		meters = []*domain.ParkingMeter{}
+	}
+	c.all = meters
+	c.expiresAt = c.now().Add(c.ttl)
+	fmt.Printf("[DEBUG] Cached %d meters for %s\n", len(meters), c.ttl)
+
+	return c.all, nil
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVancouverParkingRepository_DatasetCache(t *testing.T) {
+	// One page of meters, then an empty page to end the paging
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Query().Get("offset") != "0" {
+			fmt.Fprint(w, `{"total_count": 3, "results": []}`)
+			return
+		}
+		fmt.Fprint(w, `{
+			"total_count": 3,
+			"results": [
+				{"meterid": "DOWNTOWN", "r_mf_9a_6p": "$3.50", "geo_point_2d": {"lat": 49.2827, "lon": -123.1207}},
+				{"meterid": "NEARBY", "r_mf_9a_6p": "$3.50", "geo_point_2d": {"lat": 49.2830, "lon": -123.1210}},
+				{"meterid": "KITSILANO", "r_mf_9a_6p": "$2.00", "geo_point_2d": {"lat": 49.2684, "lon": -123.1683}}
+			]
+		}`)
+	}))
+	defer server.Close()
+
+	dataset := VancouverDataset()
+	dataset.BaseURL = server.URL
+	repo := NewVancouverParkingRepository(WithDataset(dataset), WithDatasetCache(time.Hour))
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	repo.datasetCache.now = func() time.Time { return now }
+
+	meters, err := repo.GetParkingMetersNear(49.2827, -123.1207, 0.5)
+	require.NoError(t, err)
+	require.Len(t, meters, 2)
+	assert.Equal(t, "DOWNTOWN", meters[0].MeterID)
+	assert.Equal(t, "NEARBY", meters[1].MeterID)
+	fetched := atomic.LoadInt32(&requests)
+
+	// Within the TTL, other stops and lookups are answered from the cache
+	meters, err = repo.GetParkingMetersNear(49.2684, -123.1683, 0.5)
+	require.NoError(t, err)
+	require.Len(t, meters, 1)
+	assert.Equal(t, "KITSILANO", meters[0].MeterID)
+
+	meter, err := repo.GetParkingMeter("NEARBY")
+	require.NoError(t, err)
+	assert.Equal(t, "NEARBY", meter.MeterID)
+	_, err = repo.GetParkingMeter("MISSING")
+	assert.ErrorIs(t, err, ErrMeterNotFound)
+
+	all, err := repo.GetAllParkingMeters()
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+	assert.Equal(t, fetched, atomic.LoadInt32(&requests))
+
+	// Once expired, the dataset is fetched again
+	now = now.Add(time.Hour)
+	_, err = repo.GetParkingMetersNear(49.2827, -123.1207, 0.5)
+	require.NoError(t, err)
+	assert.Equal(t, 2*fetched, atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// ErrMeterNotFound is returned when no meter has the requested ID
+var ErrMeterNotFound = errors.New("parking meter not found")
+
+// MeterFinder is implemented by repositories that can look a single meter up
+// by its ID
+type MeterFinder interface {
+	GetParkingMeter(meterID string) (*domain.ParkingMeter, error)
+}
+
+// GetParkingMeter fetches the meter with the given ID, or finds it in the
+// dataset cache when that is on
+func (r *VancouverParkingRepository) GetParkingMeter(meterID string) (*domain.ParkingMeter, error) {
+	if r.datasetCache != nil {
+		meters, err := r.datasetCache.meters(r.fetchAllParkingMeters)
+		if err != nil {
+			return nil, err
+		}
+		for _, meter := range meters {
+			if meter.MeterID == meterID {
+				return meter, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrMeterNotFound, meterID)
+	}
+
+	params := url.Values{}
+	params.Add("where", fmt.Sprintf("%s = %s", r.dataset.Fields.MeterID, strconv.Quote(meterID)))
+	params.Add("limit", "1")
+	params.Add("select", "*")
+
+	url := fmt.Sprintf("%s?%s", r.dataset.BaseURL, params.Encode())
+	fmt.Printf("[DEBUG] Looking up meter %s: %s\n", meterID, url)
+
+	body, err := r.get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var apiResp datasetResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	for _, record := range apiResp.Results {
+		data, err := r.dataset.decodeRecord(record)
+		if err != nil {
+			fmt.Printf("[DEBUG] Skipping malformed record: %v\n", err)
+			continue
+		}
+		if meter := r.convertToDomainModel(data); meter != nil && meter.MeterID == meterID {
+			return meter, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrMeterNotFound, meterID)
+}
+
+// GetParkingMeter is passed through uncached, when the wrapped repository can
+// look meters up by ID
+func (r *CachedParkingRepository) GetParkingMeter(meterID string) (*domain.ParkingMeter, error) {
+	finder, ok := r.next.(MeterFinder)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMeterNotFound, meterID)
+	}
+	return finder.GetParkingMeter(meterID)
+}
@@ -3,45 +3,109 @@ package repository
 import (
 	"encoding/json"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"vancouver-trip-planner/internal/domain"
 	"vancouver-trip-planner/pkg/maps"
 )
 
-// VancouverParkingResponse represents the API response structure
-type VancouverParkingResponse struct {
-	TotalCount int                    `json:"total_count"`
-	Results    []VancouverParkingData `json:"results"`
-}
-
 // VancouverParkingData represents a single parking meter from Vancouver API
 type VancouverParkingData struct {
-	MeterHead  string `json:"meterhead"`
-	RateMF9A6P string `json:"r_mf_9a_6p"`
-	RateMF6P10 string `json:"r_mf_6p_10"`
-	RateSA9A6P string `json:"r_sa_9a_6p"`
-	RateSA6P10 string `json:"r_sa_6p_10"`
-	RateSU9A6P string `json:"r_su_9a_6p"`
-	RateSU6P10 string `json:"r_su_6p_10"`
-	TimeMF9A6P string `json:"t_mf_9a_6p"`
-	TimeMF6P10 string `json:"t_mf_6p_10"`
-	TimeSA9A6P string `json:"t_sa_9a_6p"`
-	TimeSA6P10 string `json:"t_sa_6p_10"`
-	TimeSU9A6P string `json:"t_su_9a_6p"`
-	TimeSU6P10 string `json:"t_su_6p_10"`
-	CreditCard string `json:"creditcard"`
-	MeterID    string `json:"meterid"`
-	LocalArea  string `json:"geo_local_area"`
-	GeoPoint2D struct {
-		Lat float64 `json:"lat"`
-		Lng float64 `json:"lon"`
-	} `json:"geo_point_2d"`
+	MeterHead  string     `json:"meterhead"`
+	RateMF9A6P FlexString `json:"r_mf_9a_6p"`
+	RateMF6P10 FlexString `json:"r_mf_6p_10"`
+	RateSA9A6P FlexString `json:"r_sa_9a_6p"`
+	RateSA6P10 FlexString `json:"r_sa_6p_10"`
+	RateSU9A6P FlexString `json:"r_su_9a_6p"`
+	RateSU6P10 FlexString `json:"r_su_6p_10"`
+	TimeMF9A6P FlexString `json:"t_mf_9a_6p"`
+	TimeMF6P10 FlexString `json:"t_mf_6p_10"`
+	TimeSA9A6P FlexString `json:"t_sa_9a_6p"`
+	TimeSA6P10 FlexString `json:"t_sa_6p_10"`
+	TimeSU9A6P FlexString `json:"t_su_9a_6p"`
+	TimeSU6P10 FlexString `json:"t_su_6p_10"`
+	CreditCard string     `json:"creditcard"`
+	PayPhone   FlexString `json:"pay_phone"` // PayByPhone location number
+	MeterID    string     `json:"meterid"`
+	LocalArea  string     `json:"geo_local_area"`
+	GeoPoint2D GeoPoint   `json:"geo_point_2d"`
+}
+
+// FlexString is a field the Vancouver API returns either as a string ("$3.50",
+// "2 Hr") or as a bare JSON number (3.5, 2). Numbers keep their literal text;
+// null becomes an empty string.
+type FlexString string
+
+// UnmarshalJSON accepts a JSON string, number or null
+func (f *FlexString) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*f = ""
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*f = FlexString(str)
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("expected string or number, got %s", string(data))
+	}
+	*f = FlexString(number.String())
+	return nil
+}
+
+// GeoPoint is a meter's location. The Vancouver API usually returns it as an
+// object with lat and lon keys, but sometimes inline as a "lat,lon" string.
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lon"`
+}
+
+// UnmarshalJSON accepts the object form, the "lat,lon" string form or null
+func (p *GeoPoint) UnmarshalJSON(data []byte) error {
+	lat, lng, err := parseGeoPoint(data, "lat", "lon")
+	if err != nil {
+		return err
+	}
+	p.Lat, p.Lng = lat, lng
+	return nil
+}
+
+// parseGeoPoint reads a point given either as an object holding latKey and
+// lngKey or as a "lat,lon" string. Null is no point, (0,0).
+func parseGeoPoint(data []byte, latKey, lngKey string) (float64, float64, error) {
+	if string(data) == "null" {
+		return 0, 0, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		parts := strings.Split(text, ",")
+		if len(parts) != 2 {
+			return 0, 0, fmt.Errorf("expected \"lat,lon\", got %q", text)
+		}
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		lng, lngErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if latErr != nil || lngErr != nil {
+			return 0, 0, fmt.Errorf("expected \"lat,lon\", got %q", text)
+		}
+		return lat, lng, nil
+	}
+
+	var point map[string]float64
+	if err := json.Unmarshal(data, &point); err != nil {
+		return 0, 0, fmt.Errorf("expected an object or \"lat,lon\" string, got %s", string(data))
+	}
+	return point[latKey], point[lngKey], nil
 }
 
 // MeterWithDistance holds a parking meter and its distance from the target location
@@ -56,88 +120,221 @@ type ParkingRepository interface {
 	GetAllParkingMeters() ([]*domain.ParkingMeter, error)
 }
 
-// VancouverParkingRepository implements ParkingRepository using Vancouver Open Data API
+// MissingEveningRatePolicy decides how meters that list a daytime rate but leave
+// the evening rate blank are priced in the evening
+type MissingEveningRatePolicy int
+
+const (
+	// EveningRateFree treats a blank evening rate as free parking (the default)
+	EveningRateFree MissingEveningRatePolicy = iota
+	// EveningRateInheritDaytime charges the same day's daytime rate and time limit
+	EveningRateInheritDaytime
+	// EveningRateExclude leaves such meters out, since their evening price is unknown
+	EveningRateExclude
+)
+
+// ParseMissingEveningRatePolicy returns the policy with the given configuration name
+func ParseMissingEveningRatePolicy(name string) (MissingEveningRatePolicy, error) {
+	switch name {
+	case "free":
+		return EveningRateFree, nil
+	case "inherit":
+		return EveningRateInheritDaytime, nil
+	case "exclude":
+		return EveningRateExclude, nil
+	}
+	return EveningRateFree, fmt.Errorf("unknown missing evening rate policy: %s", name)
+}
+
+// VancouverParkingRepository implements ParkingRepository using Vancouver Open Data API,
+// or another Opendatasoft dataset given WithDataset
 type VancouverParkingRepository struct {
-	baseURL    string
+	dataset    DatasetConfig
 	httpClient *http.Client
+
+	missingEveningRate MissingEveningRatePolicy
+
+	// assumedRate prices meters listing time limits but no rates; zero
+	// excludes them
+	assumedRate float64
+
+	// retry is how failed requests are retried; sleep waits between attempts
+	// and is replaced in tests
+	retry RetryPolicy
+	sleep func(time.Duration)
+
+	// datasetCache, when set, holds every meter so lookups are answered locally
+	datasetCache *datasetCache
+
+	// earth measures the distances radius searches filter and sort by
+	earth maps.Earth
+}
+
+// RepositoryOption configures a VancouverParkingRepository
+type RepositoryOption func(*VancouverParkingRepository)
+
+// WithMissingEveningRatePolicy sets how blank evening rates are interpreted
+func WithMissingEveningRatePolicy(policy MissingEveningRatePolicy) RepositoryOption {
+	return func(r *VancouverParkingRepository) {
+		r.missingEveningRate = policy
+	}
+}
+
+// WithAssumedRate sets the hourly rate assumed for meters that list time
+// limits but no rates, for each window with a limit. Such meters are excluded
+// by default rather than treated as free.
+func WithAssumedRate(rate float64) RepositoryOption {
+	return func(r *VancouverParkingRepository) {
+		r.assumedRate = rate
+	}
+}
+
+// WithEarth sets the model radius searches measure distances with. It
+// defaults to a sphere of radius maps.EarthRadiusKm.
+func WithEarth(earth maps.Earth) RepositoryOption {
+	return func(r *VancouverParkingRepository) {
+		r.earth = earth
+	}
+}
+
+// Earth returns the model radius searches measure distances with
+func (r *VancouverParkingRepository) Earth() maps.Earth {
+	return r.earth
 }
 
 // NewVancouverParkingRepository creates a new Vancouver parking repository
-func NewVancouverParkingRepository() *VancouverParkingRepository {
-	return &VancouverParkingRepository{
-		baseURL:    "https://opendata.vancouver.ca/api/explore/v2.1/catalog/datasets/parking-meters/records",
+func NewVancouverParkingRepository(opts ...RepositoryOption) *VancouverParkingRepository {
+	r := &VancouverParkingRepository{
+		dataset:    VancouverDataset(),
 		httpClient: &http.Client{Timeout: 30 * time.Second},
+		retry:      DefaultRetryPolicy(),
+	}
+
+	for _, opt := range opts {
+		opt(r)
 	}
+
+	return r
 }
 
-// GetParkingMetersNear fetches parking meters within a radius of the given location using spatial query
+// GetParkingMetersNear fetches the parking meters within a radius of the given
+// location using a spatial query, closest first
 func (r *VancouverParkingRepository) GetParkingMetersNear(lat, lng, radiusKm float64) ([]*domain.ParkingMeter, error) {
 	fmt.Printf("[DEBUG] Finding parking meters for stop: (%.6f, %.6f) within %.1fkm radius\n", lat, lng, radiusKm)
-	
-	// Use bounding box approach - this works reliably with the Vancouver API
-	// Create a bounding box around the target location (±0.01 degrees ≈ 1km)
-	latMin := lat - 0.01
-	latMax := lat + 0.01
-	lngMin := lng - 0.01
-	lngMax := lng + 0.01
-	
-	whereClause := fmt.Sprintf("in_bbox(geo_point_2d, %f, %f, %f, %f)", latMin, lngMin, latMax, lngMax)
-	
-	params := url.Values{}
-	params.Add("where", whereClause)
-	params.Add("limit", "50") // Get up to 50 meters within the bounding box
-	params.Add("select", "*")
-	
-	url := fmt.Sprintf("%s?%s", r.baseURL, params.Encode())
-	fmt.Printf("[DEBUG] Calling Vancouver API: %s\n", url)
 
-	resp, err := r.httpClient.Get(url)
-	if err != nil {
-		fmt.Printf("[DEBUG] HTTP request failed: %v\n", err)
-		return nil, fmt.Errorf("failed to fetch parking meters: %w", err)
+	// With the dataset cached, search it rather than the API
+	if r.datasetCache != nil {
+		meters, err := r.datasetCache.meters(r.fetchAllParkingMeters)
+		if err != nil {
+			return nil, err
+		}
+		return nearestMeters(meters, lat, lng, radiusKm, r.earth), nil
 	}
-	defer resp.Body.Close()
+	
+	// Use bounding box approach - this works reliably with the Vancouver API.
+	// The box just covers the search circle; meters in its corners are
+	// filtered out by distance below.
+	latMin, lngMin, latMax, lngMax := boundingBox(lat, lng, radiusKm)
+	whereClause := fmt.Sprintf("in_bbox(%s, %f, %f, %f, %f)", r.dataset.Fields.GeoPoint, latMin, lngMin, latMax, lngMax)
 
-	fmt.Printf("[DEBUG] Vancouver API response status: %s\n", resp.Status)
+	// The API returns at most a page of records per request, so larger
+	// searches are fetched a page at a time
+	limit := nearbyRecordLimit(radiusKm)
+	var meters []*domain.ParkingMeter
+	for offset := 0; offset < limit; offset += nearbyPageSize {
+		pageLimit := min(nearbyPageSize, limit-offset)
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("[DEBUG] Failed to read response body: %v\n", err)
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
+		params := url.Values{}
+		params.Add("where", whereClause)
+		params.Add("limit", strconv.Itoa(pageLimit))
+		params.Add("offset", strconv.Itoa(offset))
+		params.Add("select", "*")
 
-	fmt.Printf("[DEBUG] Vancouver API response length: %d bytes\n", len(body))
+		url := fmt.Sprintf("%s?%s", r.dataset.BaseURL, params.Encode())
+		fmt.Printf("[DEBUG] Calling Vancouver API: %s\n", url)
 
-	// Always print response body for debugging
-	maxLen := len(body)
-	if maxLen > 500 {
-		maxLen = 500
-	}
-	fmt.Printf("[DEBUG] Response body: %s\n", string(body)[:maxLen])
+		body, err := r.get(url)
+		if err != nil {
+			fmt.Printf("[DEBUG] HTTP request failed: %v\n", err)
+			return nil, err
+		}
+
+		fmt.Printf("[DEBUG] Vancouver API response length: %d bytes\n", len(body))
+
+		var apiResp datasetResponse
+		if err := json.Unmarshal(body, &apiResp); err != nil {
+			fmt.Printf("[DEBUG] JSON unmarshal failed: %v\n", err)
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+
+		fmt.Printf("[DEBUG] Vancouver API returned %d results within bounding box\n", len(apiResp.Results))
 
-	var apiResp VancouverParkingResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		fmt.Printf("[DEBUG] JSON unmarshal failed: %v\n", err)
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		// Convert API results to domain models
+		for _, record := range apiResp.Results {
+			data, err := r.dataset.decodeRecord(record)
+			if err != nil {
+				fmt.Printf("[DEBUG] Skipping malformed record: %v\n", err)
+				continue
+			}
+			if meter := r.convertToDomainModel(data); meter != nil {
+				meters = append(meters, meter)
+			}
+		}
+
+		if len(apiResp.Results) < pageLimit {
+			break
+		}
+		if offset+pageLimit >= limit {
+			fmt.Printf("[DEBUG] Stopped at %d records; the %.1fkm box may hold more\n", limit, radiusKm)
+		}
 	}
 
-	fmt.Printf("[DEBUG] Vancouver API returned %d results within bounding box\n", len(apiResp.Results))
+	return nearestMeters(meters, lat, lng, radiusKm, r.earth), nil
+}
+
+// Nearby searches fetch up to nearbyRecordsPerSqKm records for each square
+// kilometre of the search box, in pages of nearbyPageSize (the most the
+// records API returns per request), between one page and maxNearbyRecords.
+const (
+	nearbyPageSize       = 100
+	nearbyRecordsPerSqKm = 200
+	maxNearbyRecords     = 1000
+)
+
+// kmPerDegreeLat is the length of a degree of latitude
+const kmPerDegreeLat = 111.32
+
+// boundingBox returns the bounds of the smallest box holding every point
+// within radiusKm of the location
+func boundingBox(lat, lng, radiusKm float64) (latMin, lngMin, latMax, lngMax float64) {
+	latDelta := radiusKm / kmPerDegreeLat
+	// Degrees of longitude shrink towards the poles
+	lngDelta := radiusKm / (kmPerDegreeLat * math.Cos(lat*math.Pi/180))
+	return lat - latDelta, lng - lngDelta, lat + latDelta, lng + lngDelta
+}
+
+// nearbyRecordLimit returns how many records a search within radiusKm fetches
+// at most
+func nearbyRecordLimit(radiusKm float64) int {
+	side := 2 * radiusKm
+	limit := int(math.Ceil(nearbyRecordsPerSqKm * side * side))
+	return max(nearbyPageSize, min(limit, maxNearbyRecords))
+}
 
-	// Convert API results to domain models and calculate exact distances for sorting
+// nearestMeters returns the meters within radiusKm of the location, closest
+// first. Callers wanting fewer cut the list themselves, after ranking by
+// whatever matters to them.
+func nearestMeters(meters []*domain.ParkingMeter, lat, lng, radiusKm float64, earth maps.Earth) []*domain.ParkingMeter {
+	// Calculate exact distances for sorting
 	var metersWithDistance []MeterWithDistance
-	for _, data := range apiResp.Results {
-		meter := r.convertToDomainModel(data)
-		
+	for _, meter := range meters {
 		// Calculate exact distance using haversine formula for precise sorting
-		distance := maps.CalculateDistance(
+		distanceKm := earth.Distance(
 			&domain.Location{Lat: lat, Lng: lng},
 			&domain.Location{Lat: meter.Lat, Lng: meter.Lng},
 		)
 		
-		// Convert distance from meters to kilometers
-		distanceKm := distance / 1000.0
-		
-		// Filter by actual distance (bounding box might include some meters slightly outside radius)
+		// Filter by actual distance (a bounding box might include some meters slightly outside radius)
 		if distanceKm <= radiusKm {
 			metersWithDistance = append(metersWithDistance, MeterWithDistance{
 				Meter:   meter,
@@ -153,25 +350,33 @@ func (r *VancouverParkingRepository) GetParkingMetersNear(lat, lng, radiusKm flo
 		return metersWithDistance[i].Distance < metersWithDistance[j].Distance
 	})
 	
-	// Convert back to domain models and limit to top 10
-	var nearbyMeters []*domain.ParkingMeter
-	maxMeters := 10
-	if len(metersWithDistance) < maxMeters {
-		maxMeters = len(metersWithDistance)
+	// Convert back to domain models
+	nearbyMeters := make([]*domain.ParkingMeter, 0, len(metersWithDistance))
+	for _, nearby := range metersWithDistance {
+		nearbyMeters = append(nearbyMeters, nearby.Meter)
 	}
-	
-	for i := 0; i < maxMeters; i++ {
-		nearbyMeters = append(nearbyMeters, metersWithDistance[i].Meter)
-		fmt.Printf("[DEBUG] Meter %s at distance %.3fkm\n", 
-			metersWithDistance[i].Meter.MeterID, 
-			metersWithDistance[i].Distance)
+	if len(metersWithDistance) > 0 {
+		fmt.Printf("[DEBUG] Nearest meter %s at distance %.3fkm\n", metersWithDistance[0].Meter.MeterID, metersWithDistance[0].Distance)
 	}
 
-	return nearbyMeters, nil
+	return nearbyMeters
 }
 
-// GetAllParkingMeters fetches all parking meters (paginated)
+// GetAllParkingMeters fetches all parking meters, from the dataset cache when
+// it is on and fresh
 func (r *VancouverParkingRepository) GetAllParkingMeters() ([]*domain.ParkingMeter, error) {
+	if r.datasetCache != nil {
+		meters, err := r.datasetCache.meters(r.fetchAllParkingMeters)
+		if err != nil {
+			return nil, err
+		}
+		return append([]*domain.ParkingMeter(nil), meters...), nil
+	}
+	return r.fetchAllParkingMeters()
+}
+
+// fetchAllParkingMeters fetches all parking meters (paginated)
+func (r *VancouverParkingRepository) fetchAllParkingMeters() ([]*domain.ParkingMeter, error) {
 	var allMeters []*domain.ParkingMeter
 	limit := 1000
 	offset := 0
@@ -182,20 +387,14 @@ func (r *VancouverParkingRepository) GetAllParkingMeters() ([]*domain.ParkingMet
 		params.Add("offset", strconv.Itoa(offset))
 		params.Add("select", "*")
 
-		url := fmt.Sprintf("%s?%s", r.baseURL, params.Encode())
-
-		resp, err := r.httpClient.Get(url)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch parking meters: %w", err)
-		}
+		url := fmt.Sprintf("%s?%s", r.dataset.BaseURL, params.Encode())
 
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
+		body, err := r.get(url)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %w", err)
+			return nil, err
 		}
 
-		var apiResp VancouverParkingResponse
+		var apiResp datasetResponse
 		if err := json.Unmarshal(body, &apiResp); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 		}
@@ -204,9 +403,15 @@ func (r *VancouverParkingRepository) GetAllParkingMeters() ([]*domain.ParkingMet
 			break
 		}
 
-		for _, data := range apiResp.Results {
-			meter := r.convertToDomainModel(data)
-			allMeters = append(allMeters, meter)
+		for _, record := range apiResp.Results {
+			data, err := r.dataset.decodeRecord(record)
+			if err != nil {
+				fmt.Printf("[DEBUG] Skipping malformed record: %v\n", err)
+				continue
+			}
+			if meter := r.convertToDomainModel(data); meter != nil {
+				allMeters = append(allMeters, meter)
+			}
 		}
 
 		offset += limit
@@ -215,26 +420,137 @@ func (r *VancouverParkingRepository) GetAllParkingMeters() ([]*domain.ParkingMet
 	return allMeters, nil
 }
 
-// convertToDomainModel converts Vancouver API data to domain model
+// convertToDomainModel converts a dataset record to the domain model in dollars
+// and hours, returning nil for meters the missing evening rate policy excludes
+// and for meters with time limits but no rates that no assumed rate covers.
+// Rows without a geo_point_2d are also skipped, since they'd otherwise become
+// meters at (0,0) that the routing service would walk to.
 func (r *VancouverParkingRepository) convertToDomainModel(data VancouverParkingData) *domain.ParkingMeter {
-	return &domain.ParkingMeter{
+	if !hasCoordinates(data.GeoPoint2D.Lat, data.GeoPoint2D.Lng) {
+		fmt.Printf("[DEBUG] Skipping meter %s without coordinates\n", data.MeterID)
+		return nil
+	}
+
+	meter := &domain.ParkingMeter{
 		MeterID:         data.MeterID,
 		Lat:             data.GeoPoint2D.Lat,
 		Lng:             data.GeoPoint2D.Lng,
 		MeterType:       data.MeterHead,
 		LocalArea:       data.LocalArea,
 		CreditCard:      data.CreditCard == "Yes",
-		RateMF9A6P:      domain.ParseRate(data.RateMF9A6P),
-		RateMF6P10:      domain.ParseRate(data.RateMF6P10),
-		RateSA9A6P:      domain.ParseRate(data.RateSA9A6P),
-		RateSA6P10:      domain.ParseRate(data.RateSA6P10),
-		RateSU9A6P:      domain.ParseRate(data.RateSU9A6P),
-		RateSU6P10:      domain.ParseRate(data.RateSU6P10),
-		TimeLimitMF9A6P: domain.ParseTimeLimit(data.TimeMF9A6P),
-		TimeLimitMF6P10: domain.ParseTimeLimit(data.TimeMF6P10),
-		TimeLimitSA9A6P: domain.ParseTimeLimit(data.TimeSA9A6P),
-		TimeLimitSA6P10: domain.ParseTimeLimit(data.TimeSA6P10),
-		TimeLimitSU9A6P: domain.ParseTimeLimit(data.TimeSU9A6P),
-		TimeLimitSU6P10: domain.ParseTimeLimit(data.TimeSU6P10),
+		PayByPhoneZone:  strings.TrimSpace(string(data.PayPhone)),
+		RateMF9A6P:      r.dataset.rate(domain.ParseRate(string(data.RateMF9A6P))),
+		RateMF6P10:      r.dataset.rate(domain.ParseRate(string(data.RateMF6P10))),
+		RateSA9A6P:      r.dataset.rate(domain.ParseRate(string(data.RateSA9A6P))),
+		RateSA6P10:      r.dataset.rate(domain.ParseRate(string(data.RateSA6P10))),
+		RateSU9A6P:      r.dataset.rate(domain.ParseRate(string(data.RateSU9A6P))),
+		RateSU6P10:      r.dataset.rate(domain.ParseRate(string(data.RateSU6P10))),
+		TimeLimitMF9A6P: r.dataset.timeLimit(domain.ParseTimeLimit(string(data.TimeMF9A6P))),
+		TimeLimitMF6P10: r.dataset.timeLimit(domain.ParseTimeLimit(string(data.TimeMF6P10))),
+		TimeLimitSA9A6P: r.dataset.timeLimit(domain.ParseTimeLimit(string(data.TimeSA9A6P))),
+		TimeLimitSA6P10: r.dataset.timeLimit(domain.ParseTimeLimit(string(data.TimeSA6P10))),
+		TimeLimitSU9A6P: r.dataset.timeLimit(domain.ParseTimeLimit(string(data.TimeSU9A6P))),
+		TimeLimitSU6P10: r.dataset.timeLimit(domain.ParseTimeLimit(string(data.TimeSU6P10))),
+
+		// The dataset doesn't publish grace periods, so none are assumed
+		FreeGraceMinutes: 0,
+	}
+
+	if !r.applyMissingEveningRates(meter, data) {
+		fmt.Printf("[DEBUG] Excluding meter %s with a blank evening rate\n", meter.MeterID)
+		return nil
+	}
+
+	if !r.applyAssumedRate(meter) {
+		fmt.Printf("[DEBUG] Excluding meter %s with time limits but no rates\n", meter.MeterID)
+		return nil
+	}
+
+	meter.PrecomputeSchedule()
+
+	return meter
+}
+
+// hasCoordinates reports whether a meter has a usable location; the dataset
+// leaves geo_point_2d out for some rows, which decode as (0,0)
+func hasCoordinates(lat, lng float64) bool {
+	return !(lat == 0 && lng == 0)
+}
+
+// applyAssumedRate prices a meter that lists time limits but no rates at the
+// repository's assumed rate. It returns false if no rate is assumed, so the
+// meter should be excluded rather than treated as free.
+func (r *VancouverParkingRepository) applyAssumedRate(meter *domain.ParkingMeter) bool {
+	windows := []struct {
+		rate  *float64
+		limit int
+	}{
+		{&meter.RateMF9A6P, meter.TimeLimitMF9A6P},
+		{&meter.RateMF6P10, meter.TimeLimitMF6P10},
+		{&meter.RateSA9A6P, meter.TimeLimitSA9A6P},
+		{&meter.RateSA6P10, meter.TimeLimitSA6P10},
+		{&meter.RateSU9A6P, meter.TimeLimitSU9A6P},
+		{&meter.RateSU6P10, meter.TimeLimitSU6P10},
+	}
+
+	limited := false
+	for _, window := range windows {
+		if *window.rate > 0 {
+			return true
+		}
+		limited = limited || window.limit > 0
+	}
+	if !limited {
+		return true
+	}
+	if r.assumedRate <= 0 {
+		return false
+	}
+
+	for _, window := range windows {
+		if window.limit > 0 {
+			*window.rate = r.assumedRate
+		}
+	}
+	meter.RateAssumed = true
+	return true
+}
+
+// applyMissingEveningRates fills in evening windows that list no rate after a
+// priced daytime window, according to the repository's policy. It returns
+// false if the policy excludes the meter.
+func (r *VancouverParkingRepository) applyMissingEveningRates(meter *domain.ParkingMeter, data VancouverParkingData) bool {
+	days := []struct {
+		dayRate, eveningRate, eveningLimit FlexString
+		daytimeRate                        float64
+		daytimeLimit                       int
+		rate                               *float64
+		limit                              *int
+	}{
+		{data.RateMF9A6P, data.RateMF6P10, data.TimeMF6P10, meter.RateMF9A6P, meter.TimeLimitMF9A6P, &meter.RateMF6P10, &meter.TimeLimitMF6P10},
+		{data.RateSA9A6P, data.RateSA6P10, data.TimeSA6P10, meter.RateSA9A6P, meter.TimeLimitSA9A6P, &meter.RateSA6P10, &meter.TimeLimitSA6P10},
+		{data.RateSU9A6P, data.RateSU6P10, data.TimeSU6P10, meter.RateSU9A6P, meter.TimeLimitSU9A6P, &meter.RateSU6P10, &meter.TimeLimitSU6P10},
+	}
+
+	for _, day := range days {
+		if blankField(day.dayRate) || !blankField(day.eveningRate) {
+			continue
+		}
+		switch r.missingEveningRate {
+		case EveningRateInheritDaytime:
+			*day.rate = day.daytimeRate
+			if blankField(day.eveningLimit) {
+				*day.limit = day.daytimeLimit
+			}
+		case EveningRateExclude:
+			return false
+		}
 	}
+
+	return true
+}
+
+// blankField reports whether the API left a field empty or null
+func blankField(value FlexString) bool {
+	return strings.TrimSpace(string(value)) == ""
 }
@@ -0,0 +1,515 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+)
+
+func TestVancouverParkingData_UnmarshalRates(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{
+			name: "String rates",
+			payload: `{
+				"meterid": "570101",
+				"r_mf_9a_6p": "$3.50", "r_mf_6p_10": "$2.00",
+				"r_sa_9a_6p": "$3.00", "r_sa_6p_10": "$2.00",
+				"r_su_9a_6p": "$3.00", "r_su_6p_10": null,
+				"t_mf_9a_6p": "2 Hr", "t_mf_6p_10": "4 Hr",
+				"geo_point_2d": {"lat": 49.2827, "lon": -123.1207}
+			}`,
+		},
+		{
+			name: "Numeric rates",
+			payload: `{
+				"meterid": "570101",
+				"r_mf_9a_6p": 3.5, "r_mf_6p_10": 2,
+				"r_sa_9a_6p": 3.0, "r_sa_6p_10": 2.00,
+				"r_su_9a_6p": 3, "r_su_6p_10": null,
+				"t_mf_9a_6p": 2, "t_mf_6p_10": 4,
+				"geo_point_2d": {"lat": 49.2827, "lon": -123.1207}
+			}`,
+		},
+	}
+
+	repo := NewVancouverParkingRepository()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data VancouverParkingData
+			require.NoError(t, json.Unmarshal([]byte(tt.payload), &data))
+			data.GeoPoint2D.Lat, data.GeoPoint2D.Lng = 49.2827, -123.1207
+
+			meter := repo.convertToDomainModel(data)
+			require.NotNil(t, meter)
+			assert.Equal(t, "570101", meter.MeterID)
+			assert.Equal(t, 3.50, meter.RateMF9A6P)
+			assert.Equal(t, 2.00, meter.RateMF6P10)
+			assert.Equal(t, 3.00, meter.RateSA9A6P)
+			assert.Equal(t, 2.00, meter.RateSA6P10)
+			assert.Equal(t, 3.00, meter.RateSU9A6P)
+			assert.Equal(t, 0.0, meter.RateSU6P10)
+			assert.Equal(t, 2, meter.TimeLimitMF9A6P)
+			assert.Equal(t, 4, meter.TimeLimitMF6P10)
+			assert.Equal(t, 49.2827, meter.Lat)
+		})
+	}
+}
+
+func TestFlexString_RejectsOtherTypes(t *testing.T) {
+	var data VancouverParkingData
+	err := json.Unmarshal([]byte(`{"r_mf_9a_6p": {"amount": 3.5}}`), &data)
+	assert.Error(t, err)
+}
+
+func TestGeoPoint_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		lat     float64
+		lng     float64
+	}{
+		{name: "Object", payload: `{"lat": 49.2827, "lon": -123.1207}`, lat: 49.2827, lng: -123.1207},
+		{name: "Inline string", payload: `"49.2827,-123.1207"`, lat: 49.2827, lng: -123.1207},
+		{name: "Inline string with a space", payload: `"49.2827, -123.1207"`, lat: 49.2827, lng: -123.1207},
+		{name: "Null", payload: `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data VancouverParkingData
+			require.NoError(t, json.Unmarshal([]byte(`{"meterid": "570301", "geo_point_2d": `+tt.payload+`}`), &data))
+			assert.Equal(t, tt.lat, data.GeoPoint2D.Lat)
+			assert.Equal(t, tt.lng, data.GeoPoint2D.Lng)
+		})
+	}
+
+	for _, payload := range []string{`"49.2827"`, `"north,west"`, `[49.2827, -123.1207]`, `true`} {
+		var point GeoPoint
+		assert.Error(t, json.Unmarshal([]byte(payload), &point), payload)
+	}
+}
+
+func TestVancouverParkingRepository_InlineGeoPoint(t *testing.T) {
+	// The second row's point is inline and the third's can't be read
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+			"total_count": 3,
+			"results": [
+				{"meterid": "570301", "r_mf_9a_6p": "$3.50", "geo_point_2d": {"lat": 49.2827, "lon": -123.1207}},
+				{"meterid": "570302", "r_mf_9a_6p": "$3.50", "geo_point_2d": "49.2829,-123.1209"},
+				{"meterid": "570303", "r_mf_9a_6p": "$3.50", "geo_point_2d": "somewhere downtown"}
+			]
+		}`)
+	}))
+	defer server.Close()
+
+	dataset := VancouverDataset()
+	dataset.BaseURL = server.URL
+	repo := NewVancouverParkingRepository(WithDataset(dataset))
+
+	meters, err := repo.GetParkingMetersNear(49.2827, -123.1207, 0.5)
+	require.NoError(t, err)
+	require.Len(t, meters, 2)
+	assert.Equal(t, "570301", meters[0].MeterID)
+	assert.Equal(t, "570302", meters[1].MeterID)
+	assert.Equal(t, 49.2829, meters[1].Lat)
+	assert.Equal(t, -123.1209, meters[1].Lng)
+}
+
+func TestVancouverParkingRepository_RadiusInKilometres(t *testing.T) {
+	// The API's box can hand back meters beyond the radius: these are about
+	// 0, 0.3 and 0.75 km from the stop
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+			"total_count": 3,
+			"results": [
+				{"meterid": "HERE", "r_mf_9a_6p": "$3.50", "geo_point_2d": {"lat": 49.2827, "lon": -123.1207}},
+				{"meterid": "NEAR", "r_mf_9a_6p": "$3.50", "geo_point_2d": {"lat": 49.2854, "lon": -123.1207}},
+				{"meterid": "FAR", "r_mf_9a_6p": "$3.50", "geo_point_2d": {"lat": 49.2894, "lon": -123.1207}}
+			]
+		}`)
+	}))
+	defer server.Close()
+
+	dataset := VancouverDataset()
+	dataset.BaseURL = server.URL
+	repo := NewVancouverParkingRepository(WithDataset(dataset))
+
+	meters, err := repo.GetParkingMetersNear(49.2827, -123.1207, 0.5)
+	require.NoError(t, err)
+	require.Len(t, meters, 2)
+	assert.Equal(t, "HERE", meters[0].MeterID)
+	assert.Equal(t, "NEAR", meters[1].MeterID)
+
+	meters, err = repo.GetParkingMetersNear(49.2827, -123.1207, 0.2)
+	require.NoError(t, err)
+	require.Len(t, meters, 1)
+	assert.Equal(t, "HERE", meters[0].MeterID)
+}
+
+func TestVancouverParkingRepository_SearchBoxFromRadius(t *testing.T) {
+	type query struct {
+		latMin, lngMin, latMax, lngMax float64
+		limit, offset                  int
+	}
+
+	// newRepo serves the meters the way the records API does: those inside
+	// the where clause's box, a page at a time
+	newRepo := func(t *testing.T, meters map[string]domain.Location) (*VancouverParkingRepository, *[]query) {
+		ids := make([]string, 0, len(meters))
+		for id := range meters {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		var queries []query
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var q query
+			_, err := fmt.Sscanf(r.URL.Query().Get("where"), "in_bbox(geo_point_2d, %f, %f, %f, %f)", &q.latMin, &q.lngMin, &q.latMax, &q.lngMax)
+			require.NoError(t, err)
+			q.limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+			q.offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+			require.LessOrEqual(t, q.limit, 100)
+			queries = append(queries, q)
+
+			var inBox []string
+			for _, id := range ids {
+				loc := meters[id]
+				if loc.Lat >= q.latMin && loc.Lat <= q.latMax && loc.Lng >= q.lngMin && loc.Lng <= q.lngMax {
+					inBox = append(inBox, fmt.Sprintf(`{"meterid": %q, "r_mf_9a_6p": "$3.50", "geo_point_2d": {"lat": %f, "lon": %f}}`, id, loc.Lat, loc.Lng))
+				}
+			}
+			page := inBox[min(q.offset, len(inBox)):min(q.offset+q.limit, len(inBox))]
+			fmt.Fprintf(w, `{"total_count": %d, "results": [%s]}`, len(inBox), strings.Join(page, ","))
+		}))
+		t.Cleanup(server.Close)
+
+		dataset := VancouverDataset()
+		dataset.BaseURL = server.URL
+		return NewVancouverParkingRepository(WithDataset(dataset)), &queries
+	}
+
+	t.Run("The box grows with the radius", func(t *testing.T) {
+		// FAR is about 1.5 km east of the stop
+		repo, queries := newRepo(t, map[string]domain.Location{
+			"HERE": {Lat: 49.2827, Lng: -123.1207},
+			"FAR":  {Lat: 49.2827, Lng: -123.1001},
+		})
+
+		meters, err := repo.GetParkingMetersNear(49.2827, -123.1207, 0.5)
+		require.NoError(t, err)
+		require.Len(t, meters, 1)
+		assert.Equal(t, "HERE", meters[0].MeterID)
+
+		meters, err = repo.GetParkingMetersNear(49.2827, -123.1207, 2)
+		require.NoError(t, err)
+		require.Len(t, meters, 2)
+		assert.Equal(t, "FAR", meters[1].MeterID)
+
+		require.Len(t, *queries, 2)
+		small, large := (*queries)[0], (*queries)[1]
+		assert.InDelta(t, 2*0.5/111.32, small.latMax-small.latMin, 1e-5)
+		assert.InDelta(t, 4*(small.latMax-small.latMin), large.latMax-large.latMin, 1e-5)
+		assert.InDelta(t, 4*(small.lngMax-small.lngMin), large.lngMax-large.lngMin, 1e-5)
+		// A degree of longitude is shorter than one of latitude this far north
+		assert.Greater(t, small.lngMax-small.lngMin, small.latMax-small.latMin)
+	})
+
+	t.Run("Larger searches fetch more pages", func(t *testing.T) {
+		// 250 meters in a row north of the stop, about 1 m apart
+		meters := map[string]domain.Location{}
+		for i := 0; i < 250; i++ {
+			meters[fmt.Sprintf("M%03d", i)] = domain.Location{Lat: 49.2827 + float64(i)*0.00001, Lng: -123.1207}
+		}
+		repo, queries := newRepo(t, meters)
+
+		nearby, err := repo.GetParkingMetersNear(49.2827, -123.1207, 1)
+		require.NoError(t, err)
+		require.Len(t, nearby, 250)
+		assert.Equal(t, "M000", nearby[0].MeterID)
+		assert.Equal(t, "M249", nearby[249].MeterID)
+		require.Len(t, *queries, 3)
+		for i, q := range *queries {
+			assert.Equal(t, 100, q.limit)
+			assert.Equal(t, 100*i, q.offset)
+		}
+
+		// A small search still fetches a full page, and stops there
+		*queries = nil
+		_, err = repo.GetParkingMetersNear(49.2827, -123.1207, 0.25)
+		require.NoError(t, err)
+		require.Len(t, *queries, 1)
+		assert.Equal(t, 100, (*queries)[0].limit)
+	})
+}
+
+func TestNearbyRecordLimit(t *testing.T) {
+	assert.Equal(t, 100, nearbyRecordLimit(0.25))
+	assert.Equal(t, 200, nearbyRecordLimit(0.5))
+	assert.Equal(t, 800, nearbyRecordLimit(1))
+	assert.Equal(t, 1000, nearbyRecordLimit(5))
+}
+
+func TestVancouverParkingData_PayByPhoneZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		expected string
+	}{
+		{name: "String zone", payload: `{"meterid": "570101", "pay_phone": "66001"}`, expected: "66001"},
+		{name: "Numeric zone", payload: `{"meterid": "570101", "pay_phone": 66001}`, expected: "66001"},
+		{name: "Null zone", payload: `{"meterid": "570101", "pay_phone": null}`, expected: ""},
+		{name: "Missing zone", payload: `{"meterid": "570101"}`, expected: ""},
+	}
+
+	repo := NewVancouverParkingRepository()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data VancouverParkingData
+			require.NoError(t, json.Unmarshal([]byte(tt.payload), &data))
+			data.GeoPoint2D.Lat, data.GeoPoint2D.Lng = 49.2827, -123.1207
+
+			meter := repo.convertToDomainModel(data)
+			require.NotNil(t, meter)
+			assert.Equal(t, tt.expected, meter.PayByPhoneZone)
+		})
+	}
+}
+
+func TestConvertToDomainModel_MissingEveningRate(t *testing.T) {
+	// Weekday evening rate and limit are blank; Saturday's evening is explicitly free
+	payload := `{
+		"meterid": "570101",
+		"r_mf_9a_6p": "$3.50", "r_mf_6p_10": null,
+		"t_mf_9a_6p": "2 Hr", "t_mf_6p_10": "",
+		"r_sa_9a_6p": "$3.00", "r_sa_6p_10": "$0.00",
+		"geo_point_2d": {"lat": 49.2827, "lon": -123.1207}
+	}`
+	var data VancouverParkingData
+	require.NoError(t, json.Unmarshal([]byte(payload), &data))
+
+	t.Run("Free by default", func(t *testing.T) {
+		meter := NewVancouverParkingRepository().convertToDomainModel(data)
+		require.NotNil(t, meter)
+		assert.Equal(t, 0.0, meter.RateMF6P10)
+		assert.Equal(t, 0, meter.TimeLimitMF6P10)
+	})
+
+	t.Run("Inherit daytime", func(t *testing.T) {
+		repo := NewVancouverParkingRepository(WithMissingEveningRatePolicy(EveningRateInheritDaytime))
+		meter := repo.convertToDomainModel(data)
+		require.NotNil(t, meter)
+		assert.Equal(t, 3.50, meter.RateMF6P10)
+		assert.Equal(t, 2, meter.TimeLimitMF6P10)
+		assert.Equal(t, 0.0, meter.RateSA6P10) // an explicit $0.00 is kept
+	})
+
+	t.Run("Exclude", func(t *testing.T) {
+		repo := NewVancouverParkingRepository(WithMissingEveningRatePolicy(EveningRateExclude))
+		assert.Nil(t, repo.convertToDomainModel(data))
+
+		// Meters with every evening rate listed are unaffected
+		var complete VancouverParkingData
+		require.NoError(t, json.Unmarshal([]byte(`{"meterid": "570102", "r_mf_9a_6p": "$3.50", "r_mf_6p_10": "$1.00", "geo_point_2d": {"lat": 49.2827, "lon": -123.1207}}`), &complete))
+		assert.NotNil(t, repo.convertToDomainModel(complete))
+	})
+
+	t.Run("Policy names", func(t *testing.T) {
+		policy, err := ParseMissingEveningRatePolicy("inherit")
+		require.NoError(t, err)
+		assert.Equal(t, EveningRateInheritDaytime, policy)
+
+		_, err = ParseMissingEveningRatePolicy("guess")
+		assert.Error(t, err)
+	})
+}
+
+func TestConvertToDomainModel_AssumedRate(t *testing.T) {
+	// Time limits are listed, but every rate is blank
+	payload := `{
+		"meterid": "570201",
+		"t_mf_9a_6p": "2 Hr", "t_sa_9a_6p": "2 Hr",
+		"geo_point_2d": {"lat": 49.2827, "lon": -123.1207}
+	}`
+	var data VancouverParkingData
+	require.NoError(t, json.Unmarshal([]byte(payload), &data))
+
+	t.Run("Excluded by default", func(t *testing.T) {
+		assert.Nil(t, NewVancouverParkingRepository().convertToDomainModel(data))
+	})
+
+	t.Run("Assumed rate", func(t *testing.T) {
+		meter := NewVancouverParkingRepository(WithAssumedRate(2.50)).convertToDomainModel(data)
+		require.NotNil(t, meter)
+		assert.True(t, meter.RateAssumed)
+		assert.Equal(t, 2.50, meter.RateMF9A6P)
+		assert.Equal(t, 2.50, meter.RateSA9A6P)
+		assert.Equal(t, 0.0, meter.RateMF6P10) // no limit listed, so still free
+	})
+
+	t.Run("Meters with a rate are unaffected", func(t *testing.T) {
+		var priced VancouverParkingData
+		require.NoError(t, json.Unmarshal([]byte(`{"meterid": "570202", "r_mf_9a_6p": "$3.50", "t_mf_9a_6p": "2 Hr", "geo_point_2d": {"lat": 49.2827, "lon": -123.1207}}`), &priced))
+		meter := NewVancouverParkingRepository(WithAssumedRate(2.50)).convertToDomainModel(priced)
+		require.NotNil(t, meter)
+		assert.False(t, meter.RateAssumed)
+		assert.Equal(t, 3.50, meter.RateMF9A6P)
+	})
+}
+
+func TestVancouverParkingRepository_SkipsMetersWithoutCoordinates(t *testing.T) {
+	// The second row has no geo_point_2d and the third an explicit (0,0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+			"total_count": 3,
+			"results": [
+				{"meterid": "570301", "r_mf_9a_6p": "$3.50", "geo_point_2d": {"lat": 49.2827, "lon": -123.1207}},
+				{"meterid": "570302", "r_mf_9a_6p": "$3.50"},
+				{"meterid": "570303", "r_mf_9a_6p": "$3.50", "geo_point_2d": {"lat": 0, "lon": 0}}
+			]
+		}`)
+	}))
+	defer server.Close()
+
+	dataset := VancouverDataset()
+	dataset.BaseURL = server.URL
+	repo := NewVancouverParkingRepository(WithDataset(dataset))
+
+	meters, err := repo.GetParkingMetersNear(49.2827, -123.1207, 0.5)
+	require.NoError(t, err)
+	require.Len(t, meters, 1)
+	assert.Equal(t, "570301", meters[0].MeterID)
+
+	// The cache drops coordinate-less meters from any wrapped repository
+	cached := NewCachedParkingRepository(&stubRepository{meters: []*domain.ParkingMeter{
+		{MeterID: "570301", Lat: 49.2827, Lng: -123.1207},
+		{MeterID: "570302"},
+	}}, time.Minute)
+	meters, err = cached.GetParkingMetersNear(0, 0, 0.5)
+	require.NoError(t, err)
+	assert.Empty(t, meters)
+}
+
+func TestVancouverParkingRepository_AlternateDataset(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		fmt.Fprint(w, `{
+			"total_count": 1,
+			"results": [{
+				"station_id": "TO-1001",
+				"hourly_rate_cents": 450,
+				"evening_rate_cents": 200,
+				"max_stay_minutes": 180,
+				"location": {"latitude": 43.6532, "longitude": -79.3832}
+			}]
+		}`)
+	}))
+	defer server.Close()
+
+	repo := NewVancouverParkingRepository(WithDataset(DatasetConfig{
+		BaseURL: server.URL,
+		Fields: DatasetFields{
+			MeterID:    "station_id",
+			RateMF9A6P: "hourly_rate_cents",
+			RateMF6P10: "evening_rate_cents",
+			TimeMF9A6P: "max_stay_minutes",
+			GeoPoint:   "location",
+			GeoLat:     "latitude",
+			GeoLng:     "longitude",
+		},
+		RateMultiplier: 0.01,
+		TimeLimitUnit:  time.Minute,
+	}))
+
+	meters, err := repo.GetParkingMetersNear(43.6532, -79.3832, 0.5)
+	require.NoError(t, err)
+	require.Len(t, meters, 1)
+
+	assert.Contains(t, query.Get("where"), "in_bbox(location,")
+
+	meter := meters[0]
+	assert.Equal(t, "TO-1001", meter.MeterID)
+	assert.Equal(t, 43.6532, meter.Lat)
+	assert.Equal(t, -79.3832, meter.Lng)
+	assert.InDelta(t, 4.50, meter.RateMF9A6P, 1e-9)
+	assert.InDelta(t, 2.00, meter.RateMF6P10, 1e-9)
+	assert.Equal(t, 3, meter.TimeLimitMF9A6P)
+	assert.Equal(t, 0.0, meter.RateSA9A6P) // unmapped fields are left empty
+}
+
+func TestDatasetConfig_VancouverDecodesLikeStructTags(t *testing.T) {
+	payload := `{
+		"meterid": "570101",
+		"meterhead": "Twin",
+		"geo_local_area": "Downtown",
+		"creditcard": "Yes",
+		"pay_phone": 12345,
+		"r_mf_9a_6p": "$3.50",
+		"r_mf_6p_10": 1.5,
+		"t_mf_9a_6p": "2 Hr",
+		"geo_point_2d": {"lat": 49.2827, "lon": -123.1207}
+	}`
+
+	var expected VancouverParkingData
+	require.NoError(t, json.Unmarshal([]byte(payload), &expected))
+
+	var record map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(payload), &record))
+	data, err := VancouverDataset().decodeRecord(record)
+	require.NoError(t, err)
+
+	assert.Equal(t, expected, data)
+}
+
+func TestVancouverParkingRepository_GetParkingMeter(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		if query.Get("where") != `meterid = "570301"` {
+			fmt.Fprint(w, `{"total_count": 0, "results": []}`)
+			return
+		}
+		fmt.Fprint(w, `{
+			"total_count": 1,
+			"results": [{"meterid": "570301", "r_mf_9a_6p": "$3.50", "geo_point_2d": {"lat": 49.2827, "lon": -123.1207}}]
+		}`)
+	}))
+	defer server.Close()
+
+	dataset := VancouverDataset()
+	dataset.BaseURL = server.URL
+	repo := NewVancouverParkingRepository(WithDataset(dataset))
+
+	meter, err := repo.GetParkingMeter("570301")
+	require.NoError(t, err)
+	assert.Equal(t, "570301", meter.MeterID)
+	assert.Equal(t, 3.50, meter.RateMF9A6P)
+	assert.Equal(t, "1", query.Get("limit"))
+
+	_, err = repo.GetParkingMeter("999999")
+	assert.ErrorIs(t, err, ErrMeterNotFound)
+
+	// The cache passes lookups through, and finds nothing when it can't
+	meter, err = NewCachedParkingRepository(repo, time.Minute).GetParkingMeter("570301")
+	require.NoError(t, err)
+	assert.Equal(t, "570301", meter.MeterID)
+	_, err = NewCachedParkingRepository(&stubRepository{}, time.Minute).GetParkingMeter("570301")
+	assert.ErrorIs(t, err, ErrMeterNotFound)
+}
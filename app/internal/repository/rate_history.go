@@ -0,0 +1,20 @@
+package repository
+
+import "time"
+
+// RateHistoryProvider reports how meters' rates have changed, from the dataset
+// or a companion source that keeps past rates
+type RateHistoryProvider interface {
+	// RateChange returns how much the meter's daytime weekday rate has risen
+	// (negative if it fell) over the period up to now, and false when there is
+	// no history for the meter
+	RateChange(meterID string, period time.Duration) (float64, bool, error)
+}
+
+// NoRateHistory knows no meter's past rates. It is the default.
+type NoRateHistory struct{}
+
+// RateChange always reports no history
+func (NoRateHistory) RateChange(meterID string, period time.Duration) (float64, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrUpstreamStatus is returned when the parking API answers with an error
+// status, after any retries
+var ErrUpstreamStatus = errors.New("parking API request failed")
+
+// RetryPolicy is how requests to the parking API are retried after transient
+// failures: network errors, 429 Too Many Requests and 5xx responses. Other
+// error statuses fail at once.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a request is made in all; 1 or less never retries
+	MaxAttempts int
+
+	// BaseDelay is the wait before the first retry, doubling before each
+	// further one up to MaxDelay, if set. A longer Retry-After is honoured,
+	// still capped at MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Jitter is the fraction, from 0 to 1, of each wait taken off at random so
+	// that clients failing together don't retry together
+	Jitter float64
+}
+
+// DefaultRetryPolicy makes three attempts, waiting about half a second and
+// then a second between them
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// WithRetryPolicy sets how failed requests to the parking API are retried
+func WithRetryPolicy(policy RetryPolicy) RepositoryOption {
+	return func(r *VancouverParkingRepository) {
+		r.retry = policy
+	}
+}
+
+// delay returns the wait before the given retry, counting from 1, when the
+// server asked for retryAfter (zero if it didn't)
+func (p RetryPolicy) delay(retry int, retryAfter time.Duration) time.Duration {
+	delay := p.BaseDelay << (retry - 1)
+	if delay < 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(p.Jitter * rand.Float64() * float64(delay))
+	}
+
+	if retryAfter > delay {
+		delay = retryAfter
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+	return delay
+}
+
+// retryable reports whether a response status is worth another attempt
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date, returning zero if it is missing or can't be read
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// get fetches url from the parking API and returns the response body,
+// retrying transient failures under the repository's retry policy
+func (r *VancouverParkingRepository) get(url string) ([]byte, error) {
+	sleep := r.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	for attempt := 1; ; attempt++ {
+		body, retryAfter, err := r.getOnce(url)
+		if err == nil || retryAfter < 0 || attempt >= r.retry.MaxAttempts {
+			return body, err
+		}
+
+		delay := r.retry.delay(attempt, retryAfter)
+		fmt.Printf("[DEBUG] Parking API request failed (%v), retrying in %s\n", err, delay)
+		sleep(delay)
+	}
+}
+
+// getOnce makes a single request. On failure it also returns the wait the
+// server asked for, or -1 if the request shouldn't be retried.
+func (r *VancouverParkingRepository) getOnce(url string) ([]byte, time.Duration, error) {
+	resp, err := r.httpClient.Get(url)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch parking meters: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("%w: %s", ErrUpstreamStatus, resp.Status)
+		if !retryable(resp.StatusCode) {
+			return nil, -1, err
+		}
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()), err
+	}
+	return body, 0, nil
+}
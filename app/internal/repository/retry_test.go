@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVancouverParkingRepository_Retry(t *testing.T) {
+	const page = `{"total_count": 1, "results": [
+		{"meterid": "570301", "r_mf_9a_6p": "$3.50", "geo_point_2d": {"lat": 49.2827, "lon": -123.1207}}
+	]}`
+
+	// newRepo serves the given statuses in turn, then the page
+	newRepo := func(t *testing.T, policy RetryPolicy, statuses ...int) (*VancouverParkingRepository, *int32, *[]time.Duration) {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := int(atomic.AddInt32(&requests, 1))
+			if n <= len(statuses) {
+				if statuses[n-1] == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "2")
+				}
+				w.WriteHeader(statuses[n-1])
+				return
+			}
+			fmt.Fprint(w, page)
+		}))
+		t.Cleanup(server.Close)
+
+		dataset := VancouverDataset()
+		dataset.BaseURL = server.URL
+		repo := NewVancouverParkingRepository(WithDataset(dataset), WithRetryPolicy(policy))
+		var waits []time.Duration
+		repo.sleep = func(d time.Duration) { waits = append(waits, d) }
+		return repo, &requests, &waits
+	}
+
+	t.Run("Transient failures are retried", func(t *testing.T) {
+		repo, requests, waits := newRepo(t, RetryPolicy{MaxAttempts: 3}, http.StatusServiceUnavailable, http.StatusBadGateway)
+
+		meters, err := repo.GetParkingMetersNear(49.2827, -123.1207, 0.5)
+		require.NoError(t, err)
+		require.Len(t, meters, 1)
+		assert.Equal(t, "570301", meters[0].MeterID)
+		assert.EqualValues(t, 3, *requests)
+		assert.Equal(t, []time.Duration{0, 0}, *waits)
+	})
+
+	t.Run("Backoff doubles and Retry-After is honoured", func(t *testing.T) {
+		policy := RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+		repo, _, waits := newRepo(t, policy, http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusInternalServerError)
+
+		_, err := repo.GetParkingMeter("570301")
+		require.NoError(t, err)
+		// The 429 asked for two seconds, as long as the backoff had reached
+		assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, *waits)
+	})
+
+	t.Run("Client errors fail at once", func(t *testing.T) {
+		repo, requests, _ := newRepo(t, RetryPolicy{MaxAttempts: 3}, http.StatusBadRequest)
+
+		_, err := repo.GetAllParkingMeters()
+		require.ErrorIs(t, err, ErrUpstreamStatus)
+		assert.Contains(t, err.Error(), "400")
+		assert.EqualValues(t, 1, *requests)
+	})
+
+	t.Run("Gives up after the last attempt", func(t *testing.T) {
+		repo, requests, _ := newRepo(t, RetryPolicy{MaxAttempts: 2}, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+
+		_, err := repo.GetParkingMetersNear(49.2827, -123.1207, 0.5)
+		require.ErrorIs(t, err, ErrUpstreamStatus)
+		assert.EqualValues(t, 2, *requests)
+	})
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second, Jitter: 0.5}
+	for retry := 1; retry <= 5; retry++ {
+		full := min(time.Second<<(retry-1), 5*time.Second)
+		delay := policy.delay(retry, 0)
+		assert.LessOrEqual(t, delay, full)
+		assert.GreaterOrEqual(t, delay, full/2)
+	}
+
+	// A long Retry-After is capped at MaxDelay
+	assert.Equal(t, 5*time.Second, policy.delay(1, time.Minute))
+
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, time.Minute, parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+}
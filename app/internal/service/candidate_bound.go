@@ -0,0 +1,49 @@
+package service
+
+// WithCandidatePruning turns branch-and-bound pruning of partial routes on or
+// off; it is on by default. Pruning relies on the hybrid score never falling
+// as cost, time or walking grow, so turn it off for a ScoreFunc that does.
+func WithCandidatePruning(enabled bool) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.pruneCandidates = enabled
+	}
+}
+
+// candidateBound tracks the best cost, transit time and hybrid score of the
+// candidates completed so far in a planning run. Those only grow as a route is
+// extended, so a partial route already worse than the best on all three can
+// never become the cheapest, fastest or hybrid plan and is abandoned.
+type candidateBound struct {
+	set     bool
+	cost    float64
+	transit int
+	score   float64
+
+	// pruned counts the partial routes abandoned
+	pruned int
+}
+
+// exceeded reports whether a partial route is worse than the best completed
+// candidates on every objective. A nil bound never prunes.
+func (b *candidateBound) exceeded(cost float64, transit int, score float64) bool {
+	if b == nil || !b.set {
+		return false
+	}
+	return cost > b.cost && transit > b.transit && score > b.score
+}
+
+// record tightens the bound with a completed candidate
+func (b *candidateBound) record(candidate *RouteCandidate) {
+	if b == nil {
+		return
+	}
+	transit := candidate.TransitTime()
+	if !b.set {
+		b.set = true
+		b.cost, b.transit, b.score = candidate.TotalCost, transit, candidate.HybridScore
+		return
+	}
+	b.cost = min(b.cost, candidate.TotalCost)
+	b.transit = min(b.transit, transit)
+	b.score = min(b.score, candidate.HybridScore)
+}
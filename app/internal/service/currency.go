@@ -0,0 +1,81 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// currencyFormat describes how a locale writes Canadian dollar amounts
+type currencyFormat struct {
+	decimal   string
+	thousands string
+	prefix    string
+	suffix    string
+}
+
+// currencyFormats maps locales to their CAD formatting. Languages without a
+// region entry fall back to the language-only entry.
+var currencyFormats = map[string]currencyFormat{
+	"en-CA": {decimal: ".", thousands: ",", prefix: "$"},
+	"en":    {decimal: ".", thousands: ",", prefix: "CA$"},
+	"fr-CA": {decimal: ",", thousands: " ", suffix: " $"},
+	"fr":    {decimal: ",", thousands: " ", suffix: " $CA"},
+}
+
+// defaultCurrencyFormat is used when no locale is requested
+var defaultCurrencyFormat = currencyFormats["en-CA"]
+
+// SupportedLocale reports whether cost strings can be formatted for a locale
+func SupportedLocale(locale string) bool {
+	_, ok := lookupCurrencyFormat(locale)
+	return ok
+}
+
+func lookupCurrencyFormat(locale string) (currencyFormat, bool) {
+	if locale == "" {
+		return defaultCurrencyFormat, true
+	}
+
+	normalized := strings.ReplaceAll(locale, "_", "-")
+	parts := strings.SplitN(normalized, "-", 2)
+	language := strings.ToLower(parts[0])
+	if len(parts) == 2 {
+		if format, ok := currencyFormats[language+"-"+strings.ToUpper(parts[1])]; ok {
+			return format, true
+		}
+	}
+
+	format, ok := currencyFormats[language]
+	return format, ok
+}
+
+// FormatCurrency renders a dollar amount for display in the given locale,
+// e.g. "$1,234.50" for en-CA or "1 234,50 $" for fr-CA. Unsupported locales
+// use the default en-CA format.
+func FormatCurrency(amount float64, locale string) string {
+	format, ok := lookupCurrencyFormat(locale)
+	if !ok {
+		format = defaultCurrencyFormat
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	cents := int64(math.Round(amount * 100))
+	whole := fmt.Sprintf("%d", cents/100)
+
+	// Group the whole part into thousands
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteString(format.thousands)
+		}
+		grouped.WriteRune(digit)
+	}
+
+	return fmt.Sprintf("%s%s%s%s%02d%s", sign, format.prefix, grouped.String(), format.decimal, cents%100, format.suffix)
+}
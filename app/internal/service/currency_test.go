@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   float64
+		locale   string
+		expected string
+	}{
+		{"Default locale", 12.5, "", "$12.50"},
+		{"Canadian English", 1234.5, "en-CA", "$1,234.50"},
+		{"French Canadian", 12.5, "fr-CA", "12,50 $"},
+		{"French Canadian thousands", 1234.5, "fr_CA", "1 234,50 $"},
+		{"American English", 12.5, "en-US", "CA$12.50"},
+		{"France", 12.5, "fr-FR", "12,50 $CA"},
+		{"Negative amount", -3.25, "en-CA", "-$3.25"},
+		{"Unsupported locale falls back", 12.5, "de-DE", "$12.50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, FormatCurrency(tt.amount, tt.locale))
+		})
+	}
+}
+
+func TestSupportedLocale(t *testing.T) {
+	assert.True(t, SupportedLocale(""))
+	assert.True(t, SupportedLocale("fr-CA"))
+	assert.True(t, SupportedLocale("en-GB"))
+	assert.False(t, SupportedLocale("de-DE"))
+}
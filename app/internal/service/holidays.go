@@ -0,0 +1,97 @@
+package service
+
+import "time"
+
+// HolidayCalendar reports whether a date is a holiday, on which meters charge
+// their Sunday rates
+type HolidayCalendar interface {
+	// IsHoliday reports whether t falls on a holiday, judged by t's own date
+	IsHoliday(t time.Time) bool
+}
+
+// HolidaySet is a fixed set of holiday dates, e.g. a city's published calendar
+type HolidaySet map[string]bool
+
+// NewHolidaySet returns the set of the given dates
+func NewHolidaySet(dates ...time.Time) HolidaySet {
+	set := make(HolidaySet, len(dates))
+	for _, date := range dates {
+		set[date.Format(time.DateOnly)] = true
+	}
+	return set
+}
+
+// IsHoliday reports whether t's date is in the set
+func (h HolidaySet) IsHoliday(t time.Time) bool {
+	return h[t.Format(time.DateOnly)]
+}
+
+// BCStatutoryHolidays are British Columbia's statutory holidays, worked out
+// for any year. Holidays count on the day itself; days off given in lieu of a
+// holiday falling at the weekend are not holidays.
+type BCStatutoryHolidays struct{}
+
+// IsHoliday reports whether t falls on a BC statutory holiday
+func (BCStatutoryHolidays) IsHoliday(t time.Time) bool {
+	year, month, day := t.Date()
+	for _, holiday := range bcStatutoryHolidays(year) {
+		if holiday.Month() == month && holiday.Day() == day {
+			return true
+		}
+	}
+	return false
+}
+
+// bcStatutoryHolidays lists the year's BC statutory holidays, as UTC dates
+func bcStatutoryHolidays(year int) []time.Time {
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	holidays := []time.Time{
+		date(time.January, 1),                                  // New Year's Day
+		nthWeekday(year, time.February, time.Monday, 3),        // Family Day
+		easterSunday(year).AddDate(0, 0, -2),                   // Good Friday
+		lastWeekdayOnOrBefore(date(time.May, 24), time.Monday), // Victoria Day
+		date(time.July, 1),                                     // Canada Day
+		nthWeekday(year, time.August, time.Monday, 1),          // British Columbia Day
+		nthWeekday(year, time.September, time.Monday, 1),       // Labour Day
+		nthWeekday(year, time.October, time.Monday, 2),         // Thanksgiving
+		date(time.November, 11),                                // Remembrance Day
+		date(time.December, 25),                                // Christmas Day
+	}
+	if year >= 2023 {
+		holidays = append(holidays, date(time.September, 30)) // National Day for Truth and Reconciliation
+	}
+	return holidays
+}
+
+// nthWeekday returns the nth given weekday of the month
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	offset := (int(weekday) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, offset+7*(n-1))
+}
+
+// lastWeekdayOnOrBefore returns the latest given weekday no later than date
+func lastWeekdayOnOrBefore(date time.Time, weekday time.Weekday) time.Time {
+	offset := (int(date.Weekday()) - int(weekday) + 7) % 7
+	return date.AddDate(0, 0, -offset)
+}
+
+// easterSunday returns the date of Easter Sunday, by the anonymous Gregorian
+// algorithm
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
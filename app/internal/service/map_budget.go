@@ -0,0 +1,116 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// budgetedMapsService caps the number of upstream maps calls made for a single
+// plan. Identical travel-time lookups are served from a local cache, and once
+// the budget is spent travel times fall back to straight-line estimates.
+type budgetedMapsService struct {
+	next      maps.MapsService
+	maxCalls  int
+	earth     maps.Earth // estimates travel times once the budget is spent
+	mu        sync.Mutex
+	calls     int
+	estimated int
+	travel    map[string]int
+}
+
+func newBudgetedMapsService(next maps.MapsService, maxCalls int, earth maps.Earth) *budgetedMapsService {
+	return &budgetedMapsService{
+		next:     next,
+		maxCalls: maxCalls,
+		earth:    earth,
+		travel:   make(map[string]int),
+	}
+}
+
+// spend reserves one upstream call, returning false when the budget is exhausted
+func (b *budgetedMapsService) spend() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.calls >= b.maxCalls {
+		b.estimated++
+		return false
+	}
+	b.calls++
+	return true
+}
+
+// Limited reports whether any lookup had to be estimated because of the budget
+func (b *budgetedMapsService) Limited() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.estimated > 0
+}
+
+// CallsUsed returns the number of upstream calls made
+func (b *budgetedMapsService) CallsUsed() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls
+}
+
+func travelKey(from, to *domain.Location) string {
+	return fmt.Sprintf("%.6f,%.6f|%.6f,%.6f", from.Lat, from.Lng, to.Lat, to.Lng)
+}
+
+// GetTravelTime returns a cached or upstream travel time, or an estimate once the budget is spent
+func (b *budgetedMapsService) GetTravelTime(from, to *domain.Location, departureTime time.Time) (int, error) {
+	key := travelKey(from, to)
+
+	b.mu.Lock()
+	minutes, ok := b.travel[key]
+	b.mu.Unlock()
+	if ok {
+		return minutes, nil
+	}
+
+	if !b.spend() {
+		return b.earth.DrivingTime(from, to), nil
+	}
+
+	minutes, err := b.next.GetTravelTime(from, to, departureTime)
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	b.travel[key] = minutes
+	b.mu.Unlock()
+
+	return minutes, nil
+}
+
+// GetTravelTimeMatrix counts as a single call, falling back to an estimated matrix
+func (b *budgetedMapsService) GetTravelTimeMatrix(locations []*domain.Location, departureTime time.Time) ([][]int, error) {
+	if b.spend() {
+		return b.next.GetTravelTimeMatrix(locations, departureTime)
+	}
+
+	matrix := make([][]int, len(locations))
+	for i := range locations {
+		matrix[i] = make([]int, len(locations))
+		for j := range locations {
+			if i != j {
+				matrix[i][j] = b.earth.DrivingTime(locations[i], locations[j])
+			}
+		}
+	}
+	return matrix, nil
+}
+
+// GeocodeAddress has no offline fallback, so an exhausted budget is an error
+func (b *budgetedMapsService) GeocodeAddress(address string) (*domain.Location, error) {
+	if !b.spend() {
+		return nil, fmt.Errorf("maps call budget of %d exhausted before geocoding %s", b.maxCalls, address)
+	}
+	return b.next.GeocodeAddress(address)
+}
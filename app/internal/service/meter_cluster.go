@@ -0,0 +1,74 @@
+package service
+
+import (
+	"math"
+
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// Default meter clustering thresholds: meters closer than this and priced within
+// the tolerance are treated as the same parking option
+const (
+	DefaultClusterDistanceKm    = 0.015 // 15 metres
+	DefaultClusterRateTolerance = 0.05  // dollars per hour
+)
+
+// clusterMeters collapses meters that sit within distanceKm of an earlier meter
+// and share its rates, time limits and features, keeping the first (closest) as the
+// representative. Input order is preserved.
+func clusterMeters(meters []*domain.ParkingMeter, distanceKm, rateTolerance float64) []*domain.ParkingMeter {
+	if distanceKm <= 0 {
+		return meters
+	}
+
+	var representatives []*domain.ParkingMeter
+	for _, meter := range meters {
+		duplicate := false
+		for _, representative := range representatives {
+			distance := maps.CalculateDistance(
+				&domain.Location{Lat: meter.Lat, Lng: meter.Lng},
+				&domain.Location{Lat: representative.Lat, Lng: representative.Lng},
+			)
+			if distance <= distanceKm && sameFeatures(meter, representative) && similarRates(meter, representative, rateTolerance) {
+				duplicate = true
+				break
+			}
+		}
+
+		if !duplicate {
+			representatives = append(representatives, meter)
+		}
+	}
+
+	return representatives
+}
+
+// sameFeatures reports whether two meters are paid for and parked at alike,
+// so that neither offers something a plan could be chosen for, like card
+// payment, cover or a free grace period
+func sameFeatures(a, b *domain.ParkingMeter) bool {
+	return a.CreditCard == b.CreditCard &&
+		a.IsCovered() == b.IsCovered() &&
+		a.FreeGraceMinutes == b.FreeGraceMinutes &&
+		a.PayByPhoneZone == b.PayByPhoneZone
+}
+
+// similarRates reports whether two meters charge within tolerance of each other
+// and enforce the same time limits in every window
+func similarRates(a, b *domain.ParkingMeter, tolerance float64) bool {
+	scheduleA := domain.NewRateSchedule(a)
+	scheduleB := domain.NewRateSchedule(b)
+
+	for dayType := range scheduleA {
+		for period := range scheduleA[dayType] {
+			windowA := scheduleA[dayType][period]
+			windowB := scheduleB[dayType][period]
+			if math.Abs(windowA.Rate-windowB.Rate) > tolerance || windowA.TimeLimit != windowB.TimeLimit {
+				return false
+			}
+		}
+	}
+
+	return true
+}
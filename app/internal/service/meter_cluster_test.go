@@ -0,0 +1,98 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+)
+
+func TestClusterMeters(t *testing.T) {
+	// Five meters along a few metres of the same block with effectively the same rates
+	var block []*domain.ParkingMeter
+	for i, id := range []string{"B1", "B2", "B3", "B4", "B5"} {
+		block = append(block, &domain.ParkingMeter{
+			MeterID:         id,
+			Lat:             49.28270 + float64(i)*0.00002,
+			Lng:             -123.12070,
+			RateMF9A6P:      3.50,
+			RateMF6P10:      2.00,
+			TimeLimitMF9A6P: 2,
+		})
+	}
+	block[4].RateMF9A6P = 3.48 // within tolerance, but would win on price if not clustered
+
+	t.Run("Near-identical meters collapse to one", func(t *testing.T) {
+		clustered := clusterMeters(block, DefaultClusterDistanceKm, DefaultClusterRateTolerance)
+
+		require.Len(t, clustered, 1)
+		assert.Equal(t, "B1", clustered[0].MeterID)
+	})
+
+	t.Run("Differently priced or distant meters are kept", func(t *testing.T) {
+		meters := append([]*domain.ParkingMeter{}, block...)
+		meters = append(meters,
+			&domain.ParkingMeter{MeterID: "PRICEY", Lat: 49.28270, Lng: -123.12070, RateMF9A6P: 5.00, RateMF6P10: 2.00, TimeLimitMF9A6P: 2},
+			&domain.ParkingMeter{MeterID: "LONGER", Lat: 49.28270, Lng: -123.12070, RateMF9A6P: 3.50, RateMF6P10: 2.00, TimeLimitMF9A6P: 4},
+			&domain.ParkingMeter{MeterID: "NEXT_BLOCK", Lat: 49.28370, Lng: -123.12070, RateMF9A6P: 3.50, RateMF6P10: 2.00, TimeLimitMF9A6P: 2},
+		)
+
+		clustered := clusterMeters(meters, DefaultClusterDistanceKm, DefaultClusterRateTolerance)
+
+		var ids []string
+		for _, meter := range clustered {
+			ids = append(ids, meter.MeterID)
+		}
+		assert.Equal(t, []string{"B1", "PRICEY", "LONGER", "NEXT_BLOCK"}, ids)
+	})
+
+	t.Run("Meters with different features are kept", func(t *testing.T) {
+		street := *block[0]
+		// A metre away, at the same rate, but covered, taking cards and with a grace period
+		garage := street
+		garage.MeterID = "GARAGE"
+		garage.Lat += 0.00001
+		garage.MeterType = "Parkade"
+		garage.CreditCard = true
+		garage.FreeGraceMinutes = 15
+		// Identical but for its PayByPhone zone
+		zoned := street
+		zoned.MeterID = "ZONED"
+		zoned.PayByPhoneZone = "66001"
+
+		clustered := clusterMeters([]*domain.ParkingMeter{&street, &garage, &zoned}, DefaultClusterDistanceKm, DefaultClusterRateTolerance)
+
+		var ids []string
+		for _, meter := range clustered {
+			ids = append(ids, meter.MeterID)
+		}
+		assert.Equal(t, []string{"B1", "GARAGE", "ZONED"}, ids)
+	})
+
+	t.Run("Zero distance disables clustering", func(t *testing.T) {
+		assert.Len(t, clusterMeters(block, 0, DefaultClusterRateTolerance), len(block))
+	})
+
+	t.Run("Planner only sees the representative meter", func(t *testing.T) {
+		repo := &fakeParkingRepository{meters: block}
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 5}, NewPricingService())
+
+		stops := []domain.Stop{
+			{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 30},
+			{ID: "b", Address: "Stop B", Lat: 49.2828, Lng: -123.1207, Duration: 30},
+		}
+		plans, err := routing.PlanTrip(&domain.TripRequest{
+			Stops:       stops,
+			StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		})
+		require.NoError(t, err)
+
+		for _, plan := range plans {
+			for _, segment := range plan.Route {
+				assert.Equal(t, "B1", segment.ParkingMeter.MeterID)
+			}
+		}
+	})
+}
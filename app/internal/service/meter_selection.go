@@ -0,0 +1,44 @@
+package service
+
+import (
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// WithSelectionMemo turns reuse of per-stop meter selections across route
+// candidates on or off; it is on by default. Turning it off ranks a stop's
+// meters afresh for every candidate, which only helps when comparing the two.
+func WithSelectionMemo(enabled bool) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.memoizeSelections = enabled
+	}
+}
+
+// selectionKey identifies a stop's parking window. Within one planning run a
+// stop's meters and selection options are fixed, so candidates that reach the
+// stop with the same window get the same ranking.
+type selectionKey struct {
+	stopID      string
+	startMinute int64
+	minutes     int
+}
+
+// rankStopMeters ranks the meters near stop for the parking window, reusing
+// the ranking of an earlier candidate that parked there in the same window
+func (s *DefaultRoutingService) rankStopMeters(stop *domain.Stop, meters []*domain.ParkingMeter, start time.Time, minutes int, opts []SelectionOption) ([]RankedMeter, error) {
+	if s.selections == nil {
+		return s.pricingService.RankParkingMeters(meters, start, minutes, opts...)
+	}
+
+	key := selectionKey{stopID: stop.ID, startMinute: start.Round(time.Minute).Unix(), minutes: minutes}
+	if ranked, ok := s.selections[key]; ok {
+		return ranked, nil
+	}
+	ranked, err := s.pricingService.RankParkingMeters(meters, start, minutes, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.selections[key] = ranked
+	return ranked, nil
+}
@@ -0,0 +1,27 @@
+package service
+
+import "vancouver-trip-planner/internal/domain"
+
+// WithParkingSearchTime sets the minutes typically spent circling for a spot
+// in each local area, e.g. {"Downtown": 8}. Every park at a meter in a listed
+// area adds that time to the trip; unlisted areas add none, as does the
+// default.
+func WithParkingSearchTime(minutesByArea map[string]int) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.searchMinutes = minutesByArea
+	}
+}
+
+// circlingMinutes returns the time expected to be spent finding a spot at meter
+func (s *DefaultRoutingService) circlingMinutes(meter *domain.ParkingMeter) int {
+	if meter == nil {
+		return 0
+	}
+	return max(s.searchMinutes[meter.LocalArea], 0)
+}
+
+// segmentCircling returns the circling time recorded on a segment
+func segmentCircling(segment domain.RouteSegment) int {
+	minutes, _ := segment.Metadata["circling_minutes"].(int)
+	return minutes
+}
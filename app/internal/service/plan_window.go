@@ -0,0 +1,253 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// DefaultWindowInterval is the spacing between start times tried in a window
+const DefaultWindowInterval = 15 * time.Minute
+
+// MaxWindowStarts bounds how many start times a single window may try
+const MaxWindowStarts = 48
+
+// WindowPlanner is implemented by routing services that can search a window of
+// start times for the cheapest departure
+type WindowPlanner interface {
+	PlanTripWindow(request *domain.TripRequest, earliest, latest time.Time, interval time.Duration) (*WindowPlan, error)
+}
+
+// WindowStart is the cheapest plan's cost for one start time in a window
+type WindowStart struct {
+	StartTime time.Time `json:"start_time"`
+	TotalCost float64   `json:"total_cost"`
+}
+
+// WindowPlan is the cheapest departure found across a window of start times
+type WindowPlan struct {
+	StartTime time.Time        `json:"start_time"`
+	Plan      *domain.TripPlan `json:"plan"`
+	Starts    []WindowStart    `json:"starts"`
+}
+
+// PlanTripWindow plans the trip at every interval from earliest to latest and
+// returns the start time with the cheapest plan, ties going to the earliest.
+// Travel times and geocodes are looked up once and reused for every start, so
+// only parking prices vary across the window. Start times at which a fixed
+// arrival can't be met are skipped.
+func (s *DefaultRoutingService) PlanTripWindow(request *domain.TripRequest, earliest, latest time.Time, interval time.Duration) (*WindowPlan, error) {
+	if latest.Before(earliest) {
+		return nil, fmt.Errorf("latest start must not be before earliest start")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive")
+	}
+	if starts := int(latest.Sub(earliest)/interval) + 1; starts > MaxWindowStarts {
+		return nil, fmt.Errorf("window covers %d start times, more than the limit of %d", starts, MaxWindowStarts)
+	}
+
+	// Shape routes and set the travel mode before caching, since the window's
+	// cache can't itself avoid features or change mode; each start's request
+	// then leaves avoid to the shared service and finds it already in the mode.
+	// Unsupported avoids are left on the request so plans still warn about them.
+	mapsService := s.mapsService
+	avoid := request.Avoid
+	if len(avoid) > 0 {
+		shaped, supported, err := s.avoidingMapsService(avoid)
+		if err != nil {
+			return nil, err
+		}
+		mapsService = shaped
+		if supported {
+			avoid = nil
+		}
+	}
+	if !drives(request) {
+		moded, err := modeMapsService(mapsService, request.TravelMode)
+		if err != nil {
+			return nil, err
+		}
+		mapsService = moded
+	}
+	scoped := *s
+	scoped.mapsService = newWindowMapsService(mapsService, request.TravelMode)
+	s = &scoped
+
+	var best *WindowPlan
+	var starts []WindowStart
+	for start := earliest; !start.After(latest); start = start.Add(interval) {
+		startRequest := *request
+		startRequest.StartTime = start
+		startRequest.Avoid = avoid
+
+		plans, err := s.PlanTrip(&startRequest)
+		if errors.Is(err, ErrFixedArrivalInfeasible) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan trip starting %s: %w", start.Format(time.RFC3339), err)
+		}
+
+		var cheapest *domain.TripPlan
+		for _, plan := range plans {
+			if plan.Type == "cheapest" {
+				cheapest = plan
+			}
+		}
+		if cheapest == nil {
+			continue
+		}
+
+		starts = append(starts, WindowStart{StartTime: start, TotalCost: cheapest.TotalCost})
+		if best == nil || cheapest.TotalCost < best.Plan.TotalCost {
+			best = &WindowPlan{StartTime: start, Plan: cheapest}
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("no start time in the window produced a plan")
+	}
+	best.Starts = starts
+
+	return best, nil
+}
+
+// windowMapsService remembers travel times and geocodes across the plans in a
+// window. Travel times are reused regardless of departure time, treating
+// traffic as constant over the window.
+type windowMapsService struct {
+	next maps.MapsService
+
+	// mode is the travel mode next times legs in; travel times are kept by mode
+	mode  string
+	cache *windowCache
+}
+
+// windowCache is shared by a window's services in every mode
+type windowCache struct {
+	mu        sync.Mutex
+	travel    map[string]int
+	locations map[string]*domain.Location
+}
+
+func newWindowMapsService(next maps.MapsService, mode string) *windowMapsService {
+	return &windowMapsService{
+		next: next,
+		mode: mode,
+		cache: &windowCache{
+			travel:    make(map[string]int),
+			locations: make(map[string]*domain.Location),
+		},
+	}
+}
+
+// WithTravelMode returns the window in the given mode, itself if it is
+// already in it, sharing the window's geocodes and travel times
+func (w *windowMapsService) WithTravelMode(mode string) (maps.MapsService, error) {
+	if mode == w.mode {
+		return w, nil
+	}
+	router, ok := w.next.(maps.ModeRouter)
+	if !ok {
+		return nil, fmt.Errorf("%w: can only time driving", maps.ErrUnsupported)
+	}
+	moded, err := router.WithTravelMode(mode)
+	if err != nil {
+		return nil, err
+	}
+	return &windowMapsService{next: moded, mode: mode, cache: w.cache}, nil
+}
+
+// legKey keys a leg's travel time by the window's mode as well as its ends
+func (w *windowMapsService) legKey(from, to *domain.Location) string {
+	return w.mode + "|" + travelKey(from, to)
+}
+
+// GetTravelTime returns the first travel time looked up for the pair of locations
+func (w *windowMapsService) GetTravelTime(from, to *domain.Location, departureTime time.Time) (int, error) {
+	key := w.legKey(from, to)
+
+	w.cache.mu.Lock()
+	minutes, ok := w.cache.travel[key]
+	w.cache.mu.Unlock()
+	if ok {
+		return minutes, nil
+	}
+
+	minutes, err := w.next.GetTravelTime(from, to, departureTime)
+	if err != nil {
+		return 0, err
+	}
+
+	w.cache.mu.Lock()
+	w.cache.travel[key] = minutes
+	w.cache.mu.Unlock()
+
+	return minutes, nil
+}
+
+// GetTravelTimeMatrix returns the first travel times looked up for each pair
+// of locations, only asking the wrapped service when a pair is new
+func (w *windowMapsService) GetTravelTimeMatrix(locations []*domain.Location, departureTime time.Time) ([][]int, error) {
+	matrix := make([][]int, len(locations))
+	complete := true
+	w.cache.mu.Lock()
+	for i := range locations {
+		matrix[i] = make([]int, len(locations))
+		for j := range locations {
+			if i == j {
+				continue
+			}
+			minutes, ok := w.cache.travel[w.legKey(locations[i], locations[j])]
+			matrix[i][j] = minutes
+			complete = complete && ok
+		}
+	}
+	w.cache.mu.Unlock()
+	if complete {
+		return matrix, nil
+	}
+
+	matrix, err := w.next.GetTravelTimeMatrix(locations, departureTime)
+	if err != nil {
+		return nil, err
+	}
+
+	w.cache.mu.Lock()
+	for i := range matrix {
+		for j := range matrix[i] {
+			if i != j && matrix[i][j] >= 0 {
+				w.cache.travel[w.legKey(locations[i], locations[j])] = matrix[i][j]
+			}
+		}
+	}
+	w.cache.mu.Unlock()
+
+	return matrix, nil
+}
+
+// GeocodeAddress returns the first result found for the address
+func (w *windowMapsService) GeocodeAddress(address string) (*domain.Location, error) {
+	w.cache.mu.Lock()
+	location, ok := w.cache.locations[address]
+	w.cache.mu.Unlock()
+	if ok {
+		return location, nil
+	}
+
+	location, err := w.next.GeocodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	w.cache.mu.Lock()
+	w.cache.locations[address] = location
+	w.cache.mu.Unlock()
+
+	return location, nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// costKey identifies a priced stay: the meter, the arrival rounded to the
+// nearest minute, and the duration
+type costKey struct {
+	meterID         string
+	arrivalMinute   int64
+	durationMinutes int
+}
+
+// memoPricingService caches parking costs for the lifetime of a single trip plan.
+// It is not safe for concurrent use and must not be shared across requests.
+type memoPricingService struct {
+	PricingService
+	costs map[costKey]float64
+}
+
+// newMemoPricingService wraps next with a fresh, request-scoped cost cache
+func newMemoPricingService(next PricingService) *memoPricingService {
+	return &memoPricingService{
+		PricingService: next,
+		costs:          make(map[costKey]float64),
+	}
+}
+
+// CalculateParkingCost returns the cached cost for the stay, pricing it on a miss
+func (m *memoPricingService) CalculateParkingCost(meter *domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) (float64, error) {
+	key := costKey{
+		meterID:         meter.MeterID,
+		arrivalMinute:   arrivalTime.Round(time.Minute).Unix(),
+		durationMinutes: durationMinutes,
+	}
+	if cost, ok := m.costs[key]; ok {
+		return cost, nil
+	}
+
+	cost, err := m.PricingService.CalculateParkingCost(meter, arrivalTime, durationMinutes)
+	if err != nil {
+		return 0.0, err
+	}
+
+	m.costs[key] = cost
+	return cost, nil
+}
+
+// GetOptimalParkingMeter selects a meter, pricing candidates through the cache
+func (m *memoPricingService) GetOptimalParkingMeter(meters []*domain.ParkingMeter, arrivalTime time.Time, durationMinutes int, opts ...SelectionOption) (*domain.ParkingMeter, float64, error) {
+	return m.selector().GetOptimalParkingMeter(meters, arrivalTime, durationMinutes, opts...)
+}
+
+// RankParkingMeters ranks meters, pricing candidates through the cache
+func (m *memoPricingService) RankParkingMeters(meters []*domain.ParkingMeter, arrivalTime time.Time, durationMinutes int, opts ...SelectionOption) ([]RankedMeter, error) {
+	return m.selector().RankParkingMeters(meters, arrivalTime, durationMinutes, opts...)
+}
+
+// PlanSplitVisit plans sittings, pricing candidates through the cache
+func (m *memoPricingService) PlanSplitVisit(meters []*domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) ([]domain.ParkingSitting, error) {
+	return m.selector().PlanSplitVisit(meters, arrivalTime, durationMinutes)
+}
+
+// selector returns the wrapped service with its internal cost lookups pointed
+// at the cache, when the wrapped service supports it
+func (m *memoPricingService) selector() PricingService {
+	if base, ok := m.PricingService.(*DefaultPricingService); ok {
+		scoped := *base
+		scoped.costFunc = m.CalculateParkingCost
+		return &scoped
+	}
+	return m.PricingService
+}
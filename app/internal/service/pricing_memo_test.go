@@ -0,0 +1,107 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+)
+
+// countingPricingService counts the costs and rankings that reach the wrapped service
+type countingPricingService struct {
+	PricingService
+	costCalls int
+	rankCalls int
+}
+
+func (c *countingPricingService) CalculateParkingCost(meter *domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) (float64, error) {
+	c.costCalls++
+	return c.PricingService.CalculateParkingCost(meter, arrivalTime, durationMinutes)
+}
+
+func (c *countingPricingService) RankParkingMeters(meters []*domain.ParkingMeter, arrivalTime time.Time, durationMinutes int, opts ...SelectionOption) ([]RankedMeter, error) {
+	c.rankCalls++
+	return c.PricingService.RankParkingMeters(meters, arrivalTime, durationMinutes, opts...)
+}
+
+func TestMemoPricingService_CalculateParkingCost(t *testing.T) {
+	meter := &domain.ParkingMeter{MeterID: "M1", RateMF9A6P: 3.50, TimeLimitMF9A6P: 3}
+	arrival, err := time.Parse(time.RFC3339, "2024-01-15T10:00:00-08:00")
+	require.NoError(t, err)
+
+	counting := &countingPricingService{PricingService: NewPricingService()}
+	memo := newMemoPricingService(counting)
+
+	first, err := memo.CalculateParkingCost(meter, arrival, 60)
+	require.NoError(t, err)
+	assert.InDelta(t, 3.50, first, 0.01)
+
+	// Identical requests, including arrivals within the same rounded minute, hit the cache
+	second, err := memo.CalculateParkingCost(meter, arrival, 60)
+	require.NoError(t, err)
+	_, err = memo.CalculateParkingCost(meter, arrival.Add(20*time.Second), 60)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, counting.costCalls)
+
+	// A different duration, arrival minute or meter is priced afresh
+	_, err = memo.CalculateParkingCost(meter, arrival, 90)
+	require.NoError(t, err)
+	_, err = memo.CalculateParkingCost(meter, arrival.Add(time.Minute), 60)
+	require.NoError(t, err)
+	_, err = memo.CalculateParkingCost(&domain.ParkingMeter{MeterID: "M2", RateMF9A6P: 2.00}, arrival, 60)
+	require.NoError(t, err)
+	assert.Equal(t, 4, counting.costCalls)
+
+	// A new memo starts empty
+	_, err = newMemoPricingService(counting).CalculateParkingCost(meter, arrival, 60)
+	require.NoError(t, err)
+	assert.Equal(t, 5, counting.costCalls)
+}
+
+func TestMemoPricingService_GetOptimalParkingMeter(t *testing.T) {
+	meters := []*domain.ParkingMeter{
+		{MeterID: "EXPENSIVE", RateMF9A6P: 5.00, TimeLimitMF9A6P: 3},
+		{MeterID: "CHEAP", RateMF9A6P: 2.00, TimeLimitMF9A6P: 3},
+	}
+	arrival, err := time.Parse(time.RFC3339, "2024-01-15T10:00:00-08:00")
+	require.NoError(t, err)
+
+	memo := newMemoPricingService(NewPricingService())
+
+	for i := 0; i < 3; i++ {
+		meter, cost, err := memo.GetOptimalParkingMeter(meters, arrival, 60)
+		require.NoError(t, err)
+		assert.Equal(t, "CHEAP", meter.MeterID)
+		assert.InDelta(t, 2.00, cost, 0.01)
+	}
+
+	// Selection prices each meter once, then reuses the cached costs
+	assert.Len(t, memo.costs, 2)
+}
+
+func TestRoutingService_SelectionMemo(t *testing.T) {
+	plan := func(t *testing.T, memoize bool) ([]*domain.TripPlan, int) {
+		repo, mapsService, stops := circuitousFixture()
+		counting := &countingPricingService{PricingService: NewPricingService()}
+		routing := NewRoutingService(repo, mapsService, counting, WithSelectionMemo(memoize), WithCandidatePruning(false))
+
+		plans, err := routing.PlanTrip(&domain.TripRequest{
+			Stops:       stops,
+			StartTime:   mustParseTime(t, "2024-01-15T16:30:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		})
+		require.NoError(t, err)
+		return plans, counting.rankCalls
+	}
+
+	naive, naiveCalls := plan(t, false)
+	memoized, memoCalls := plan(t, true)
+
+	// Orders that share a prefix reach its stops in the same windows, so
+	// those stops are ranked once between them
+	assert.Less(t, memoCalls, naiveCalls)
+	assert.Equal(t, naive, memoized)
+}
@@ -1,10 +1,16 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"math"
+	"sort"
+	"sync"
 	"time"
 
 	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/pkg/maps"
 )
 
 // PricingService handles time-dependent parking cost calculations
@@ -12,68 +18,357 @@ type PricingService interface {
 	CalculateParkingCost(meter *domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) (float64, error)
 	GetParkingRateAtTime(meter *domain.ParkingMeter, t time.Time) (float64, int)
 	IsMeterActive(t time.Time) bool
-	GetOptimalParkingMeter(meters []*domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) (*domain.ParkingMeter, float64, error)
+	GetOptimalParkingMeter(meters []*domain.ParkingMeter, arrivalTime time.Time, durationMinutes int, opts ...SelectionOption) (*domain.ParkingMeter, float64, error)
+	RankParkingMeters(meters []*domain.ParkingMeter, arrivalTime time.Time, durationMinutes int, opts ...SelectionOption) ([]RankedMeter, error)
+	PlanSplitVisit(meters []*domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) ([]domain.ParkingSitting, error)
 }
 
-type DefaultPricingService struct{}
+// maxSplitSittings bounds how many times a single visit may be re-parked
+const maxSplitSittings = 8
 
-func NewPricingService() PricingService {
-	return &DefaultPricingService{}
+// ErrNegativeDuration is returned when a stay with a negative length is priced
+var ErrNegativeDuration = errors.New("duration must not be negative")
+
+// ErrInvalidTimezone is returned when meters are to be priced in a timezone
+// that isn't in the tz database
+var ErrInvalidTimezone = errors.New("invalid timezone")
+
+// MaxStayMinutes is the longest stay priced. Longer stays are clamped to it,
+// with a warning, rather than walked rate window by rate window.
+const MaxStayMinutes = 7 * 24 * 60
+
+// DefaultOverstayPenalty is the score penalty, in dollars, applied to a meter whose
+// time limit is shorter than the stay when overstaying is allowed without an explicit penalty
+const DefaultOverstayPenalty = 10.00
+
+// DefaultCoveredBonus is the score bonus, in dollars, given to covered meters when
+// covered parking is preferred without an explicit bonus
+const DefaultCoveredBonus = 2.00
+
+// RankedMeter is a meter that can hold a stay, with its cost and selection score
+type RankedMeter struct {
+	Meter *domain.ParkingMeter
+	Cost  float64
+	Score float64
+}
+
+// SelectionOption adjusts how GetOptimalParkingMeter ranks meters
+type SelectionOption func(*selectionConfig)
+
+type selectionConfig struct {
+	allowOverstay   bool
+	overstayPenalty float64
+	cardMeterBonus  float64
+	coveredBonus    float64
+	maxCost         float64
+
+	// destination, when set, excludes meters more than maxWalkMinutes from it
+	destination    *domain.Location
+	maxWalkMinutes int
+	walkingTime    func(from, to *domain.Location) int
+}
+
+func newSelectionConfig(opts []SelectionOption) *selectionConfig {
+	config := &selectionConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+// WithOverstayPenalty includes meters whose time limit is shorter than the stay,
+// adding penalty to their score instead of skipping them
+func WithOverstayPenalty(penalty float64) SelectionOption {
+	return func(c *selectionConfig) {
+		c.allowOverstay = true
+		c.overstayPenalty = penalty
+	}
+}
+
+// WithCardMeterBonus subtracts bonus from the score of meters that accept credit
+// cards, preferring them without excluding coin-only meters
+func WithCardMeterBonus(bonus float64) SelectionOption {
+	return func(c *selectionConfig) {
+		c.cardMeterBonus = bonus
+	}
+}
+
+// WithCoveredBonus subtracts bonus from the score of covered meters, preferring
+// them while still falling back to street meters
+func WithCoveredBonus(bonus float64) SelectionOption {
+	return func(c *selectionConfig) {
+		c.coveredBonus = bonus
+	}
+}
+
+// WithMaxCost skips meters that would charge more than limit dollars for the stay
+func WithMaxCost(limit float64) SelectionOption {
+	return func(c *selectionConfig) {
+		c.maxCost = limit
+	}
+}
+
+// WithWalkingLimit skips meters more than maxMinutes' walk from destination,
+// however cheap. walkingTime estimates walks, straight-line walking if nil.
+func WithWalkingLimit(destination *domain.Location, maxMinutes int, walkingTime func(from, to *domain.Location) int) SelectionOption {
+	return func(c *selectionConfig) {
+		if walkingTime == nil {
+			walkingTime = maps.CalculateWalkingTime
+		}
+		c.destination = destination
+		c.maxWalkMinutes = maxMinutes
+		c.walkingTime = walkingTime
+	}
+}
+
+type DefaultPricingService struct {
+	// costFunc, when set, replaces CalculateParkingCost for the costs computed
+	// while selecting meters, e.g. to route them through a request-scoped memo
+	costFunc func(meter *domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) (float64, error)
+
+	// holidays are charged at Sunday rates, or nothing when freeOnHolidays is set
+	holidays       HolidayCalendar
+	freeOnHolidays bool
+
+	// rounding adjusts the time paid for in each metered period, in order
+	rounding []RoundingPolicy
+
+	// location is the timezone meter hours are kept in, Vancouver time if nil
+	location *time.Location
+}
+
+// PricingOption configures a DefaultPricingService
+type PricingOption func(*DefaultPricingService)
+
+// WithHolidays sets the holidays on which meters charge their Sunday rates,
+// whatever day of the week they fall on. BC statutory holidays are the
+// default; nil treats every day by its weekday.
+func WithHolidays(calendar HolidayCalendar) PricingOption {
+	return func(s *DefaultPricingService) {
+		s.holidays = calendar
+	}
+}
+
+// WithFreeHolidays makes parking free all day on holidays instead of charging
+// Sunday rates
+func WithFreeHolidays() PricingOption {
+	return func(s *DefaultPricingService) {
+		s.freeOnHolidays = true
+	}
+}
+
+// TimezonePricer is implemented by pricing services that can keep meter hours
+// in a timezone other than Vancouver's
+type TimezonePricer interface {
+	// InTimezone returns a copy of the service that reads meter hours in the
+	// named IANA timezone, or ErrInvalidTimezone if the name is unknown
+	InTimezone(name string) (PricingService, error)
+}
+
+// InTimezone returns a copy of the service that reads meter hours in the named
+// timezone, so 9 AM is 9 AM there. Without tzdata, Pacific timezones fall back
+// to fixed PST/PDT offsets like Vancouver time does.
+func (s *DefaultPricingService) InTimezone(name string) (PricingService, error) {
+	if _, err := TimezoneAt(name, time.Now()); err != nil {
+		return nil, err
+	}
+	zoned := *s
+	zoned.location = nil
+	if loc, err := loadLocation(name); err == nil {
+		zoned.location = loc
+	}
+	return &zoned, nil
+}
+
+func NewPricingService(opts ...PricingOption) PricingService {
+	s := &DefaultPricingService{holidays: BCStatutoryHolidays{}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // CalculateParkingCost calculates the total cost for parking at a specific time and duration
 func (s *DefaultPricingService) CalculateParkingCost(meter *domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) (float64, error) {
-	if durationMinutes <= 0 {
-		return 0.0, nil
+	totalCost := 0.0
+	err := s.walkStay(meter, arrivalTime, durationMinutes, func(period ParkingCostPeriod) {
+		totalCost += period.Cost
+	})
+	if err != nil {
+		return 0.0, err
 	}
+	return totalCost, nil
+}
+
+// ParkingCostPeriod is the part of a stay spent in one metered rate window
+type ParkingCostPeriod struct {
+	Start time.Time
+	End   time.Time
+
+	// Rate is the hourly rate and TimeLimit the window's limit in hours, 0 if none
+	Rate      float64
+	TimeLimit int
 
-	// Convert to Vancouver timezone if needed
-	loc, err := time.LoadLocation("America/Vancouver")
+	// ChargedMinutes is how much of the period is paid for, less any grace
+	// period and rounded up by the service's rounding policies
+	ChargedMinutes float64
+	Cost           float64
+}
+
+// CostBreakdownReporter is implemented by pricing services that can show how
+// a stay's cost is made up
+type CostBreakdownReporter interface {
+	// ParkingCostBreakdown returns the metered periods of the stay in order.
+	// Their costs add up to CalculateParkingCost's; unmetered time is left out.
+	ParkingCostBreakdown(meter *domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) ([]ParkingCostPeriod, error)
+}
+
+// ParkingCostBreakdown returns the metered periods of the stay in order
+func (s *DefaultPricingService) ParkingCostBreakdown(meter *domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) ([]ParkingCostPeriod, error) {
+	var periods []ParkingCostPeriod
+	err := s.walkStay(meter, arrivalTime, durationMinutes, func(period ParkingCostPeriod) {
+		periods = append(periods, period)
+	})
 	if err != nil {
-		return 0.0, err
+		return nil, err
+	}
+	return periods, nil
+}
+
+// walkStay calls visit with each metered period of the stay, in order
+func (s *DefaultPricingService) walkStay(meter *domain.ParkingMeter, arrivalTime time.Time, durationMinutes int, visit func(ParkingCostPeriod)) error {
+	durationMinutes, err := stayMinutes(durationMinutes)
+	if err != nil {
+		return err
+	}
+	if durationMinutes == 0 {
+		return nil
+	}
+
+	// Convert to the meters' timezone if needed
+	localArrival, err := s.localTime(arrivalTime)
+	if err != nil {
+		return err
 	}
-	localArrival := arrivalTime.In(loc)
 
-	totalCost := 0.0
 	currentTime := localArrival
-	remainingMinutes := durationMinutes
+	departure := localArrival.Add(time.Duration(durationMinutes) * time.Minute)
+	grace := time.Duration(meter.FreeGraceMinutes) * time.Minute
+	var allowance dailyAllowance
+
+	// Walk the stay one rate window at a time. Each window runs up to but not
+	// including its closing boundary, so a stay ending exactly at 6 PM or 10 PM
+	// pays nothing at the following rate. Spans are kept as durations rather
+	// than whole minutes so arrivals part-way through a minute aren't charged
+	// twice or dropped at a boundary.
+	for currentTime.Before(departure) {
+		// Find the next time boundary (either rate change or meter inactive)
+		nextBoundary := s.getNextTimeBoundary(currentTime)
+		span := departure.Sub(currentTime)
+		if toBoundary := nextBoundary.Sub(currentTime); toBoundary < span {
+			span = toBoundary
+		}
 
-	for remainingMinutes > 0 {
 		if !s.IsMeterActive(currentTime) {
-			// Parking is free outside of 9 AM - 10 PM
-			break
+			// Parking is free outside of 9 AM - 10 PM; skip ahead to when the meter starts
+			currentTime = currentTime.Add(span)
+			continue
 		}
 
 		rate, timeLimit := s.GetParkingRateAtTime(meter, currentTime)
 
-		// Find the next time boundary (either rate change or meter inactive)
-		nextBoundary := s.getNextTimeBoundary(currentTime)
-		minutesToBoundary := int(nextBoundary.Sub(currentTime).Minutes())
+		// Apply what is left of the day's time limit if it is shorter
+		remaining, limited := allowance.remaining(currentTime, timeLimit)
+		overLimit := limited && remaining < span
+		if overLimit {
+			span = remaining
+		}
+
+		if span > 0 {
+			// The grace period covers the first metered minutes of the stay
+			charged := span
+			if grace > 0 {
+				free := grace
+				if charged < free {
+					free = charged
+				}
+				charged -= free
+				grace -= free
+			}
+			charged = s.roundCharged(charged, timeLimit)
 
-		// Calculate how many minutes to charge at this rate
-		minutesAtThisRate := int(math.Min(float64(remainingMinutes), float64(minutesToBoundary)))
+			period := ParkingCostPeriod{
+				Start:          currentTime,
+				End:            currentTime.Add(span),
+				Rate:           rate,
+				TimeLimit:      timeLimit,
+				ChargedMinutes: charged.Minutes(),
+			}
+			if charged > 0 {
+				period.Cost = rate * charged.Hours()
+			}
+			visit(period)
 
-		// Apply time limit if it exists and is lower
-		if timeLimit > 0 {
-			timeLimitMinutes := timeLimit * 60
-			minutesAtThisRate = int(math.Min(float64(minutesAtThisRate), float64(timeLimitMinutes)))
+			allowance.use(span)
+			currentTime = currentTime.Add(span)
 		}
 
-		if minutesAtThisRate > 0 {
-			cost := rate * (float64(minutesAtThisRate) / 60.0) // Convert minutes to hours
-			totalCost += cost
+		// Past the time limit no more can be paid for in this window. The
+		// allowance is per day, so a later window the same day only has what is
+		// left of it, and the next day starts with a fresh limit.
+		if overLimit {
+			currentTime = nextBoundary
 		}
+	}
 
-		currentTime = currentTime.Add(time.Duration(minutesAtThisRate) * time.Minute)
-		remainingMinutes -= minutesAtThisRate
+	return nil
+}
 
-		// If we hit a time limit, we can't park longer at this meter
-		if timeLimit > 0 && minutesAtThisRate >= timeLimit*60 {
-			break
-		}
+// dailyAllowance tracks the metered time a stay has used on its current local
+// day. A meter's time limit is an allowance for the day: time parked earlier in
+// the day counts against the limit of each later window, and a new day starts
+// afresh. Windows without a limit aren't restricted.
+type dailyAllowance struct {
+	day  string
+	used time.Duration
+}
+
+// remaining returns what is left of the day's allowance at t under a window
+// limit of limitHours, or false when the window has no limit
+func (a *dailyAllowance) remaining(t time.Time, limitHours int) (time.Duration, bool) {
+	if day := t.Format(time.DateOnly); day != a.day {
+		a.day, a.used = day, 0
+	}
+	if limitHours <= 0 {
+		return 0, false
 	}
+	return max(time.Duration(limitHours)*time.Hour-a.used, 0), true
+}
 
-	return totalCost, nil
+// use counts parked time against the day's allowance
+func (a *dailyAllowance) use(parked time.Duration) {
+	a.used += parked
+}
+
+// stayMinutes checks a stay's length before it is priced, rejecting negative
+// lengths and clamping ones beyond MaxStayMinutes
+func stayMinutes(durationMinutes int) (int, error) {
+	if durationMinutes < 0 {
+		return 0, fmt.Errorf("%w: got %d minutes", ErrNegativeDuration, durationMinutes)
+	}
+	if durationMinutes > MaxStayMinutes {
+		log.Printf("Warning: clamping a %d-minute stay to %d minutes", durationMinutes, MaxStayMinutes)
+		return MaxStayMinutes, nil
+	}
+	return durationMinutes, nil
+}
+
+// parkingCost prices a stay through costFunc when one is configured
+func (s *DefaultPricingService) parkingCost(meter *domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) (float64, error) {
+	if s.costFunc != nil {
+		return s.costFunc(meter, arrivalTime, durationMinutes)
+	}
+	return s.CalculateParkingCost(meter, arrivalTime, durationMinutes)
 }
 
 // GetParkingRateAtTime returns the parking rate and time limit for a specific time
@@ -82,31 +377,42 @@ func (s *DefaultPricingService) GetParkingRateAtTime(meter *domain.ParkingMeter,
 		return 0.0, 0
 	}
 
-	weekday := t.Weekday()
-	hour := t.Hour()
-
-	switch weekday {
-	case time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday:
-		if hour >= 9 && hour < 18 { // 9 AM - 6 PM
-			return meter.RateMF9A6P, meter.TimeLimitMF9A6P
-		} else if hour >= 18 && hour < 22 { // 6 PM - 10 PM
-			return meter.RateMF6P10, meter.TimeLimitMF6P10
+	dayType, period, ok := rateWindowAt(t)
+	if !ok {
+		return 0.0, 0 // Free parking
+	}
+	if s.holidays != nil && s.holidays.IsHoliday(t) {
+		if s.freeOnHolidays {
+			return 0.0, 0
 		}
+		dayType = domain.Sunday
+	}
+
+	window := meter.RateWindowAt(dayType, period)
+	return window.Rate, window.TimeLimit
+}
+
+// rateWindowAt maps a local time onto the day type and period used to look up meter rates
+func rateWindowAt(t time.Time) (domain.DayType, domain.RatePeriod, bool) {
+	var dayType domain.DayType
+	switch t.Weekday() {
 	case time.Saturday:
-		if hour >= 9 && hour < 18 {
-			return meter.RateSA9A6P, meter.TimeLimitSA9A6P
-		} else if hour >= 18 && hour < 22 {
-			return meter.RateSA6P10, meter.TimeLimitSA6P10
-		}
+		dayType = domain.Saturday
 	case time.Sunday:
-		if hour >= 9 && hour < 18 {
-			return meter.RateSU9A6P, meter.TimeLimitSU9A6P
-		} else if hour >= 18 && hour < 22 {
-			return meter.RateSU6P10, meter.TimeLimitSU6P10
-		}
+		dayType = domain.Sunday
+	default:
+		dayType = domain.Weekday
 	}
 
-	return 0.0, 0 // Free parking
+	hour := t.Hour()
+	switch {
+	case hour >= 9 && hour < 18: // 9 AM - 6 PM
+		return dayType, domain.Daytime, true
+	case hour >= 18 && hour < 22: // 6 PM - 10 PM
+		return dayType, domain.Evening, true
+	}
+
+	return dayType, domain.Daytime, false
 }
 
 // IsMeterActive checks if parking meters are active at a given time
@@ -138,19 +444,289 @@ func (s *DefaultPricingService) getNextTimeBoundary(t time.Time) time.Time {
 	return time.Date(year, month, day+1, 9, 0, 0, 0, loc)
 }
 
-// GetOptimalParkingMeter finds the best parking meter for a given arrival time and duration
-func (s *DefaultPricingService) GetOptimalParkingMeter(meters []*domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) (*domain.ParkingMeter, float64, error) {
-	if len(meters) == 0 {
-		return nil, 0.0, nil
+// meterTimezone is the timezone the meter schedules are defined in
+const meterTimezone = "America/Vancouver"
+
+// loadLocation loads timezones; tests replace it to simulate missing tzdata
+var loadLocation = time.LoadLocation
+
+// SetLocationLoader replaces how timezones are loaded, returning a function
+// that restores the previous loader. Tests use it to simulate a host without
+// tzdata.
+func SetLocationLoader(load func(name string) (*time.Location, error)) (restore func()) {
+	previous := loadLocation
+	loadLocation = load
+	return func() { loadLocation = previous }
+}
+
+var tzdataWarning sync.Once
+
+// pacificTimezones observe Pacific time, so they can still be used without
+// tzdata through fixed PST/PDT offsets
+var pacificTimezones = map[string]bool{
+	meterTimezone:         true,
+	"America/Los_Angeles": true,
+	"Canada/Pacific":      true,
+	"US/Pacific":          true,
+	"PST8PDT":             true,
+}
+
+// TimezoneAt returns the named IANA timezone as in effect at t. Without tzdata,
+// Pacific timezones fall back to the fixed PST/PDT offset in effect at t,
+// warning once; other names fail with ErrInvalidTimezone.
+func TimezoneAt(name string, t time.Time) (*time.Location, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: no timezone given", ErrInvalidTimezone)
+	}
+	loc, err := loadLocation(name)
+	if err == nil {
+		return loc, nil
+	}
+	if !pacificTimezones[name] {
+		return nil, fmt.Errorf("%w: %q is not a known IANA timezone", ErrInvalidTimezone, name)
 	}
+	tzdataWarning.Do(func() {
+		log.Printf("Warning: failed to load %s, using fixed PST/PDT offsets: %v", name, err)
+	})
+	return pacificFixedZone(t), nil
+}
 
-	// For now, just return the first meter since they're already sorted by distance
-	// In a more sophisticated system, we could implement a hybrid cost-distance optimization
-	meter := meters[0]
-	cost, err := s.CalculateParkingCost(meter, arrivalTime, durationMinutes)
+// toLocalTime converts a time into the timezone the meter schedules are defined
+// in. Without tzdata it falls back to Pacific fixed offsets, warning once.
+func toLocalTime(t time.Time) (time.Time, error) {
+	loc, err := TimezoneAt(meterTimezone, t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(loc), nil
+}
+
+// localTime converts a time into the timezone the service reads meter hours in
+func (s *DefaultPricingService) localTime(t time.Time) (time.Time, error) {
+	if s.location != nil {
+		return t.In(s.location), nil
+	}
+	return toLocalTime(t)
+}
+
+// MeterLocalTime returns t in the timezone the meter schedules are defined in
+func MeterLocalTime(t time.Time) time.Time {
+	local, _ := toLocalTime(t)
+	return local
+}
+
+// pacificFixedZone returns the fixed-offset Pacific zone in effect at t under
+// the North American rules: PDT from 2 AM on the second Sunday of March to
+// 2 AM on the first Sunday of November, PST otherwise
+func pacificFixedZone(t time.Time) *time.Location {
+	year := t.UTC().Year()
+	dstStart := nthSunday(year, time.March, 2).Add(10 * time.Hour) // 2 AM PST
+	dstEnd := nthSunday(year, time.November, 1).Add(9 * time.Hour) // 2 AM PDT
+	if !t.Before(dstStart) && t.Before(dstEnd) {
+		return time.FixedZone("PDT", -7*60*60)
+	}
+	return time.FixedZone("PST", -8*60*60)
+}
+
+// nthSunday returns midnight UTC on the nth Sunday of the month
+func nthSunday(year int, month time.Month, n int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	offset := (int(time.Sunday) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, offset+7*(n-1))
+}
+
+// exceedsTimeLimit reports whether a stay would run past the day's time limit
+// in any metered window it overlaps
+func (s *DefaultPricingService) exceedsTimeLimit(meter *domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) (bool, error) {
+	currentTime, err := s.localTime(arrivalTime)
+	if err != nil {
+		return false, err
+	}
+	remainingMinutes := durationMinutes
+	var allowance dailyAllowance
+
+	for remainingMinutes > 0 {
+		nextBoundary := s.getNextTimeBoundary(currentTime)
+		minutesInWindow := int(math.Min(float64(remainingMinutes), nextBoundary.Sub(currentTime).Minutes()))
+
+		if s.IsMeterActive(currentTime) {
+			_, timeLimit := s.GetParkingRateAtTime(meter, currentTime)
+			left, limited := allowance.remaining(currentTime, timeLimit)
+			if limited && time.Duration(minutesInWindow)*time.Minute > left {
+				return true, nil
+			}
+			allowance.use(time.Duration(minutesInWindow) * time.Minute)
+		}
+
+		currentTime = currentTime.Add(time.Duration(minutesInWindow) * time.Minute)
+		remainingMinutes -= minutesInWindow
+	}
+
+	return false, nil
+}
+
+// allowedMinutes returns how much of a stay, up to durationMinutes, can be spent at
+// a meter from arrivalTime before the day's time limit is reached
+func (s *DefaultPricingService) allowedMinutes(meter *domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) (int, error) {
+	currentTime, err := s.localTime(arrivalTime)
+	if err != nil {
+		return 0, err
+	}
+	allowed := 0
+	var allowance dailyAllowance
+
+	for allowed < durationMinutes {
+		nextBoundary := s.getNextTimeBoundary(currentTime)
+		minutesInWindow := int(math.Min(float64(durationMinutes-allowed), nextBoundary.Sub(currentTime).Minutes()))
+
+		if s.IsMeterActive(currentTime) {
+			_, timeLimit := s.GetParkingRateAtTime(meter, currentTime)
+			left, limited := allowance.remaining(currentTime, timeLimit)
+			if limited && time.Duration(minutesInWindow)*time.Minute > left {
+				return allowed + int(left.Minutes()), nil
+			}
+			allowance.use(time.Duration(minutesInWindow) * time.Minute)
+		}
+
+		currentTime = currentTime.Add(time.Duration(minutesInWindow) * time.Minute)
+		allowed += minutesInWindow
+	}
+
+	return allowed, nil
+}
+
+// PlanSplitVisit covers a stay that outlasts the meters' time limits with
+// consecutive sittings, each at a different meter than the one before it when
+// possible. Each sitting takes the meter that covers the most remaining time,
+// breaking ties on cost.
+func (s *DefaultPricingService) PlanSplitVisit(meters []*domain.ParkingMeter, arrivalTime time.Time, durationMinutes int) ([]domain.ParkingSitting, error) {
+	durationMinutes, err := stayMinutes(durationMinutes)
+	if err != nil {
+		return nil, err
+	}
+
+	var sittings []domain.ParkingSitting
+	var previous *domain.ParkingMeter
+	startTime := arrivalTime
+	remaining := durationMinutes
+
+	for remaining > 0 {
+		if len(sittings) == maxSplitSittings {
+			return nil, fmt.Errorf("visit of %d minutes needs more than %d sittings", durationMinutes, maxSplitSittings)
+		}
+
+		var best *domain.ParkingMeter
+		bestMinutes := 0
+		bestCost := 0.0
+
+		for _, meter := range meters {
+			// The car has to move, so avoid the meter just used when there is a choice
+			if meter == previous && len(meters) > 1 {
+				continue
+			}
+
+			minutes, err := s.allowedMinutes(meter, startTime, remaining)
+			if err != nil {
+				return nil, err
+			}
+			if minutes <= 0 {
+				continue
+			}
+
+			cost, err := s.parkingCost(meter, startTime, minutes)
+			if err != nil {
+				return nil, err
+			}
+
+			if best == nil || minutes > bestMinutes || (minutes == bestMinutes && cost < bestCost) {
+				best = meter
+				bestMinutes = minutes
+				bestCost = cost
+			}
+		}
+
+		if best == nil {
+			return nil, fmt.Errorf("no meter can be used at %s", startTime.Format(time.RFC3339))
+		}
+
+		sittings = append(sittings, domain.ParkingSitting{
+			ParkingMeter: best,
+			StartTime:    startTime,
+			Minutes:      bestMinutes,
+			Cost:         bestCost,
+		})
+
+		previous = best
+		startTime = startTime.Add(time.Duration(bestMinutes) * time.Minute)
+		remaining -= bestMinutes
+	}
+
+	return sittings, nil
+}
+
+// GetOptimalParkingMeter finds the best parking meter for a given arrival time and duration.
+// Meters whose time limit is too short for the stay are skipped unless an overstay
+// penalty option allows them.
+func (s *DefaultPricingService) GetOptimalParkingMeter(meters []*domain.ParkingMeter, arrivalTime time.Time, durationMinutes int, opts ...SelectionOption) (*domain.ParkingMeter, float64, error) {
+	ranked, err := s.RankParkingMeters(meters, arrivalTime, durationMinutes, opts...)
 	if err != nil {
 		return nil, 0.0, err
 	}
+	if len(ranked) == 0 {
+		return nil, 0.0, nil
+	}
+	return ranked[0].Meter, ranked[0].Cost, nil
+}
+
+// RankParkingMeters orders the meters that can hold the stay from best to worst score.
+// Meters arrive sorted by distance, so a stable sort keeps the closest first on ties.
+func (s *DefaultPricingService) RankParkingMeters(meters []*domain.ParkingMeter, arrivalTime time.Time, durationMinutes int, opts ...SelectionOption) ([]RankedMeter, error) {
+	durationMinutes, err := stayMinutes(durationMinutes)
+	if err != nil {
+		return nil, err
+	}
+	config := newSelectionConfig(opts)
+
+	var ranked []RankedMeter
+	for _, meter := range meters {
+		score := 0.0
+
+		if config.destination != nil && config.walkingTime(&domain.Location{Lat: meter.Lat, Lng: meter.Lng}, config.destination) > config.maxWalkMinutes {
+			continue
+		}
+
+		exceeds, err := s.exceedsTimeLimit(meter, arrivalTime, durationMinutes)
+		if err != nil {
+			return nil, err
+		}
+		if exceeds {
+			if !config.allowOverstay {
+				continue
+			}
+			score += config.overstayPenalty
+		}
+
+		cost, err := s.parkingCost(meter, arrivalTime, durationMinutes)
+		if err != nil {
+			return nil, err
+		}
+		if config.maxCost > 0 && cost > config.maxCost {
+			continue
+		}
+		score += cost
+		if meter.CreditCard {
+			score -= config.cardMeterBonus
+		}
+		if meter.IsCovered() {
+			score -= config.coveredBonus
+		}
+
+		ranked = append(ranked, RankedMeter{Meter: meter, Cost: cost, Score: score})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score < ranked[j].Score
+	})
 
-	return meter, cost, nil
+	return ranked, nil
 }
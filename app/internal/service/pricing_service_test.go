@@ -1,10 +1,12 @@
 package service
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"vancouver-trip-planner/internal/domain"
 )
 
@@ -255,3 +257,669 @@ func TestPricingService_GetOptimalParkingMeter(t *testing.T) {
 		assert.Equal(t, 0.00, cost)
 	})
 }
+
+func scheduleTestMeter() *domain.ParkingMeter {
+	return &domain.ParkingMeter{
+		MeterID:         "SCHEDULE001",
+		RateMF9A6P:      3.50,
+		RateMF6P10:      2.00,
+		RateSA9A6P:      3.00,
+		RateSA6P10:      1.50,
+		RateSU9A6P:      2.50,
+		RateSU6P10:      1.00,
+		TimeLimitMF9A6P: 2,
+		TimeLimitMF6P10: 4,
+		TimeLimitSA9A6P: 3,
+		TimeLimitSA6P10: 4,
+		TimeLimitSU9A6P: 3,
+		TimeLimitSU6P10: 4,
+	}
+}
+
+func TestPricingService_PrecomputedScheduleMatchesFields(t *testing.T) {
+	service := NewPricingService()
+
+	onDemand := scheduleTestMeter()
+	precomputed := scheduleTestMeter()
+	precomputed.PrecomputeSchedule()
+
+	// Every 15 minutes across a full week hits each day type and period
+	start, _ := time.Parse(time.RFC3339, "2024-01-15T00:00:00-08:00")
+	for at := start; at.Before(start.Add(7 * 24 * time.Hour)); at = at.Add(15 * time.Minute) {
+		expectedRate, expectedLimit := service.GetParkingRateAtTime(onDemand, at)
+		rate, limit := service.GetParkingRateAtTime(precomputed, at)
+
+		assert.Equal(t, expectedRate, rate, "rate at %s", at)
+		assert.Equal(t, expectedLimit, limit, "limit at %s", at)
+	}
+}
+
+// BenchmarkGetParkingRateAtTime prices ten meters minute-by-minute across an
+// active day, mirroring the lookups made while enumerating candidate routes
+func BenchmarkGetParkingRateAtTime(b *testing.B) {
+	service := NewPricingService()
+	start, _ := time.Parse(time.RFC3339, "2024-01-15T09:00:00-08:00")
+
+	run := func(b *testing.B, precompute bool) {
+		meters := make([]*domain.ParkingMeter, 10)
+		for i := range meters {
+			meters[i] = scheduleTestMeter()
+			if precompute {
+				meters[i].PrecomputeSchedule()
+			}
+		}
+
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			for _, meter := range meters {
+				for minute := 0; minute < 13*60; minute += 5 {
+					service.GetParkingRateAtTime(meter, start.Add(time.Duration(minute)*time.Minute))
+				}
+			}
+		}
+	}
+
+	b.Run("on-demand", func(b *testing.B) { run(b, false) })
+	b.Run("precomputed", func(b *testing.B) { run(b, true) })
+}
+
+func TestPricingService_GetOptimalParkingMeter_OverstayModes(t *testing.T) {
+	service := NewPricingService()
+
+	// Only two-hour meters are available for a three-hour visit
+	meters := []*domain.ParkingMeter{
+		{MeterID: "TWO_HOUR_PRICEY", RateMF9A6P: 4.00, TimeLimitMF9A6P: 2},
+		{MeterID: "TWO_HOUR_CHEAP", RateMF9A6P: 2.50, TimeLimitMF9A6P: 2},
+	}
+	arrivalTime, _ := time.Parse(time.RFC3339, "2024-01-15T10:00:00-08:00") // Monday 10 AM
+
+	t.Run("Hard mode skips every meter", func(t *testing.T) {
+		bestMeter, cost, err := service.GetOptimalParkingMeter(meters, arrivalTime, 180)
+
+		assert.NoError(t, err)
+		assert.Nil(t, bestMeter)
+		assert.Equal(t, 0.00, cost)
+	})
+
+	t.Run("Soft mode accepts the cheapest meter despite the overstay", func(t *testing.T) {
+		bestMeter, cost, err := service.GetOptimalParkingMeter(meters, arrivalTime, 180, WithOverstayPenalty(5.00))
+
+		assert.NoError(t, err)
+		assert.NotNil(t, bestMeter)
+		assert.Equal(t, "TWO_HOUR_CHEAP", bestMeter.MeterID)
+		assert.InDelta(t, 5.00, cost, 0.01) // Charged up to the 2 hour limit; the penalty only affects ranking
+	})
+
+	t.Run("Penalty favours a sufficient meter when one exists", func(t *testing.T) {
+		withLongMeter := append([]*domain.ParkingMeter{
+			{MeterID: "FOUR_HOUR", RateMF9A6P: 3.00, TimeLimitMF9A6P: 4},
+		}, meters...)
+
+		bestMeter, cost, err := service.GetOptimalParkingMeter(withLongMeter, arrivalTime, 180, WithOverstayPenalty(5.00))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "FOUR_HOUR", bestMeter.MeterID)
+		assert.InDelta(t, 9.00, cost, 0.01)
+	})
+}
+
+func TestPricingService_FreeGraceMinutes(t *testing.T) {
+	service := NewPricingService()
+	meter := &domain.ParkingMeter{
+		MeterID:          "GRACE",
+		RateMF9A6P:       3.00,
+		RateMF6P10:       1.20,
+		FreeGraceMinutes: 15,
+	}
+
+	tests := []struct {
+		name            string
+		arrivalTime     string
+		durationMinutes int
+		expectedCost    float64
+	}{
+		{
+			name:            "20 minutes with a 15 minute grace charges 5 minutes",
+			arrivalTime:     "2024-01-15T10:00:00-08:00",
+			durationMinutes: 20,
+			expectedCost:    0.25, // 5 minutes at $3.00/hr
+		},
+		{
+			name:            "Stay shorter than the grace is free",
+			arrivalTime:     "2024-01-15T10:00:00-08:00",
+			durationMinutes: 10,
+			expectedCost:    0.00,
+		},
+		{
+			name:            "Grace is used once across a rate change",
+			arrivalTime:     "2024-01-15T17:50:00-08:00",
+			durationMinutes: 60,
+			expectedCost:    0.90, // 10 grace minutes at $3.00, then 5 grace + 45 minutes at $1.20/hr
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arrivalTime, err := time.Parse(time.RFC3339, tt.arrivalTime)
+			assert.NoError(t, err)
+
+			cost, err := service.CalculateParkingCost(meter, arrivalTime, tt.durationMinutes)
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.expectedCost, cost, 0.01)
+		})
+	}
+}
+
+func TestPricingService_Rounding(t *testing.T) {
+	meter := &domain.ParkingMeter{
+		MeterID:         "ROUNDING",
+		RateMF9A6P:      3.00,
+		TimeLimitMF9A6P: 2,
+		RateMF6P10:      1.20,
+	}
+
+	tests := []struct {
+		name            string
+		service         PricingService
+		arrivalTime     string
+		durationMinutes int
+		expectedCost    float64
+	}{
+		{
+			name:            "No rounding charges the exact time",
+			service:         NewPricingService(WithRounding(NoRounding())),
+			arrivalTime:     "2024-01-15T10:00:00-08:00",
+			durationMinutes: 65,
+			expectedCost:    3.25,
+		},
+		{
+			name:            "30 minute increments charge 65 minutes as 90",
+			service:         NewPricingService(WithRounding(CeilToIncrement(30))),
+			arrivalTime:     "2024-01-15T10:00:00-08:00",
+			durationMinutes: 65,
+			expectedCost:    4.50,
+		},
+		{
+			name:            "A whole number of increments isn't rounded",
+			service:         NewPricingService(WithRounding(CeilToIncrement(30))),
+			arrivalTime:     "2024-01-15T10:00:00-08:00",
+			durationMinutes: 60,
+			expectedCost:    3.00,
+		},
+		{
+			name:            "Minimum purchase charges a short stay for an hour",
+			service:         NewPricingService(WithRounding(MinimumPurchase(60))),
+			arrivalTime:     "2024-01-15T10:00:00-08:00",
+			durationMinutes: 20,
+			expectedCost:    3.00,
+		},
+		{
+			name:            "Increments then a minimum",
+			service:         NewPricingService(WithRounding(CeilToIncrement(5), MinimumPurchase(60))),
+			arrivalTime:     "2024-01-15T10:00:00-08:00",
+			durationMinutes: 62,
+			expectedCost:    3.25, // 65 minutes
+		},
+		{
+			name:            "Each rate period is bought separately",
+			service:         NewPricingService(WithRounding(MinimumPurchase(60))),
+			arrivalTime:     "2024-01-15T17:30:00-08:00",
+			durationMinutes: 60,
+			expectedCost:    4.20, // An hour at $3.00, then an hour at $1.20
+		},
+		{
+			name:            "Rounding stops at the time limit",
+			service:         NewPricingService(WithRounding(CeilToIncrement(45))),
+			arrivalTime:     "2024-01-15T10:00:00-08:00",
+			durationMinutes: 110,
+			expectedCost:    6.00, // 135 minutes capped at the two hour limit
+		},
+		{
+			name:            "Unmetered time isn't bought",
+			service:         NewPricingService(WithRounding(MinimumPurchase(60))),
+			arrivalTime:     "2024-01-15T07:00:00-08:00",
+			durationMinutes: 60,
+			expectedCost:    0.00,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arrivalTime, err := time.Parse(time.RFC3339, tt.arrivalTime)
+			require.NoError(t, err)
+
+			cost, err := tt.service.CalculateParkingCost(meter, arrivalTime, tt.durationMinutes)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.expectedCost, cost, 0.01)
+		})
+	}
+}
+
+func TestParseRoundingPolicies(t *testing.T) {
+	policies, err := ParseRoundingPolicies("ceil_to_increment(5), minimum_purchase(60)")
+	require.NoError(t, err)
+	assert.Equal(t, []RoundingPolicy{CeilToIncrement(5), MinimumPurchase(60)}, policies)
+
+	policies, err = ParseRoundingPolicies("none")
+	require.NoError(t, err)
+	assert.Equal(t, []RoundingPolicy{NoRounding()}, policies)
+
+	for _, value := range []string{"", "ceil_to_increment", "ceil_to_increment(0)", "round(5)", "minimum_purchase(x)"} {
+		_, err := ParseRoundingPolicies(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestPricingService_InTimezone(t *testing.T) {
+	meter := &domain.ParkingMeter{
+		MeterID:    "ZONED",
+		RateMF9A6P: 4.00,
+		RateMF6P10: 1.00,
+	}
+	// 3:30 PM in Vancouver, 6:30 PM in Toronto
+	arrivalTime := mustParseTime(t, "2024-01-15T15:30:00-08:00")
+
+	vancouver, err := NewPricingService().CalculateParkingCost(meter, arrivalTime, 60)
+	require.NoError(t, err)
+	assert.InDelta(t, 4.00, vancouver, 0.01)
+
+	zoned, err := NewPricingService().(TimezonePricer).InTimezone("America/Toronto")
+	require.NoError(t, err)
+	toronto, err := zoned.CalculateParkingCost(meter, arrivalTime, 60)
+	require.NoError(t, err)
+	assert.InDelta(t, 1.00, toronto, 0.01, "the evening rate applies in Toronto")
+
+	for _, name := range []string{"", "Pacific/Nowhere"} {
+		_, err := NewPricingService().(TimezonePricer).InTimezone(name)
+		assert.ErrorIs(t, err, ErrInvalidTimezone, name)
+	}
+}
+
+func TestPricingService_Holidays(t *testing.T) {
+	meter := &domain.ParkingMeter{
+		MeterID:         "HOLIDAY",
+		RateMF9A6P:      4.00,
+		TimeLimitMF9A6P: 2,
+		RateSU9A6P:      1.00,
+		TimeLimitSU9A6P: 4,
+	}
+
+	tests := []struct {
+		name         string
+		arrivalTime  string
+		service      PricingService
+		expectedCost float64
+		expectedRate float64
+	}{
+		{
+			name:         "Canada Day on a Monday charges the Sunday rate",
+			arrivalTime:  "2024-07-01T10:00:00-07:00",
+			service:      NewPricingService(),
+			expectedCost: 3.00,
+			expectedRate: 1.00,
+		},
+		{
+			name:         "Christmas on a Wednesday charges the Sunday rate",
+			arrivalTime:  "2024-12-25T10:00:00-08:00",
+			service:      NewPricingService(),
+			expectedCost: 3.00,
+			expectedRate: 1.00,
+		},
+		{
+			name:         "The day after Canada Day is a weekday again",
+			arrivalTime:  "2024-07-02T10:00:00-07:00",
+			service:      NewPricingService(),
+			expectedCost: 8.00, // Only the two hours the weekday limit allows
+			expectedRate: 4.00,
+		},
+		{
+			name:         "Free on holidays when configured",
+			arrivalTime:  "2024-12-25T10:00:00-08:00",
+			service:      NewPricingService(WithFreeHolidays()),
+			expectedCost: 0.00,
+			expectedRate: 0.00,
+		},
+		{
+			name:         "Weekday rates without a holiday calendar",
+			arrivalTime:  "2024-07-01T10:00:00-07:00",
+			service:      NewPricingService(WithHolidays(nil)),
+			expectedCost: 8.00,
+			expectedRate: 4.00,
+		},
+		{
+			name:         "Custom holiday set",
+			arrivalTime:  "2024-07-02T10:00:00-07:00",
+			service:      NewPricingService(WithHolidays(NewHolidaySet(time.Date(2024, 7, 2, 0, 0, 0, 0, time.UTC)))),
+			expectedCost: 3.00,
+			expectedRate: 1.00,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arrivalTime, err := time.Parse(time.RFC3339, tt.arrivalTime)
+			require.NoError(t, err)
+
+			cost, err := tt.service.CalculateParkingCost(meter, arrivalTime, 180)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.expectedCost, cost, 0.01)
+
+			rate, _ := tt.service.GetParkingRateAtTime(meter, MeterLocalTime(arrivalTime))
+			assert.Equal(t, tt.expectedRate, rate)
+		})
+	}
+}
+
+func TestBCStatutoryHolidays(t *testing.T) {
+	holidays := BCStatutoryHolidays{}
+	for _, date := range []string{
+		"2024-01-01", "2024-02-19", "2024-03-29", "2024-05-20", "2024-07-01", "2024-08-05",
+		"2024-09-02", "2024-09-30", "2024-10-14", "2024-11-11", "2024-12-25",
+		"2025-04-18", "2025-05-19", "2026-04-03", "2026-05-18",
+	} {
+		day, err := time.Parse(time.DateOnly, date)
+		require.NoError(t, err)
+		assert.True(t, holidays.IsHoliday(day), date)
+	}
+	for _, date := range []string{"2024-01-15", "2024-03-31", "2024-05-27", "2024-12-26", "2022-09-30"} {
+		day, err := time.Parse(time.DateOnly, date)
+		require.NoError(t, err)
+		assert.False(t, holidays.IsHoliday(day), date)
+	}
+}
+
+func TestPricingService_GetOptimalParkingMeter_CardMeterBonus(t *testing.T) {
+	service := NewPricingService()
+
+	// Equal-cost meters; the coin-only one is closer so it wins ties by default
+	meters := []*domain.ParkingMeter{
+		{MeterID: "COIN", RateMF9A6P: 3.00, CreditCard: false},
+		{MeterID: "CARD", RateMF9A6P: 3.00, CreditCard: true},
+		{MeterID: "CHEAP_COIN", RateMF9A6P: 1.00, CreditCard: false},
+	}
+	arrivalTime, _ := time.Parse(time.RFC3339, "2024-01-15T10:00:00-08:00") // Monday 10 AM
+
+	t.Run("No preference keeps the closest of equal meters", func(t *testing.T) {
+		bestMeter, _, err := service.GetOptimalParkingMeter(meters[:2], arrivalTime, 60)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "COIN", bestMeter.MeterID)
+	})
+
+	t.Run("Bonus picks the card meter among equal costs", func(t *testing.T) {
+		bestMeter, cost, err := service.GetOptimalParkingMeter(meters[:2], arrivalTime, 60, WithCardMeterBonus(0.25))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "CARD", bestMeter.MeterID)
+		assert.InDelta(t, 3.00, cost, 0.01) // The bonus only affects ranking
+	})
+
+	t.Run("Coin meters still win when clearly cheaper", func(t *testing.T) {
+		bestMeter, _, err := service.GetOptimalParkingMeter(meters, arrivalTime, 60, WithCardMeterBonus(0.25))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "CHEAP_COIN", bestMeter.MeterID)
+	})
+}
+
+func TestPricingService_GetOptimalParkingMeter_CoveredBonus(t *testing.T) {
+	service := NewPricingService()
+
+	meters := []*domain.ParkingMeter{
+		{MeterID: "STREET", MeterType: "Twin", RateMF9A6P: 3.00},
+		{MeterID: "PARKADE", MeterType: "Parkade Pay Station", RateMF9A6P: 4.00},
+	}
+	arrivalTime, _ := time.Parse(time.RFC3339, "2024-01-15T10:00:00-08:00") // Monday 10 AM
+
+	t.Run("Cheapest wins without the preference", func(t *testing.T) {
+		bestMeter, _, err := service.GetOptimalParkingMeter(meters, arrivalTime, 60)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "STREET", bestMeter.MeterID)
+	})
+
+	t.Run("Covered meter wins with the preference", func(t *testing.T) {
+		bestMeter, cost, err := service.GetOptimalParkingMeter(meters, arrivalTime, 60, WithCoveredBonus(DefaultCoveredBonus))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "PARKADE", bestMeter.MeterID)
+		assert.InDelta(t, 4.00, cost, 0.01)
+	})
+
+	t.Run("Falls back to the street when nothing is covered", func(t *testing.T) {
+		bestMeter, _, err := service.GetOptimalParkingMeter(meters[:1], arrivalTime, 60, WithCoveredBonus(DefaultCoveredBonus))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "STREET", bestMeter.MeterID)
+	})
+}
+
+func TestPricingService_CalculateParkingCost_MultiDayLimits(t *testing.T) {
+	service := NewPricingService()
+
+	meter := &domain.ParkingMeter{
+		MeterID:         "DAILY001",
+		RateMF9A6P:      4.00,
+		RateMF6P10:      2.50,
+		TimeLimitMF9A6P: 3, // 3 hours each day
+	}
+
+	tests := []struct {
+		name            string
+		arrivalTime     string
+		durationMinutes int
+		expectedCost    float64
+	}{
+		// 3 PM-6 PM Monday, the evening, then 9 AM-noon Tuesday on a fresh limit
+		{"Within the limit on both days", "2024-01-15T15:00:00-08:00", 21 * 60, 3*4.00 + 4*2.50 + 3*4.00},
+		// Monday's limit ends the paid daytime at noon; the evening is still paid
+		{"9 AM to 9 AM the next day", "2024-01-15T09:00:00-08:00", 24 * 60, 3*4.00 + 4*2.50},
+		{"Over the limit on both days", "2024-01-15T09:00:00-08:00", 30 * 60, 3*4.00 + 4*2.50 + 3*4.00},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arrivalTime, err := time.Parse(time.RFC3339, tt.arrivalTime)
+			require.NoError(t, err)
+
+			cost, err := service.CalculateParkingCost(meter, arrivalTime, tt.durationMinutes)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.expectedCost, cost, 0.01)
+		})
+	}
+
+	t.Run("The evening doesn't start a fresh limit", func(t *testing.T) {
+		// 3 hours a day, with no more than 2 of them in the evening
+		limited := *meter
+		limited.TimeLimitMF6P10 = 2
+
+		// 4 PM to 10 PM: two daytime hours leave nothing for the evening
+		arrivalTime := mustParseTime(t, "2024-01-15T16:00:00-08:00")
+		cost, err := service.CalculateParkingCost(&limited, arrivalTime, 6*60)
+		require.NoError(t, err)
+		assert.InDelta(t, 2*4.00, cost, 0.01)
+
+		// Meter selection holds the stay to the same allowance
+		pricing := service.(*DefaultPricingService)
+		exceeds, err := pricing.exceedsTimeLimit(&limited, arrivalTime, 2*60)
+		require.NoError(t, err)
+		assert.False(t, exceeds)
+		exceeds, err = pricing.exceedsTimeLimit(&limited, arrivalTime, 3*60)
+		require.NoError(t, err)
+		assert.True(t, exceeds)
+		allowed, err := pricing.allowedMinutes(&limited, arrivalTime, 6*60)
+		require.NoError(t, err)
+		assert.Equal(t, 2*60, allowed)
+
+		// 5 PM: one daytime hour leaves one evening hour, and Tuesday starts afresh
+		cost, err = service.CalculateParkingCost(&limited, mustParseTime(t, "2024-01-15T17:00:00-08:00"), 19*60)
+		require.NoError(t, err)
+		assert.InDelta(t, 1*4.00+1*2.50+3*4.00, cost, 0.01)
+	})
+}
+
+func TestPricingService_CalculateParkingCost_Boundaries(t *testing.T) {
+	service := NewPricingService()
+
+	meter := &domain.ParkingMeter{
+		MeterID:    "EDGE001",
+		RateMF9A6P: 4.00, // $4.00/hr, so a minute costs $0.0667
+		RateMF6P10: 2.50, // $2.50/hr, so a minute costs $0.0417
+	}
+	const dayMinute, eveningMinute = 4.00 / 60, 2.50 / 60
+
+	tests := []struct {
+		name            string
+		arrivalTime     string
+		durationMinutes int
+		expectedCost    float64
+	}{
+		{"Ends exactly at 6 PM", "2024-01-15T16:00:00-08:00", 120, 120 * dayMinute},
+		{"One minute past 6 PM", "2024-01-15T16:00:00-08:00", 121, 120*dayMinute + eveningMinute},
+		{"Starts exactly at 6 PM", "2024-01-15T18:00:00-08:00", 60, 60 * eveningMinute},
+		{"Ends exactly at 10 PM", "2024-01-15T20:00:00-08:00", 120, 120 * eveningMinute},
+		{"Runs past 10 PM", "2024-01-15T20:00:00-08:00", 121, 120 * eveningMinute},
+		{"Last metered minute", "2024-01-15T21:59:00-08:00", 1, eveningMinute},
+		{"Half a minute either side of 6 PM", "2024-01-15T17:59:30-08:00", 1, dayMinute/2 + eveningMinute/2},
+		{"Ends exactly at 9 AM", "2024-01-15T08:00:00-08:00", 60, 0},
+		{"Starts before 9 AM", "2024-01-15T08:30:00-08:00", 60, 30 * dayMinute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arrivalTime, err := time.Parse(time.RFC3339, tt.arrivalTime)
+			assert.NoError(t, err)
+
+			cost, err := service.CalculateParkingCost(meter, arrivalTime, tt.durationMinutes)
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.expectedCost, cost, 1e-9)
+		})
+	}
+}
+
+func TestPricingService_GetOptimalParkingMeter_WalkingLimit(t *testing.T) {
+	service := NewPricingService()
+	destination := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	close := &domain.ParkingMeter{MeterID: "CLOSE", Lat: 49.2829, Lng: -123.1207, RateMF9A6P: 4.00, TimeLimitMF9A6P: 2}
+	// About 2 km south: cheap, but a 24-minute walk
+	distant := &domain.ParkingMeter{MeterID: "DISTANT", Lat: 49.2647, Lng: -123.1207, RateMF9A6P: 1.00, TimeLimitMF9A6P: 2}
+	monday := time.Date(2024, 1, 15, 10, 0, 0, 0, time.FixedZone("PST", -8*60*60))
+	meters := []*domain.ParkingMeter{close, distant}
+
+	meter, _, err := service.GetOptimalParkingMeter(meters, monday, 60)
+	require.NoError(t, err)
+	assert.Equal(t, "DISTANT", meter.MeterID, "without a limit the cheapest meter wins")
+
+	meter, cost, err := service.GetOptimalParkingMeter(meters, monday, 60, WithWalkingLimit(destination, 15, nil))
+	require.NoError(t, err)
+	require.NotNil(t, meter)
+	assert.Equal(t, "CLOSE", meter.MeterID)
+	assert.Equal(t, 4.00, cost)
+
+	meter, _, err = service.GetOptimalParkingMeter([]*domain.ParkingMeter{distant}, monday, 60, WithWalkingLimit(destination, 15, nil))
+	require.NoError(t, err)
+	assert.Nil(t, meter)
+}
+
+func TestPricingService_OutOfRangeDurations(t *testing.T) {
+	service := NewPricingService()
+	meter := &domain.ParkingMeter{MeterID: "TEST001", RateMF9A6P: 1.00, RateMF6P10: 1.00}
+	monday := time.Date(2024, 1, 15, 10, 0, 0, 0, time.FixedZone("PST", -8*60*60))
+
+	t.Run("Negative durations are rejected", func(t *testing.T) {
+		_, err := service.CalculateParkingCost(meter, monday, -30)
+		assert.ErrorIs(t, err, ErrNegativeDuration)
+
+		_, _, err = service.GetOptimalParkingMeter([]*domain.ParkingMeter{meter}, monday, -30)
+		assert.ErrorIs(t, err, ErrNegativeDuration)
+
+		_, err = service.PlanSplitVisit([]*domain.ParkingMeter{meter}, monday, -30)
+		assert.ErrorIs(t, err, ErrNegativeDuration)
+	})
+
+	t.Run("Enormous durations are priced as a week", func(t *testing.T) {
+		week, err := service.CalculateParkingCost(meter, monday, MaxStayMinutes)
+		require.NoError(t, err)
+		assert.Greater(t, week, 0.0)
+
+		year, err := service.CalculateParkingCost(meter, monday, 365*24*60)
+		require.NoError(t, err)
+		assert.Equal(t, week, year)
+	})
+
+	t.Run("Zero durations are free", func(t *testing.T) {
+		cost, err := service.CalculateParkingCost(meter, monday, 0)
+		require.NoError(t, err)
+		assert.Zero(t, cost)
+	})
+}
+
+func TestPricingService_WithoutTzdata(t *testing.T) {
+	vancouver, err := time.LoadLocation("America/Vancouver")
+	require.NoError(t, err)
+
+	defer SetLocationLoader(func(name string) (*time.Location, error) {
+		return nil, fmt.Errorf("unknown time zone %s", name)
+	})()
+
+	service := NewPricingService()
+	meter := &domain.ParkingMeter{
+		MeterID:         "TEST001",
+		RateMF9A6P:      3.50,
+		RateMF6P10:      2.00,
+		TimeLimitMF9A6P: 3,
+		TimeLimitMF6P10: 4,
+	}
+
+	tests := []struct {
+		name         string
+		arrivalTime  string
+		duration     int
+		expectedCost float64
+	}{
+		// 16:00 UTC is 8 AM PST in winter, before the meters start
+		{"Winter, from 8 AM PST", "2024-01-15T16:00:00Z", 120, 3.50},
+		// 16:00 UTC is 9 AM PDT in summer, all daytime
+		{"Summer, from 9 AM PDT", "2024-07-15T16:00:00Z", 120, 7.00},
+		// 01:00 UTC is 5 PM PST, running into the evening rate
+		{"Winter, across 6 PM", "2024-01-16T01:00:00Z", 120, 5.50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, err := service.CalculateParkingCost(meter, mustParseTime(t, tt.arrivalTime), tt.duration)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.expectedCost, cost, 0.01)
+		})
+	}
+
+	t.Run("Pacific timezones still price", func(t *testing.T) {
+		for _, name := range []string{"America/Vancouver", "America/Los_Angeles"} {
+			zoned, err := service.(TimezonePricer).InTimezone(name)
+			require.NoError(t, err, name)
+			cost, err := zoned.CalculateParkingCost(meter, mustParseTime(t, "2024-07-15T16:00:00Z"), 120)
+			require.NoError(t, err, name)
+			assert.InDelta(t, 7.00, cost, 0.01, name)
+		}
+
+		_, err := service.(TimezonePricer).InTimezone("America/Toronto")
+		assert.ErrorIs(t, err, ErrInvalidTimezone)
+	})
+
+	t.Run("Fixed offsets match the tz database", func(t *testing.T) {
+		for year := 2020; year <= 2030; year++ {
+			for hour := 0; hour < 365*24; hour += 7 {
+				instant := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(hour) * time.Hour)
+				_, want := instant.In(vancouver).Zone()
+				_, got := instant.In(pacificFixedZone(instant)).Zone()
+				require.Equal(t, want, got, instant.Format(time.RFC3339))
+			}
+		}
+		for _, instant := range []string{"2024-03-10T09:59:59Z", "2024-03-10T10:00:00Z", "2024-11-03T08:59:59Z", "2024-11-03T09:00:00Z"} {
+			at := mustParseTime(t, instant)
+			_, want := at.In(vancouver).Zone()
+			_, got := at.In(pacificFixedZone(at)).Zone()
+			assert.Equal(t, want, got, instant)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package service
+
+import "vancouver-trip-planner/internal/domain"
+
+// MostReliablePlanType is the plan type of the route keeping the most buffer
+// against stop time windows
+const MostReliablePlanType = "most_reliable"
+
+// slackTracker keeps the smallest buffer seen against a stop's time window
+type slackTracker struct {
+	min int
+	set bool
+}
+
+// observe records a buffer in minutes; negative buffers mean the window was missed
+func (t *slackTracker) observe(minutes int) {
+	if !t.set || minutes < t.min {
+		t.min = minutes
+	}
+	t.set = true
+}
+
+// hasTimeWindows reports whether any stop has a fixed arrival or latest departure
+func hasTimeWindows(stops []domain.Stop) bool {
+	for _, stop := range stops {
+		if !stop.FixedArrival.IsZero() || !stop.LatestDeparture.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// mostReliableRoute returns the route with the largest minimum buffer against
+// its stops' time windows, preferring less time spent getting around among
+// equals. Skipping a stop drops its window, so only routes visiting every stop
+// compete; it returns nil when no route has a time window.
+func mostReliableRoute(routes []*RouteCandidate) *RouteCandidate {
+	var reliable *RouteCandidate
+	for _, route := range routes {
+		if !route.Windowed || len(route.DroppedStops) > 0 {
+			continue
+		}
+		if reliable == nil || route.MinSlack > reliable.MinSlack ||
+			(route.MinSlack == reliable.MinSlack && route.TransitTime() < reliable.TransitTime()) {
+			reliable = route
+		}
+	}
+	return reliable
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RoundingMode is how a RoundingPolicy adjusts the time paid for
+type RoundingMode int
+
+const (
+	// RoundNone charges for exactly the time parked (the default)
+	RoundNone RoundingMode = iota
+	// RoundCeilToIncrement rounds the time paid for up to a whole number of increments
+	RoundCeilToIncrement
+	// RoundMinimumPurchase charges for at least a minimum amount of time
+	RoundMinimumPurchase
+)
+
+// RoundingPolicy models how meters sell time, e.g. in 5-minute blocks or
+// with a one hour minimum. It applies to each metered period of a stay, since
+// a change of rate needs a fresh purchase.
+type RoundingPolicy struct {
+	Mode    RoundingMode
+	Minutes int
+}
+
+// NoRounding charges for exactly the time parked
+func NoRounding() RoundingPolicy {
+	return RoundingPolicy{Mode: RoundNone}
+}
+
+// CeilToIncrement rounds the time paid for up to a multiple of minutes
+func CeilToIncrement(minutes int) RoundingPolicy {
+	return RoundingPolicy{Mode: RoundCeilToIncrement, Minutes: minutes}
+}
+
+// MinimumPurchase charges for at least minutes whenever anything is paid
+func MinimumPurchase(minutes int) RoundingPolicy {
+	return RoundingPolicy{Mode: RoundMinimumPurchase, Minutes: minutes}
+}
+
+// apply returns the time paid for when charged is parked
+func (p RoundingPolicy) apply(charged time.Duration) time.Duration {
+	step := time.Duration(p.Minutes) * time.Minute
+	if charged <= 0 || step <= 0 {
+		return charged
+	}
+
+	switch p.Mode {
+	case RoundCeilToIncrement:
+		if remainder := charged % step; remainder != 0 {
+			charged += step - remainder
+		}
+	case RoundMinimumPurchase:
+		if charged < step {
+			charged = step
+		}
+	}
+	return charged
+}
+
+// ParseRoundingPolicies reads a comma-separated list of rounding policies,
+// each none, ceil_to_increment(minutes) or minimum_purchase(minutes)
+func ParseRoundingPolicies(value string) ([]RoundingPolicy, error) {
+	var policies []RoundingPolicy
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "none" {
+			policies = append(policies, NoRounding())
+			continue
+		}
+
+		mode, arg, ok := strings.Cut(strings.TrimSuffix(name, ")"), "(")
+		if !ok || !strings.HasSuffix(name, ")") {
+			return nil, fmt.Errorf("unknown rounding policy: %s", name)
+		}
+		minutes, err := strconv.Atoi(arg)
+		if err != nil || minutes <= 0 {
+			return nil, fmt.Errorf("rounding policy %s needs a positive number of minutes", name)
+		}
+
+		switch mode {
+		case "ceil_to_increment":
+			policies = append(policies, CeilToIncrement(minutes))
+		case "minimum_purchase":
+			policies = append(policies, MinimumPurchase(minutes))
+		default:
+			return nil, fmt.Errorf("unknown rounding policy: %s", name)
+		}
+	}
+	return policies, nil
+}
+
+// WithRounding sets how meters sell time. Policies apply in order, so
+// CeilToIncrement(5) then MinimumPurchase(60) sells 5-minute blocks with a
+// one hour minimum. Time paid for never exceeds the period's time limit.
+func WithRounding(policies ...RoundingPolicy) PricingOption {
+	return func(s *DefaultPricingService) {
+		s.rounding = policies
+	}
+}
+
+// roundCharged returns the time paid for when charged is parked in a period
+// with the given time limit in hours
+func (s *DefaultPricingService) roundCharged(charged time.Duration, timeLimit int) time.Duration {
+	if charged <= 0 || len(s.rounding) == 0 {
+		return charged
+	}
+
+	paid := charged
+	for _, policy := range s.rounding {
+		paid = policy.apply(paid)
+	}
+	if limit := time.Duration(timeLimit) * time.Hour; timeLimit > 0 && paid > limit {
+		paid = max(limit, charged)
+	}
+	return paid
+}
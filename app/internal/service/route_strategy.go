@@ -0,0 +1,271 @@
+package service
+
+import (
+	"fmt"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// Route strategy names accepted in TripRequest.Strategy
+const (
+	StrategyExhaustive      = "exhaustive"
+	StrategyNearestNeighbor = "nearest_neighbor"
+	StrategyTwoOpt          = "two_opt"
+)
+
+// RouteStrategy decides which stop orderings are evaluated for a trip
+type RouteStrategy interface {
+	Name() string
+	GenerateRoutes(ctx *RouteContext) []*RouteCandidate
+}
+
+// RouteContext gives a strategy the trip being planned and access to the
+// routing service's evaluation helpers
+type RouteContext struct {
+	Stops          []*domain.Stop
+	ParkingOptions map[string][]*domain.ParkingMeter
+	Request        *domain.TripRequest
+
+	// MaxCandidates bounds how many candidates a strategy should generate; zero
+	// means no bound. Strategies that stop short of every candidate they could
+	// generate set Truncated.
+	MaxCandidates int
+	Truncated     bool
+
+	service     *DefaultRoutingService
+	travelTimes map[[2]string]int
+}
+
+// newRouteContext creates a route context for a single planning run
+func (s *DefaultRoutingService) newRouteContext(stops []*domain.Stop, parkingOptions map[string][]*domain.ParkingMeter, request *domain.TripRequest) *RouteContext {
+	return &RouteContext{
+		Stops:          stops,
+		ParkingOptions: parkingOptions,
+		Request:        request,
+		MaxCandidates:  s.maxCandidates,
+		service:        s,
+		travelTimes:    make(map[[2]string]int),
+	}
+}
+
+// BuildCandidate prices a complete stop ordering, returning nil if it is infeasible
+func (c *RouteContext) BuildCandidate(order []*domain.Stop) *RouteCandidate {
+	return c.service.buildRouteCandidate(order, c.ParkingOptions, c.Request)
+}
+
+// TravelTime returns the driving minutes between two stops at the trip start time,
+// memoized for the lifetime of the context
+func (c *RouteContext) TravelTime(from, to *domain.Stop) (int, error) {
+	key := [2]string{from.ID, to.ID}
+	if minutes, ok := c.travelTimes[key]; ok {
+		return minutes, nil
+	}
+
+	minutes, err := c.service.legTravelTime(from, to, c.Request.StartTime)
+	if err != nil {
+		return 0, err
+	}
+
+	c.travelTimes[key] = minutes
+	return minutes, nil
+}
+
+// pathTravelTime sums the travel time along an ordering of stops
+func (c *RouteContext) pathTravelTime(order []*domain.Stop) (int, error) {
+	return pathTravelTime(order, c.TravelTime)
+}
+
+// travelTimeFunc returns the driving minutes between two stops
+type travelTimeFunc func(from, to *domain.Stop) (int, error)
+
+// pathTravelTime sums the travel time along an ordering of stops
+func pathTravelTime(order []*domain.Stop, travelTime travelTimeFunc) (int, error) {
+	total := 0
+	for i := 1; i < len(order); i++ {
+		minutes, err := travelTime(order[i-1], order[i])
+		if err != nil {
+			return 0, err
+		}
+		total += minutes
+	}
+	return total, nil
+}
+
+// RouteStrategyByName returns the built-in strategy with the given name
+func RouteStrategyByName(name string) (RouteStrategy, error) {
+	switch name {
+	case StrategyExhaustive:
+		return ExhaustiveStrategy{}, nil
+	case StrategyNearestNeighbor:
+		return NearestNeighborStrategy{}, nil
+	case StrategyTwoOpt:
+		return TwoOptStrategy{}, nil
+	}
+	return nil, fmt.Errorf("unknown route strategy: %s", name)
+}
+
+// ExhaustiveStrategy evaluates every ordering of the stops after the first
+type ExhaustiveStrategy struct{}
+
+// Name returns the strategy identifier
+func (ExhaustiveStrategy) Name() string { return StrategyExhaustive }
+
+// GenerateRoutes builds a candidate for each permutation of the remaining stops
+func (ExhaustiveStrategy) GenerateRoutes(ctx *RouteContext) []*RouteCandidate {
+	var routes []*RouteCandidate
+
+	// Generate permutations of stops (for small numbers of stops)
+	stopPermutations := ctx.service.generateStopPermutations(ctx.Stops[1:]) // Exclude first stop as starting point
+	if ctx.MaxCandidates > 0 && len(stopPermutations) > ctx.MaxCandidates {
+		fmt.Printf("[DEBUG] Evaluating %d of %d stop orders\n", ctx.MaxCandidates, len(stopPermutations))
+		stopPermutations = spreadSample(stopPermutations, ctx.MaxCandidates)
+		ctx.Truncated = true
+	}
+
+	for _, perm := range stopPermutations {
+		// Add starting stop
+		route := []*domain.Stop{ctx.Stops[0]}
+		route = append(route, perm...)
+
+		// Try different parking combinations for this route
+		routeCandidates := ctx.service.evaluateRouteWithParkingCombinations(route, ctx.ParkingOptions, ctx.Request)
+		routes = append(routes, routeCandidates...)
+	}
+
+	return routes
+}
+
+// NearestNeighborStrategy greedily drives to the closest unvisited stop
+type NearestNeighborStrategy struct{}
+
+// Name returns the strategy identifier
+func (NearestNeighborStrategy) Name() string { return StrategyNearestNeighbor }
+
+// GenerateRoutes builds the single greedy nearest-neighbor ordering
+func (NearestNeighborStrategy) GenerateRoutes(ctx *RouteContext) []*RouteCandidate {
+	order, err := nearestNeighborOrder(ctx.Stops, ctx.TravelTime)
+	if err != nil {
+		fmt.Printf("[DEBUG] Nearest-neighbor ordering failed: %v\n", err)
+		return nil
+	}
+
+	if candidate := ctx.BuildCandidate(order); candidate != nil {
+		return []*RouteCandidate{candidate}
+	}
+	return nil
+}
+
+// TwoOptStrategy improves the nearest-neighbor ordering with 2-opt segment reversals
+type TwoOptStrategy struct{}
+
+// Name returns the strategy identifier
+func (TwoOptStrategy) Name() string { return StrategyTwoOpt }
+
+// GenerateRoutes builds the 2-opt improved ordering
+func (TwoOptStrategy) GenerateRoutes(ctx *RouteContext) []*RouteCandidate {
+	order, err := heuristicStopOrder(ctx.Stops, ctx.TravelTime)
+	if err != nil {
+		fmt.Printf("[DEBUG] Heuristic ordering failed: %v\n", err)
+		return nil
+	}
+
+	if candidate := ctx.BuildCandidate(order); candidate != nil {
+		return []*RouteCandidate{candidate}
+	}
+	return nil
+}
+
+// heuristicStopOrder orders the stops, keeping the first one first, by
+// visiting the nearest unvisited stop each time and then improving the order
+// with 2-opt reversals. It looks up O(n²) travel times per pass rather than
+// trying all (n-1)! orders, so it suits trips too large to plan exactly.
+func heuristicStopOrder(stops []*domain.Stop, travelTime travelTimeFunc) ([]*domain.Stop, error) {
+	order, err := nearestNeighborOrder(stops, travelTime)
+	if err != nil {
+		return nil, err
+	}
+	return twoOptImprove(order, travelTime)
+}
+
+// nearestNeighborOrder starts at the first stop and repeatedly visits the
+// unvisited stop with the shortest travel time
+func nearestNeighborOrder(stops []*domain.Stop, travelTime travelTimeFunc) ([]*domain.Stop, error) {
+	order := []*domain.Stop{stops[0]}
+	remaining := append([]*domain.Stop{}, stops[1:]...)
+
+	for len(remaining) > 0 {
+		current := order[len(order)-1]
+		bestIndex := -1
+		bestTime := 0
+
+		for i, candidate := range remaining {
+			minutes, err := travelTime(current, candidate)
+			if err != nil {
+				return nil, err
+			}
+			if bestIndex == -1 || minutes < bestTime {
+				bestIndex = i
+				bestTime = minutes
+			}
+		}
+
+		order = append(order, remaining[bestIndex])
+		remaining = append(remaining[:bestIndex], remaining[bestIndex+1:]...)
+	}
+
+	return order, nil
+}
+
+// twoOptImprove reverses sub-sequences of the ordering (keeping the first stop
+// fixed) until no reversal reduces the total travel time
+func twoOptImprove(order []*domain.Stop, travelTime travelTimeFunc) ([]*domain.Stop, error) {
+	best := append([]*domain.Stop{}, order...)
+	bestTime, err := pathTravelTime(best, travelTime)
+	if err != nil {
+		return nil, err
+	}
+
+	improved := true
+	for improved {
+		improved = false
+		for i := 1; i < len(best)-1; i++ {
+			for k := i + 1; k < len(best); k++ {
+				candidate := reverseSegment(best, i, k)
+				candidateTime, err := pathTravelTime(candidate, travelTime)
+				if err != nil {
+					return nil, err
+				}
+				if candidateTime < bestTime {
+					best = candidate
+					bestTime = candidateTime
+					improved = true
+				}
+			}
+		}
+	}
+
+	return best, nil
+}
+
+// reverseSegment returns a copy of order with the stops between i and k (inclusive) reversed
+func reverseSegment(order []*domain.Stop, i, k int) []*domain.Stop {
+	reversed := append([]*domain.Stop{}, order...)
+	for left, right := i, k; left < right; left, right = left+1, right-1 {
+		reversed[left], reversed[right] = reversed[right], reversed[left]
+	}
+	return reversed
+}
+
+// spreadSample keeps n of items spread evenly across them. Permutations are
+// generated in lexicographic order, so this keeps a mix of orderings rather
+// than the first n, which all share a prefix.
+func spreadSample[T any](items []T, n int) []T {
+	if n <= 0 || len(items) <= n {
+		return items
+	}
+	sampled := make([]T, n)
+	for i := range sampled {
+		sampled[i] = items[i*len(items)/n]
+	}
+	return sampled
+}
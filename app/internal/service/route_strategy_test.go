@@ -0,0 +1,376 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+)
+
+// fourStopFixture places a meter beside each of four downtown stops and
+// makes travel time proportional to how far apart the stops are
+func fourStopFixture() (*fakeParkingRepository, *fakeMapsService, []domain.Stop) {
+	stops := []domain.Stop{
+		{ID: "a", Address: "Stop A", Lat: 49.2800, Lng: -123.1200, Duration: 30},
+		{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1200, Duration: 30},
+		{ID: "c", Address: "Stop C", Lat: 49.2900, Lng: -123.1000, Duration: 30},
+		{ID: "d", Address: "Stop D", Lat: 49.2800, Lng: -123.1000, Duration: 30},
+	}
+
+	repo := &fakeParkingRepository{}
+	mapsService := &fakeMapsService{travelTimes: map[string]int{}}
+	for i, from := range stops {
+		repo.meters = append(repo.meters, &domain.ParkingMeter{
+			MeterID: "M" + from.ID, Lat: from.Lat + 0.0001, Lng: from.Lng, RateMF9A6P: 2.00 + float64(i),
+		})
+		for _, to := range stops {
+			if from.ID == to.ID {
+				continue
+			}
+			// Roughly one minute per 100 m of separation in either axis
+			minutes := int((abs(from.Lat-to.Lat) + abs(from.Lng-to.Lng)) * 1000)
+			mapsService.travelTimes[locationKey(
+				&domain.Location{Lat: from.Lat, Lng: from.Lng},
+				&domain.Location{Lat: to.Lat, Lng: to.Lng},
+			)] = minutes
+		}
+	}
+
+	return repo, mapsService, stops
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func TestRouteStrategies_ReturnValidRoutes(t *testing.T) {
+	strategies := []RouteStrategy{ExhaustiveStrategy{}, NearestNeighborStrategy{}, TwoOptStrategy{}}
+
+	for _, strategy := range strategies {
+		t.Run(strategy.Name(), func(t *testing.T) {
+			repo, mapsService, stops := fourStopFixture()
+			routing := NewRoutingService(repo, mapsService, NewPricingService(), WithRouteStrategy(strategy))
+
+			plans, err := routing.PlanTrip(&domain.TripRequest{
+				Stops:       stops,
+				StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+				Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+			})
+			require.NoError(t, err)
+			require.Len(t, plans, 3)
+
+			for _, plan := range plans {
+				require.Len(t, plan.Route, len(stops))
+				assert.Equal(t, "a", plan.Route[0].ToStop.ID, "first stop stays fixed")
+
+				visited := map[string]bool{}
+				for _, segment := range plan.Route {
+					assert.NotNil(t, segment.ParkingMeter)
+					visited[segment.ToStop.ID] = true
+				}
+				assert.Len(t, visited, len(stops), "every stop visited exactly once")
+			}
+		})
+	}
+}
+
+func TestRouteStrategies_HeuristicsAvoidCrossingRoute(t *testing.T) {
+	repo, mapsService, stops := fourStopFixture()
+	routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+	for _, name := range []string{StrategyNearestNeighbor, StrategyTwoOpt} {
+		t.Run(name, func(t *testing.T) {
+			plans, err := routing.PlanTrip(&domain.TripRequest{
+				Stops:       stops,
+				StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+				Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+				Strategy:    name,
+			})
+			require.NoError(t, err)
+
+			// Walking the square's perimeter (a -> b -> c -> d) is the shortest tour
+			fastest := findPlan(plans, "fastest")
+			require.NotNil(t, fastest)
+			var order []string
+			for _, segment := range fastest.Route {
+				order = append(order, segment.ToStop.ID)
+			}
+			assert.Equal(t, []string{"a", "b", "c", "d"}, order)
+		})
+	}
+}
+
+func TestRouteStrategyByName(t *testing.T) {
+	strategy, err := RouteStrategyByName(StrategyTwoOpt)
+	assert.NoError(t, err)
+	assert.Equal(t, StrategyTwoOpt, strategy.Name())
+
+	_, err = RouteStrategyByName("genetic")
+	assert.Error(t, err)
+}
+
+func TestRoutingService_MaxCandidates(t *testing.T) {
+	repo := &fakeParkingRepository{}
+	request := &domain.TripRequest{
+		StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	}
+	for i := 0; i < 6; i++ {
+		lat := 49.2800 + 0.002*float64(i)
+		id := string(rune('a' + i))
+		request.Stops = append(request.Stops, domain.Stop{ID: id, Address: "Stop " + id, Lat: lat, Lng: -123.1200, Duration: 30})
+		repo.meters = append(repo.meters, &domain.ParkingMeter{MeterID: "M" + id, Lat: lat + 0.0001, Lng: -123.1200, RateMF9A6P: 2.00})
+	}
+
+	t.Run("Keeps at most the cap, spread across orderings", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService(), WithMaxCandidates(100))
+
+		candidates, err := routing.EvaluateCandidates(request)
+		require.NoError(t, err)
+		// 5! = 120 orderings of the stops after the first
+		assert.Len(t, candidates, 100)
+
+		secondStops := make(map[string]bool)
+		for _, candidate := range candidates {
+			secondStops[candidate.Stops[1].ID] = true
+		}
+		assert.Len(t, secondStops, 5)
+
+		plans, err := routing.PlanTrip(request)
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+		assert.Equal(t, true, plans[0].Metadata["candidates_truncated"])
+	})
+
+	t.Run("Caps candidates across optional stop subsets", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService(), WithMaxCandidates(100))
+
+		optional := *request
+		optional.Stops = append([]domain.Stop{}, request.Stops...)
+		optional.Stops[5].Optional = true
+		candidates, err := routing.EvaluateCandidates(&optional)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(candidates), 100)
+	})
+
+	t.Run("Doesn't flag plans under the cap", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+
+		candidates, err := routing.EvaluateCandidates(request)
+		require.NoError(t, err)
+		assert.Len(t, candidates, 120)
+
+		plans, err := routing.PlanTrip(request)
+		require.NoError(t, err)
+		assert.Nil(t, plans[0].Metadata["candidates_truncated"])
+	})
+}
+
+// pruningFixture has six stops whose meters are cheap by day and dear in the
+// evening or the other way round, so visiting order changes both cost and time
+func pruningFixture() (*fakeParkingRepository, *fakeMapsService, []domain.Stop) {
+	repo := &fakeParkingRepository{}
+	mapsService := &fakeMapsService{travelTimes: map[string]int{}}
+	var stops []domain.Stop
+	for i := 0; i < 6; i++ {
+		id := string(rune('a' + i))
+		lat := 49.2700 + 0.004*float64(i%3)
+		lng := -123.1300 + 0.006*float64(i/2)
+		stops = append(stops, domain.Stop{ID: id, Address: "Stop " + id, Lat: lat, Lng: lng, Duration: 45})
+
+		dayRate, eveningRate := 1.00+float64(i), 6.00-float64(i)
+		repo.meters = append(repo.meters, &domain.ParkingMeter{
+			MeterID: "M" + id, Lat: lat + 0.0001, Lng: lng,
+			RateMF9A6P: dayRate, RateMF6P10: eveningRate, TimeLimitMF9A6P: 3, TimeLimitMF6P10: 3,
+		})
+	}
+	for _, from := range stops {
+		for _, to := range stops {
+			if from.ID != to.ID {
+				mapsService.travelTimes[locationKey(
+					&domain.Location{Lat: from.Lat, Lng: from.Lng},
+					&domain.Location{Lat: to.Lat, Lng: to.Lng},
+				)] = 3 + int((abs(from.Lat-to.Lat)+abs(from.Lng-to.Lng))*1000)
+			}
+		}
+	}
+	return repo, mapsService, stops
+}
+
+// planSummary reduces plans to what a client sees of them
+func planSummary(plans []*domain.TripPlan) []string {
+	var summary []string
+	for _, plan := range plans {
+		line := fmt.Sprintf("%s $%.2f %dm", plan.Type, plan.TotalCost, plan.TotalTime)
+		for _, segment := range plan.Route {
+			line += fmt.Sprintf(" %s@%s", segment.ToStop.ID, segment.ParkingMeter.MeterID)
+		}
+		summary = append(summary, line)
+	}
+	return summary
+}
+
+func TestRoutingService_CandidatePruning(t *testing.T) {
+	requests := map[string]func(stops []domain.Stop) *domain.TripRequest{
+		"Balanced": func(stops []domain.Stop) *domain.TripRequest {
+			return &domain.TripRequest{Stops: stops, Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5}}
+		},
+		"Cost only": func(stops []domain.Stop) *domain.TripRequest {
+			return &domain.TripRequest{Stops: stops, Preferences: domain.Preferences{CostWeight: 1}}
+		},
+		"Optional stop": func(stops []domain.Stop) *domain.TripRequest {
+			stops[4].Optional = true
+			return &domain.TripRequest{Stops: stops, Preferences: domain.Preferences{CostWeight: 0.7, TimeWeight: 0.3}}
+		},
+	}
+
+	for name, build := range requests {
+		t.Run(name, func(t *testing.T) {
+			plan := func(pruning bool) ([]string, int) {
+				repo, mapsService, stops := pruningFixture()
+				request := build(stops)
+				request.StartTime = mustParseTime(t, "2024-01-15T16:30:00-08:00")
+				// Legs are looked up one at a time so lookups count the routes evaluated
+				routing := NewRoutingService(repo, mapsService, NewPricingService(), WithCandidatePruning(pruning), WithTravelMatrix(false))
+				plans, err := routing.PlanTrip(request)
+				require.NoError(t, err)
+				return planSummary(plans), mapsService.travelCalls
+			}
+
+			pruned, prunedCalls := plan(true)
+			unpruned, unprunedCalls := plan(false)
+			assert.Equal(t, unpruned, pruned, "pruning never changes the plans")
+			assert.Less(t, prunedCalls, unprunedCalls, "pruning abandons some routes part way")
+		})
+	}
+}
+
+func BenchmarkRoutingService_CandidatePruning(b *testing.B) {
+	for _, pruning := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pruning=%t", pruning), func(b *testing.B) {
+			repo, mapsService, stops := pruningFixture()
+			routing := NewRoutingService(repo, mapsService, NewPricingService(), WithCandidatePruning(pruning), WithTravelMatrix(false))
+			request := &domain.TripRequest{
+				Stops:       stops,
+				StartTime:   time.Date(2024, 1, 15, 16, 30, 0, 0, time.FixedZone("PST", -8*60*60)),
+				Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := routing.PlanTrip(request); err != nil {
+					b.Fatal(err)
+				}
+			}
+			// Each stop reached makes one travel time lookup, so fewer lookups
+			// means fewer partial routes evaluated
+			b.ReportMetric(float64(mapsService.travelCalls)/float64(b.N), "legs/op")
+		})
+	}
+}
+
+func TestRoutingService_ExactPlanningLimit(t *testing.T) {
+	t.Run("The default is exhaustive within the candidate cap", func(t *testing.T) {
+		// The first stop stays put and the rest are reordered
+		orders := 1
+		for n := 2; n < DefaultExactPlanningMaxStops; n++ {
+			orders *= n
+		}
+		assert.Equal(t, 5040, orders)
+		assert.LessOrEqual(t, orders, DefaultMaxCandidates)
+	})
+
+	t.Run("Nine stops are ordered heuristically", func(t *testing.T) {
+		repo := &fakeParkingRepository{}
+		var stops []domain.Stop
+		for i := 0; i < 9; i++ {
+			id := string(rune('a' + i))
+			lat := 49.2700 + 0.004*float64(i%3)
+			lng := -123.1300 + 0.006*float64(i/3)
+			stops = append(stops, domain.Stop{ID: id, Address: "Stop " + id, Lat: lat, Lng: lng, Duration: 20})
+			repo.meters = append(repo.meters, &domain.ParkingMeter{MeterID: "M" + id, Lat: lat + 0.0001, Lng: lng, RateMF9A6P: 2.00})
+		}
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 5}, NewPricingService())
+
+		// The 40,320 orders of the last eight stops are never built
+		run, err := routing.generateCandidates(&domain.TripRequest{
+			Stops:       stops,
+			StartTime:   time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		}, true)
+		require.NoError(t, err)
+		require.Len(t, run.routes, 1)
+		assert.Len(t, run.routes[0].Stops, 9)
+		assert.False(t, run.truncated)
+		require.Len(t, run.warnings, 1)
+		assert.Contains(t, run.warnings[0], "more than 8 stops")
+	})
+
+	t.Run("Configurable", func(t *testing.T) {
+		repo, mapsService, stops := fourStopFixture()
+		request := &domain.TripRequest{
+			Stops:       stops,
+			StartTime:   time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		}
+
+		run, err := NewRoutingService(repo, mapsService, NewPricingService()).generateCandidates(request, false)
+		require.NoError(t, err)
+		assert.Len(t, run.routes, 6)
+		assert.Empty(t, run.warnings)
+
+		run, err = NewRoutingService(repo, mapsService, NewPricingService(), WithExactPlanningLimit(3)).generateCandidates(request, false)
+		require.NoError(t, err)
+		assert.Len(t, run.routes, 1)
+		assert.NotEmpty(t, run.warnings)
+	})
+}
+
+func TestHeuristicStopOrder(t *testing.T) {
+	stops := []*domain.Stop{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}}
+	// One-way streets make c to d a long way round, though d to c is quick
+	minutes := map[string]int{
+		"ab": 1, "ac": 20, "ad": 20,
+		"ba": 1, "bc": 1, "bd": 2,
+		"ca": 20, "cb": 1, "cd": 10,
+		"da": 20, "db": 2, "dc": 2,
+	}
+	travelTime := func(from, to *domain.Stop) (int, error) {
+		return minutes[from.ID+to.ID], nil
+	}
+	ids := func(order []*domain.Stop) string {
+		var joined string
+		for _, stop := range order {
+			joined += stop.ID
+		}
+		return joined
+	}
+
+	// Nearest first heads for c and is then stuck with the long way to d
+	greedy, err := nearestNeighborOrder(stops, travelTime)
+	require.NoError(t, err)
+	assert.Equal(t, "abcd", ids(greedy))
+	greedyTime, err := pathTravelTime(greedy, travelTime)
+	require.NoError(t, err)
+	assert.Equal(t, 12, greedyTime)
+
+	order, err := heuristicStopOrder(stops, travelTime)
+	require.NoError(t, err)
+	assert.Equal(t, "abdc", ids(order))
+	orderTime, err := pathTravelTime(order, travelTime)
+	require.NoError(t, err)
+	assert.Equal(t, 5, orderTime)
+
+	// No order starting at a does better
+	for _, perm := range (&DefaultRoutingService{}).generateStopPermutations(stops[1:]) {
+		permTime, err := pathTravelTime(append([]*domain.Stop{stops[0]}, perm...), travelTime)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, permTime, orderTime, ids(perm))
+	}
+}
@@ -1,8 +1,13 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
 	"sort"
+	"strings"
 	"time"
 
 	"vancouver-trip-planner/internal/domain"
@@ -10,6 +15,72 @@ import (
 	"vancouver-trip-planner/pkg/maps"
 )
 
+// ErrFixedArrivalInfeasible is returned when no stop order reaches every
+// fixed-arrival stop on time
+var ErrFixedArrivalInfeasible = errors.New("fixed arrival time cannot be met")
+
+// ErrParkingInAvoidZone is returned when a required stop has no parking outside
+// the request's avoid zones
+var ErrParkingInAvoidZone = errors.New("all parking is inside avoid zones")
+
+// ErrOutsideCoverage is returned when a stop geocodes to somewhere the parking
+// data doesn't cover
+var ErrOutsideCoverage = errors.New("location is outside the parking data coverage area")
+
+// ErrDuplicateStopID is returned when two stops, or a stop and the origin,
+// share an ID, since parking options and results are keyed by stop ID
+var ErrDuplicateStopID = errors.New("stop IDs must be unique")
+
+// ErrWalkingLimitExceeded is returned when every candidate walks more in total
+// than the trip's walking cap allows
+var ErrWalkingLimitExceeded = errors.New("every route walks more than the trip's walking limit")
+
+// ErrTravelModeUnsupported is returned when a trip asks for a travel mode the
+// maps provider can't time legs in
+var ErrTravelModeUnsupported = errors.New("travel mode is not supported")
+
+// VancouverCoverage is the area covered by the City of Vancouver's parking meter
+// data, with a little margin, and the default coverage area
+var VancouverCoverage = domain.BoundingBox{MinLat: 49.19, MinLng: -123.27, MaxLat: 49.32, MaxLng: -123.02}
+
+// DefaultParkingSearchRadiusKm is how far from each stop meters are considered
+// unless the request overrides it
+const DefaultParkingSearchRadiusKm = 1.0
+
+// MaxParkingSearchRadiusKm is the largest search radius a request may ask for
+const MaxParkingSearchRadiusKm = 5.0
+
+// DefaultMaxCandidates bounds how many route candidates a plan keeps, whatever
+// the strategy, so memory stays bounded for trips with many stops. It leaves
+// room for every order of a trip of DefaultExactPlanningMaxStops stops.
+const DefaultMaxCandidates = 10000
+
+// DefaultExactPlanningMaxStops is the most stops whose every order the
+// exhaustive strategy tries. The first stop stays put and the orders of the
+// rest grow factorially, 5,040 for eight stops but 40,320 for nine, so larger
+// trips are ordered by the 2-opt heuristic instead.
+const DefaultExactPlanningMaxStops = 8
+
+// DefaultMaxWalkingMinutes is the longest walk from a meter to its stop when
+// the request's preferences don't set one
+const DefaultMaxWalkingMinutes = 15
+
+// Spreading load picks among meters within these tolerances of the best one
+const (
+	SpreadLoadCostTolerance    = 0.25 // dollars of selection score
+	SpreadLoadWalkingTolerance = 2    // minutes
+)
+
+// maxOptionalStops bounds how many optional stops are considered for skipping,
+// since each one doubles the candidates evaluated
+const maxOptionalStops = 4
+
+// maxMeterAlternatives is how many runner-up meters each segment suggests
+const maxMeterAlternatives = 2
+
+// OriginStopID identifies the synthetic stop created for a separate trip origin
+const OriginStopID = "origin"
+
 // RoutingService handles multi-objective trip planning
 type RoutingService interface {
 	PlanTrip(request *domain.TripRequest) ([]*domain.TripPlan, error)
@@ -20,89 +91,1185 @@ type DefaultRoutingService struct {
 	parkingRepo    repository.ParkingRepository
 	mapsService    maps.MapsService
 	pricingService PricingService
+	routeStrategy  RouteStrategy
+
+	clusterDistanceKm    float64
+	clusterRateTolerance float64
+
+	// parkingLeadMinutes starts paid parking this long before the arrival at a stop
+	parkingLeadMinutes int
+
+	// scoreFunc computes the hybrid score candidates are ranked by (lower is better)
+	scoreFunc ScoreFunc
+
+	// reverseGeocoder, when set, fills in display addresses for coordinate-only stops
+	reverseGeocoder maps.ReverseGeocoder
+
+	// roadSnapper, when set, moves coordinate-only stops onto the nearest road
+	roadSnapper maps.RoadSnapper
+
+	// coverage, when set, is where geocoded stops must land for parking to be found
+	coverage *domain.BoundingBox
+
+	// elevation lengthens walks that climb; the default is flat
+	elevation maps.ElevationProvider
+
+	// earth is the model straight-line distances and estimates are computed with
+	earth maps.Earth
+
+	// walkingRouter traces walks for requests that ask for walking routes
+	walkingRouter maps.WalkingRouter
+
+	// rateHistory supplies the past rates behind segments' rate trend notes
+	rateHistory repository.RateHistoryProvider
+
+	// transitFares prices the rides of transit plans
+	transitFares TransitFareModel
+
+	// maxCandidates bounds the route candidates kept per plan; zero means no bound
+	maxCandidates int
+
+	// exactMaxStops is the most stops planned with the exhaustive strategy;
+	// zero means no limit
+	exactMaxStops int
+
+	// loadSeed seeds the meter picks of requests that spread load. Unless set
+	// by WithSpreadLoadSeed, each plan draws a fresh seed.
+	loadSeed   int64
+	loadSeeded bool
+
+	// pruneCandidates abandons partial routes that can't become a plan
+	pruneCandidates bool
+
+	// bound is the running bound of a single planning run, set only on the
+	// request-scoped copy of the service when the run prunes
+	bound *candidateBound
+
+	// searchMinutes is the circling time for a spot in each local area
+	searchMinutes map[string]int
+
+	// memoizeSelections reuses each stop's meter ranking across candidates
+	// that park there in the same window
+	memoizeSelections bool
+
+	// travelBounds, when set, is what driving times are checked against
+	travelBounds *TravelTimeBounds
+
+	// useTravelMatrix looks up the driving times between a plan's stops in one
+	// request; matrix holds them, set only on the request-scoped copy
+	useTravelMatrix bool
+	matrix          *travelMatrix
+
+	// selections holds those rankings for a single planning run, set only on
+	// the request-scoped copy of the service
+	selections map[selectionKey][]RankedMeter
+}
+
+// ScoreFunc scores a route candidate for the hybrid plan from its total cost in
+// dollars, total time and total walking time in minutes, and the request's
+// preferences. The candidate with the lowest score becomes the hybrid plan.
+type ScoreFunc func(cost float64, timeMinutes int, walkingMinutes int, prefs domain.Preferences) float64
+
+// DefaultScoreFunc weighs dollars against hours using the preference weights
+func DefaultScoreFunc(cost float64, timeMinutes int, walkingMinutes int, prefs domain.Preferences) float64 {
+	return prefs.CostWeight*cost + prefs.TimeWeight*float64(timeMinutes)/60.0
+}
+
+// RoutingOption configures a DefaultRoutingService
+type RoutingOption func(*DefaultRoutingService)
+
+// WithRouteStrategy sets the default strategy used to generate candidate routes
+func WithRouteStrategy(strategy RouteStrategy) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.routeStrategy = strategy
+	}
+}
+
+// WithMeterClustering sets how close (in km) and how similarly priced meters must be
+// to collapse into a single parking option. A zero distance disables clustering.
+func WithMeterClustering(distanceKm, rateTolerance float64) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.clusterDistanceKm = distanceKm
+		s.clusterRateTolerance = rateTolerance
+	}
+}
+
+// WithParkingLeadTime starts paying for parking the given number of minutes before
+// the computed arrival, extending the paid duration to match, to reflect time spent
+// finding a spot and paying. The default is zero.
+func WithParkingLeadTime(minutes int) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.parkingLeadMinutes = minutes
+	}
+}
+
+// WithScoreFunc replaces the hybrid score formula, e.g. to penalize walking
+func WithScoreFunc(score ScoreFunc) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.scoreFunc = score
+	}
+}
+
+// reverseGeocodeCacheSize bounds how many stop locations' addresses are remembered
+const reverseGeocodeCacheSize = 1000
+
+// WithReverseGeocoding looks up a display address for stops given only as
+// coordinates. It is off by default since every new location is a paid lookup;
+// results are cached.
+func WithReverseGeocoding(geocoder maps.ReverseGeocoder) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.reverseGeocoder = maps.NewCachedReverseGeocoder(geocoder, reverseGeocodeCacheSize)
+	}
+}
+
+// WithRoadSnapping moves stops given only as coordinates onto the nearest road
+// before planning, so a GPS fix inside a building or over water doesn't skew
+// the parking search and travel times. Each such stop costs a lookup; a failed
+// one leaves the coordinates as given.
+func WithRoadSnapping(snapper maps.RoadSnapper) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.roadSnapper = snapper
+	}
+}
+
+// WithRateHistory notes on each segment how its meter's rate has changed over
+// the last year, as far as provider knows
+func WithRateHistory(provider repository.RateHistoryProvider) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.rateHistory = provider
+	}
+}
+
+// WithCoverageArea sets the area geocoded stops must fall in, matching the
+// parking data in use. Nil turns the check off.
+func WithCoverageArea(area *domain.BoundingBox) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.coverage = area
+	}
+}
+
+// CoverageReporter is implemented by routing services that limit stops to an
+// area, so clients can be told what it is
+type CoverageReporter interface {
+	// CoverageArea returns the area stops must fall in, or nil if any will do
+	CoverageArea() *domain.BoundingBox
+}
+
+// CoverageArea returns the area geocoded stops must fall in, nil if unchecked
+func (s *DefaultRoutingService) CoverageArea() *domain.BoundingBox {
+	return s.coverage
+}
+
+// TravelModeReporter is implemented by routing services that can plan trips
+// in other ways than driving, so clients can be told which
+type TravelModeReporter interface {
+	// TravelModes returns the modes trips can be planned in, driving first
+	TravelModes() []string
+}
+
+// TravelModes returns driving, and bicycling and transit when the maps
+// service can time legs in them
+func (s *DefaultRoutingService) TravelModes() []string {
+	if router, ok := s.mapsService.(maps.ModeRouter); ok {
+		if _, err := router.WithTravelMode(maps.TravelModeTransit); err == nil {
+			return []string{maps.TravelModeDriving, maps.TravelModeBicycling, maps.TravelModeTransit}
+		}
+	}
+	return []string{maps.TravelModeDriving}
+}
+
+// WithElevationProvider makes walking times account for hills, adding time for
+// walks that climb between the meter and the stop
+func WithElevationProvider(elevation maps.ElevationProvider) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.elevation = elevation
+	}
+}
+
+// WithEarth sets the model straight-line distances are measured with, and so
+// walking times and the estimates used in place of maps lookups. It defaults
+// to a sphere of radius maps.EarthRadiusKm.
+func WithEarth(earth maps.Earth) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.earth = earth
+	}
+}
+
+// WithMaxCandidates bounds how many route candidates a plan keeps. Beyond it,
+// candidates spread across the stop orders are kept and plans are flagged as
+// truncated. Zero or less removes the bound.
+func WithMaxCandidates(n int) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.maxCandidates = max(n, 0)
+	}
+}
+
+// WithExactPlanningLimit sets the most stops a trip may have for the
+// exhaustive strategy to try every order of them. Larger trips are ordered by
+// the 2-opt strategy, with a warning. Zero or less removes the limit.
+func WithExactPlanningLimit(maxStops int) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.exactMaxStops = max(maxStops, 0)
+	}
+}
+
+// WithSpreadLoadSeed fixes the seed behind the meter picks of requests that
+// spread load, making them repeatable, e.g. in tests
+func WithSpreadLoadSeed(seed int64) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.loadSeed = seed
+		s.loadSeeded = true
+	}
+}
+
+// WithWalkingRouter traces walks with router when a request includes walking
+// routes. It defaults to the maps service, if that can trace walks.
+func WithWalkingRouter(router maps.WalkingRouter) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.walkingRouter = router
+	}
 }
 
 // NewRoutingService creates a new routing service
-func NewRoutingService(parkingRepo repository.ParkingRepository, mapsService maps.MapsService, pricingService PricingService) *DefaultRoutingService {
-	return &DefaultRoutingService{
+func NewRoutingService(parkingRepo repository.ParkingRepository, mapsService maps.MapsService, pricingService PricingService, opts ...RoutingOption) *DefaultRoutingService {
+	s := &DefaultRoutingService{
 		parkingRepo:    parkingRepo,
 		mapsService:    mapsService,
 		pricingService: pricingService,
+		routeStrategy:  ExhaustiveStrategy{},
+		scoreFunc:      DefaultScoreFunc,
+		coverage:       &VancouverCoverage,
+		elevation:      maps.FlatElevation{},
+		transitFares:   DefaultTransitFare,
+		rateHistory:    repository.NoRateHistory{},
+		maxCandidates:  DefaultMaxCandidates,
+		exactMaxStops:  DefaultExactPlanningMaxStops,
+
+		pruneCandidates:   true,
+		memoizeSelections: true,
+		useTravelMatrix:   true,
+
+		clusterDistanceKm:    DefaultClusterDistanceKm,
+		clusterRateTolerance: DefaultClusterRateTolerance,
+	}
+	if router, ok := mapsService.(maps.WalkingRouter); ok {
+		s.walkingRouter = router
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
+}
+
+// CandidateEvaluator is implemented by routing services that can expose every
+// route candidate they evaluate, for auditing the plan selection
+type CandidateEvaluator interface {
+	EvaluateCandidates(request *domain.TripRequest) ([]*RouteCandidate, error)
+}
+
+// candidateRun is the outcome of generating candidates for one request
+type candidateRun struct {
+	service   *DefaultRoutingService // request-scoped copy used for the run
+	routes    []*RouteCandidate
+	budget    *budgetedMapsService
+	warnings  []string
+	truncated bool // candidates were dropped to stay within maxCandidates
 }
 
 // PlanTrip creates three optimized trip plans: cheapest, fastest, and hybrid
 func (s *DefaultRoutingService) PlanTrip(request *domain.TripRequest) ([]*domain.TripPlan, error) {
 	fmt.Printf("[DEBUG] PlanTrip started with %d stops\n", len(request.Stops))
 
-	if len(request.Stops) < 2 {
-		return nil, fmt.Errorf("at least 2 stops are required")
+	run, err := s.generateCandidates(request, true)
+	if err != nil {
+		return nil, err
+	}
+	s = run.service
+	routes := run.routes
+	budget := run.budget
+
+	// Step 4: Select the best routes for each objective
+	plans := s.selectOptimalPlans(routes, request)
+	fmt.Printf("[DEBUG] Selected %d optimal plans\n", len(plans))
+
+	if len(run.warnings) > 0 {
+		for _, plan := range plans {
+			plan.Metadata["warnings"] = run.warnings
+		}
+	}
+	if run.truncated {
+		for _, plan := range plans {
+			plan.Metadata["candidates_truncated"] = true
+		}
+	}
+
+	// Flag plans whose travel times were partly estimated to stay within budget
+	if budget != nil {
+		for _, plan := range plans {
+			plan.Metadata["map_calls_used"] = budget.CallsUsed()
+			if budget.Limited() {
+				plan.Metadata["budget_limited"] = true
+			}
+		}
+	}
+
+	// Step 5: Attach cost/time ranges when travel times are uncertain
+	if request.TravelTimeVariance > 0 {
+		for _, plan := range plans {
+			if err := s.attachUncertaintyRange(plan, request); err != nil {
+				return nil, fmt.Errorf("failed to estimate cost range: %w", err)
+			}
+		}
+	}
+
+	// Step 6: Trace walks for UIs that draw them
+	if request.IncludeWalkingRoutes {
+		s.attachWalkingRoutes(plans)
+	}
+
+	// Step 7: Tell drivers about meters that recently got dearer or cheaper
+	s.attachRateTrends(plans, request)
+
+	return plans, nil
+}
+
+// RateTrendPeriod is how far back segments' rate trend notes look
+const RateTrendPeriod = 365 * 24 * time.Hour
+
+// attachRateTrends sets the segment metadata "rate_trend", e.g. "rate increased
+// $0.50 in the last year", on segments that park at a meter whose rate changed
+// over RateTrendPeriod. Segments that stay at the previous stop's meter aren't
+// noted again. A failed lookup leaves the segment without a note.
+func (s *DefaultRoutingService) attachRateTrends(plans []*domain.TripPlan, request *domain.TripRequest) {
+	notes := make(map[string]string)
+	for _, plan := range plans {
+		for i := range plan.Route {
+			segment := &plan.Route[i]
+			if segment.ParkingMeter == nil || segment.Metadata["shared_parking"] == true || segment.Metadata["walk_linked"] == true {
+				continue
+			}
+
+			meterID := segment.ParkingMeter.MeterID
+			note, ok := notes[meterID]
+			if !ok {
+				change, known, err := s.rateHistory.RateChange(meterID, RateTrendPeriod)
+				if err != nil {
+					fmt.Printf("[DEBUG] Failed to look up rate history for meter %s: %v\n", meterID, err)
+				} else if known && change != 0 {
+					direction := "increased"
+					if change < 0 {
+						direction = "decreased"
+					}
+					note = fmt.Sprintf("rate %s %s in the last year", direction, FormatCurrency(math.Abs(change), request.Locale))
+				}
+				notes[meterID] = note
+			}
+			if note == "" {
+				continue
+			}
+
+			if segment.Metadata == nil {
+				segment.Metadata = make(map[string]interface{})
+			}
+			segment.Metadata["rate_trend"] = note
+		}
+	}
+}
+
+// attachWalkingRoutes sets each segment's walking polyline, from the meter to
+// the stop, or from the previous stop for a walk-linked visit. Each walk is
+// traced once; when it can't be, a straight line is used and the segment's
+// metadata "walking_route" is "straight_line".
+func (s *DefaultRoutingService) attachWalkingRoutes(plans []*domain.TripPlan) {
+	type tracedWalk struct {
+		polyline string
+		straight bool
+	}
+	traced := make(map[string]tracedWalk)
+
+	for _, plan := range plans {
+		for i := range plan.Route {
+			segment := &plan.Route[i]
+			from, to := walkEndpoints(segment)
+			if from == nil {
+				continue
+			}
+
+			key := travelKey(from, to)
+			walk, ok := traced[key]
+			if !ok {
+				walk.straight = true
+				if s.walkingRouter != nil {
+					polyline, _, err := s.walkingRouter.GetWalkingRoute(from, to)
+					if err != nil {
+						fmt.Printf("[DEBUG] Failed to trace walk, using a straight line: %v\n", err)
+					} else {
+						walk = tracedWalk{polyline: polyline}
+					}
+				}
+				if walk.straight {
+					walk.polyline = maps.StraightLinePolyline(from, to)
+				}
+				traced[key] = walk
+			}
+
+			segment.WalkingPolyline = walk.polyline
+			if walk.straight {
+				if segment.Metadata == nil {
+					segment.Metadata = make(map[string]interface{})
+				}
+				segment.Metadata["walking_route"] = "straight_line"
+			}
+		}
+	}
+}
+
+// walkEndpoints returns where a segment's walk starts and ends, or nils when
+// there is no walk, e.g. when staying parked for a stop at the same spot
+func walkEndpoints(segment *domain.RouteSegment) (*domain.Location, *domain.Location) {
+	if segment.ToStop == nil || segment.ParkingMeter == nil {
+		return nil, nil
+	}
+	if shared, _ := segment.Metadata["shared_parking"].(bool); shared {
+		return nil, nil
+	}
+
+	to := &domain.Location{Lat: segment.ToStop.Lat, Lng: segment.ToStop.Lng}
+	if walkLinked, _ := segment.Metadata["walk_linked"].(bool); walkLinked && segment.FromStop != nil {
+		return &domain.Location{Lat: segment.FromStop.Lat, Lng: segment.FromStop.Lng}, to
+	}
+	return &domain.Location{Lat: segment.ParkingMeter.Lat, Lng: segment.ParkingMeter.Lng}, to
+}
+
+// PlanTripTopN returns up to n plans for the request's best distinct stop
+// orderings by hybrid score, best first, for a user to choose between. Each plan
+// has type "ranked" and its 1-based position in metadata "rank".
+func (s *DefaultRoutingService) PlanTripTopN(request *domain.TripRequest, n int) ([]*domain.TripPlan, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("n must be positive, got %d", n)
+	}
+
+	run, err := s.generateCandidates(request, false)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := append([]*RouteCandidate{}, run.routes...)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].HybridScore < routes[j].HybridScore
+	})
+
+	var plans []*domain.TripPlan
+	seen := make(map[string]bool)
+	for _, route := range routes {
+		if len(plans) == n {
+			break
+		}
+
+		// Keep only the best-scoring candidate for each ordering
+		key := stopOrderKey(route.Stops)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		plan := &domain.TripPlan{
+			Type:      "ranked",
+			TotalCost: route.TotalCost,
+			TotalTime: route.TotalTime,
+			Route:     route.Segments,
+			Metadata: map[string]interface{}{
+				"rank":         len(plans) + 1,
+				"hybrid_score": route.HybridScore,
+			},
+		}
+		if len(route.DroppedStops) > 0 {
+			plan.Metadata["dropped_stops"] = route.DroppedStops
+		}
+		if len(run.warnings) > 0 {
+			plan.Metadata["warnings"] = run.warnings
+		}
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// stopOrderKey identifies the order a candidate visits its stops in
+func stopOrderKey(stops []*domain.Stop) string {
+	ids := make([]string, len(stops))
+	for i, stop := range stops {
+		ids[i] = stop.ID
+	}
+	return strings.Join(ids, "\x00")
+}
+
+// EvaluateCandidates returns every route candidate that plan selection would
+// choose from for the request
+func (s *DefaultRoutingService) EvaluateCandidates(request *domain.TripRequest) ([]*RouteCandidate, error) {
+	run, err := s.generateCandidates(request, false)
+	if err != nil {
+		return nil, err
+	}
+	return run.routes, nil
+}
+
+// generateCandidates geocodes the stops, finds their parking options and
+// generates the route candidates that plans are selected from. With prune set,
+// candidates that can't become the cheapest, fastest or hybrid plan may be
+// left out, so callers that need every candidate must not set it.
+func (s *DefaultRoutingService) generateCandidates(request *domain.TripRequest, prune bool) (*candidateRun, error) {
+	if len(request.Stops) < 2 {
+		return nil, fmt.Errorf("at least 2 stops are required")
+	}
+
+	// Work on a request-scoped copy of the service so concurrent plans don't
+	// share state: parking costs are memoized for this plan only, and upstream
+	// maps calls are counted against the request's budget, if any
+	scoped := *s
+	pricing, err := zonedPricingService(s.pricingService, request.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	scoped.pricingService = newMemoPricingService(pricing)
+	var warnings []string
+	if len(request.Avoid) > 0 {
+		shaped, supported, err := s.avoidingMapsService(request.Avoid)
+		if err != nil {
+			return nil, err
+		}
+		if !supported {
+			warnings = append(warnings, "the maps provider can't avoid route features; travel times ignore avoid")
+		}
+		scoped.mapsService = shaped
+	}
+	if !drives(request) {
+		shaped, err := modeMapsService(scoped.mapsService, request.TravelMode)
+		if err != nil {
+			return nil, err
+		}
+		scoped.mapsService = shaped
+	}
+	if request.SpreadLoad && !s.loadSeeded {
+		scoped.loadSeed = time.Now().UnixNano()
+	}
+	var plausible *plausibleMapsService
+	if s.travelBounds != nil {
+		plausible = newPlausibleMapsService(scoped.mapsService, *s.travelBounds, s.earth)
+		scoped.mapsService = plausible
+	}
+	var budget *budgetedMapsService
+	if request.MaxMapCalls > 0 {
+		budget = newBudgetedMapsService(scoped.mapsService, request.MaxMapCalls, s.earth)
+		scoped.mapsService = budget
+	}
+	scoped.selections = nil
+	if s.memoizeSelections {
+		scoped.selections = make(map[selectionKey][]RankedMeter)
+	}
+	// Filtering detours or walking afterwards could drop the candidates the
+	// bound was tightened by, so only prune when every candidate built is kept.
+	// The most reliable route may be neither cheap nor fast, so stops with time
+	// windows turn pruning off too.
+	scoped.bound = nil
+	if prune && s.pruneCandidates && request.MaxDetourRatio == 0 && request.Preferences.MaxTotalWalkingMinutes == 0 && !hasTimeWindows(request.Stops) {
+		scoped.bound = &candidateBound{}
+	}
+	s = &scoped
+
+	strategy := s.routeStrategy
+	if request.Strategy != "" {
+		var err error
+		strategy, err = RouteStrategyByName(request.Strategy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if strategy.Name() == StrategyExhaustive && s.exactMaxStops > 0 && len(request.Stops) > s.exactMaxStops {
+		fmt.Printf("[DEBUG] %d stops is too many to try every order; using the %s strategy\n", len(request.Stops), StrategyTwoOpt)
+		warnings = append(warnings, fmt.Sprintf("with more than %d stops not every order is tried; stops are visited nearest first, improved by 2-opt", s.exactMaxStops))
+		strategy = TwoOptStrategy{}
+	}
+
+	// Step 1: Geocode all stops if needed
+	stops := make([]*domain.Stop, len(request.Stops))
+	for i, stop := range request.Stops {
+		fmt.Printf("[DEBUG] Processing stop %d: %s\n", i, stop.Address)
+		stops[i] = &domain.Stop{
+			ID:       stop.ID,
+			Address:  stop.Address,
+			Duration: stop.Duration,
+			Lat:      stop.Lat,
+			Lng:      stop.Lng,
+
+			FixedArrival:    stop.FixedArrival,
+			LatestDeparture: stop.LatestDeparture,
+			Optional:        stop.Optional,
+			FreeParking:     stop.FreeParking,
+			Note:            stop.Note,
+			Tags:            stop.Tags,
+		}
+
+		// Handlers validate durations, but the service is also called directly
+		if stops[i].Duration < 0 {
+			return nil, fmt.Errorf("%w: stop %s has %d minutes", ErrNegativeDuration, stopLabel(stops[i]), stops[i].Duration)
+		}
+		if stops[i].Duration > MaxStayMinutes {
+			warnings = append(warnings, fmt.Sprintf("the %d-minute visit to %s was shortened to %d minutes", stops[i].Duration, stopLabel(stops[i]), MaxStayMinutes))
+			stops[i].Duration = MaxStayMinutes
+		}
+
+		// Snap raw coordinates to the nearest road, keeping them if that fails
+		if s.roadSnapper != nil && stops[i].Address == "" && (stops[i].Lat != 0 || stops[i].Lng != 0) {
+			raw := &domain.Location{Lat: stops[i].Lat, Lng: stops[i].Lng}
+			if snapped, err := s.roadSnapper.SnapToRoad(raw); err != nil {
+				fmt.Printf("[DEBUG] Snapping to road failed, keeping %.6f, %.6f: %v\n", raw.Lat, raw.Lng, err)
+			} else {
+				fmt.Printf("[DEBUG] Snapped %.6f, %.6f to road at %.6f, %.6f\n", raw.Lat, raw.Lng, snapped.Lat, snapped.Lng)
+				stops[i].Lat = snapped.Lat
+				stops[i].Lng = snapped.Lng
+			}
+		}
+
+		// Geocode if coordinates are missing
+		if stops[i].Lat == 0 && stops[i].Lng == 0 {
+			fmt.Printf("[DEBUG] Geocoding address: %s\n", stop.Address)
+			location, err := s.mapsService.GeocodeAddress(stop.Address)
+			if err != nil {
+				fmt.Printf("[DEBUG] Geocoding failed: %v\n", err)
+				return nil, fmt.Errorf("failed to geocode address %s: %w", stop.Address, err)
+			}
+			fmt.Printf("[DEBUG] Geocoded to: %.6f, %.6f\n", location.Lat, location.Lng)
+			if err := s.checkCoverage(stop.Address, location); err != nil {
+				return nil, err
+			}
+			stops[i].Lat = location.Lat
+			stops[i].Lng = location.Lng
+		}
+
+		// Give coordinate-only stops an address to display; planning doesn't need one
+		if stops[i].Address == "" && s.reverseGeocoder != nil {
+			address, err := s.reverseGeocoder.ReverseGeocode(&domain.Location{Lat: stops[i].Lat, Lng: stops[i].Lng})
+			if err != nil {
+				fmt.Printf("[DEBUG] Reverse geocoding failed: %v\n", err)
+			} else {
+				stops[i].Address = address
+			}
+		}
+	}
+
+	// Start from the separate origin, if any, so every stop can be reordered
+	if request.Origin != nil {
+		origin, err := s.resolveOrigin(request.Origin)
+		if err != nil {
+			return nil, err
+		}
+		stops = append([]*domain.Stop{origin}, stops...)
+	}
+
+	seen := make(map[string]bool, len(stops))
+	for _, stop := range stops {
+		if seen[stop.ID] {
+			return nil, fmt.Errorf("%w: %q is used more than once", ErrDuplicateStopID, stop.ID)
+		}
+		seen[stop.ID] = true
+	}
+
+	// Step 2: Find parking options for each stop
+	searchRadiusKm := DefaultParkingSearchRadiusKm
+	if request.ParkingSearchRadiusKm > 0 {
+		searchRadiusKm = math.Min(request.ParkingSearchRadiusKm, MaxParkingSearchRadiusKm)
+	}
+	stopParkingOptions := make(map[string][]*domain.ParkingMeter)
+	var avoidedStops []*domain.Stop
+	for _, stop := range stops {
+		if stop.IsOrigin || stop.FreeParking || !drives(request) {
+			continue
+		}
+
+		fmt.Printf("[DEBUG] Finding parking meters for stop: %s (%.6f, %.6f)\n", stop.Address, stop.Lat, stop.Lng)
+		meters, err := s.parkingRepo.GetParkingMetersNear(stop.Lat, stop.Lng, searchRadiusKm)
+		if err != nil {
+			fmt.Printf("[DEBUG] Error getting parking meters: %v\n", err)
+			return nil, fmt.Errorf("failed to get parking meters for stop %s: %w", stop.Address, err)
+		}
+		fmt.Printf("[DEBUG] Found %d parking meters for stop: %s\n", len(meters), stop.Address)
+
+		// Leave out meters in areas the driver wants to avoid
+		if len(request.AvoidZones) > 0 {
+			allowed := metersOutsideZones(meters, request.AvoidZones, s.earth)
+			if len(meters) > 0 && len(allowed) == 0 {
+				warnings = append(warnings, fmt.Sprintf("all parking near %s is inside an avoid zone", stopLabel(stop)))
+				avoidedStops = append(avoidedStops, stop)
+			}
+			meters = allowed
+		}
+
+		// Collapse near-identical meters so they don't crowd out distinct options,
+		// then order by distance. Both steps work from meter ID order so identical
+		// inputs yield the same candidates whatever order the repository returns
+		meters = clusterMeters(sortMetersByID(meters), s.clusterDistanceKm, s.clusterRateTolerance)
+		meters = sortMetersByDistance(stop, meters, s.earth)
+
+		// Limit to top 10 closest meters to avoid excessive combinations
+		if len(meters) > 10 {
+			meters = meters[:10]
+			fmt.Printf("[DEBUG] Limited to top 10 meters for stop: %s\n", stop.Address)
+		}
+
+		stopParkingOptions[stop.ID] = meters
+	}
+
+	// Step 3: Generate and evaluate route combinations, with the driving
+	// times between stops looked up together rather than one leg at a time.
+	// Transit times follow the timetable, so each transit leg is looked up at
+	// its own departure instead.
+	s.matrix = nil
+	if s.useTravelMatrix && request.TravelMode != maps.TravelModeTransit {
+		s.matrix = s.newTravelMatrix(stops, request.StartTime)
+	}
+	fmt.Printf("[DEBUG] Generating routes with %s strategy...\n", strategy.Name())
+	routeCtx := s.newRouteContext(stops, stopParkingOptions, request)
+	routes := strategy.GenerateRoutes(routeCtx)
+	// Also consider skipping each combination of optional stops
+	optionalRoutes, optionalTruncated := s.routesWithoutOptionalStops(strategy, stops, stopParkingOptions, request)
+	routes = append(routes, optionalRoutes...)
+	truncated := routeCtx.Truncated || optionalTruncated
+	if s.maxCandidates > 0 && len(routes) > s.maxCandidates {
+		routes = spreadSample(routes, s.maxCandidates)
+		truncated = true
+	}
+	fmt.Printf("[DEBUG] Generated %d route candidates\n", len(routes))
+	if s.bound != nil && s.bound.pruned > 0 {
+		fmt.Printf("[DEBUG] Abandoned %d partial routes that couldn't become a plan\n", s.bound.pruned)
+	}
+
+	// Explain an empty result when avoid zones or appointments are what made
+	// every order infeasible
+	if len(routes) == 0 {
+		for _, stop := range avoidedStops {
+			if !stop.Optional {
+				return nil, fmt.Errorf("%w: no parking near %s outside the avoid zones", ErrParkingInAvoidZone, stopLabel(stop))
+			}
+		}
+		for _, stop := range stops {
+			if !stop.FixedArrival.IsZero() {
+				return nil, fmt.Errorf("%w: no stop order reaches %s by %s",
+					ErrFixedArrivalInfeasible, stop.Address, stop.FixedArrival.Format(time.RFC3339))
+			}
+		}
+	}
+
+	// Drop candidates that walk too much across the whole trip
+	if limit := request.Preferences.MaxTotalWalkingMinutes; limit > 0 && len(routes) > 0 {
+		var err error
+		routes, err = filterTotalWalking(routes, limit)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("[DEBUG] %d route candidates within %d minutes of walking\n", len(routes), limit)
+	}
+
+	// Drop candidates that wander too far from the most direct ordering
+	if request.MaxDetourRatio > 0 {
+		var err error
+		routes, err = s.filterDetours(routeCtx, routes, request.MaxDetourRatio)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute direct route baseline: %w", err)
+		}
+		fmt.Printf("[DEBUG] %d route candidates within detour ratio %.2f\n", len(routes), request.MaxDetourRatio)
+	}
+
+	if plausible != nil {
+		warnings = append(warnings, plausible.Warnings()...)
+	}
+
+	return &candidateRun{service: s, routes: routes, budget: budget, warnings: warnings, truncated: truncated}, nil
+}
+
+// metersOutsideZones returns the meters that fall outside every zone
+func metersOutsideZones(meters []*domain.ParkingMeter, zones []domain.Circle, earth maps.Earth) []*domain.ParkingMeter {
+	var allowed []*domain.ParkingMeter
+	for _, meter := range meters {
+		inside := false
+		for _, zone := range zones {
+			distance := earth.Distance(
+				&domain.Location{Lat: zone.Lat, Lng: zone.Lng},
+				&domain.Location{Lat: meter.Lat, Lng: meter.Lng},
+			)
+			if distance <= zone.RadiusKm {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			allowed = append(allowed, meter)
+		}
+	}
+	return allowed
+}
+
+// stopLabel names a stop in messages by its address, or its ID when it has none
+func stopLabel(stop *domain.Stop) string {
+	if stop.Address != "" {
+		return stop.Address
+	}
+	return stop.ID
+}
+
+// avoidingMapsService returns the maps service to time driving legs with when
+// they should avoid the given features. Providers that can't shape routes are
+// returned unchanged, reporting false.
+func (s *DefaultRoutingService) avoidingMapsService(avoid []string) (maps.MapsService, bool, error) {
+	if err := maps.ValidateAvoid(avoid); err != nil {
+		return nil, false, err
+	}
+
+	shaper, ok := s.mapsService.(maps.RouteShaper)
+	if !ok {
+		fmt.Printf("[DEBUG] Maps service can't avoid %v; ignoring\n", avoid)
+		return s.mapsService, false, nil
+	}
+
+	shaped, err := shaper.WithAvoid(avoid)
+	if errors.Is(err, maps.ErrUnsupported) {
+		fmt.Printf("[DEBUG] Maps service can't avoid %v; ignoring\n", avoid)
+		return s.mapsService, false, nil
+	}
+	return shaped, err == nil, err
+}
+
+// drives reports whether the trip is made by car, and so parks at its stops
+func drives(request *domain.TripRequest) bool {
+	return request.TravelMode == "" || request.TravelMode == maps.TravelModeDriving
+}
+
+// ridesTransit reports whether the leg from one stop to the next is a transit
+// ride, paying a fare. There is no ride to the first stop or between stops at
+// the same spot.
+func ridesTransit(request *domain.TripRequest, from, to *domain.Stop) bool {
+	return request.TravelMode == maps.TravelModeTransit && from != nil && !coincidentStops(from, to)
+}
+
+// modeMapsService returns a maps service timing legs in the given travel mode
+func modeMapsService(base maps.MapsService, mode string) (maps.MapsService, error) {
+	if err := maps.ValidateTravelMode(mode); err != nil {
+		return nil, err
+	}
+	router, ok := base.(maps.ModeRouter)
+	if !ok {
+		return nil, fmt.Errorf("%w: the maps provider can only time driving", ErrTravelModeUnsupported)
+	}
+	moded, err := router.WithTravelMode(mode)
+	if errors.Is(err, maps.ErrUnsupported) {
+		return nil, fmt.Errorf("%w: %v", ErrTravelModeUnsupported, err)
+	}
+	return moded, err
+}
+
+// zonedPricingService returns a pricing service reading meter hours in the
+// request's timezone. Services that can't change timezone are used as they are.
+func zonedPricingService(base PricingService, timezone string) (PricingService, error) {
+	if timezone == "" {
+		return base, nil
+	}
+	pricer, ok := base.(TimezonePricer)
+	if !ok {
+		fmt.Printf("[DEBUG] Pricing service can't use timezone %s; ignoring\n", timezone)
+		return base, nil
+	}
+	return pricer.InTimezone(timezone)
+}
+
+// resolveOrigin converts the request origin into a non-dwelling starting stop,
+// geocoding its address when no coordinates were supplied
+func (s *DefaultRoutingService) resolveOrigin(origin *domain.Origin) (*domain.Stop, error) {
+	stop := &domain.Stop{
+		ID:       OriginStopID,
+		Address:  origin.Address,
+		Lat:      origin.Lat,
+		Lng:      origin.Lng,
+		IsOrigin: true,
+	}
+
+	if stop.Lat == 0 && stop.Lng == 0 {
+		if origin.Address == "" {
+			return nil, fmt.Errorf("origin requires an address or coordinates")
+		}
+		location, err := s.mapsService.GeocodeAddress(origin.Address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to geocode origin %s: %w", origin.Address, err)
+		}
+		if err := s.checkCoverage(origin.Address, location); err != nil {
+			return nil, err
+		}
+		stop.Lat = location.Lat
+		stop.Lng = location.Lng
+	}
+
+	return stop, nil
+}
+
+// checkCoverage fails with ErrOutsideCoverage when a geocoded address resolved
+// outside the coverage area, where no parking would be found
+func (s *DefaultRoutingService) checkCoverage(address string, location *domain.Location) error {
+	if s.coverage == nil || s.coverage.Contains(location.Lat, location.Lng) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s resolved to (%.6f, %.6f)", ErrOutsideCoverage, address, location.Lat, location.Lng)
+}
+
+// walkingTime estimates a walk between two points, allowing for the climb when
+// elevations are available and falling back to the flat estimate when not
+func (s *DefaultRoutingService) walkingTime(from, to *domain.Location) int {
+	minutes, err := s.earth.WalkingTimeWithElevation(from, to, s.elevation)
+	if err != nil {
+		fmt.Printf("[DEBUG] Elevation lookup failed, assuming flat walk: %v\n", err)
+	}
+	return minutes
+}
+
+// coincidentStopKm is how close two stops must be to be treated as the same spot
+const coincidentStopKm = 0.005
+
+// parkingSession is a single park that later stops at the same spot can extend
+type parkingSession struct {
+	meter *domain.ParkingMeter
+	stop  *domain.Stop // last stop visited on this park
+	start time.Time
+	cost  float64 // total paid so far
+}
+
+// continueSession prices extending an earlier session at the same meter through
+// a later visit ending at end. It returns the extra cost, and whether that beats
+// paying separateCost for a new session plus the request's re-entry penalty. A
+// session can't be stretched past the meter's time limit.
+func (s *DefaultRoutingService) continueSession(session *parkingSession, end time.Time, separateCost float64, request *domain.TripRequest) (float64, bool, error) {
+	strict := *request
+	strict.AllowOverstay = false
+
+	minutes := int(math.Ceil(end.Sub(session.start).Minutes()))
+	ranked, err := s.pricingService.RankParkingMeters([]*domain.ParkingMeter{session.meter}, session.start, minutes, s.selectionOptions(&strict)...)
+	if err != nil || len(ranked) == 0 {
+		return 0, false, err
+	}
+
+	extra := ranked[0].Cost - session.cost
+	return extra, extra < separateCost+request.ReentryPenalty, nil
+}
+
+// maxWalkLinkKm is how far apart consecutive stops may be for the planner to
+// consider walking between them instead of moving the car
+const maxWalkLinkKm = 0.5
+
+// walkLinkOption is a visit reached on foot from the previous stop, with the
+// car left at the previous stop's meter
+type walkLinkOption struct {
+	arrival     time.Time
+	backAtCar   time.Time
+	walkingTime int     // there from the previous stop and back to the car afterwards
+	cost        float64 // extra paid to keep the car's session running
+}
+
+// walkLink prices walking to stop from the previous stop, where the car is
+// parked in session, and back to the car after the visit. It returns nil when
+// the stops are too far apart, the car isn't parked for the previous stop, the
+// stop has a fixed arrival or latest departure, or the meter's time limit
+// can't cover the longer session.
+func (s *DefaultRoutingService) walkLink(session *parkingSession, fromStop, stop *domain.Stop, departure time.Time, dwell int, request *domain.TripRequest) *walkLinkOption {
+	if session == nil || fromStop == nil || session.stop != fromStop {
+		return nil
+	}
+	if !stop.FixedArrival.IsZero() || !stop.LatestDeparture.IsZero() {
+		return nil
+	}
+	fromLocation := &domain.Location{Lat: fromStop.Lat, Lng: fromStop.Lng}
+	stopLocation := &domain.Location{Lat: stop.Lat, Lng: stop.Lng}
+	if s.earth.Distance(fromLocation, stopLocation) > maxWalkLinkKm {
+		return nil
+	}
+
+	there := s.walkingTime(fromLocation, stopLocation)
+	back := s.walkingTime(stopLocation, &domain.Location{Lat: session.meter.Lat, Lng: session.meter.Lng})
+	arrival := departure.Add(time.Duration(there) * time.Minute)
+	backAtCar := arrival.Add(time.Duration(dwell+back) * time.Minute)
+
+	minutes := max(int(math.Ceil(backAtCar.Sub(session.start).Minutes())), request.MinParkingMinutes)
+	ranked, err := s.pricingService.RankParkingMeters([]*domain.ParkingMeter{session.meter}, session.start, minutes, s.selectionOptions(request)...)
+	if err != nil {
+		fmt.Printf("[DEBUG] Failed to price a walk-linked visit: %v\n", err)
+		return nil
+	}
+	if len(ranked) == 0 {
+		return nil
+	}
+
+	return &walkLinkOption{
+		arrival:     arrival,
+		backAtCar:   backAtCar,
+		walkingTime: there + back,
+		cost:        ranked[0].Cost - session.cost,
+	}
+}
+
+// markShortenedVisit records on a segment's metadata that the stop's latest
+// departure cut its visit short, creating the metadata if needed
+func markShortenedVisit(metadata map[string]interface{}, requested, dwell int, missed bool) map[string]interface{} {
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata["requested_duration_minutes"] = requested
+	metadata["dwell_minutes"] = dwell
+	if missed {
+		metadata["departure_deadline_missed"] = true
+	}
+	return metadata
+}
+
+// coincidentStops reports whether two stops are at effectively the same location
+func coincidentStops(a, b *domain.Stop) bool {
+	return maps.CalculateDistance(
+		&domain.Location{Lat: a.Lat, Lng: a.Lng},
+		&domain.Location{Lat: b.Lat, Lng: b.Lng},
+	) <= coincidentStopKm
+}
+
+// parkingWindow returns when paid parking starts and how long it runs for a visit
+// arriving at arrivalTime, accounting for the parking lead time and buying at
+// least minimumMinutes
+func (s *DefaultRoutingService) parkingWindow(arrivalTime time.Time, durationMinutes, minimumMinutes int) (time.Time, int) {
+	lead := s.parkingLeadMinutes
+	return arrivalTime.Add(-time.Duration(lead) * time.Minute), max(durationMinutes+lead, minimumMinutes)
+}
+
+// sortMetersByID returns a copy of meters ordered by meter ID
+func sortMetersByID(meters []*domain.ParkingMeter) []*domain.ParkingMeter {
+	sorted := append([]*domain.ParkingMeter{}, meters...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].MeterID < sorted[j].MeterID
+	})
+	return sorted
+}
+
+// sortMetersByDistance returns a copy of meters ordered by distance from the
+// stop, breaking ties by meter ID
+func sortMetersByDistance(stop *domain.Stop, meters []*domain.ParkingMeter, earth maps.Earth) []*domain.ParkingMeter {
+	stopLocation := &domain.Location{Lat: stop.Lat, Lng: stop.Lng}
+	distance := make(map[*domain.ParkingMeter]float64, len(meters))
+	for _, meter := range meters {
+		distance[meter] = earth.Distance(stopLocation, &domain.Location{Lat: meter.Lat, Lng: meter.Lng})
+	}
+
+	sorted := append([]*domain.ParkingMeter{}, meters...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if distance[sorted[i]] != distance[sorted[j]] {
+			return distance[sorted[i]] < distance[sorted[j]]
+		}
+		return sorted[i].MeterID < sorted[j].MeterID
+	})
+	return sorted
+}
+
+// meterAlternatives describes up to maxMeterAlternatives runner-up meters for a stop
+func (s *DefaultRoutingService) meterAlternatives(ranked []RankedMeter, stop *domain.Stop) []domain.MeterAlternative {
+	if len(ranked) > maxMeterAlternatives {
+		ranked = ranked[:maxMeterAlternatives]
+	}
+
+	alternatives := make([]domain.MeterAlternative, len(ranked))
+	for i, option := range ranked {
+		alternatives[i] = domain.MeterAlternative{
+			MeterID:     option.Meter.MeterID,
+			Lat:         option.Meter.Lat,
+			Lng:         option.Meter.Lng,
+			ParkingCost: option.Cost,
+			WalkingTime: s.walkingTime(
+				&domain.Location{Lat: option.Meter.Lat, Lng: option.Meter.Lng},
+				&domain.Location{Lat: stop.Lat, Lng: stop.Lng},
+			),
+		}
+	}
+	return alternatives
+}
+
+// spreadLoad moves a meter picked at random from those nearly as good as the
+// best, by score and walk, to the front of the ranking, so drivers sent to the
+// same stop don't all head for one meter. Picks depend only on the seed and the
+// stop, so every candidate route parks at the same meter for a stop.
+func (s *DefaultRoutingService) spreadLoad(ranked []RankedMeter, stop *domain.Stop) []RankedMeter {
+	if len(ranked) < 2 {
+		return ranked
 	}
 
-	// Step 1: Geocode all stops if needed
-	stops := make([]*domain.Stop, len(request.Stops))
-	for i, stop := range request.Stops {
-		fmt.Printf("[DEBUG] Processing stop %d: %s\n", i, stop.Address)
-		stops[i] = &domain.Stop{
-			ID:       stop.ID,
-			Address:  stop.Address,
-			Duration: stop.Duration,
-			Lat:      stop.Lat,
-			Lng:      stop.Lng,
-		}
+	stopLocation := &domain.Location{Lat: stop.Lat, Lng: stop.Lng}
+	walkTo := func(meter *domain.ParkingMeter) int {
+		return s.walkingTime(&domain.Location{Lat: meter.Lat, Lng: meter.Lng}, stopLocation)
+	}
+	bestWalk := walkTo(ranked[0].Meter)
 
-		// Geocode if coordinates are missing
-		if stops[i].Lat == 0 && stops[i].Lng == 0 {
-			fmt.Printf("[DEBUG] Geocoding address: %s\n", stop.Address)
-			location, err := s.mapsService.GeocodeAddress(stop.Address)
-			if err != nil {
-				fmt.Printf("[DEBUG] Geocoding failed: %v\n", err)
-				return nil, fmt.Errorf("failed to geocode address %s: %w", stop.Address, err)
-			}
-			stops[i].Lat = location.Lat
-			stops[i].Lng = location.Lng
-			fmt.Printf("[DEBUG] Geocoded to: %.6f, %.6f\n", location.Lat, location.Lng)
+	var equivalent []int
+	for i, option := range ranked {
+		if option.Score > ranked[0].Score+SpreadLoadCostTolerance {
+			break
+		}
+		if walkTo(option.Meter) <= bestWalk+SpreadLoadWalkingTolerance {
+			equivalent = append(equivalent, i)
 		}
 	}
+	if len(equivalent) < 2 {
+		return ranked
+	}
 
-	// Step 2: Find parking options for each stop
-	stopParkingOptions := make(map[string][]*domain.ParkingMeter)
-	for _, stop := range stops {
-		fmt.Printf("[DEBUG] Finding parking meters for stop: %s (%.6f, %.6f)\n", stop.Address, stop.Lat, stop.Lng)
-		meters, err := s.parkingRepo.GetParkingMetersNear(stop.Lat, stop.Lng, 1.0) // 1km radius
-		if err != nil {
-			fmt.Printf("[DEBUG] Error getting parking meters: %v\n", err)
-			return nil, fmt.Errorf("failed to get parking meters for stop %s: %w", stop.Address, err)
-		}
-		fmt.Printf("[DEBUG] Found %d parking meters for stop: %s\n", len(meters), stop.Address)
+	hash := fnv.New64a()
+	hash.Write([]byte(stop.ID))
+	rng := rand.New(rand.NewSource(s.loadSeed ^ int64(hash.Sum64())))
+	picked := equivalent[rng.Intn(len(equivalent))]
 
-		// Limit to top 10 closest meters to avoid excessive combinations
-		if len(meters) > 10 {
-			// Sort by distance and take closest 10
-			sort.Slice(meters, func(i, j int) bool {
-				distI := maps.CalculateWalkingTime(&domain.Location{Lat: stop.Lat, Lng: stop.Lng},
-					&domain.Location{Lat: meters[i].Lat, Lng: meters[i].Lng})
-				distJ := maps.CalculateWalkingTime(&domain.Location{Lat: stop.Lat, Lng: stop.Lng},
-					&domain.Location{Lat: meters[j].Lat, Lng: meters[j].Lng})
-				return distI < distJ
-			})
-			meters = meters[:10]
-			fmt.Printf("[DEBUG] Limited to top 10 meters for stop: %s\n", stop.Address)
+	reordered := make([]RankedMeter, 0, len(ranked))
+	reordered = append(reordered, ranked[picked])
+	reordered = append(reordered, ranked[:picked]...)
+	return append(reordered, ranked[picked+1:]...)
+}
+
+// maxWalkingMinutes returns the longest walk from a meter the preferences allow
+func maxWalkingMinutes(prefs domain.Preferences) int {
+	if prefs.MaxWalkingMinutes > 0 {
+		return prefs.MaxWalkingMinutes
+	}
+	return DefaultMaxWalkingMinutes
+}
+
+// selectionOptions translates request preferences into meter selection options
+func (s *DefaultRoutingService) selectionOptions(request *domain.TripRequest) []SelectionOption {
+	var opts []SelectionOption
+
+	if request.AllowOverstay {
+		penalty := request.OverstayPenalty
+		if penalty == 0 {
+			penalty = DefaultOverstayPenalty
 		}
+		opts = append(opts, WithOverstayPenalty(penalty))
+	}
 
-		stopParkingOptions[stop.ID] = meters
+	if request.CardMeterBonus > 0 {
+		opts = append(opts, WithCardMeterBonus(request.CardMeterBonus))
 	}
 
-	// Step 3: Generate and evaluate route combinations
-	fmt.Printf("[DEBUG] Generating routes...\n")
-	routes := s.generateRoutes(stops, stopParkingOptions, request)
-	fmt.Printf("[DEBUG] Generated %d route candidates\n", len(routes))
+	if request.PreferCovered {
+		bonus := request.CoveredBonus
+		if bonus == 0 {
+			bonus = DefaultCoveredBonus
+		}
+		opts = append(opts, WithCoveredBonus(bonus))
+	}
 
-	// Step 4: Select the best routes for each objective
-	plans := s.selectOptimalPlans(routes)
-	fmt.Printf("[DEBUG] Selected %d optimal plans\n", len(plans))
+	if request.MaxPerStopCost > 0 {
+		opts = append(opts, WithMaxCost(request.MaxPerStopCost))
+	}
 
-	return plans, nil
+	return opts
 }
 
 // RouteCandidate represents a possible route through all stops
@@ -112,29 +1279,28 @@ type RouteCandidate struct {
 	TotalCost   float64
 	TotalTime   int
 	HybridScore float64
-}
-
-// generateRoutes creates route candidates using different parking options
-func (s *DefaultRoutingService) generateRoutes(stops []*domain.Stop, parkingOptions map[string][]*domain.ParkingMeter, request *domain.TripRequest) []*RouteCandidate {
-	var routes []*RouteCandidate
 
-	// For simplicity, we'll use a greedy approach to generate candidate routes
-	// In a production system, you might want to use more sophisticated algorithms like genetic algorithms
+	// DroppedStops lists the IDs of optional stops this candidate skips
+	DroppedStops []string
 
-	// Generate permutations of stops (for small numbers of stops)
-	stopPermutations := s.generateStopPermutations(stops[1:]) // Exclude first stop as starting point
+	// FinishTime is when the last visit ends, counting any waits for fixed
+	// arrivals that TotalTime leaves out
+	FinishTime time.Time
 
-	for _, perm := range stopPermutations {
-		// Add starting stop
-		route := []*domain.Stop{stops[0]}
-		route = append(route, perm...)
+	// MinSlack is the smallest buffer in minutes against any stop's fixed
+	// arrival or latest departure; it is only meaningful when Windowed is set
+	MinSlack int
+	Windowed bool
+}
 
-		// Try different parking combinations for this route
-		routeCandidates := s.evaluateRouteWithParkingCombinations(route, parkingOptions, request)
-		routes = append(routes, routeCandidates...)
+// TransitTime is the candidate's total time less the time spent at stops, so
+// candidates that visit different sets of stops can be compared fairly
+func (c *RouteCandidate) TransitTime() int {
+	transit := c.TotalTime
+	for _, segment := range c.Segments {
+		transit -= segment.ToStop.Duration
 	}
-
-	return routes
+	return transit
 }
 
 // evaluateRouteWithParkingCombinations evaluates a route with different parking options
@@ -155,7 +1321,12 @@ func (s *DefaultRoutingService) buildRouteCandidate(stops []*domain.Stop, parkin
 	var segments []domain.RouteSegment
 	totalCost := 0.0
 	totalTime := 0
+	totalWalking := 0
 	currentTime := request.StartTime
+	var lastPark *parkingSession
+	sessions := make(map[string]*parkingSession) // latest session at each meter
+	var slack slackTracker
+	fares := transitFareTracker{fares: s.transitFares}
 
 	fmt.Printf("[DEBUG] Building route with %d stops in sequence\n", len(stops))
 
@@ -164,37 +1335,41 @@ func (s *DefaultRoutingService) buildRouteCandidate(stops []*domain.Stop, parkin
 		currentStop := stops[i]
 		fmt.Printf("[DEBUG] Processing stop %d: %s\n", i+1, currentStop.Address)
 
-		// Find optimal parking for this stop
-		meters := parkingOptions[currentStop.ID]
-		if len(meters) == 0 {
-			fmt.Printf("[DEBUG] No parking meters available for stop: %s\n", currentStop.Address)
+		if currentStop.IsOrigin {
+			// The origin is only driven from; there is nothing to park or visit
+			continue
+		}
+		if currentStop.Duration < 0 {
+			fmt.Printf("[DEBUG] Stop %s has a negative duration of %d minutes\n", currentStop.Address, currentStop.Duration)
 			return nil
 		}
 
-		bestMeter, parkingCost, err := s.pricingService.GetOptimalParkingMeter(meters, currentTime, currentStop.Duration)
-		if err != nil || bestMeter == nil {
-			fmt.Printf("[DEBUG] Failed to find optimal parking: %v\n", err)
+		// Costs and times only grow from here, so stop once this route can't
+		// beat the candidates already built
+		partial := &RouteCandidate{Segments: segments, TotalTime: totalTime}
+		if s.bound.exceeded(totalCost, partial.TransitTime(), s.scoreFunc(totalCost, totalTime, totalWalking, request.Preferences)) {
+			fmt.Printf("[DEBUG] Abandoning route after %d stops; it can't beat the routes built so far\n", len(segments))
+			s.bound.pruned++
 			return nil
 		}
 
-		fmt.Printf("[DEBUG] Selected parking meter %s at (%.6f, %.6f) for stop %s\n",
-			bestMeter.MeterID, bestMeter.Lat, bestMeter.Lng, currentStop.Address)
-
 		var travelTime int
 		var fromStop *domain.Stop
+		var err error
 
 		if i == 0 {
-			// For the first stop, we start at the stop location (no previous stop)
+			// The trip starts at the first stop, so there is no drive to it, but it
+			// is still a destination that needs parking for the visit
 			travelTime = 0
 			fromStop = nil // No previous stop for the first segment
+		} else if coincidentStops(stops[i-1], currentStop) {
+			// Same spot as the previous stop (e.g. the same building): no driving
+			travelTime = 0
+			fromStop = stops[i-1]
 		} else {
 			// Calculate travel time from previous stop to this stop
 			prevStop := stops[i-1]
-			travelTime, err = s.mapsService.GetTravelTime(
-				&domain.Location{Lat: prevStop.Lat, Lng: prevStop.Lng},
-				&domain.Location{Lat: currentStop.Lat, Lng: currentStop.Lng},
-				currentTime,
-			)
+			travelTime, err = s.legTravelTime(prevStop, currentStop, currentTime)
 			if err != nil {
 				fmt.Printf("[DEBUG] Failed to calculate travel time: %v\n", err)
 				return nil
@@ -202,23 +1377,319 @@ func (s *DefaultRoutingService) buildRouteCandidate(stops []*domain.Stop, parkin
 			fromStop = prevStop
 		}
 
+		// Leave the origin early enough to reach the first stop at the start
+		// time, when that is what the start time means
+		if fromStop != nil && fromStop.IsOrigin && request.StartTimeMeaning == domain.StartTimeArriveFirstStop {
+			currentTime = currentTime.Add(-time.Duration(travelTime) * time.Minute)
+			origin := *fromStop
+			origin.DepartureTime = currentTime
+			fromStop = &origin
+		}
+
 		// Calculate arrival time at this stop
 		currentTime = currentTime.Add(time.Duration(travelTime) * time.Minute)
 
+		// Hold back for a fixed arrival; being late can't be made up
+		waitTime := 0
+		if !currentStop.FixedArrival.IsZero() {
+			if currentTime.After(currentStop.FixedArrival) {
+				fmt.Printf("[DEBUG] Arrives at %s after its fixed arrival time\n", currentStop.Address)
+				return nil
+			}
+			waitTime = int(currentStop.FixedArrival.Sub(currentTime).Minutes())
+			currentTime = currentStop.FixedArrival
+			slack.observe(waitTime)
+		}
+
+		// Shorten the visit to end by the stop's deadline. The segment carries a
+		// copy of the stop with the dwell actually spent; the full requested dwell
+		// still counts toward total time so arriving late never looks faster.
+		visitStop := currentStop
+		dwell := currentStop.Duration
+		deadlineMissed := false
+		if !currentStop.LatestDeparture.IsZero() {
+			available := int(currentStop.LatestDeparture.Sub(currentTime).Minutes())
+			slack.observe(available - currentStop.Duration)
+			if available < dwell {
+				dwell = max(available, 0)
+				deadlineMissed = available <= 0
+				shortened := *currentStop
+				shortened.Duration = dwell
+				visitStop = &shortened
+				fmt.Printf("[DEBUG] Visit to %s shortened to %d minutes to leave by %s\n",
+					currentStop.Address, dwell, currentStop.LatestDeparture.Format(time.RFC3339))
+			}
+		}
+
+		// Park for free at a stop with its own parking, right at the door, or
+		// arrive without a car to park at all
+		if currentStop.FreeParking || !drives(request) {
+			segmentMetadata := map[string]interface{}{"free_parking": true}
+			if !drives(request) {
+				segmentMetadata = map[string]interface{}{"travel_mode": request.TravelMode}
+			}
+			// Transit rides pay fares as they do in mode comparisons
+			if ridesTransit(request, fromStop, currentStop) {
+				boarding := currentTime.Add(-time.Duration(travelTime+waitTime) * time.Minute)
+				fare, transfer := fares.ride(
+					&domain.Location{Lat: fromStop.Lat, Lng: fromStop.Lng},
+					&domain.Location{Lat: currentStop.Lat, Lng: currentStop.Lng},
+					boarding,
+				)
+				if transfer {
+					segmentMetadata["transfer"] = true
+				}
+				segmentMetadata["fare"] = fare
+				totalCost += fare
+			}
+			if waitTime > 0 {
+				segmentMetadata["wait_minutes"] = waitTime
+			}
+			if visitStop != currentStop {
+				segmentMetadata = markShortenedVisit(segmentMetadata, currentStop.Duration, dwell, deadlineMissed)
+			}
+			segments = append(segments, domain.RouteSegment{
+				FromStop:    fromStop,
+				ToStop:      visitStop,
+				TravelTime:  travelTime,
+				ArrivalTime: currentTime,
+				Metadata:    segmentMetadata,
+			})
+			totalTime += travelTime + currentStop.Duration
+			currentTime = currentTime.Add(time.Duration(dwell) * time.Minute)
+
+			// The car leaves the free spot, so no meter session carries on
+			lastPark = nil
+
+			fmt.Printf("[DEBUG] Stop %s needs no parking - Travel: %dm\n", currentStop.Address, travelTime)
+			continue
+		}
+
+		// Stay parked for a stop at the same spot as the last one, paying for the
+		// combined dwell, as long as the meter's time limit allows it
+		if lastPark != nil && lastPark.stop == fromStop && waitTime == 0 && coincidentStops(fromStop, currentStop) {
+			combinedMinutes := max(int(currentTime.Sub(lastPark.start).Minutes())+dwell, request.MinParkingMinutes)
+			ranked, err := s.pricingService.RankParkingMeters([]*domain.ParkingMeter{lastPark.meter}, lastPark.start, combinedMinutes, s.selectionOptions(request)...)
+			if err != nil {
+				fmt.Printf("[DEBUG] Failed to price shared parking: %v\n", err)
+				return nil
+			}
+
+			if len(ranked) > 0 {
+				parkingCost := ranked[0].Cost - lastPark.cost
+				segments = append(segments, domain.RouteSegment{
+					FromStop:     fromStop,
+					ToStop:       visitStop,
+					ParkingMeter: lastPark.meter,
+					TravelTime:   0,
+					ParkingCost:  parkingCost,
+					WalkingTime:  0,
+					ArrivalTime:  currentTime,
+					Metadata: map[string]interface{}{
+						"shared_parking": true,
+						"shares_with":    fromStop.ID,
+					},
+				})
+				if visitStop != currentStop {
+					segments[len(segments)-1].Metadata = markShortenedVisit(segments[len(segments)-1].Metadata, currentStop.Duration, dwell, deadlineMissed)
+				}
+				totalCost += parkingCost
+				totalTime += currentStop.Duration
+				currentTime = currentTime.Add(time.Duration(dwell) * time.Minute)
+
+				lastPark.stop = currentStop
+				lastPark.cost = ranked[0].Cost
+
+				fmt.Printf("[DEBUG] Stop %s shares parking with %s - Cost: $%.2f\n", currentStop.Address, fromStop.Address, parkingCost)
+				continue
+			}
+		}
+
+		// Find optimal parking for this stop, priced from the arrival time
+		meters := parkingOptions[currentStop.ID]
+		if len(meters) == 0 {
+			fmt.Printf("[DEBUG] No parking meters available for stop: %s\n", currentStop.Address)
+			return nil
+		}
+
+		// Paying starts the lead time before arrival and runs to the end of the visit
+		parkStart, parkMinutes := s.parkingWindow(currentTime, dwell, request.MinParkingMinutes)
+
+		// However cheap, a meter is no use if it is too far to walk from
+		opts := append(s.selectionOptions(request), WithWalkingLimit(
+			&domain.Location{Lat: currentStop.Lat, Lng: currentStop.Lng}, maxWalkingMinutes(request.Preferences), s.walkingTime))
+		ranked, err := s.rankStopMeters(currentStop, meters, parkStart, parkMinutes, opts)
+		if err != nil {
+			fmt.Printf("[DEBUG] Failed to find optimal parking: %v\n", err)
+			return nil
+		}
+
+		if request.SpreadLoad {
+			ranked = s.spreadLoad(ranked, currentStop)
+		}
+
+		var bestMeter *domain.ParkingMeter
+		parkingCost := 0.0
+		if len(ranked) > 0 {
+			bestMeter = ranked[0].Meter
+			parkingCost = ranked[0].Cost
+		}
+
+		var sittings []domain.ParkingSitting
+		if bestMeter == nil && request.AllowSplitVisit {
+			// No single meter allows the whole visit; re-park partway through instead
+			sittings, err = s.pricingService.PlanSplitVisit(meters, parkStart, parkMinutes)
+			if err != nil {
+				fmt.Printf("[DEBUG] Failed to split visit: %v\n", err)
+				return nil
+			}
+			bestMeter = sittings[0].ParkingMeter
+			parkingCost = 0
+			for _, sitting := range sittings {
+				if request.MaxPerStopCost > 0 && sitting.Cost > request.MaxPerStopCost {
+					fmt.Printf("[DEBUG] A sitting at %s costs more than the per-stop limit\n", currentStop.Address)
+					return nil
+				}
+				parkingCost += sitting.Cost
+			}
+		}
+
+		if bestMeter == nil {
+			fmt.Printf("[DEBUG] No meter allows a %d minute visit to %s\n", dwell, currentStop.Address)
+			return nil
+		}
+
+		fmt.Printf("[DEBUG] Selected parking meter %s at (%.6f, %.6f) for stop %s\n",
+			bestMeter.MeterID, bestMeter.Lat, bestMeter.Lng, currentStop.Address)
+
+		// Coming back to a meter paid for earlier in the trip: keep that session
+		// running through the gap instead when it beats paying again
+		var resumed *parkingSession
+		separateCost := parkingCost
+		if earlier, ok := sessions[bestMeter.MeterID]; ok && len(sittings) == 0 {
+			visitEnd := parkStart.Add(time.Duration(parkMinutes) * time.Minute)
+			extra, cheaper, err := s.continueSession(earlier, visitEnd, parkingCost, request)
+			if err != nil {
+				fmt.Printf("[DEBUG] Failed to price a continued session: %v\n", err)
+				return nil
+			}
+			if cheaper {
+				resumed = earlier
+				parkingCost = extra
+				fmt.Printf("[DEBUG] Continuing the session at meter %s from %s - Cost: $%.2f instead of $%.2f\n",
+					bestMeter.MeterID, earlier.stop.Address, extra, separateCost)
+			}
+		}
+
 		// Calculate walking time from parking to destination
-		walkingTime := maps.CalculateWalkingTime(
+		walkingTime := s.walkingTime(
 			&domain.Location{Lat: bestMeter.Lat, Lng: bestMeter.Lng},
 			&domain.Location{Lat: currentStop.Lat, Lng: currentStop.Lng},
 		)
 
+		var segmentMetadata map[string]interface{}
+		if len(sittings) > 1 {
+			// Each move means walking back to the car and then from the new meter
+			for j := 1; j < len(sittings); j++ {
+				walkingTime += s.walkingTime(
+					&domain.Location{Lat: currentStop.Lat, Lng: currentStop.Lng},
+					&domain.Location{Lat: sittings[j-1].ParkingMeter.Lat, Lng: sittings[j-1].ParkingMeter.Lng},
+				)
+				walkingTime += s.walkingTime(
+					&domain.Location{Lat: sittings[j].ParkingMeter.Lat, Lng: sittings[j].ParkingMeter.Lng},
+					&domain.Location{Lat: currentStop.Lat, Lng: currentStop.Lng},
+				)
+			}
+			segmentMetadata = map[string]interface{}{
+				"split_visit":   true,
+				"move_required": true,
+				"moves":         len(sittings) - 1,
+			}
+		}
+		// Offer the next-best meters as backups in case the chosen one is taken
+		if len(sittings) == 0 && len(ranked) > 1 {
+			if segmentMetadata == nil {
+				segmentMetadata = make(map[string]interface{})
+			}
+			segmentMetadata["alternatives"] = s.meterAlternatives(ranked[1:], currentStop)
+		}
+		if waitTime > 0 {
+			if segmentMetadata == nil {
+				segmentMetadata = make(map[string]interface{})
+			}
+			segmentMetadata["wait_minutes"] = waitTime
+		}
+		if visitStop != currentStop {
+			segmentMetadata = markShortenedVisit(segmentMetadata, currentStop.Duration, dwell, deadlineMissed)
+		}
+		if bestMeter.RateAssumed {
+			if segmentMetadata == nil {
+				segmentMetadata = make(map[string]interface{})
+			}
+			segmentMetadata["rate_assumed"] = true
+		}
+		// Finding a spot takes longer in busy areas
+		circling := s.circlingMinutes(bestMeter)
+		if circling > 0 {
+			if segmentMetadata == nil {
+				segmentMetadata = make(map[string]interface{})
+			}
+			segmentMetadata["circling_minutes"] = circling
+		}
+		if resumed != nil {
+			if segmentMetadata == nil {
+				segmentMetadata = make(map[string]interface{})
+			}
+			segmentMetadata["continues_session_from"] = resumed.stop.ID
+			segmentMetadata["single_session_saving"] = math.Round((separateCost+request.ReentryPenalty-parkingCost)*100) / 100
+		}
+
+		// Leave the car where it is and walk over from the last stop when that
+		// scores better than driving here and parking again
+		departure := currentTime.Add(-time.Duration(travelTime+waitTime) * time.Minute)
+		if link := s.walkLink(lastPark, fromStop, currentStop, departure, dwell, request); link != nil &&
+			s.scoreFunc(link.cost, link.walkingTime, link.walkingTime, request.Preferences) <
+				s.scoreFunc(parkingCost, travelTime+circling+walkingTime, walkingTime, request.Preferences) {
+			segments = append(segments, domain.RouteSegment{
+				FromStop:     fromStop,
+				ToStop:       visitStop,
+				ParkingMeter: lastPark.meter,
+				TravelTime:   0,
+				ParkingCost:  link.cost,
+				WalkingTime:  link.walkingTime,
+				ArrivalTime:  link.arrival,
+				Metadata: map[string]interface{}{
+					"walk_linked":    true,
+					"walk_from":      fromStop.ID,
+					"reparking_cost": math.Round(parkingCost*100) / 100,
+				},
+			})
+			totalCost += link.cost
+			totalTime += link.walkingTime + currentStop.Duration
+			totalWalking += link.walkingTime
+			currentTime = link.backAtCar
+
+			lastPark.stop = currentStop
+			lastPark.cost += link.cost
+
+			fmt.Printf("[DEBUG] Walking to %s from %s, leaving the car at meter %s - Cost: $%.2f instead of $%.2f\n",
+				currentStop.Address, fromStop.Address, lastPark.meter.MeterID, link.cost, parkingCost)
+			continue
+		}
+
 		// Create segment
 		segment := domain.RouteSegment{
 			FromStop:     fromStop,
-			ToStop:       currentStop,
+			ToStop:       visitStop,
 			ParkingMeter: bestMeter,
 			TravelTime:   travelTime,
 			ParkingCost:  parkingCost,
 			WalkingTime:  walkingTime,
+			ArrivalTime:  currentTime,
+			Metadata:     segmentMetadata,
+		}
+		if len(sittings) > 1 {
+			segment.Sittings = sittings
 		}
 
 		if fromStop == nil {
@@ -229,30 +1700,129 @@ func (s *DefaultRoutingService) buildRouteCandidate(stops []*domain.Stop, parkin
 
 		segments = append(segments, segment)
 		totalCost += parkingCost
-		totalTime += travelTime + walkingTime + currentStop.Duration
 
-		// Update current time to account for walking and visit duration
-		currentTime = currentTime.Add(time.Duration(walkingTime+currentStop.Duration) * time.Minute)
+		lastPark = nil
+		if resumed != nil {
+			resumed.stop = currentStop
+			resumed.cost += parkingCost
+			lastPark = resumed
+		} else if len(sittings) <= 1 {
+			lastPark = &parkingSession{meter: bestMeter, stop: currentStop, start: parkStart, cost: parkingCost}
+			sessions[bestMeter.MeterID] = lastPark
+		}
+		totalTime += travelTime + circling + walkingTime + currentStop.Duration
+		totalWalking += walkingTime
+
+		// Update current time to account for circling, walking and visit duration
+		currentTime = currentTime.Add(time.Duration(circling+walkingTime+dwell) * time.Minute)
 
 		fmt.Printf("[DEBUG] Stop complete - Travel: %dm, Walk: %dm, Cost: $%.2f\n", travelTime, walkingTime, parkingCost)
 	}
 
 	// Calculate hybrid score
-	hybridScore := request.Preferences.CostWeight*totalCost + request.Preferences.TimeWeight*float64(totalTime)/60.0
+	hybridScore := s.scoreFunc(totalCost, totalTime, totalWalking, request.Preferences)
 
 	fmt.Printf("[DEBUG] Route complete - Total Cost: $%.2f, Total Time: %dm, Hybrid Score: %.2f\n", totalCost, totalTime, hybridScore)
 
-	return &RouteCandidate{
+	candidate := &RouteCandidate{
 		Stops:       stops,
 		Segments:    segments,
 		TotalCost:   totalCost,
 		TotalTime:   totalTime,
 		HybridScore: hybridScore,
+		FinishTime:  currentTime,
+		MinSlack:    slack.min,
+		Windowed:    slack.set,
+	}
+	s.bound.record(candidate)
+	return candidate
+}
+
+// TravelTime returns the total driving minutes across the candidate's segments
+func (c *RouteCandidate) TravelTime() int {
+	total := 0
+	for _, segment := range c.Segments {
+		total += segment.TravelTime
+	}
+	return total
+}
+
+// WalkingTime returns the minutes walked across the route, between meters and
+// stops and along walk links
+func (c *RouteCandidate) WalkingTime() int {
+	total := 0
+	for _, segment := range c.Segments {
+		total += segment.WalkingTime
+	}
+	return total
+}
+
+// filterTotalWalking removes candidates that walk more than limit minutes in
+// total. If none are left, the error names the stops whose walks made up most
+// of the least-walking candidate's total.
+func filterTotalWalking(routes []*RouteCandidate, limit int) ([]*RouteCandidate, error) {
+	var filtered []*RouteCandidate
+	least := routes[0]
+	for _, route := range routes {
+		if route.WalkingTime() <= limit {
+			filtered = append(filtered, route)
+		}
+		if route.WalkingTime() < least.WalkingTime() {
+			least = route
+		}
+	}
+	if len(filtered) > 0 {
+		return filtered, nil
+	}
+
+	// Walks to the same stop (a shared meter's walk link) count together
+	walks := make(map[string]int)
+	var order []*domain.Stop
+	for _, segment := range least.Segments {
+		if segment.WalkingTime == 0 || segment.ToStop == nil {
+			continue
+		}
+		if _, ok := walks[segment.ToStop.ID]; !ok {
+			order = append(order, segment.ToStop)
+		}
+		walks[segment.ToStop.ID] += segment.WalkingTime
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return walks[order[i].ID] > walks[order[j].ID]
+	})
+	details := make([]string, 0, len(order))
+	for _, stop := range order {
+		details = append(details, fmt.Sprintf("%s (%d min)", stopLabel(stop), walks[stop.ID]))
+	}
+	return nil, fmt.Errorf("%w: the route with the least walking walks %d minutes against a limit of %d, mostly at %s",
+		ErrWalkingLimitExceeded, least.WalkingTime(), limit, strings.Join(details, ", "))
+}
+
+// filterDetours removes candidates whose total travel exceeds the nearest-neighbor
+// ordering's travel time multiplied by maxRatio
+func (s *DefaultRoutingService) filterDetours(ctx *RouteContext, routes []*RouteCandidate, maxRatio float64) ([]*RouteCandidate, error) {
+	order, err := nearestNeighborOrder(ctx.Stops, ctx.TravelTime)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := ctx.pathTravelTime(order)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := float64(baseline) * maxRatio
+	var filtered []*RouteCandidate
+	for _, route := range routes {
+		if float64(route.TravelTime()) <= limit {
+			filtered = append(filtered, route)
+		}
 	}
+
+	return filtered, nil
 }
 
 // selectOptimalPlans selects the best routes for each objective
-func (s *DefaultRoutingService) selectOptimalPlans(routes []*RouteCandidate) []*domain.TripPlan {
+func (s *DefaultRoutingService) selectOptimalPlans(routes []*RouteCandidate, request *domain.TripRequest) []*domain.TripPlan {
 	if len(routes) == 0 {
 		return nil
 	}
@@ -265,10 +1835,12 @@ func (s *DefaultRoutingService) selectOptimalPlans(routes []*RouteCandidate) []*
 		}
 	}
 
-	// Find fastest route
+	// Find fastest route. Time spent at stops is the point of the trip, so
+	// compare time spent getting around; with the same stops this is the same
+	// ordering as total time.
 	fastestRoute := routes[0]
 	for _, route := range routes {
-		if route.TotalTime < fastestRoute.TotalTime {
+		if route.TransitTime() < fastestRoute.TransitTime() {
 			fastestRoute = route
 		}
 	}
@@ -289,7 +1861,7 @@ func (s *DefaultRoutingService) selectOptimalPlans(routes []*RouteCandidate) []*
 			Route:     cheapestRoute.Segments,
 			Metadata: map[string]interface{}{
 				"optimization": "cost",
-				"savings":      fmt.Sprintf("$%.2f vs fastest", fastestRoute.TotalCost-cheapestRoute.TotalCost),
+				"savings":      fmt.Sprintf("%s vs fastest", FormatCurrency(fastestRoute.TotalCost-cheapestRoute.TotalCost, request.Locale)),
 			},
 		},
 		{
@@ -314,9 +1886,246 @@ func (s *DefaultRoutingService) selectOptimalPlans(routes []*RouteCandidate) []*
 		},
 	}
 
+	// Note which optional stops each plan leaves out
+	for i, route := range []*RouteCandidate{cheapestRoute, fastestRoute, hybridRoute} {
+		if len(route.DroppedStops) > 0 {
+			plans[i].Metadata["dropped_stops"] = route.DroppedStops
+		}
+	}
+
+	// Add the route that finishes soonest when waits for fixed arrivals make
+	// it finish before the fastest one
+	if finishRoute := earliestFinishRoute(routes); finishRoute != nil && finishRoute.FinishTime.Before(fastestRoute.FinishTime) {
+		plans = append(plans, &domain.TripPlan{
+			Type:      EarliestFinishPlanType,
+			TotalCost: finishRoute.TotalCost,
+			TotalTime: finishRoute.TotalTime,
+			Route:     finishRoute.Segments,
+			Metadata: map[string]interface{}{
+				"optimization": "finish_time",
+				"finish_saved": fmt.Sprintf("%d minutes vs fastest", int(fastestRoute.FinishTime.Sub(finishRoute.FinishTime).Minutes())),
+			},
+		})
+	}
+
+	// Add the route that keeps the most buffer against stop time windows when
+	// it leaves more room than the fastest one
+	if reliableRoute := mostReliableRoute(routes); reliableRoute != nil && reliableRoute.MinSlack > fastestRoute.MinSlack {
+		plans = append(plans, &domain.TripPlan{
+			Type:      MostReliablePlanType,
+			TotalCost: reliableRoute.TotalCost,
+			TotalTime: reliableRoute.TotalTime,
+			Route:     reliableRoute.Segments,
+			Metadata: map[string]interface{}{
+				"optimization":      "reliability",
+				"min_slack_minutes": reliableRoute.MinSlack,
+				"buffer_gained":     fmt.Sprintf("%d minutes vs fastest", reliableRoute.MinSlack-fastestRoute.MinSlack),
+			},
+		})
+	}
+
 	return plans
 }
 
+// PlanTypes lists the objectives PlanTrip can return a plan for, in order
+var PlanTypes = []string{"cheapest", "fastest", "hybrid", EarliestFinishPlanType, MostReliablePlanType}
+
+// EarliestFinishPlanType is the plan type of the route whose last visit ends soonest
+const EarliestFinishPlanType = "earliest_finish"
+
+// earliestFinishRoute returns the route whose last visit ends first. Skipping a
+// stop always finishes sooner, so only routes visiting every stop compete; it
+// returns nil when there are none.
+func earliestFinishRoute(routes []*RouteCandidate) *RouteCandidate {
+	var earliest *RouteCandidate
+	for _, route := range routes {
+		if len(route.DroppedStops) > 0 {
+			continue
+		}
+		if earliest == nil || route.FinishTime.Before(earliest.FinishTime) {
+			earliest = route
+		}
+	}
+	return earliest
+}
+
+// routesWithoutOptionalStops generates candidates for every way of skipping the
+// trip's optional stops, recording which were skipped on each candidate. It
+// reports whether the strategy truncated any of its runs.
+func (s *DefaultRoutingService) routesWithoutOptionalStops(strategy RouteStrategy, stops []*domain.Stop, parkingOptions map[string][]*domain.ParkingMeter, request *domain.TripRequest) ([]*RouteCandidate, bool) {
+	var optional []*domain.Stop
+	for _, stop := range stops {
+		if stop.Optional && !stop.IsOrigin {
+			optional = append(optional, stop)
+		}
+	}
+	if len(optional) > maxOptionalStops {
+		fmt.Printf("[DEBUG] Only the first %d of %d optional stops may be skipped\n", maxOptionalStops, len(optional))
+		optional = optional[:maxOptionalStops]
+	}
+
+	var routes []*RouteCandidate
+	truncated := false
+	for mask := 1; mask < 1<<len(optional); mask++ {
+		dropped := make(map[*domain.Stop]bool)
+		var droppedIDs []string
+		for i, stop := range optional {
+			if mask&(1<<i) != 0 {
+				dropped[stop] = true
+				droppedIDs = append(droppedIDs, stop.ID)
+			}
+		}
+
+		var remaining []*domain.Stop
+		visits := 0
+		for _, stop := range stops {
+			if dropped[stop] {
+				continue
+			}
+			remaining = append(remaining, stop)
+			if !stop.IsOrigin {
+				visits++
+			}
+		}
+		if visits == 0 {
+			continue
+		}
+
+		ctx := s.newRouteContext(remaining, parkingOptions, request)
+		candidates := strategy.GenerateRoutes(ctx)
+		for _, candidate := range candidates {
+			candidate.DroppedStops = droppedIDs
+		}
+		routes = append(routes, candidates...)
+		truncated = truncated || ctx.Truncated
+	}
+
+	return routes, truncated
+}
+
+// attachUncertaintyRange re-prices a plan with every travel leg shortened and
+// lengthened by the request's variance and records the resulting ranges
+func (s *DefaultRoutingService) attachUncertaintyRange(plan *domain.TripPlan, request *domain.TripRequest) error {
+	lowCost, lowTime, err := s.evaluateWithTravelScale(plan.Route, request, 1-request.TravelTimeVariance)
+	if err != nil {
+		return err
+	}
+	highCost, highTime, err := s.evaluateWithTravelScale(plan.Route, request, 1+request.TravelTimeVariance)
+	if err != nil {
+		return err
+	}
+
+	// Arriving later is not necessarily more expensive (e.g. slipping past 6 PM),
+	// so the cost bounds include the nominal plan and both extremes
+	plan.Metadata["cost_low"] = math.Min(plan.TotalCost, math.Min(lowCost, highCost))
+	plan.Metadata["cost_high"] = math.Max(plan.TotalCost, math.Max(lowCost, highCost))
+	plan.Metadata["time_low"] = lowTime
+	plan.Metadata["time_high"] = highTime
+	plan.Metadata["travel_time_variance"] = request.TravelTimeVariance
+
+	return nil
+}
+
+// evaluateWithTravelScale replays a route with each travel leg scaled by factor,
+// keeping the chosen meters, and returns the resulting total cost and time
+func (s *DefaultRoutingService) evaluateWithTravelScale(segments []domain.RouteSegment, request *domain.TripRequest, factor float64) (float64, int, error) {
+	totalCost := 0.0
+	totalTime := 0
+	currentTime := tripDeparture(segments, request)
+
+	// The session the car was last parked in, and each meter's latest session
+	// for revisits that keep it running
+	type replaySession struct {
+		start time.Time
+		cost  float64
+	}
+	var session *replaySession
+	sessions := make(map[string]*replaySession)
+	fares := transitFareTracker{fares: s.transitFares}
+
+	for _, segment := range segments {
+		travelTime := int(math.Round(float64(segment.TravelTime) * factor))
+		if ridesTransit(request, segment.FromStop, segment.ToStop) {
+			fare, _ := fares.ride(
+				&domain.Location{Lat: segment.FromStop.Lat, Lng: segment.FromStop.Lng},
+				&domain.Location{Lat: segment.ToStop.Lat, Lng: segment.ToStop.Lng},
+				currentTime,
+			)
+			totalCost += fare
+		}
+		currentTime = currentTime.Add(time.Duration(travelTime) * time.Minute)
+		if fixed := segment.ToStop.FixedArrival; currentTime.Before(fixed) {
+			currentTime = fixed
+		}
+
+		parkStart, parkMinutes := s.parkingWindow(currentTime, segment.ToStop.Duration, request.MinParkingMinutes)
+
+		shared, _ := segment.Metadata["shared_parking"].(bool)
+		walkLinked, _ := segment.Metadata["walk_linked"].(bool)
+		_, continues := segment.Metadata["continues_session_from"]
+		var earlier *replaySession
+		if continues && segment.ParkingMeter != nil {
+			earlier = sessions[segment.ParkingMeter.MeterID]
+		}
+		if (shared || walkLinked) && session != nil {
+			// Extend the previous park to cover this visit too, and the walks to
+			// and from it when the car stayed put
+			combinedMinutes := max(int(currentTime.Sub(session.start).Minutes())+segment.WalkingTime+segment.ToStop.Duration, request.MinParkingMinutes)
+			cost, err := s.pricingService.CalculateParkingCost(segment.ParkingMeter, session.start, combinedMinutes)
+			if err != nil {
+				return 0, 0, err
+			}
+			totalCost += cost - session.cost
+			session.cost = cost
+		} else if earlier != nil {
+			// Keep the earlier session at this meter running through the end
+			// of this visit rather than paying again
+			end := parkStart.Add(time.Duration(parkMinutes) * time.Minute)
+			cost, err := s.pricingService.CalculateParkingCost(segment.ParkingMeter, earlier.start, int(math.Ceil(end.Sub(earlier.start).Minutes())))
+			if err != nil {
+				return 0, 0, err
+			}
+			totalCost += cost - earlier.cost
+			earlier.cost = cost
+			session = earlier
+		} else if len(segment.Sittings) > 0 {
+			// Shift each sitting by the same amount the arrival moved
+			offset := parkStart.Sub(segment.Sittings[0].StartTime)
+			for _, sitting := range segment.Sittings {
+				cost, err := s.pricingService.CalculateParkingCost(sitting.ParkingMeter, sitting.StartTime.Add(offset), sitting.Minutes)
+				if err != nil {
+					return 0, 0, err
+				}
+				totalCost += cost
+			}
+		} else if segment.ParkingMeter != nil {
+			cost, err := s.pricingService.CalculateParkingCost(segment.ParkingMeter, parkStart, parkMinutes)
+			if err != nil {
+				return 0, 0, err
+			}
+			totalCost += cost
+			session = &replaySession{start: parkStart, cost: cost}
+			sessions[segment.ParkingMeter.MeterID] = session
+		}
+
+		circling := segmentCircling(segment)
+		totalTime += travelTime + circling + segment.WalkingTime + segment.ToStop.Duration
+		currentTime = currentTime.Add(time.Duration(circling+segment.WalkingTime+segment.ToStop.Duration) * time.Minute)
+	}
+
+	return totalCost, totalTime, nil
+}
+
+// tripDeparture is when a route's driving begins: the start time, or for a
+// start time that is the arrival at the first stop, that less the drive there
+func tripDeparture(segments []domain.RouteSegment, request *domain.TripRequest) time.Time {
+	if len(segments) > 0 && segments[0].FromStop != nil && !segments[0].FromStop.DepartureTime.IsZero() &&
+		request.StartTimeMeaning == domain.StartTimeArriveFirstStop {
+		return segments[0].FromStop.DepartureTime
+	}
+	return request.StartTime
+}
+
 // Helper functions
 
 func (s *DefaultRoutingService) generateStopPermutations(stops []*domain.Stop) [][]*domain.Stop {
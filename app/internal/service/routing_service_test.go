@@ -0,0 +1,2221 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// fakeParkingRepository returns the configured meters that fall within the radius
+type fakeParkingRepository struct {
+	meters []*domain.ParkingMeter
+}
+
+func (r *fakeParkingRepository) GetParkingMetersNear(lat, lng, radiusKm float64) ([]*domain.ParkingMeter, error) {
+	var nearby []*domain.ParkingMeter
+	for _, meter := range r.meters {
+		distance := maps.CalculateDistance(
+			&domain.Location{Lat: lat, Lng: lng},
+			&domain.Location{Lat: meter.Lat, Lng: meter.Lng},
+		)
+		if distance <= radiusKm {
+			nearby = append(nearby, meter)
+		}
+	}
+	return nearby, nil
+}
+
+func (r *fakeParkingRepository) GetAllParkingMeters() ([]*domain.ParkingMeter, error) {
+	return r.meters, nil
+}
+
+// fakeMapsService returns a fixed travel time for every leg unless overridden per pair
+type fakeMapsService struct {
+	travelMinutes int
+	travelTimes   map[string]int
+	locations     map[string]*domain.Location
+	travelCalls   int
+	matrixCalls   int
+	geocodeCalls  int
+}
+
+func locationKey(from, to *domain.Location) string {
+	return fmt.Sprintf("%.5f,%.5f->%.5f,%.5f", from.Lat, from.Lng, to.Lat, to.Lng)
+}
+
+func (m *fakeMapsService) minutes(from, to *domain.Location) int {
+	if minutes, ok := m.travelTimes[locationKey(from, to)]; ok {
+		return minutes
+	}
+	return m.travelMinutes
+}
+
+func (m *fakeMapsService) GetTravelTime(from, to *domain.Location, departureTime time.Time) (int, error) {
+	m.travelCalls++
+	return m.minutes(from, to), nil
+}
+
+func (m *fakeMapsService) GetTravelTimeMatrix(locations []*domain.Location, departureTime time.Time) ([][]int, error) {
+	m.matrixCalls++
+	matrix := make([][]int, len(locations))
+	for i := range locations {
+		matrix[i] = make([]int, len(locations))
+		for j := range locations {
+			if i != j {
+				matrix[i][j] = m.minutes(locations[i], locations[j])
+			}
+		}
+	}
+	return matrix, nil
+}
+
+func (m *fakeMapsService) GeocodeAddress(address string) (*domain.Location, error) {
+	m.geocodeCalls++
+	if location, ok := m.locations[address]; ok {
+		return location, nil
+	}
+	return nil, fmt.Errorf("no results found for address: %s", address)
+}
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	require.NoError(t, err)
+	return parsed
+}
+
+func findPlan(plans []*domain.TripPlan, planType string) *domain.TripPlan {
+	for _, plan := range plans {
+		if plan.Type == planType {
+			return plan
+		}
+	}
+	return nil
+}
+
+// twoStopFixture places one meter next to each of two downtown stops
+func twoStopFixture() (*fakeParkingRepository, []domain.Stop) {
+	repo := &fakeParkingRepository{
+		meters: []*domain.ParkingMeter{
+			{MeterID: "A1", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 4.00, RateMF6P10: 1.00},
+			{MeterID: "B1", Lat: 49.2901, Lng: -123.1301, RateMF9A6P: 4.00, RateMF6P10: 1.00},
+		},
+	}
+	stops := []domain.Stop{
+		{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 30},
+		{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1300, Duration: 60},
+	}
+	return repo, stops
+}
+
+func TestRoutingService_TravelTimeVarianceRange(t *testing.T) {
+	costSpread := func(t *testing.T, startTime string) (*domain.TripPlan, float64) {
+		repo, stops := twoStopFixture()
+		mapsService := &fakeMapsService{travelMinutes: 60}
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+		plans, err := routing.PlanTrip(&domain.TripRequest{
+			Stops:              stops,
+			StartTime:          mustParseTime(t, startTime),
+			Preferences:        domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+			TravelTimeVariance: 0.15,
+		})
+		require.NoError(t, err)
+
+		plan := findPlan(plans, "cheapest")
+		require.NotNil(t, plan)
+		low := plan.Metadata["cost_low"].(float64)
+		high := plan.Metadata["cost_high"].(float64)
+		assert.LessOrEqual(t, low, plan.TotalCost)
+		assert.GreaterOrEqual(t, high, plan.TotalCost)
+		return plan, high - low
+	}
+
+	t.Run("Variance straddling 6 PM widens the cost range", func(t *testing.T) {
+		// Leave stop A at 5:00 PM, nominally arriving at stop B at exactly 6:00 PM
+		plan, spread := costSpread(t, "2024-01-15T16:30:00-08:00")
+		_, middaySpread := costSpread(t, "2024-01-15T11:30:00-08:00")
+
+		assert.Greater(t, spread, 0.25)
+		assert.InDelta(t, 0.0, middaySpread, 0.001)
+		assert.Equal(t, 141, plan.Metadata["time_low"])
+		assert.Equal(t, 159, plan.Metadata["time_high"])
+	})
+
+	t.Run("No range without variance", func(t *testing.T) {
+		repo, stops := twoStopFixture()
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 60}, NewPricingService())
+
+		plans, err := routing.PlanTrip(&domain.TripRequest{
+			Stops:       stops,
+			StartTime:   mustParseTime(t, "2024-01-15T16:30:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		})
+		require.NoError(t, err)
+		for _, plan := range plans {
+			assert.NotContains(t, plan.Metadata, "cost_low")
+		}
+	})
+}
+
+// setTravelTime overrides the fake travel time between two stops
+func (m *fakeMapsService) setTravelTime(from, to domain.Stop, minutes int) {
+	if m.travelTimes == nil {
+		m.travelTimes = map[string]int{}
+	}
+	m.travelTimes[locationKey(
+		&domain.Location{Lat: from.Lat, Lng: from.Lng},
+		&domain.Location{Lat: to.Lat, Lng: to.Lng},
+	)] = minutes
+}
+
+// circuitousFixture makes visiting stop B last (via a long drive) cheaper because
+// it pushes the pricey B meter past 6 PM
+func circuitousFixture() (*fakeParkingRepository, *fakeMapsService, []domain.Stop) {
+	stops := []domain.Stop{
+		{ID: "a", Address: "Stop A", Lat: 49.2800, Lng: -123.1200, Duration: 30},
+		{ID: "b", Address: "Stop B", Lat: 49.3000, Lng: -123.1200, Duration: 60},
+		{ID: "c", Address: "Stop C", Lat: 49.3200, Lng: -123.1200, Duration: 30},
+	}
+	repo := &fakeParkingRepository{
+		meters: []*domain.ParkingMeter{
+			{MeterID: "MA", Lat: 49.2801, Lng: -123.1200, RateMF9A6P: 1.00, RateMF6P10: 1.00},
+			{MeterID: "MB", Lat: 49.3001, Lng: -123.1200, RateMF9A6P: 10.00, RateMF6P10: 1.00},
+			{MeterID: "MC", Lat: 49.3201, Lng: -123.1200, RateMF9A6P: 1.00, RateMF6P10: 1.00},
+		},
+	}
+	mapsService := &fakeMapsService{travelMinutes: 10}
+	mapsService.setTravelTime(stops[0], stops[2], 40)
+	mapsService.setTravelTime(stops[2], stops[1], 40)
+	return repo, mapsService, stops
+}
+
+func stopOrder(plan *domain.TripPlan) []string {
+	var order []string
+	for _, segment := range plan.Route {
+		order = append(order, segment.ToStop.ID)
+	}
+	return order
+}
+
+func TestRoutingService_MaxDetourRatio(t *testing.T) {
+	plan := func(t *testing.T, ratio float64) *domain.TripPlan {
+		repo, mapsService, stops := circuitousFixture()
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+		plans, err := routing.PlanTrip(&domain.TripRequest{
+			Stops:          stops,
+			StartTime:      mustParseTime(t, "2024-01-15T16:30:00-08:00"),
+			Preferences:    domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+			MaxDetourRatio: ratio,
+		})
+		require.NoError(t, err)
+		cheapest := findPlan(plans, "cheapest")
+		require.NotNil(t, cheapest)
+		return cheapest
+	}
+
+	t.Run("Without a limit the circuitous route is cheapest", func(t *testing.T) {
+		cheapest := plan(t, 0)
+		assert.Equal(t, []string{"a", "c", "b"}, stopOrder(cheapest))
+	})
+
+	t.Run("A 1.2 ratio rejects the circuitous route", func(t *testing.T) {
+		cheapest := plan(t, 1.2)
+		assert.Equal(t, []string{"a", "b", "c"}, stopOrder(cheapest))
+	})
+}
+
+func TestRoutingService_MaxTotalWalking(t *testing.T) {
+	stops := []domain.Stop{
+		{ID: "a", Address: "Stop A", Lat: 49.2800, Lng: -123.1200, Duration: 30},
+		{ID: "gym", Address: "Gym", Lat: 49.3000, Lng: -123.1200, Duration: 30, Optional: true},
+		{ID: "b", Address: "Stop B", Lat: 49.3200, Lng: -123.1200, Duration: 30},
+	}
+	// The meters at A and the gym are each a 9-minute walk, inside the
+	// per-stop limit; B's is at the door
+	repo := &fakeParkingRepository{
+		meters: []*domain.ParkingMeter{
+			{MeterID: "MA", Lat: 49.2732, Lng: -123.1200, RateMF9A6P: 1.00},
+			{MeterID: "MGYM", Lat: 49.3068, Lng: -123.1200, RateMF9A6P: 1.00},
+			{MeterID: "MB", Lat: 49.3201, Lng: -123.1200, RateMF9A6P: 1.00},
+		},
+	}
+	// The gym sits on a quick route that avoids the slow direct drive from A to B
+	mapsService := &fakeMapsService{travelMinutes: 40}
+	mapsService.setTravelTime(stops[0], stops[1], 5)
+	mapsService.setTravelTime(stops[1], stops[2], 5)
+	routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+	plan := func(limit int) ([]*domain.TripPlan, error) {
+		return routing.PlanTrip(&domain.TripRequest{
+			StartTime: mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+			Stops:     stops,
+			Preferences: domain.Preferences{
+				CostWeight:             0.5,
+				TimeWeight:             0.5,
+				MaxTotalWalkingMinutes: limit,
+			},
+		})
+	}
+
+	t.Run("Without a cap the fastest plan walks at A and the gym", func(t *testing.T) {
+		plans, err := plan(0)
+		require.NoError(t, err)
+		fastest := findPlan(plans, "fastest")
+		require.NotNil(t, fastest)
+		assert.Equal(t, []string{"a", "gym", "b"}, stopOrder(fastest))
+	})
+
+	t.Run("The trip total rules out walking at both", func(t *testing.T) {
+		plans, err := plan(15)
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+		for _, plan := range plans {
+			assert.Equal(t, []string{"a", "b"}, stopOrder(plan))
+		}
+	})
+
+	t.Run("An unreachable cap names the stops walked from", func(t *testing.T) {
+		_, err := plan(5)
+		require.ErrorIs(t, err, ErrWalkingLimitExceeded)
+		assert.Contains(t, err.Error(), "walks 9 minutes against a limit of 5")
+		assert.Contains(t, err.Error(), "Stop A (9 min)")
+		assert.NotContains(t, err.Error(), "Gym")
+	})
+}
+
+func TestRoutingService_MaxMapCallsBudget(t *testing.T) {
+	// Looked up leg by leg, the legs of a four-stop trip outrun the budget
+	repo, mapsService, stops := fourStopFixture()
+	routing := NewRoutingService(repo, mapsService, NewPricingService(), WithTravelMatrix(false))
+
+	plans, err := routing.PlanTrip(&domain.TripRequest{
+		Stops:       stops,
+		StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		MaxMapCalls: 3,
+	})
+	require.NoError(t, err)
+	require.Len(t, plans, 3)
+
+	assert.LessOrEqual(t, mapsService.travelCalls, 3)
+	for _, plan := range plans {
+		assert.Equal(t, true, plan.Metadata["budget_limited"])
+		assert.Equal(t, 3, plan.Metadata["map_calls_used"])
+		assert.Len(t, plan.Route, len(stops))
+	}
+}
+
+func TestRoutingService_Earth(t *testing.T) {
+	repo, mapsService, stops := fourStopFixture()
+	request := &domain.TripRequest{
+		Stops:       stops,
+		StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	}
+	walking := func(plans []*domain.TripPlan) int {
+		minutes := 0
+		for _, segment := range plans[0].Route {
+			minutes += segment.WalkingTime
+		}
+		return minutes
+	}
+
+	plans, err := NewRoutingService(repo, mapsService, NewPricingService()).PlanTrip(request)
+	require.NoError(t, err)
+	flat := walking(plans)
+
+	// On a sphere a hundred times larger every walk is a hundred times longer
+	earth := maps.Earth{RadiusKm: 100 * maps.EarthRadiusKm}
+	plans, err = NewRoutingService(repo, mapsService, NewPricingService(), WithEarth(earth)).PlanTrip(request)
+	require.NoError(t, err)
+	assert.Greater(t, walking(plans), flat)
+
+	// Estimates made once the budget is spent are measured on it too
+	from, to := &domain.Location{Lat: stops[0].Lat, Lng: stops[0].Lng}, &domain.Location{Lat: stops[1].Lat, Lng: stops[1].Lng}
+	minutes, err := newBudgetedMapsService(mapsService, 0, earth).GetTravelTime(from, to, request.StartTime)
+	require.NoError(t, err)
+	assert.Equal(t, earth.DrivingTime(from, to), minutes)
+	assert.Greater(t, minutes, maps.EstimateDrivingTime(from, to))
+}
+
+func TestRoutingService_MaxMapCallsBudgetWithMatrix(t *testing.T) {
+	request := func(stops []domain.Stop) *domain.TripRequest {
+		return &domain.TripRequest{
+			Stops:       stops,
+			StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+			MaxMapCalls: 1,
+		}
+	}
+
+	t.Run("One matrix call times every leg", func(t *testing.T) {
+		repo, mapsService, stops := fourStopFixture()
+
+		plans, err := NewRoutingService(repo, mapsService, NewPricingService()).PlanTrip(request(stops))
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+		assert.Equal(t, 1, mapsService.matrixCalls)
+		assert.Zero(t, mapsService.travelCalls)
+		for _, plan := range plans {
+			assert.Equal(t, 1, plan.Metadata["map_calls_used"])
+			assert.NotContains(t, plan.Metadata, "budget_limited")
+		}
+	})
+
+	t.Run("Legs missing from the matrix are estimated once the budget is spent", func(t *testing.T) {
+		repo, fake, stops := fourStopFixture()
+		hole := locationKey(&domain.Location{Lat: stops[0].Lat, Lng: stops[0].Lng}, &domain.Location{Lat: stops[1].Lat, Lng: stops[1].Lng})
+		mapsService := &holeyMapsService{fakeMapsService: fake, hole: hole}
+
+		plans, err := NewRoutingService(repo, mapsService, NewPricingService()).PlanTrip(request(stops))
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+		assert.Equal(t, 1, fake.matrixCalls)
+		assert.Empty(t, mapsService.legs)
+		for _, plan := range plans {
+			assert.Equal(t, 1, plan.Metadata["map_calls_used"])
+			assert.Equal(t, true, plan.Metadata["budget_limited"])
+		}
+	})
+}
+
+// holeyMapsService reports no route in the travel time matrix for one leg and
+// records the legs looked up on their own
+type holeyMapsService struct {
+	*fakeMapsService
+	hole string
+	legs []string
+}
+
+func (m *holeyMapsService) GetTravelTime(from, to *domain.Location, departureTime time.Time) (int, error) {
+	m.legs = append(m.legs, locationKey(from, to))
+	return m.fakeMapsService.GetTravelTime(from, to, departureTime)
+}
+
+func (m *holeyMapsService) GetTravelTimeMatrix(locations []*domain.Location, departureTime time.Time) ([][]int, error) {
+	matrix, err := m.fakeMapsService.GetTravelTimeMatrix(locations, departureTime)
+	for i := range locations {
+		for j := range locations {
+			if locationKey(locations[i], locations[j]) == m.hole {
+				matrix[i][j] = -1
+			}
+		}
+	}
+	return matrix, err
+}
+
+func TestRoutingService_TravelMatrix(t *testing.T) {
+	request := func(stops []domain.Stop) *domain.TripRequest {
+		return &domain.TripRequest{
+			Stops:       stops,
+			StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		}
+	}
+
+	t.Run("One matrix for a four-stop trip", func(t *testing.T) {
+		repo, mapsService, stops := fourStopFixture()
+		plans, err := NewRoutingService(repo, mapsService, NewPricingService()).PlanTrip(request(stops))
+		require.NoError(t, err)
+		assert.Equal(t, 1, mapsService.matrixCalls)
+		assert.Zero(t, mapsService.travelCalls)
+
+		// The plans are the same as looking up each leg on its own
+		repo, legByLeg, stops := fourStopFixture()
+		expected, err := NewRoutingService(repo, legByLeg, NewPricingService(), WithTravelMatrix(false)).PlanTrip(request(stops))
+		require.NoError(t, err)
+		assert.Equal(t, planSummary(expected), planSummary(plans))
+		assert.Greater(t, legByLeg.travelCalls, 3)
+	})
+
+	t.Run("Legs with no route in the matrix are looked up on their own", func(t *testing.T) {
+		repo, fake, stops := fourStopFixture()
+		hole := locationKey(&domain.Location{Lat: stops[0].Lat, Lng: stops[0].Lng}, &domain.Location{Lat: stops[1].Lat, Lng: stops[1].Lng})
+		mapsService := &holeyMapsService{fakeMapsService: fake, hole: hole}
+
+		plans, err := NewRoutingService(repo, mapsService, NewPricingService()).PlanTrip(request(stops))
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+		assert.Equal(t, 1, fake.matrixCalls)
+		require.NotEmpty(t, mapsService.legs)
+		for _, leg := range mapsService.legs {
+			assert.Equal(t, hole, leg, "only the missing leg is looked up on its own")
+		}
+	})
+}
+
+func TestRoutingService_LocaleFormatsSavings(t *testing.T) {
+	repo, mapsService, stops := circuitousFixture()
+	routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+	plans, err := routing.PlanTrip(&domain.TripRequest{
+		Stops:       stops,
+		StartTime:   mustParseTime(t, "2024-01-15T16:30:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		Locale:      "fr-CA",
+	})
+	require.NoError(t, err)
+
+	cheapest := findPlan(plans, "cheapest")
+	fastest := findPlan(plans, "fastest")
+	require.NotNil(t, cheapest)
+	require.NotNil(t, fastest)
+
+	expected := FormatCurrency(fastest.TotalCost-cheapest.TotalCost, "fr-CA") + " vs fastest"
+	assert.Equal(t, expected, cheapest.Metadata["savings"])
+	assert.Contains(t, cheapest.Metadata["savings"], ",")
+	assert.Contains(t, cheapest.Metadata["savings"], " $ vs fastest")
+}
+
+func TestRoutingService_AllowSplitVisit(t *testing.T) {
+	// Only two-hour meters serve a five-hour visit to stop A
+	repo := &fakeParkingRepository{
+		meters: []*domain.ParkingMeter{
+			{MeterID: "A1", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 2.00, TimeLimitMF9A6P: 2},
+			{MeterID: "A2", Lat: 49.2826, Lng: -123.1207, RateMF9A6P: 2.50, TimeLimitMF9A6P: 2},
+			{MeterID: "B1", Lat: 49.3001, Lng: -123.1207, RateMF9A6P: 1.00, TimeLimitMF9A6P: 2},
+		},
+	}
+	stops := []domain.Stop{
+		{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 300},
+		{ID: "b", Address: "Stop B", Lat: 49.3000, Lng: -123.1207, Duration: 30},
+	}
+	request := &domain.TripRequest{
+		Stops:       stops,
+		StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	}
+
+	t.Run("Without splitting no route is feasible", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+		plans, err := routing.PlanTrip(request)
+		require.NoError(t, err)
+		assert.Empty(t, plans)
+	})
+
+	t.Run("Splitting re-parks after each time limit", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+		splitRequest := *request
+		splitRequest.AllowSplitVisit = true
+
+		plans, err := routing.PlanTrip(&splitRequest)
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+
+		segment := plans[0].Route[0]
+		require.Len(t, segment.Sittings, 3)
+		assert.Equal(t, true, segment.Metadata["move_required"])
+		assert.Equal(t, 2, segment.Metadata["moves"])
+
+		var ids []string
+		minutes := 0
+		for _, sitting := range segment.Sittings {
+			ids = append(ids, sitting.ParkingMeter.MeterID)
+			minutes += sitting.Minutes
+		}
+		assert.Equal(t, []string{"A1", "A2", "A1"}, ids)
+		assert.Equal(t, 300, minutes)
+		assert.Equal(t, "2024-01-15T12:00:00-08:00", segment.Sittings[1].StartTime.Format(time.RFC3339))
+
+		// 2h @ $2.00 + 2h @ $2.50 + 1h @ $2.00
+		assert.InDelta(t, 11.00, segment.ParkingCost, 0.01)
+		assert.InDelta(t, 11.00+0.50, plans[0].TotalCost, 0.01)
+	})
+}
+
+func TestRoutingService_FixedArrival(t *testing.T) {
+	t.Run("Schedules around a fixed middle stop", func(t *testing.T) {
+		repo, mapsService, stops := circuitousFixture()
+		stops[1].FixedArrival = mustParseTime(t, "2024-01-15T11:00:00-08:00")
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+		plans, err := routing.PlanTrip(&domain.TripRequest{
+			StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+			Stops:       stops,
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+
+		for _, plan := range plans {
+			// Visiting C first would reach B late, so B stays in the middle
+			require.Equal(t, []string{"a", "b", "c"}, stopOrder(plan))
+			fixed := plan.Route[1]
+			assert.True(t, fixed.ArrivalTime.Equal(stops[1].FixedArrival))
+			assert.Greater(t, fixed.Metadata["wait_minutes"], 0)
+
+			// The stop after the appointment is timed from the fixed arrival
+			expected := fixed.ArrivalTime.Add(time.Duration(fixed.WalkingTime+60+10) * time.Minute)
+			assert.True(t, plan.Route[2].ArrivalTime.Equal(expected))
+		}
+	})
+
+	t.Run("Fails clearly when the fixed arrival can't be met", func(t *testing.T) {
+		repo, mapsService, stops := circuitousFixture()
+		stops[1].FixedArrival = mustParseTime(t, "2024-01-15T10:20:00-08:00")
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+		_, err := routing.PlanTrip(&domain.TripRequest{
+			StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+			Stops:       stops,
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		})
+		require.ErrorIs(t, err, ErrFixedArrivalInfeasible)
+		assert.Contains(t, err.Error(), "Stop B")
+	})
+}
+
+func TestRoutingService_EarliestFinish(t *testing.T) {
+	stops := []domain.Stop{
+		{ID: "a", Address: "Stop A", Lat: 49.2800, Lng: -123.1200, Duration: 30},
+		{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1200, Duration: 60},
+		{ID: "c", Address: "Stop C", Lat: 49.2800, Lng: -123.1000, Duration: 30},
+	}
+	repo := &fakeParkingRepository{}
+	for _, stop := range stops {
+		repo.meters = append(repo.meters, &domain.ParkingMeter{MeterID: "M" + stop.ID, Lat: stop.Lat + 0.0001, Lng: stop.Lng, RateMF9A6P: 2.00})
+	}
+	location := func(stop domain.Stop) *domain.Location { return &domain.Location{Lat: stop.Lat, Lng: stop.Lng} }
+	mapsService := &fakeMapsService{travelMinutes: 10, travelTimes: map[string]int{
+		locationKey(location(stops[0]), location(stops[2])): 5,
+	}}
+	routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+	request := func(stops []domain.Stop) *domain.TripRequest {
+		return &domain.TripRequest{
+			StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+			Stops:       stops,
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		}
+	}
+
+	t.Run("Waiting for a fixed arrival makes the fastest plan finish later", func(t *testing.T) {
+		waiting := append([]domain.Stop{}, stops...)
+		waiting[2].FixedArrival = mustParseTime(t, "2024-01-15T12:00:00-08:00")
+
+		plans, err := routing.PlanTrip(request(waiting))
+		require.NoError(t, err)
+
+		// Heading to C first drives least, but then waits until noon for it
+		fastest := findPlan(plans, "fastest")
+		require.NotNil(t, fastest)
+		assert.Equal(t, []string{"a", "c", "b"}, stopOrder(fastest))
+
+		// Visiting B while waiting for C's slot finishes over an hour sooner
+		finish := findPlan(plans, EarliestFinishPlanType)
+		require.NotNil(t, finish)
+		assert.Equal(t, []string{"a", "b", "c"}, stopOrder(finish))
+		assert.Greater(t, finish.TotalTime, fastest.TotalTime, "more active minutes")
+		assert.Equal(t, "70 minutes vs fastest", finish.Metadata["finish_saved"])
+	})
+
+	t.Run("Left out when the fastest plan also finishes first", func(t *testing.T) {
+		plans, err := routing.PlanTrip(request(stops))
+		require.NoError(t, err)
+		assert.Len(t, plans, 3)
+		assert.Nil(t, findPlan(plans, EarliestFinishPlanType))
+	})
+}
+
+func TestRoutingService_MostReliable(t *testing.T) {
+	stops := []domain.Stop{
+		{ID: "a", Address: "Stop A", Lat: 49.2800, Lng: -123.1200, Duration: 30},
+		{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1200, Duration: 60},
+		{ID: "c", Address: "Stop C", Lat: 49.2800, Lng: -123.1000, Duration: 30},
+	}
+	repo := &fakeParkingRepository{}
+	for _, stop := range stops {
+		repo.meters = append(repo.meters, &domain.ParkingMeter{MeterID: "M" + stop.ID, Lat: stop.Lat + 0.0001, Lng: stop.Lng, RateMF9A6P: 2.00})
+	}
+	location := func(stop domain.Stop) *domain.Location { return &domain.Location{Lat: stop.Lat, Lng: stop.Lng} }
+	mapsService := &fakeMapsService{travelMinutes: 10, travelTimes: map[string]int{
+		locationKey(location(stops[0]), location(stops[2])): 5,
+	}}
+	routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+	request := func(stops []domain.Stop) *domain.TripRequest {
+		return &domain.TripRequest{
+			StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+			Stops:       stops,
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		}
+	}
+
+	t.Run("Trades a few minutes for a larger buffer", func(t *testing.T) {
+		windowed := append([]domain.Stop{}, stops...)
+		windowed[1].LatestDeparture = mustParseTime(t, "2024-01-15T12:20:00-08:00")
+		windowed[2].LatestDeparture = mustParseTime(t, "2024-01-15T13:00:00-08:00")
+
+		plans, err := routing.PlanTrip(request(windowed))
+		require.NoError(t, err)
+
+		// Heading to C first drives least, but only just makes B's closing time
+		fastest := findPlan(plans, "fastest")
+		require.NotNil(t, fastest)
+		assert.Equal(t, []string{"a", "c", "b"}, stopOrder(fastest))
+
+		// Visiting B first drives five minutes more and leaves room at both stops
+		reliable := findPlan(plans, MostReliablePlanType)
+		require.NotNil(t, reliable)
+		assert.Equal(t, []string{"a", "b", "c"}, stopOrder(reliable))
+		assert.Equal(t, fastest.TotalTime+5, reliable.TotalTime)
+
+		// B ends 40 minutes before closing, against 5 minutes on the fastest plan
+		assert.Equal(t, 40, reliable.Metadata["min_slack_minutes"])
+		assert.Equal(t, "35 minutes vs fastest", reliable.Metadata["buffer_gained"])
+		assert.Equal(t, "reliability", reliable.Metadata["optimization"])
+	})
+
+	t.Run("Left out without time windows", func(t *testing.T) {
+		plans, err := routing.PlanTrip(request(stops))
+		require.NoError(t, err)
+		assert.Nil(t, findPlan(plans, MostReliablePlanType))
+	})
+}
+
+func TestRoutingService_FreeParking(t *testing.T) {
+	repo, stops := twoStopFixture()
+	stops[0].FreeParking = true
+	routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+
+	plans, err := routing.PlanTrip(&domain.TripRequest{
+		StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+		Stops:       stops,
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	})
+	require.NoError(t, err)
+
+	for _, plan := range plans {
+		require.Len(t, plan.Route, 2, plan.Type)
+		for _, segment := range plan.Route {
+			if segment.ToStop.ID == "a" {
+				// Home has its own parking: no meter, no cost and no walk
+				assert.Nil(t, segment.ParkingMeter, plan.Type)
+				assert.Zero(t, segment.ParkingCost, plan.Type)
+				assert.Zero(t, segment.WalkingTime, plan.Type)
+				assert.Equal(t, true, segment.Metadata["free_parking"], plan.Type)
+				continue
+			}
+			require.NotNil(t, segment.ParkingMeter, plan.Type)
+			assert.Equal(t, "B1", segment.ParkingMeter.MeterID, plan.Type)
+			assert.Greater(t, segment.ParkingCost, 0.0, plan.Type)
+		}
+		assert.Equal(t, plan.Route[0].ParkingCost+plan.Route[1].ParkingCost, plan.TotalCost, plan.Type)
+	}
+}
+
+func TestRoutingService_TravelTimeBounds(t *testing.T) {
+	// The stops are about a kilometre apart, but the maps service says driving
+	// between them takes ten hours
+	repo, stops := twoStopFixture()
+	mapsService := &fakeMapsService{travelMinutes: 600}
+	request := &domain.TripRequest{
+		StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+		Stops:       stops,
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	}
+	drive := func(plan *domain.TripPlan) int {
+		for _, segment := range plan.Route {
+			if segment.FromStop != nil {
+				return segment.TravelTime
+			}
+		}
+		return 0
+	}
+
+	t.Run("Not checked by default", func(t *testing.T) {
+		plans, err := NewRoutingService(repo, mapsService, NewPricingService()).PlanTrip(request)
+		require.NoError(t, err)
+		assert.Nil(t, plans[0].Metadata["warnings"])
+		assert.Equal(t, 600, drive(plans[0]))
+	})
+
+	t.Run("Flagged", func(t *testing.T) {
+		routing := NewRoutingService(repo, mapsService, NewPricingService(), WithTravelTimeBounds(DefaultTravelTimeBounds))
+		plans, err := routing.PlanTrip(request)
+		require.NoError(t, err)
+
+		warnings, ok := plans[0].Metadata["warnings"].([]string)
+		require.True(t, ok)
+		require.NotEmpty(t, warnings)
+		assert.Contains(t, warnings[0], "600-minute drive over 1.1 km looks implausible")
+		assert.Equal(t, 600, drive(plans[0]), "flagging keeps the time")
+	})
+
+	t.Run("Estimated", func(t *testing.T) {
+		bounds := DefaultTravelTimeBounds
+		bounds.Policy = ImplausibleTravelEstimate
+		routing := NewRoutingService(repo, mapsService, NewPricingService(), WithTravelTimeBounds(bounds))
+		plans, err := routing.PlanTrip(request)
+		require.NoError(t, err)
+
+		estimate := maps.EstimateDrivingTime(&domain.Location{Lat: stops[0].Lat, Lng: stops[0].Lng}, &domain.Location{Lat: stops[1].Lat, Lng: stops[1].Lng})
+		assert.Equal(t, estimate, drive(plans[0]))
+		assert.Contains(t, plans[0].Metadata["warnings"], fmt.Sprintf("a 600-minute drive over 1.1 km looks implausible; estimated %d minutes instead", estimate))
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		bounds := DefaultTravelTimeBounds
+		bounds.Policy = ImplausibleTravelReject
+		routing := NewRoutingService(repo, mapsService, NewPricingService(), WithTravelTimeBounds(bounds))
+		plans, err := routing.PlanTrip(request)
+		require.NoError(t, err)
+		assert.Empty(t, plans, "no leg between the stops is left")
+	})
+
+	t.Run("Plausible times pass", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 5}, NewPricingService(), WithTravelTimeBounds(DefaultTravelTimeBounds))
+		plans, err := routing.PlanTrip(request)
+		require.NoError(t, err)
+		assert.Nil(t, plans[0].Metadata["warnings"])
+	})
+}
+
+func TestRoutingService_StartTimeMeaning(t *testing.T) {
+	repo, stops := twoStopFixture()
+	routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+	start := mustParseTime(t, "2025-01-15T14:00:00-08:00")
+
+	plan := func(meaning string) []*domain.TripPlan {
+		plans, err := routing.PlanTrip(&domain.TripRequest{
+			Stops:              append([]domain.Stop{}, stops...),
+			StartTime:          start,
+			Origin:             &domain.Origin{Lat: 49.2750, Lng: -123.1150},
+			Preferences:        domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+			TravelTimeVariance: 0.2,
+			StartTimeMeaning:   meaning,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+		return plans
+	}
+
+	t.Run("Departing the origin by default", func(t *testing.T) {
+		for _, plan := range plan("") {
+			first := plan.Route[0]
+			require.True(t, first.FromStop.IsOrigin)
+			assert.True(t, first.ArrivalTime.Equal(start.Add(10*time.Minute)))
+		}
+	})
+
+	t.Run("Arriving at the first stop", func(t *testing.T) {
+		for _, plan := range plan(domain.StartTimeArriveFirstStop) {
+			first := plan.Route[0]
+			require.True(t, first.FromStop.IsOrigin)
+			assert.True(t, first.ArrivalTime.Equal(start), "reaches the first stop at %s", first.ArrivalTime)
+			assert.True(t, first.FromStop.DepartureTime.Equal(start.Add(-10*time.Minute)))
+
+			// The cost range replays the route from the same departure, so it
+			// brackets the plan's cost
+			assert.LessOrEqual(t, plan.Metadata["cost_low"], plan.TotalCost)
+			assert.GreaterOrEqual(t, plan.Metadata["cost_high"], plan.TotalCost)
+		}
+	})
+}
+
+func TestRoutingService_MeterAlternatives(t *testing.T) {
+	repo, mapsService, stops := circuitousFixture()
+	repo.meters = append(repo.meters,
+		&domain.ParkingMeter{MeterID: "MA2", Lat: 49.2805, Lng: -123.1200, RateMF9A6P: 2.00, RateMF6P10: 1.00},
+		&domain.ParkingMeter{MeterID: "MB2", Lat: 49.3005, Lng: -123.1200, RateMF9A6P: 3.00, RateMF6P10: 1.00},
+		&domain.ParkingMeter{MeterID: "MC2", Lat: 49.3205, Lng: -123.1200, RateMF9A6P: 2.00, RateMF6P10: 1.00},
+		&domain.ParkingMeter{MeterID: "MC3", Lat: 49.3210, Lng: -123.1200, RateMF9A6P: 2.50, RateMF6P10: 1.00},
+		&domain.ParkingMeter{MeterID: "MC4", Lat: 49.3215, Lng: -123.1200, RateMF9A6P: 3.00, RateMF6P10: 1.00},
+	)
+	routing := NewRoutingService(repo, mapsService, NewPricingService(), WithMeterClustering(0, 0))
+
+	plans, err := routing.PlanTrip(&domain.TripRequest{
+		StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+		Stops:       stops,
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, plans)
+
+	for _, plan := range plans {
+		for _, segment := range plan.Route {
+			alternatives, ok := segment.Metadata["alternatives"].([]domain.MeterAlternative)
+			require.True(t, ok, "segment to %s has no alternatives", segment.ToStop.ID)
+			require.NotEmpty(t, alternatives)
+			assert.LessOrEqual(t, len(alternatives), 2)
+
+			for _, alternative := range alternatives {
+				assert.NotEqual(t, segment.ParkingMeter.MeterID, alternative.MeterID)
+				assert.GreaterOrEqual(t, alternative.ParkingCost, segment.ParkingCost)
+			}
+		}
+	}
+
+	// Stop C has four meters in range; the backups are the next two cheapest
+	cheapest := findPlan(plans, "cheapest")
+	for _, segment := range cheapest.Route {
+		if segment.ToStop.ID == "c" {
+			alternatives := segment.Metadata["alternatives"].([]domain.MeterAlternative)
+			require.Len(t, alternatives, 2)
+			assert.Equal(t, "MC2", alternatives[0].MeterID)
+			assert.Equal(t, "MC3", alternatives[1].MeterID)
+		}
+	}
+}
+
+func TestRoutingService_ParkingLeadTime(t *testing.T) {
+	repo, stops := twoStopFixture()
+	request := &domain.TripRequest{
+		// Arrive at A just after the 6 PM switch to the $1.00 evening rate
+		StartTime:   mustParseTime(t, "2024-01-15T18:02:00-08:00"),
+		Stops:       stops,
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	}
+
+	tests := []struct {
+		name         string
+		leadMinutes  int
+		expectedCost float64
+	}{
+		{
+			name:         "No lead prices from arrival",
+			leadMinutes:  0,
+			expectedCost: 0.50, // 30 minutes at $1.00/hr
+		},
+		{
+			name:         "Five minute lead starts in the daytime window",
+			leadMinutes:  5,
+			expectedCost: 0.73, // 3 minutes at $4.00/hr + 32 minutes at $1.00/hr
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService(),
+				WithParkingLeadTime(tt.leadMinutes))
+
+			plans, err := routing.PlanTrip(request)
+			require.NoError(t, err)
+			require.NotEmpty(t, plans)
+
+			first := plans[0].Route[0]
+			require.Equal(t, "a", first.ToStop.ID)
+			assert.InDelta(t, tt.expectedCost, first.ParkingCost, 0.01)
+		})
+	}
+}
+
+func TestRoutingService_CoincidentStops(t *testing.T) {
+	sameBuildingFixture := func(timeLimit int) (*fakeParkingRepository, *fakeMapsService, []domain.Stop) {
+		stops := []domain.Stop{
+			{ID: "a", Address: "Stop A", Lat: 49.2800, Lng: -123.1200, Duration: 30},
+			{ID: "dentist", Address: "Suite 100, 1 Tower", Lat: 49.3000, Lng: -123.1200, Duration: 30},
+			{ID: "lawyer", Address: "Suite 900, 1 Tower", Lat: 49.3000, Lng: -123.1200, Duration: 45},
+		}
+		repo := &fakeParkingRepository{
+			meters: []*domain.ParkingMeter{
+				{MeterID: "MA", Lat: 49.2801, Lng: -123.1200, RateMF9A6P: 1.00},
+				{MeterID: "TOWER", Lat: 49.3010, Lng: -123.1200, RateMF9A6P: 4.00, TimeLimitMF9A6P: timeLimit},
+			},
+		}
+		mapsService := &fakeMapsService{travelMinutes: 10}
+		// Any travel time between the two suites would be wrong; they share a building
+		mapsService.setTravelTime(stops[1], stops[2], 99)
+		mapsService.setTravelTime(stops[2], stops[1], 99)
+		return repo, mapsService, stops
+	}
+
+	request := func(stops []domain.Stop) *domain.TripRequest {
+		return &domain.TripRequest{
+			StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+			Stops:       stops,
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		}
+	}
+
+	t.Run("Shares one park with combined dwell", func(t *testing.T) {
+		repo, mapsService, stops := sameBuildingFixture(3)
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+		plans, err := routing.PlanTrip(request(stops))
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+
+		for _, plan := range plans {
+			require.Len(t, plan.Route, 3)
+			first, second := plan.Route[1], plan.Route[2]
+
+			assert.Equal(t, "TOWER", first.ParkingMeter.MeterID)
+			assert.Equal(t, first.ParkingMeter, second.ParkingMeter)
+			assert.Equal(t, 0, second.TravelTime)
+			assert.Equal(t, 0, second.WalkingTime)
+			assert.Equal(t, true, second.Metadata["shared_parking"])
+
+			// One continuous park from arriving at the tower to leaving it
+			parkedMinutes := first.WalkingTime + 30 + 45
+			assert.InDelta(t, 4.00*float64(parkedMinutes)/60.0, first.ParkingCost+second.ParkingCost, 0.01)
+			assert.InDelta(t, first.ParkingCost+second.ParkingCost+plan.Route[0].ParkingCost, plan.TotalCost, 0.01)
+		}
+	})
+
+	t.Run("Parks again when the combined dwell exceeds the time limit", func(t *testing.T) {
+		repo, mapsService, stops := sameBuildingFixture(1)
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+		plans, err := routing.PlanTrip(request(stops))
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+
+		for _, plan := range plans {
+			second := plan.Route[2]
+			assert.Nil(t, second.Metadata["shared_parking"])
+			assert.Equal(t, 0, second.TravelTime)
+			assert.Equal(t, "TOWER", second.ParkingMeter.MeterID)
+		}
+	})
+}
+
+func TestRoutingService_OptionalStops(t *testing.T) {
+	stops := []domain.Stop{
+		{ID: "a", Address: "Stop A", Lat: 49.2800, Lng: -123.1200, Duration: 30},
+		{ID: "gym", Address: "Gym", Lat: 49.3000, Lng: -123.1200, Duration: 30, Optional: true},
+		{ID: "b", Address: "Stop B", Lat: 49.3200, Lng: -123.1200, Duration: 30},
+	}
+	repo := &fakeParkingRepository{
+		meters: []*domain.ParkingMeter{
+			{MeterID: "MA", Lat: 49.2801, Lng: -123.1200, RateMF9A6P: 1.00},
+			{MeterID: "MGYM", Lat: 49.3001, Lng: -123.1200, RateMF9A6P: 10.00},
+			{MeterID: "MB", Lat: 49.3201, Lng: -123.1200, RateMF9A6P: 1.00},
+		},
+	}
+	// The gym sits on a quick route that avoids the slow direct drive from A to B
+	mapsService := &fakeMapsService{travelMinutes: 40}
+	mapsService.setTravelTime(stops[0], stops[1], 5)
+	mapsService.setTravelTime(stops[1], stops[2], 5)
+	routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+	plans, err := routing.PlanTrip(&domain.TripRequest{
+		StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+		Stops:       stops,
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	})
+	require.NoError(t, err)
+
+	cheapest := findPlan(plans, "cheapest")
+	require.NotNil(t, cheapest)
+	assert.Equal(t, []string{"a", "b"}, stopOrder(cheapest))
+	assert.Equal(t, []string{"gym"}, cheapest.Metadata["dropped_stops"])
+
+	fastest := findPlan(plans, "fastest")
+	require.NotNil(t, fastest)
+	assert.Equal(t, []string{"a", "gym", "b"}, stopOrder(fastest))
+	assert.NotContains(t, fastest.Metadata, "dropped_stops")
+}
+
+func TestRoutingService_DeterministicPlans(t *testing.T) {
+	// Identically priced meters equidistant from each stop, so only the meter ID
+	// tiebreak decides which one is chosen
+	meters := []*domain.ParkingMeter{
+		{MeterID: "A2", Lat: 49.2829, Lng: -123.1207, RateMF9A6P: 4.00, RateMF6P10: 1.00},
+		{MeterID: "A1", Lat: 49.2825, Lng: -123.1207, RateMF9A6P: 4.00, RateMF6P10: 1.00},
+		{MeterID: "B2", Lat: 49.2902, Lng: -123.1300, RateMF9A6P: 4.00, RateMF6P10: 1.00},
+		{MeterID: "B1", Lat: 49.2898, Lng: -123.1300, RateMF9A6P: 4.00, RateMF6P10: 1.00},
+		{MeterID: "C1", Lat: 49.2760, Lng: -123.1150, RateMF9A6P: 2.00, RateMF6P10: 1.00},
+	}
+	stops := []domain.Stop{
+		{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 30},
+		{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1300, Duration: 60},
+		{ID: "c", Address: "Stop C", Lat: 49.2760, Lng: -123.1150, Duration: 45},
+	}
+
+	plan := func(meters []*domain.ParkingMeter) []byte {
+		routing := NewRoutingService(&fakeParkingRepository{meters: meters}, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+		plans, err := routing.PlanTrip(&domain.TripRequest{
+			Stops:       append([]domain.Stop{}, stops...),
+			StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		})
+		require.NoError(t, err)
+		output, err := json.Marshal(plans)
+		require.NoError(t, err)
+		return output
+	}
+
+	first := plan(meters)
+	assert.Equal(t, string(first), string(plan(meters)))
+
+	// The repository returning meters in a different order must not change the plans
+	reversed := make([]*domain.ParkingMeter, len(meters))
+	for i, meter := range meters {
+		reversed[len(meters)-1-i] = meter
+	}
+	assert.Equal(t, string(first), string(plan(reversed)))
+	assert.Contains(t, string(first), `"A1"`)
+}
+
+func TestRoutingService_FirstStopParking(t *testing.T) {
+	repo, stops := twoStopFixture()
+	routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+
+	plans, err := routing.PlanTrip(&domain.TripRequest{
+		Stops:       stops,
+		StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	})
+	require.NoError(t, err)
+
+	for _, plan := range plans {
+		require.Len(t, plan.Route, 2, plan.Type)
+
+		// Without a separate origin the first stop is a destination in its own right
+		first := plan.Route[0]
+		assert.Nil(t, first.FromStop)
+		assert.Equal(t, "a", first.ToStop.ID)
+		require.NotNil(t, first.ParkingMeter)
+		assert.Equal(t, "A1", first.ParkingMeter.MeterID)
+		assert.InDelta(t, 2.00, first.ParkingCost, 0.001) // 30 minutes at $4.00/hour
+
+		total := 0.0
+		for _, segment := range plan.Route {
+			total += segment.ParkingCost
+		}
+		assert.InDelta(t, total, plan.TotalCost, 0.001)
+		assert.InDelta(t, 6.00, plan.TotalCost, 0.001) // plus 60 minutes at stop b
+	}
+}
+
+func TestRoutingService_ScoreFunc(t *testing.T) {
+	// Stop B's meter drops from $6.00 to $0.50 an hour at 6pm, so visiting it last
+	// is cheaper, but the roads make that order 40 minutes slower
+	a := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	b := &domain.Location{Lat: 49.2900, Lng: -123.1300}
+	c := &domain.Location{Lat: 49.2760, Lng: -123.1150}
+	repo := &fakeParkingRepository{
+		meters: []*domain.ParkingMeter{
+			{MeterID: "A1", Lat: a.Lat, Lng: a.Lng, RateMF9A6P: 1.00, RateMF6P10: 1.00},
+			{MeterID: "B1", Lat: b.Lat, Lng: b.Lng, RateMF9A6P: 6.00, RateMF6P10: 0.50},
+			{MeterID: "C1", Lat: c.Lat, Lng: c.Lng, RateMF9A6P: 1.00, RateMF6P10: 1.00},
+		},
+	}
+	stops := []domain.Stop{
+		{ID: "a", Address: "Stop A", Lat: a.Lat, Lng: a.Lng, Duration: 30},
+		{ID: "b", Address: "Stop B", Lat: b.Lat, Lng: b.Lng, Duration: 60},
+		{ID: "c", Address: "Stop C", Lat: c.Lat, Lng: c.Lng, Duration: 60},
+	}
+	newMaps := func() *fakeMapsService {
+		return &fakeMapsService{
+			travelMinutes: 10,
+			travelTimes: map[string]int{
+				locationKey(a, c): 30,
+				locationKey(c, b): 30,
+			},
+		}
+	}
+
+	hybridOrder := func(t *testing.T, opts ...RoutingOption) []string {
+		routing := NewRoutingService(repo, newMaps(), NewPricingService(), opts...)
+		plans, err := routing.PlanTrip(&domain.TripRequest{
+			Stops:       stops,
+			StartTime:   mustParseTime(t, "2025-01-13T17:00:00-08:00"), // Monday
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		})
+		require.NoError(t, err)
+
+		plan := findPlan(plans, "hybrid")
+		require.NotNil(t, plan)
+		var order []string
+		for _, segment := range plan.Route {
+			order = append(order, segment.ToStop.ID)
+		}
+		return order
+	}
+
+	t.Run("Default score favours the cheaper order", func(t *testing.T) {
+		assert.Equal(t, []string{"a", "c", "b"}, hybridOrder(t))
+	})
+
+	t.Run("Custom score can ignore cost", func(t *testing.T) {
+		// Time only, counting walking twice
+		timeOnly := func(cost float64, timeMinutes int, walkingMinutes int, prefs domain.Preferences) float64 {
+			return float64(timeMinutes + walkingMinutes)
+		}
+
+		assert.Equal(t, []string{"a", "b", "c"}, hybridOrder(t, WithScoreFunc(timeOnly)))
+	})
+}
+
+// fakeReverseGeocoder names locations from a lookup table, counting calls
+type fakeReverseGeocoder struct {
+	addresses map[string]string
+	calls     int
+}
+
+func (g *fakeReverseGeocoder) ReverseGeocode(location *domain.Location) (string, error) {
+	g.calls++
+	if address, ok := g.addresses[fmt.Sprintf("%.4f,%.4f", location.Lat, location.Lng)]; ok {
+		return address, nil
+	}
+	return "", fmt.Errorf("%w for location", maps.ErrNoResults)
+}
+
+func TestRoutingService_ReverseGeocoding(t *testing.T) {
+	repo, stops := twoStopFixture()
+	stops[1].Address = "" // coordinates only
+
+	request := func() *domain.TripRequest {
+		return &domain.TripRequest{
+			Stops:       append([]domain.Stop{}, stops...),
+			StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		}
+	}
+
+	t.Run("Off by default", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+		plans, err := routing.PlanTrip(request())
+		require.NoError(t, err)
+		assert.Equal(t, "", plans[0].Route[1].ToStop.Address)
+	})
+
+	t.Run("Coordinate-only stops get a display address", func(t *testing.T) {
+		geocoder := &fakeReverseGeocoder{addresses: map[string]string{
+			"49.2900,-123.1300": "1100 W Georgia St, Vancouver, BC",
+		}}
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService(), WithReverseGeocoding(geocoder))
+
+		plans, err := routing.PlanTrip(request())
+		require.NoError(t, err)
+		for _, plan := range plans {
+			assert.Equal(t, "Stop A", plan.Route[0].ToStop.Address)
+			assert.Equal(t, "1100 W Georgia St, Vancouver, BC", plan.Route[1].ToStop.Address)
+		}
+		assert.Equal(t, 1, geocoder.calls)
+
+		// Repeat plans reuse the cached address
+		_, err = routing.PlanTrip(request())
+		require.NoError(t, err)
+		assert.Equal(t, 1, geocoder.calls)
+	})
+
+	t.Run("Lookup failures leave the address empty", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService(),
+			WithReverseGeocoding(&fakeReverseGeocoder{}))
+		plans, err := routing.PlanTrip(request())
+		require.NoError(t, err)
+		assert.Equal(t, "", plans[0].Route[1].ToStop.Address)
+	})
+}
+
+// fakeRoadSnapper snaps locations from a lookup table, counting calls
+type fakeRoadSnapper struct {
+	roads map[string]*domain.Location
+	calls int
+}
+
+func (r *fakeRoadSnapper) SnapToRoad(location *domain.Location) (*domain.Location, error) {
+	r.calls++
+	if road, ok := r.roads[fmt.Sprintf("%.4f,%.4f", location.Lat, location.Lng)]; ok {
+		return road, nil
+	}
+	return nil, fmt.Errorf("%w: no road near location", maps.ErrNoResults)
+}
+
+func TestRoutingService_RoadSnapping(t *testing.T) {
+	repo, stops := twoStopFixture()
+	stops[1].Address = "" // coordinates only, inside a building
+	request := func() *domain.TripRequest {
+		return &domain.TripRequest{
+			Stops:       append([]domain.Stop{}, stops...),
+			StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		}
+	}
+
+	t.Run("Off-road coordinates move to the road", func(t *testing.T) {
+		snapper := &fakeRoadSnapper{roads: map[string]*domain.Location{
+			"49.2900,-123.1300": {Lat: 49.29035, Lng: -123.13010},
+		}}
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService(), WithRoadSnapping(snapper))
+
+		plans, err := routing.PlanTrip(request())
+		require.NoError(t, err)
+		for _, plan := range plans {
+			assert.Equal(t, 49.2827, plan.Route[0].ToStop.Lat, "stops with an address are left alone")
+			assert.Equal(t, 49.29035, plan.Route[1].ToStop.Lat)
+			assert.Equal(t, -123.13010, plan.Route[1].ToStop.Lng)
+		}
+		assert.Equal(t, 1, snapper.calls)
+	})
+
+	t.Run("Failures keep the raw coordinates", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService(), WithRoadSnapping(&fakeRoadSnapper{}))
+
+		plans, err := routing.PlanTrip(request())
+		require.NoError(t, err)
+		assert.Equal(t, 49.2900, plans[0].Route[1].ToStop.Lat)
+		assert.Equal(t, -123.1300, plans[0].Route[1].ToStop.Lng)
+	})
+}
+
+// fakeRateHistory reports fixed rate changes by meter ID
+type fakeRateHistory map[string]float64
+
+func (h fakeRateHistory) RateChange(meterID string, period time.Duration) (float64, bool, error) {
+	change, ok := h[meterID]
+	return change, ok, nil
+}
+
+func TestRoutingService_RateTrends(t *testing.T) {
+	repo, stops := twoStopFixture()
+	request := &domain.TripRequest{
+		Stops:       stops,
+		StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	}
+
+	t.Run("No history by default", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+		plans, err := routing.PlanTrip(request)
+		require.NoError(t, err)
+		for _, segment := range plans[0].Route {
+			assert.NotContains(t, segment.Metadata, "rate_trend")
+		}
+	})
+
+	t.Run("Known trends surface on the segment", func(t *testing.T) {
+		history := fakeRateHistory{"A1": 0.50, "B1": -0.25}
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService(), WithRateHistory(history))
+		plans, err := routing.PlanTrip(request)
+		require.NoError(t, err)
+		for _, plan := range plans {
+			require.Len(t, plan.Route, 2)
+			assert.Equal(t, "rate increased $0.50 in the last year", plan.Route[0].Metadata["rate_trend"])
+			assert.Equal(t, "rate decreased $0.25 in the last year", plan.Route[1].Metadata["rate_trend"])
+		}
+	})
+
+	t.Run("Unchanged rates aren't noted", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService(), WithRateHistory(fakeRateHistory{"A1": 0}))
+		plans, err := routing.PlanTrip(request)
+		require.NoError(t, err)
+		assert.NotContains(t, plans[0].Route[0].Metadata, "rate_trend")
+	})
+}
+
+func TestRoutingService_ParkingSearchTime(t *testing.T) {
+	repo, stops := twoStopFixture()
+	repo.meters[0].LocalArea = "Downtown"
+	repo.meters[1].LocalArea = "West End"
+	request := &domain.TripRequest{
+		Stops:       stops,
+		StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	}
+
+	baseline, err := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService()).PlanTrip(request)
+	require.NoError(t, err)
+	for _, segment := range baseline[0].Route {
+		assert.NotContains(t, segment.Metadata, "circling_minutes")
+	}
+
+	routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService(),
+		WithParkingSearchTime(map[string]int{"Downtown": 8, "West End": 1}))
+	plans, err := routing.PlanTrip(request)
+	require.NoError(t, err)
+	require.Len(t, plans, len(baseline))
+	for i, plan := range plans {
+		// Downtown's 8 minutes and the West End's 1 minute
+		assert.Equal(t, baseline[i].TotalTime+9, plan.TotalTime)
+		require.Len(t, plan.Route, 2)
+		assert.Equal(t, 8, plan.Route[0].Metadata["circling_minutes"])
+		assert.Equal(t, 1, plan.Route[1].Metadata["circling_minutes"])
+		assert.Equal(t, baseline[i].Route[1].ArrivalTime.Add(8*time.Minute), plan.Route[1].ArrivalTime)
+	}
+}
+
+func TestRoutingService_AvoidZones(t *testing.T) {
+	repo, stops := twoStopFixture()
+	repo.meters = append(repo.meters,
+		&domain.ParkingMeter{MeterID: "B_CHEAP", Lat: 49.2905, Lng: -123.1300, RateMF9A6P: 1.00, RateMF6P10: 1.00})
+	routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+
+	plan := func(stops []domain.Stop, zones ...domain.Circle) ([]*domain.TripPlan, error) {
+		return routing.PlanTrip(&domain.TripRequest{
+			Stops:       stops,
+			StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+			AvoidZones:  zones,
+		})
+	}
+
+	t.Run("Cheapest meter is used without a zone", func(t *testing.T) {
+		plans, err := plan(stops)
+		require.NoError(t, err)
+		assert.Equal(t, "B_CHEAP", findPlan(plans, "cheapest").Route[1].ParkingMeter.MeterID)
+	})
+
+	t.Run("Zone rules out the cheapest meter", func(t *testing.T) {
+		plans, err := plan(stops, domain.Circle{Lat: 49.2905, Lng: -123.1300, RadiusKm: 0.03})
+		require.NoError(t, err)
+		for _, plan := range plans {
+			assert.Equal(t, "B1", plan.Route[1].ParkingMeter.MeterID)
+			assert.NotContains(t, plan.Metadata, "warnings")
+		}
+	})
+
+	// Covers both meters near stop B
+	everything := domain.Circle{Lat: 49.2900, Lng: -123.1300, RadiusKm: 0.2}
+
+	t.Run("Required stop with only avoided meters fails clearly", func(t *testing.T) {
+		_, err := plan(stops, everything)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrParkingInAvoidZone))
+		assert.Contains(t, err.Error(), "Stop B")
+	})
+
+	t.Run("Optional stop with only avoided meters is skipped with a warning", func(t *testing.T) {
+		optional := append([]domain.Stop{}, stops...)
+		optional = append(optional, domain.Stop{ID: "c", Address: "Stop C", Lat: 49.2830, Lng: -123.1210, Duration: 30})
+		optional[1].Optional = true
+
+		plans, err := plan(optional, everything)
+		require.NoError(t, err)
+		for _, plan := range plans {
+			assert.Equal(t, []string{"b"}, plan.Metadata["dropped_stops"])
+			assert.Equal(t, []string{"all parking near Stop B is inside an avoid zone"}, plan.Metadata["warnings"])
+		}
+	})
+}
+
+func TestRoutingService_PlanTripTopN(t *testing.T) {
+	repo, stops := twoStopFixture()
+	repo.meters = append(repo.meters,
+		&domain.ParkingMeter{MeterID: "C1", Lat: 49.2761, Lng: -123.1151, RateMF9A6P: 2.00, RateMF6P10: 1.00},
+		&domain.ParkingMeter{MeterID: "D1", Lat: 49.2851, Lng: -123.1401, RateMF9A6P: 3.00, RateMF6P10: 1.00},
+	)
+	stops = append(stops,
+		domain.Stop{ID: "c", Address: "Stop C", Lat: 49.2760, Lng: -123.1150, Duration: 45},
+		domain.Stop{ID: "d", Address: "Stop D", Lat: 49.2850, Lng: -123.1400, Duration: 20},
+	)
+	routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+
+	request := &domain.TripRequest{
+		Stops:       stops,
+		StartTime:   mustParseTime(t, "2025-01-15T16:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	}
+
+	t.Run("Returns N distinct orderings best first", func(t *testing.T) {
+		plans, err := routing.PlanTripTopN(request, 5)
+		require.NoError(t, err)
+		require.Len(t, plans, 5)
+
+		seen := make(map[string]bool)
+		for i, plan := range plans {
+			var order []string
+			for _, segment := range plan.Route {
+				order = append(order, segment.ToStop.ID)
+			}
+			key := fmt.Sprint(order)
+			assert.False(t, seen[key], "duplicate ordering %s", key)
+			seen[key] = true
+
+			assert.Equal(t, "ranked", plan.Type)
+			assert.Equal(t, i+1, plan.Metadata["rank"])
+			if i > 0 {
+				assert.GreaterOrEqual(t, plan.Metadata["hybrid_score"], plans[i-1].Metadata["hybrid_score"])
+			}
+		}
+	})
+
+	t.Run("Stops at the number of distinct orderings", func(t *testing.T) {
+		plans, err := routing.PlanTripTopN(request, 10)
+		require.NoError(t, err)
+		assert.Len(t, plans, 6) // the first stop is fixed, so 3! orderings
+	})
+
+	t.Run("N must be positive", func(t *testing.T) {
+		_, err := routing.PlanTripTopN(request, 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestRoutingService_PlanTripWindow(t *testing.T) {
+	repo, stops := twoStopFixture()
+	mapsService := &fakeMapsService{travelMinutes: 10}
+	routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+	request := &domain.TripRequest{
+		Stops:       stops,
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	}
+
+	t.Run("Picks the cheaper evening start", func(t *testing.T) {
+		mapsService.travelCalls = 0
+		window, err := routing.PlanTripWindow(request,
+			mustParseTime(t, "2025-01-15T17:00:00-08:00"),
+			mustParseTime(t, "2025-01-15T18:30:00-08:00"),
+			30*time.Minute,
+		)
+		require.NoError(t, err)
+
+		assert.True(t, window.StartTime.Equal(mustParseTime(t, "2025-01-15T18:00:00-08:00")),
+			"expected the first evening start, got %s", window.StartTime)
+		require.Len(t, window.Starts, 4)
+		assert.Less(t, window.Plan.TotalCost, window.Starts[0].TotalCost)
+		assert.Equal(t, window.Plan.TotalCost, window.Starts[2].TotalCost)
+
+		// Only the first start looks up travel times; the rest reuse them
+		single := &fakeMapsService{travelMinutes: 10}
+		_, err = NewRoutingService(repo, single, NewPricingService()).PlanTrip(&domain.TripRequest{
+			Stops:       stops,
+			StartTime:   mustParseTime(t, "2025-01-15T17:00:00-08:00"),
+			Preferences: request.Preferences,
+		})
+		require.NoError(t, err)
+		assert.LessOrEqual(t, mapsService.travelCalls, single.travelCalls)
+		assert.LessOrEqual(t, mapsService.matrixCalls, single.matrixCalls)
+	})
+
+	t.Run("Rejects an inverted window", func(t *testing.T) {
+		_, err := routing.PlanTripWindow(request,
+			mustParseTime(t, "2025-01-15T18:00:00-08:00"),
+			mustParseTime(t, "2025-01-15T17:00:00-08:00"),
+			DefaultWindowInterval,
+		)
+		assert.Error(t, err)
+	})
+
+	t.Run("Rejects too many start times", func(t *testing.T) {
+		_, err := routing.PlanTripWindow(request,
+			mustParseTime(t, "2025-01-15T00:00:00-08:00"),
+			mustParseTime(t, "2025-01-15T23:00:00-08:00"),
+			time.Minute,
+		)
+		assert.Error(t, err)
+	})
+}
+
+// shapingMapsService records the features it was asked to avoid
+type shapingMapsService struct {
+	*fakeMapsService
+	avoided [][]string
+}
+
+func (m *shapingMapsService) WithAvoid(features []string) (maps.MapsService, error) {
+	m.avoided = append(m.avoided, features)
+	return m.fakeMapsService, nil
+}
+
+func TestRoutingService_Avoid(t *testing.T) {
+	repo, stops := twoStopFixture()
+	request := &domain.TripRequest{
+		Stops:       stops,
+		StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		Avoid:       []string{"tolls", "highways"},
+	}
+
+	t.Run("Passes avoid to the maps provider", func(t *testing.T) {
+		mapsService := &shapingMapsService{fakeMapsService: &fakeMapsService{travelMinutes: 10}}
+		plans, err := NewRoutingService(repo, mapsService, NewPricingService()).PlanTrip(request)
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+
+		assert.Equal(t, [][]string{{"tolls", "highways"}}, mapsService.avoided)
+		assert.Nil(t, plans[0].Metadata["warnings"])
+	})
+
+	t.Run("Warns when the provider can't avoid", func(t *testing.T) {
+		plans, err := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService()).PlanTrip(request)
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+		assert.NotEmpty(t, plans[0].Metadata["warnings"])
+	})
+
+	t.Run("Rejects unknown features", func(t *testing.T) {
+		invalid := *request
+		invalid.Avoid = []string{"left_turns"}
+		_, err := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService()).PlanTrip(&invalid)
+		assert.Error(t, err)
+	})
+}
+
+// modalMapsService times legs in other modes with a service of their own
+type modalMapsService struct {
+	*fakeMapsService
+	modes map[string]*fakeMapsService
+}
+
+func (m *modalMapsService) WithTravelMode(mode string) (maps.MapsService, error) {
+	return m.modes[mode], nil
+}
+
+func TestRoutingService_TravelMode(t *testing.T) {
+	repo, stops := twoStopFixture()
+	request := &domain.TripRequest{
+		Stops:       stops,
+		StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		TravelMode:  maps.TravelModeBicycling,
+	}
+
+	t.Run("Bicycling skips parking", func(t *testing.T) {
+		mapsService := &modalMapsService{
+			fakeMapsService: &fakeMapsService{travelMinutes: 10},
+			modes:           map[string]*fakeMapsService{maps.TravelModeBicycling: {travelMinutes: 25}},
+		}
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+		plans, err := routing.PlanTrip(request)
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+
+		for _, plan := range plans {
+			assert.Zero(t, plan.TotalCost, plan.Type)
+			for _, segment := range plan.Route {
+				assert.Nil(t, segment.ParkingMeter, plan.Type)
+				assert.Zero(t, segment.ParkingCost, plan.Type)
+				assert.Zero(t, segment.WalkingTime, plan.Type)
+				assert.Equal(t, maps.TravelModeBicycling, segment.Metadata["travel_mode"], plan.Type)
+				if segment.FromStop != nil {
+					assert.Equal(t, 25, segment.TravelTime, plan.Type)
+				}
+			}
+		}
+		assert.Zero(t, mapsService.travelCalls+mapsService.matrixCalls)
+		assert.Equal(t, []string{"driving", "bicycling", "transit"}, routing.TravelModes())
+	})
+
+	t.Run("Rejected when the provider only drives", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+		_, err := routing.PlanTrip(request)
+		assert.ErrorIs(t, err, ErrTravelModeUnsupported)
+		assert.Equal(t, []string{"driving"}, routing.TravelModes())
+	})
+
+	t.Run("Transit legs are timed at their own departure", func(t *testing.T) {
+		transit := &fakeMapsService{travelMinutes: 20}
+		mapsService := &modalMapsService{
+			fakeMapsService: &fakeMapsService{travelMinutes: 10},
+			modes:           map[string]*fakeMapsService{maps.TravelModeTransit: transit},
+		}
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+		transitRequest := *request
+		transitRequest.TravelMode = maps.TravelModeTransit
+		plans, err := routing.PlanTrip(&transitRequest)
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+
+		// No matrix timed every leg at the trip's start
+		assert.Zero(t, transit.matrixCalls)
+		assert.NotZero(t, transit.travelCalls)
+	})
+
+	t.Run("Transit plans pay fares", func(t *testing.T) {
+		mapsService := &modalMapsService{
+			fakeMapsService: &fakeMapsService{travelMinutes: 10},
+			modes:           map[string]*fakeMapsService{maps.TravelModeTransit: {travelMinutes: 20}},
+		}
+		routing := NewRoutingService(repo, mapsService, NewPricingService(), WithTransitFares(FlatTransitFare(4)))
+		transitRequest := *request
+		transitRequest.TravelMode = maps.TravelModeTransit
+		plans, err := routing.PlanTrip(&transitRequest)
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+
+		for _, plan := range plans {
+			fares := 0.0
+			for _, segment := range plan.Route {
+				assert.Nil(t, segment.ParkingMeter, plan.Type)
+				assert.Zero(t, segment.ParkingCost, plan.Type)
+				if segment.FromStop != nil {
+					assert.Equal(t, 4.0, segment.Metadata["fare"], plan.Type)
+					fares += segment.Metadata["fare"].(float64)
+				}
+			}
+			assert.Equal(t, 4.0, fares, plan.Type)
+			assert.Equal(t, fares, plan.TotalCost, plan.Type)
+		}
+	})
+
+	t.Run("Windows are planned in the mode", func(t *testing.T) {
+		cycling := &fakeMapsService{travelMinutes: 25}
+		mapsService := &modalMapsService{
+			fakeMapsService: &fakeMapsService{travelMinutes: 10},
+			modes:           map[string]*fakeMapsService{maps.TravelModeBicycling: cycling},
+		}
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+		window, err := routing.PlanTripWindow(request,
+			mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+			mustParseTime(t, "2025-01-15T11:00:00-08:00"),
+			30*time.Minute)
+		require.NoError(t, err)
+		assert.Zero(t, window.Plan.TotalCost)
+		assert.Len(t, window.Starts, 3)
+		for _, segment := range window.Plan.Route {
+			if segment.FromStop != nil {
+				assert.Equal(t, 25, segment.TravelTime)
+			}
+		}
+		assert.Zero(t, mapsService.travelCalls+mapsService.matrixCalls)
+
+		// Legs timed in one mode aren't reused for another
+		from, to := &domain.Location{Lat: 49.2827, Lng: -123.1207}, &domain.Location{Lat: 49.2900, Lng: -123.1300}
+		shared := newWindowMapsService(mapsService, "")
+		minutes, err := shared.GetTravelTime(from, to, request.StartTime)
+		require.NoError(t, err)
+		assert.Equal(t, 10, minutes)
+		moded, err := shared.WithTravelMode(maps.TravelModeBicycling)
+		require.NoError(t, err)
+		minutes, err = moded.GetTravelTime(from, to, request.StartTime)
+		require.NoError(t, err)
+		assert.Equal(t, 25, minutes)
+	})
+}
+
+func TestRoutingService_MaxPerStopCost(t *testing.T) {
+	repo, stops := twoStopFixture()
+	// B2 is cheaper but coin-only, so the card bonus normally picks B1 at stop b
+	repo.meters[1].RateMF9A6P = 10.00
+	repo.meters[1].CreditCard = true
+	repo.meters = append(repo.meters, &domain.ParkingMeter{MeterID: "B2", Lat: 49.2902, Lng: -123.1302, RateMF9A6P: 6.00})
+	routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+
+	meterAt := func(plan *domain.TripPlan, stopID string) *domain.RouteSegment {
+		for i := range plan.Route {
+			if plan.Route[i].ToStop.ID == stopID {
+				return &plan.Route[i]
+			}
+		}
+		return nil
+	}
+
+	request := &domain.TripRequest{
+		Stops:          stops,
+		StartTime:      mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+		Preferences:    domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		CardMeterBonus: 5.00,
+	}
+
+	plans, err := routing.PlanTrip(request)
+	require.NoError(t, err)
+	segment := meterAt(findPlan(plans, "cheapest"), "b")
+	require.NotNil(t, segment)
+	assert.Equal(t, "B1", segment.ParkingMeter.MeterID)
+	assert.Equal(t, 10.00, segment.ParkingCost)
+
+	request.MaxPerStopCost = 8.00
+	plans, err = routing.PlanTrip(request)
+	require.NoError(t, err)
+	for _, plan := range plans {
+		segment := meterAt(plan, "b")
+		require.NotNil(t, segment)
+		assert.Equal(t, "B2", segment.ParkingMeter.MeterID)
+		for _, s := range plan.Route {
+			assert.LessOrEqual(t, s.ParkingCost, 8.00)
+		}
+	}
+}
+
+func TestRoutingService_ReentryPenalty(t *testing.T) {
+	// Stops a and c share meter M; b is across town at meter N
+	meterM := &domain.ParkingMeter{MeterID: "M", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 1.00, TimeLimitMF9A6P: 3}
+	meterN := &domain.ParkingMeter{MeterID: "N", Lat: 49.2901, Lng: -123.1301, RateMF9A6P: 1.00, TimeLimitMF9A6P: 3}
+	stops := []*domain.Stop{
+		{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 30},
+		{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1300, Duration: 10},
+		{ID: "c", Address: "Stop C", Lat: 49.2829, Lng: -123.1208, Duration: 30},
+	}
+	parkingOptions := map[string][]*domain.ParkingMeter{
+		"a": {meterM},
+		"b": {meterN},
+		"c": {meterM},
+	}
+	routing := NewRoutingService(&fakeParkingRepository{}, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+
+	request := func(penalty float64) *domain.TripRequest {
+		return &domain.TripRequest{
+			StartTime:      mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+			Preferences:    domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+			ReentryPenalty: penalty,
+		}
+	}
+	build := func(penalty float64) *RouteCandidate {
+		route := routing.buildRouteCandidate(stops, parkingOptions, request(penalty))
+		require.NotNil(t, route)
+		require.Len(t, route.Segments, 3)
+		return route
+	}
+
+	t.Run("Pays again when that is cheapest", func(t *testing.T) {
+		route := build(0)
+		revisit := route.Segments[2]
+		assert.InDelta(t, 0.50, revisit.ParkingCost, 1e-9) // 30 minutes at $1/hr
+		assert.Nil(t, revisit.Metadata["continues_session_from"])
+	})
+
+	t.Run("Keeps the first session running to avoid paying again", func(t *testing.T) {
+		route := build(1.00)
+		first, revisit := route.Segments[0], route.Segments[2]
+		assert.Equal(t, "a", revisit.Metadata["continues_session_from"])
+
+		// The session runs from arriving at a to the end of the visit to c, one
+		// payment covering the gap of about half an hour between the visits
+		sessionEnd := revisit.ArrivalTime.Add(30 * time.Minute)
+		sessionHours := sessionEnd.Sub(first.ArrivalTime).Hours()
+		assert.InDelta(t, sessionHours, first.ParkingCost+revisit.ParkingCost, 0.02)
+		assert.Less(t, revisit.ParkingCost, 0.50+1.00)
+
+		saving := revisit.Metadata["single_session_saving"].(float64)
+		assert.Greater(t, saving, 0.0)
+		assert.InDelta(t, 0.50+1.00-revisit.ParkingCost, saving, 0.006)
+	})
+
+	t.Run("Replaying the route keeps the session running", func(t *testing.T) {
+		route := build(1.00)
+		require.Equal(t, "a", route.Segments[2].Metadata["continues_session_from"])
+
+		// Unscaled, the replay costs what the plan does
+		cost, _, err := routing.evaluateWithTravelScale(route.Segments, request(1.00), 1)
+		require.NoError(t, err)
+		assert.InDelta(t, route.TotalCost, cost, 0.02)
+
+		// Later arrivals at c run the session a little longer, not start afresh
+		late, _, err := routing.evaluateWithTravelScale(route.Segments, request(1.00), 1.5)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, late, cost)
+		assert.Less(t, late, route.TotalCost+0.50)
+	})
+}
+
+func TestRoutingService_MinParkingMinutes(t *testing.T) {
+	meter := &domain.ParkingMeter{MeterID: "A", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 2.00, TimeLimitMF9A6P: 3}
+	stops := []*domain.Stop{{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 10}}
+	parkingOptions := map[string][]*domain.ParkingMeter{"a": {meter}}
+	routing := NewRoutingService(&fakeParkingRepository{}, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+
+	tests := []struct {
+		name       string
+		minimum    int
+		expectCost float64
+	}{
+		{"Pays for the visit only by default", 0, 0.33},
+		{"Pays for the minimum on a short visit", 30, 1.00},
+		{"Pays for the visit when it is longer than the minimum", 5, 0.33},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := routing.buildRouteCandidate(stops, parkingOptions, &domain.TripRequest{
+				StartTime:         mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+				Preferences:       domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+				MinParkingMinutes: tt.minimum,
+			})
+			require.NotNil(t, route)
+			require.Len(t, route.Segments, 1)
+			assert.InDelta(t, tt.expectCost, route.Segments[0].ParkingCost, 0.006)
+		})
+	}
+}
+
+func TestRoutingService_LatestDeparture(t *testing.T) {
+	meterA := &domain.ParkingMeter{MeterID: "A", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 2.00, TimeLimitMF9A6P: 3}
+	meterB := &domain.ParkingMeter{MeterID: "B", Lat: 49.2901, Lng: -123.1301, RateMF9A6P: 2.00, TimeLimitMF9A6P: 3}
+	parkingOptions := map[string][]*domain.ParkingMeter{"a": {meterA}, "b": {meterB}}
+	routing := NewRoutingService(&fakeParkingRepository{}, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+
+	build := func(deadline string) *RouteCandidate {
+		stops := []*domain.Stop{
+			{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 60},
+			{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1300, Duration: 60, LatestDeparture: mustParseTime(t, deadline)},
+		}
+		route := routing.buildRouteCandidate(stops, parkingOptions, &domain.TripRequest{
+			StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		})
+		require.NotNil(t, route)
+		require.Len(t, route.Segments, 2)
+		return route
+	}
+
+	t.Run("Late arrival truncates the dwell", func(t *testing.T) {
+		route := build("2025-01-15T11:30:00-08:00")
+		segment := route.Segments[1]
+
+		// Arriving at 11:10 or a little after leaves at most 20 of the 60 minutes asked for
+		dwell := int(mustParseTime(t, "2025-01-15T11:30:00-08:00").Sub(segment.ArrivalTime).Minutes())
+		assert.LessOrEqual(t, dwell, 20)
+		assert.Equal(t, dwell, segment.ToStop.Duration)
+		assert.Equal(t, dwell, segment.Metadata["dwell_minutes"])
+		assert.Equal(t, 60, segment.Metadata["requested_duration_minutes"])
+		assert.Nil(t, segment.Metadata["departure_deadline_missed"])
+		assert.InDelta(t, 2.00*float64(dwell)/60, segment.ParkingCost, 0.01)
+
+		// The requested stop is left as it was for other candidates
+		assert.Equal(t, 60, route.Stops[1].Duration)
+	})
+
+	t.Run("Deadline far enough away keeps the full dwell", func(t *testing.T) {
+		segment := build("2025-01-15T14:00:00-08:00").Segments[1]
+		assert.Equal(t, 60, segment.ToStop.Duration)
+		assert.Nil(t, segment.Metadata["dwell_minutes"])
+	})
+
+	t.Run("Arriving after the deadline is flagged", func(t *testing.T) {
+		segment := build("2025-01-15T11:00:00-08:00").Segments[1]
+		assert.Equal(t, 0, segment.ToStop.Duration)
+		assert.Equal(t, true, segment.Metadata["departure_deadline_missed"])
+	})
+}
+
+func TestRoutingService_DuplicateStopIDs(t *testing.T) {
+	routing := NewRoutingService(&fakeParkingRepository{}, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+
+	_, err := routing.PlanTrip(&domain.TripRequest{
+		StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		Stops: []domain.Stop{
+			{ID: "x", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 30},
+			{ID: "x", Address: "Stop B", Lat: 49.2900, Lng: -123.1300, Duration: 30},
+		},
+	})
+	require.ErrorIs(t, err, ErrDuplicateStopID)
+	assert.Contains(t, err.Error(), `"x"`)
+}
+
+func TestRoutingService_Timezone(t *testing.T) {
+	repo := &fakeParkingRepository{meters: []*domain.ParkingMeter{
+		{MeterID: "A", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 4.00, RateMF6P10: 1.00},
+		{MeterID: "B", Lat: 49.2901, Lng: -123.1301, RateMF9A6P: 4.00, RateMF6P10: 1.00},
+	}}
+	routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+	request := func(timezone string) *domain.TripRequest {
+		return &domain.TripRequest{
+			// 3:30 PM in Vancouver is 6:30 PM in Toronto
+			StartTime:   mustParseTime(t, "2025-01-15T15:30:00-08:00"),
+			Timezone:    timezone,
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+			Stops: []domain.Stop{
+				{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 60},
+				{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1300, Duration: 60},
+			},
+		}
+	}
+
+	vancouver, err := routing.PlanTrip(request("America/Vancouver"))
+	require.NoError(t, err)
+	require.NotEmpty(t, vancouver)
+	toronto, err := routing.PlanTrip(request("America/Toronto"))
+	require.NoError(t, err)
+	require.NotEmpty(t, toronto)
+
+	// The evening rate applies from the start in Toronto
+	assert.Less(t, toronto[0].TotalCost, vancouver[0].TotalCost)
+
+	_, err = routing.PlanTrip(request("America/Atlantis"))
+	require.ErrorIs(t, err, ErrInvalidTimezone)
+	assert.Contains(t, err.Error(), "America/Atlantis")
+}
+
+func TestRoutingService_OutOfRangeDurations(t *testing.T) {
+	repo := &fakeParkingRepository{meters: []*domain.ParkingMeter{
+		{MeterID: "A", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 2.00},
+		{MeterID: "B", Lat: 49.2901, Lng: -123.1301, RateMF9A6P: 2.00},
+	}}
+	routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+	request := func(duration int) *domain.TripRequest {
+		return &domain.TripRequest{
+			StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+			Stops: []domain.Stop{
+				{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 30},
+				{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1300, Duration: duration},
+			},
+		}
+	}
+
+	t.Run("Rejects a negative duration", func(t *testing.T) {
+		_, err := routing.PlanTrip(request(-30))
+		require.ErrorIs(t, err, ErrNegativeDuration)
+		assert.Contains(t, err.Error(), "Stop B")
+	})
+
+	t.Run("Candidates with a negative duration are infeasible", func(t *testing.T) {
+		stops := []*domain.Stop{
+			{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 30},
+			{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1300, Duration: -30},
+		}
+		parkingOptions := map[string][]*domain.ParkingMeter{"a": repo.meters[:1], "b": repo.meters[1:]}
+		assert.Nil(t, routing.buildRouteCandidate(stops, parkingOptions, request(-30)))
+	})
+
+	t.Run("Clamps an enormous duration with a warning", func(t *testing.T) {
+		plans, err := routing.PlanTrip(request(30 * 24 * 60))
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+
+		for _, segment := range plans[0].Route {
+			assert.LessOrEqual(t, segment.ToStop.Duration, MaxStayMinutes)
+		}
+		warnings, _ := plans[0].Metadata["warnings"].([]string)
+		require.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], "Stop B")
+	})
+}
+
+func TestRoutingService_SpreadLoad(t *testing.T) {
+	// Four nearly equally priced meters a short walk from stop b, and ones too
+	// far or too pricey to count as equivalent
+	meters := []*domain.ParkingMeter{
+		{MeterID: "A", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 2.00},
+		{MeterID: "B1", Lat: 49.2901, Lng: -123.1300, RateMF9A6P: 2.00},
+		{MeterID: "B2", Lat: 49.2902, Lng: -123.1301, RateMF9A6P: 2.00},
+		{MeterID: "B3", Lat: 49.2899, Lng: -123.1302, RateMF9A6P: 2.00},
+		{MeterID: "B4", Lat: 49.2903, Lng: -123.1299, RateMF9A6P: 2.10},
+		{MeterID: "FAR", Lat: 49.2950, Lng: -123.1300, RateMF9A6P: 2.00},
+		{MeterID: "PRICEY", Lat: 49.2900, Lng: -123.1299, RateMF9A6P: 6.00},
+	}
+	request := func(spread bool) *domain.TripRequest {
+		return &domain.TripRequest{
+			StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 1, TimeWeight: 0},
+			SpreadLoad:  spread,
+			Stops: []domain.Stop{
+				{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 60},
+				{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1300, Duration: 60},
+			},
+		}
+	}
+	meterAtB := func(routing *DefaultRoutingService, spread bool) string {
+		plans, err := routing.PlanTrip(request(spread))
+		require.NoError(t, err)
+		require.NotEmpty(t, plans)
+		for _, segment := range plans[0].Route {
+			if segment.ToStop.ID == "b" {
+				return segment.ParkingMeter.MeterID
+			}
+		}
+		t.Fatal("no segment to stop b")
+		return ""
+	}
+	newRouting := func(opts ...RoutingOption) *DefaultRoutingService {
+		opts = append(opts, WithMeterClustering(0, 0))
+		return NewRoutingService(&fakeParkingRepository{meters: meters}, &fakeMapsService{travelMinutes: 10}, NewPricingService(), opts...)
+	}
+
+	t.Run("Off by default", func(t *testing.T) {
+		routing := newRouting()
+		assert.Equal(t, "B1", meterAtB(routing, false))
+	})
+
+	t.Run("A fixed seed picks the same meter every time", func(t *testing.T) {
+		routing := newRouting(WithSpreadLoadSeed(42))
+		first := meterAtB(routing, true)
+		assert.Contains(t, []string{"B1", "B2", "B3", "B4"}, first)
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, first, meterAtB(routing, true))
+		}
+	})
+
+	t.Run("Seeds spread picks across the equivalent meters", func(t *testing.T) {
+		picked := make(map[string]bool)
+		for seed := int64(0); seed < 40; seed++ {
+			picked[meterAtB(newRouting(WithSpreadLoadSeed(seed)), true)] = true
+		}
+		assert.Greater(t, len(picked), 1)
+		assert.False(t, picked["FAR"])
+		assert.False(t, picked["PRICEY"])
+	})
+}
+
+func TestRoutingService_OutsideCoverage(t *testing.T) {
+	mapsService := &fakeMapsService{
+		travelMinutes: 10,
+		locations: map[string]*domain.Location{
+			"100 Queen St W, Toronto": {Lat: 43.6532, Lng: -79.3832},
+		},
+	}
+	request := &domain.TripRequest{
+		StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		Stops: []domain.Stop{
+			{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 30},
+			{ID: "b", Address: "100 Queen St W, Toronto", Duration: 30},
+		},
+	}
+
+	t.Run("Rejects a stop geocoded outside Vancouver", func(t *testing.T) {
+		routing := NewRoutingService(&fakeParkingRepository{}, mapsService, NewPricingService())
+
+		_, err := routing.PlanTrip(request)
+		require.ErrorIs(t, err, ErrOutsideCoverage)
+		assert.Contains(t, err.Error(), "100 Queen St W, Toronto")
+		assert.Contains(t, err.Error(), "43.653200, -79.383200")
+	})
+
+	t.Run("Uses the configured coverage area", func(t *testing.T) {
+		ontario := &domain.BoundingBox{MinLat: 41.6, MinLng: -95.2, MaxLat: 56.9, MaxLng: -74.3}
+		routing := NewRoutingService(&fakeParkingRepository{}, mapsService, NewPricingService(), WithCoverageArea(ontario))
+
+		_, err := routing.PlanTrip(request)
+		assert.NotErrorIs(t, err, ErrOutsideCoverage)
+	})
+}
+
+// steepElevation rises 10 m for every 0.001 degrees north
+type steepElevation struct{}
+
+func (steepElevation) Elevation(location *domain.Location) (float64, error) {
+	return (location.Lat - 49) * 10000, nil
+}
+
+func TestRoutingService_ElevationProvider(t *testing.T) {
+	// The only meter is about 400 m south of, and 36 m below, the stop
+	meter := &domain.ParkingMeter{MeterID: "M", Lat: 49.2600, Lng: -123.1200, RateMF9A6P: 1.00, TimeLimitMF9A6P: 2}
+	stops := []*domain.Stop{{ID: "a", Address: "Stop A", Lat: 49.2636, Lng: -123.1200, Duration: 30}}
+	parkingOptions := map[string][]*domain.ParkingMeter{"a": {meter}}
+	request := &domain.TripRequest{
+		StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	}
+
+	flat := NewRoutingService(&fakeParkingRepository{}, &fakeMapsService{}, NewPricingService()).
+		buildRouteCandidate(stops, parkingOptions, request)
+	hilly := NewRoutingService(&fakeParkingRepository{}, &fakeMapsService{}, NewPricingService(), WithElevationProvider(steepElevation{})).
+		buildRouteCandidate(stops, parkingOptions, request)
+	require.NotNil(t, flat)
+	require.NotNil(t, hilly)
+
+	assert.Equal(t, flat.Segments[0].WalkingTime+4, hilly.Segments[0].WalkingTime) // 36 m climbed
+	assert.Equal(t, flat.TotalTime+4, hilly.TotalTime)
+}
+
+func TestRoutingService_WalkLinkedSegments(t *testing.T) {
+	// Stops about 300 m apart, each with its own meter out front; b's is pricier
+	meterA := &domain.ParkingMeter{MeterID: "A", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 2.00, TimeLimitMF9A6P: 3}
+	meterB := &domain.ParkingMeter{MeterID: "B", Lat: 49.2855, Lng: -123.1207, RateMF9A6P: 3.00, TimeLimitMF9A6P: 3}
+	stops := []*domain.Stop{
+		{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 45},
+		{ID: "b", Address: "Stop B", Lat: 49.2854, Lng: -123.1207, Duration: 45},
+	}
+	parkingOptions := map[string][]*domain.ParkingMeter{"a": {meterA}, "b": {meterB}}
+	request := &domain.TripRequest{
+		StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	}
+
+	t.Run("Walks rather than re-parking", func(t *testing.T) {
+		routing := NewRoutingService(&fakeParkingRepository{}, &fakeMapsService{travelMinutes: 8}, NewPricingService())
+		route := routing.buildRouteCandidate(stops, parkingOptions, request)
+		require.NotNil(t, route)
+		require.Len(t, route.Segments, 2)
+
+		walk := route.Segments[1]
+		assert.Equal(t, true, walk.Metadata["walk_linked"])
+		assert.Equal(t, "a", walk.Metadata["walk_from"])
+		assert.Equal(t, "A", walk.ParkingMeter.MeterID) // the car stays put
+		assert.Equal(t, 0, walk.TravelTime)
+		assert.Greater(t, walk.WalkingTime, 0)
+
+		// Arrive on foot after walking the 300 m, ahead of the 8 minute drive
+		firstDeparture := route.Segments[0].ArrivalTime.Add(time.Duration(route.Segments[0].WalkingTime+45) * time.Minute)
+		assert.True(t, walk.ArrivalTime.After(firstDeparture))
+		assert.True(t, walk.ArrivalTime.Before(firstDeparture.Add(8*time.Minute)))
+
+		// One session covers both visits and the walks between them
+		session := walk.ArrivalTime.Add(time.Duration(45+walk.WalkingTime/2) * time.Minute).Sub(route.Segments[0].ArrivalTime)
+		assert.InDelta(t, 2.00*session.Hours(), route.TotalCost, 0.15)
+		assert.Less(t, route.TotalTime, 8+45+45)
+		assert.InDelta(t, 2.25, walk.Metadata["reparking_cost"], 1e-9) // 45 minutes at b's meter
+		assert.Less(t, walk.ParkingCost, 2.25)
+	})
+
+	t.Run("Drives when walking scores worse", func(t *testing.T) {
+		// Only cost matters and the meter at a charges far more to stay longer
+		pricey := &domain.ParkingMeter{MeterID: "P", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 20.00, TimeLimitMF9A6P: 3}
+		costOnly := *request
+		costOnly.Preferences = domain.Preferences{CostWeight: 1}
+
+		routing := NewRoutingService(&fakeParkingRepository{}, &fakeMapsService{travelMinutes: 8}, NewPricingService())
+		route := routing.buildRouteCandidate(stops, map[string][]*domain.ParkingMeter{"a": {pricey}, "b": {meterB}}, &costOnly)
+		require.NotNil(t, route)
+
+		drive := route.Segments[1]
+		assert.Nil(t, drive.Metadata["walk_linked"])
+		assert.Equal(t, "B", drive.ParkingMeter.MeterID)
+		assert.Equal(t, 8, drive.TravelTime)
+	})
+}
+
+// walkingMapsService traces every walk as the same known polyline, or fails
+type walkingMapsService struct {
+	fakeMapsService
+	polyline string
+	err      error
+	walks    int
+}
+
+func (m *walkingMapsService) GetWalkingRoute(from, to *domain.Location) (string, int, error) {
+	m.walks++
+	return m.polyline, 3, m.err
+}
+
+func TestRoutingService_WalkingRoutes(t *testing.T) {
+	repo := &fakeParkingRepository{meters: []*domain.ParkingMeter{
+		{MeterID: "ROBSON", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 3.00, TimeLimitMF9A6P: 3},
+		{MeterID: "CANADA_PL", Lat: 49.2889, Lng: -123.1111, RateMF9A6P: 4.00, TimeLimitMF9A6P: 3},
+	}}
+	request := func(include bool) *domain.TripRequest {
+		return &domain.TripRequest{
+			StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+			Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+			Stops: []domain.Stop{
+				{ID: "a", Address: "800 Robson St", Lat: 49.2827, Lng: -123.1207, Duration: 60},
+				{ID: "b", Address: "1055 Canada Pl", Lat: 49.2888, Lng: -123.1111, Duration: 45},
+			},
+			IncludeWalkingRoutes: include,
+		}
+	}
+
+	t.Run("Uses the provider's polyline", func(t *testing.T) {
+		mapsService := &walkingMapsService{fakeMapsService: fakeMapsService{travelMinutes: 10}, polyline: "a~l~Fjk~uOwHJy@P"}
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+		plans, err := routing.PlanTrip(request(true))
+		require.NoError(t, err)
+		for _, plan := range plans {
+			for _, segment := range plan.Route {
+				assert.Equal(t, "a~l~Fjk~uOwHJy@P", segment.WalkingPolyline)
+				assert.Nil(t, segment.Metadata["walking_route"])
+			}
+		}
+		assert.Equal(t, 2, mapsService.walks) // each walk is traced once across the plans
+	})
+
+	t.Run("Off unless requested", func(t *testing.T) {
+		mapsService := &walkingMapsService{fakeMapsService: fakeMapsService{travelMinutes: 10}, polyline: "a~l~Fjk~uOwHJy@P"}
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+		plans, err := routing.PlanTrip(request(false))
+		require.NoError(t, err)
+		assert.Empty(t, plans[0].Route[0].WalkingPolyline)
+		assert.Equal(t, 0, mapsService.walks)
+	})
+
+	t.Run("Falls back to a straight line", func(t *testing.T) {
+		mapsService := &walkingMapsService{fakeMapsService: fakeMapsService{travelMinutes: 10}, err: errors.New("quota exceeded")}
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+		plans, err := routing.PlanTrip(request(true))
+		require.NoError(t, err)
+		segment := plans[0].Route[0]
+		meter := &domain.Location{Lat: segment.ParkingMeter.Lat, Lng: segment.ParkingMeter.Lng}
+		stop := &domain.Location{Lat: segment.ToStop.Lat, Lng: segment.ToStop.Lng}
+		assert.Equal(t, maps.StraightLinePolyline(meter, stop), segment.WalkingPolyline)
+		assert.Equal(t, "straight_line", segment.Metadata["walking_route"])
+	})
+}
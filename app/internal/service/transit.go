@@ -0,0 +1,244 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// TransitPlanType is the plan type of a trip made by public transit
+const TransitPlanType = "transit"
+
+// TransitTransferWindow is how long after paying a fare further rides are free,
+// as with TransLink's 90-minute transfers
+const TransitTransferWindow = 90 * time.Minute
+
+// TransitFareModel prices a single transit ride
+type TransitFareModel interface {
+	Fare(from, to *domain.Location) float64
+}
+
+// FlatTransitFare charges the same fare for every ride
+type FlatTransitFare float64
+
+// Fare returns the flat fare
+func (f FlatTransitFare) Fare(from, to *domain.Location) float64 {
+	return float64(f)
+}
+
+// DefaultTransitFare is roughly TransLink's one-zone adult fare
+const DefaultTransitFare FlatTransitFare = 3.20
+
+// ZoneTransitFare charges by how many fare zones a ride spans. Zones are
+// checked in order and a location in none of them is in the zone after the
+// last. Fares[n-1] is the fare for a ride spanning n zones; rides spanning
+// more zones than there are fares pay the last fare.
+type ZoneTransitFare struct {
+	Zones []domain.BoundingBox
+	Fares []float64
+}
+
+// Fare returns the fare for the zones between from and to
+func (f ZoneTransitFare) Fare(from, to *domain.Location) float64 {
+	if len(f.Fares) == 0 {
+		return 0
+	}
+	spanned := int(math.Abs(float64(f.zone(from)-f.zone(to)))) + 1
+	return f.Fares[min(spanned, len(f.Fares))-1]
+}
+
+// zone returns the index of the first zone holding the location
+func (f ZoneTransitFare) zone(location *domain.Location) int {
+	for i, zone := range f.Zones {
+		if zone.Contains(location.Lat, location.Lng) {
+			return i
+		}
+	}
+	return len(f.Zones)
+}
+
+// WithTransitFares sets the fare model used to price transit plans
+func WithTransitFares(model TransitFareModel) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.transitFares = model
+	}
+}
+
+// ModeComparer is implemented by routing services that can compare making a
+// trip by car with making it by transit
+type ModeComparer interface {
+	CompareModes(request *domain.TripRequest) (*ModeComparison, error)
+}
+
+// ModeComparison pairs a driving plan, paying for parking, with the same stops
+// visited by transit, paying fares
+type ModeComparison struct {
+	Driving *domain.TripPlan `json:"driving"`
+	Transit *domain.TripPlan `json:"transit"`
+}
+
+// CompareModes plans the trip by car and returns its hybrid plan alongside a
+// transit plan visiting the stops in the same order, so the two differ only
+// in how the traveller gets between stops
+func (s *DefaultRoutingService) CompareModes(request *domain.TripRequest) (*ModeComparison, error) {
+	// The comparison is always against driving, whatever mode was asked for
+	if !drives(request) {
+		driving := *request
+		driving.TravelMode = ""
+		request = &driving
+	}
+
+	plans, err := s.PlanTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("no driving plan found to compare")
+	}
+
+	driving := plans[0]
+	for _, plan := range plans {
+		if plan.Type == "hybrid" {
+			driving = plan
+			break
+		}
+	}
+
+	transit, err := s.transitPlan(driving, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan transit trip: %w", err)
+	}
+	return &ModeComparison{Driving: driving, Transit: transit}, nil
+}
+
+// transitPlan rides transit between the stops of a driving plan in its order.
+// Each ride pays the fare model's fare unless it boards within the transfer
+// window of a fare at least as high. Ride times come from the maps service
+// when it can time transit and are estimated from distance otherwise.
+func (s *DefaultRoutingService) transitPlan(driving *domain.TripPlan, request *domain.TripRequest) (*domain.TripPlan, error) {
+	var segments []domain.RouteSegment
+	totalCost := 0.0
+	totalTime := 0
+	currentTime := request.StartTime
+	fares := transitFareTracker{fares: s.transitFares}
+	var lateStops []string
+
+	var previous *domain.Stop
+	for _, drivingSegment := range driving.Route {
+		// Ride from the previous transit stop, or from the trip's origin
+		fromStop := previous
+		if fromStop == nil && drivingSegment.FromStop != nil {
+			origin := *drivingSegment.FromStop
+			fromStop = &origin
+		}
+		toStop := *drivingSegment.ToStop
+
+		rideTime := 0
+		fare := 0.0
+		metadata := map[string]interface{}{}
+		if fromStop != nil && !coincidentStops(fromStop, &toStop) {
+			from := &domain.Location{Lat: fromStop.Lat, Lng: fromStop.Lng}
+			to := &domain.Location{Lat: toStop.Lat, Lng: toStop.Lng}
+			var estimated bool
+			var err error
+			rideTime, estimated, err = s.transitRideTime(from, to, currentTime)
+			if err != nil {
+				return nil, fmt.Errorf("failed to time transit from %s to %s: %w", stopLabel(fromStop), stopLabel(&toStop), err)
+			}
+			if estimated {
+				metadata["transit_time"] = "estimated"
+			}
+
+			// Ride out to reach the first stop at the start time, when that is
+			// what the start time means
+			if fromStop.IsOrigin && request.StartTimeMeaning == domain.StartTimeArriveFirstStop {
+				currentTime = currentTime.Add(-time.Duration(rideTime) * time.Minute)
+				fromStop.DepartureTime = currentTime
+			}
+
+			var transfer bool
+			fare, transfer = fares.ride(from, to, currentTime)
+			if transfer {
+				metadata["transfer"] = true
+			}
+			metadata["fare"] = fare
+		}
+
+		currentTime = currentTime.Add(time.Duration(rideTime) * time.Minute)
+		waitTime := 0
+		if !toStop.FixedArrival.IsZero() {
+			if currentTime.After(toStop.FixedArrival) {
+				lateStops = append(lateStops, stopLabel(&toStop))
+			} else {
+				waitTime = int(toStop.FixedArrival.Sub(currentTime).Minutes())
+				currentTime = toStop.FixedArrival
+			}
+		}
+
+		toStop.ArrivalTime = currentTime
+		toStop.DepartureTime = currentTime.Add(time.Duration(toStop.Duration) * time.Minute)
+		segments = append(segments, domain.RouteSegment{
+			FromStop:    fromStop,
+			ToStop:      &toStop,
+			TravelTime:  rideTime,
+			ArrivalTime: currentTime,
+			Metadata:    metadata,
+		})
+
+		totalCost += fare
+		totalTime += rideTime + waitTime + toStop.Duration
+		currentTime = toStop.DepartureTime
+		previous = &toStop
+	}
+
+	plan := &domain.TripPlan{
+		Type:      TransitPlanType,
+		TotalCost: math.Round(totalCost*100) / 100,
+		TotalTime: totalTime,
+		Route:     segments,
+		Metadata: map[string]interface{}{
+			"mode": TransitPlanType,
+		},
+	}
+	if len(lateStops) > 0 {
+		plan.Metadata["fixed_arrivals_missed"] = lateStops
+	}
+	return plan, nil
+}
+
+// transitFareTracker prices a trip's rides in turn. Each ride pays the fare
+// model's fare unless it boards within the transfer window of a fare at least
+// as high.
+type transitFareTracker struct {
+	fares    TransitFareModel
+	paidAt   time.Time
+	paidFare float64
+}
+
+// ride returns the fare for a ride boarding at boarding, and whether the ride
+// is a free transfer
+func (t *transitFareTracker) ride(from, to *domain.Location, boarding time.Time) (float64, bool) {
+	fare := t.fares.Fare(from, to)
+	if !t.paidAt.IsZero() && boarding.Before(t.paidAt.Add(TransitTransferWindow)) && fare <= t.paidFare {
+		return 0, true
+	}
+	t.paidAt = boarding
+	t.paidFare = fare
+	return fare, false
+}
+
+// transitRideTime times a transit ride with the maps service when it can time
+// transit, and otherwise estimates it from distance, reporting that it did
+func (s *DefaultRoutingService) transitRideTime(from, to *domain.Location, departure time.Time) (int, bool, error) {
+	if router, ok := s.mapsService.(maps.TransitRouter); ok {
+		minutes, err := router.GetTransitTime(from, to, departure)
+		if !errors.Is(err, maps.ErrUnsupported) {
+			return minutes, false, err
+		}
+	}
+	return s.earth.TransitTime(from, to), true, nil
+}
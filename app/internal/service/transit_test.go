@@ -0,0 +1,144 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// transitMapsService times every transit ride at transitMinutes
+type transitMapsService struct {
+	fakeMapsService
+	transitMinutes int
+	transitCalls   int
+}
+
+func (m *transitMapsService) GetTransitTime(from, to *domain.Location, departureTime time.Time) (int, error) {
+	m.transitCalls++
+	return m.transitMinutes, nil
+}
+
+func TestRoutingService_CompareModes(t *testing.T) {
+	repo := &fakeParkingRepository{meters: []*domain.ParkingMeter{
+		{MeterID: "A", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 2.00, TimeLimitMF9A6P: 3},
+		{MeterID: "B", Lat: 49.2901, Lng: -123.1301, RateMF9A6P: 2.00, TimeLimitMF9A6P: 3},
+	}}
+	request := &domain.TripRequest{
+		Stops: []domain.Stop{
+			{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 100},
+			{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1300, Duration: 100},
+			{ID: "c", Address: "Stop C", Lat: 49.2829, Lng: -123.1208, Duration: 100},
+		},
+		StartTime:   mustParseTime(t, "2025-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+	}
+
+	t.Run("Transit plan pays fares and parks nowhere", func(t *testing.T) {
+		mapsService := &transitMapsService{fakeMapsService: fakeMapsService{travelMinutes: 10}, transitMinutes: 25}
+		routing := NewRoutingService(repo, mapsService, NewPricingService())
+
+		comparison, err := routing.CompareModes(request)
+		require.NoError(t, err)
+		require.NotNil(t, comparison.Driving)
+		require.NotNil(t, comparison.Transit)
+
+		assert.Greater(t, comparison.Driving.TotalCost, 0.0)
+		for _, segment := range comparison.Driving.Route {
+			assert.NotNil(t, segment.ParkingMeter)
+		}
+
+		transit := comparison.Transit
+		assert.Equal(t, TransitPlanType, transit.Type)
+		require.Len(t, transit.Route, 3)
+		for _, segment := range transit.Route {
+			assert.Nil(t, segment.ParkingMeter)
+			assert.Zero(t, segment.ParkingCost)
+		}
+		assert.Equal(t, 2, mapsService.transitCalls)
+		// Each ride boards more than 90 minutes after the last fare was paid
+		assert.InDelta(t, 2*float64(DefaultTransitFare), transit.TotalCost, 1e-9)
+		assert.Equal(t, 25+25+3*100, transit.TotalTime)
+
+		// The transit plan visits the stops in the driving plan's order
+		for i, segment := range transit.Route {
+			assert.Equal(t, comparison.Driving.Route[i].ToStop.ID, segment.ToStop.ID)
+		}
+	})
+
+	t.Run("Transfers within the window ride free", func(t *testing.T) {
+		mapsService := &transitMapsService{fakeMapsService: fakeMapsService{travelMinutes: 10}, transitMinutes: 10}
+		routing := NewRoutingService(repo, mapsService, NewPricingService(), WithTransitFares(FlatTransitFare(2.50)))
+
+		short := *request
+		short.Stops = []domain.Stop{
+			{ID: "a", Address: "Stop A", Lat: 49.2827, Lng: -123.1207, Duration: 15},
+			{ID: "b", Address: "Stop B", Lat: 49.2900, Lng: -123.1300, Duration: 15},
+			{ID: "c", Address: "Stop C", Lat: 49.2829, Lng: -123.1208, Duration: 15},
+		}
+		comparison, err := routing.CompareModes(&short)
+		require.NoError(t, err)
+
+		assert.InDelta(t, 2.50, comparison.Transit.TotalCost, 1e-9)
+		assert.Equal(t, true, comparison.Transit.Route[2].Metadata["transfer"])
+	})
+
+	t.Run("Estimates rides without a transit router", func(t *testing.T) {
+		routing := NewRoutingService(repo, &fakeMapsService{travelMinutes: 10}, NewPricingService())
+
+		comparison, err := routing.CompareModes(request)
+		require.NoError(t, err)
+		assert.Greater(t, comparison.Transit.TotalCost, 0.0)
+		assert.Equal(t, "estimated", comparison.Transit.Route[1].Metadata["transit_time"])
+	})
+
+	t.Run("Times rides through a geocode cache", func(t *testing.T) {
+		mapsService := &transitMapsService{fakeMapsService: fakeMapsService{travelMinutes: 10}, transitMinutes: 25}
+		routing := NewRoutingService(repo, maps.WithGeocodeCache(mapsService, 10), NewPricingService())
+
+		comparison, err := routing.CompareModes(request)
+		require.NoError(t, err)
+		assert.Equal(t, 2, mapsService.transitCalls)
+		assert.NotContains(t, comparison.Transit.Route[1].Metadata, "transit_time")
+
+		// A cached service that can't time transit still estimates
+		routing = NewRoutingService(repo, maps.WithGeocodeCache(&fakeMapsService{travelMinutes: 10}, 10), NewPricingService())
+		comparison, err = routing.CompareModes(request)
+		require.NoError(t, err)
+		assert.Equal(t, "estimated", comparison.Transit.Route[1].Metadata["transit_time"])
+	})
+}
+
+func TestZoneTransitFare(t *testing.T) {
+	fares := ZoneTransitFare{
+		Zones: []domain.BoundingBox{
+			{MinLat: 49.19, MinLng: -123.27, MaxLat: 49.32, MaxLng: -123.02}, // Vancouver
+			{MinLat: 49.10, MinLng: -123.30, MaxLat: 49.40, MaxLng: -122.85}, // Burnaby and around
+		},
+		Fares: []float64{3.20, 4.65},
+	}
+	downtown := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	kitsilano := &domain.Location{Lat: 49.2684, Lng: -123.1683}
+	metrotown := &domain.Location{Lat: 49.2276, Lng: -122.9995}
+	surrey := &domain.Location{Lat: 49.1913, Lng: -122.8490}
+
+	tests := []struct {
+		name     string
+		from, to *domain.Location
+		expected float64
+	}{
+		{"Within one zone", downtown, kitsilano, 3.20},
+		{"Across two zones", downtown, metrotown, 4.65},
+		{"Beyond the last fare pays the last fare", downtown, surrey, 4.65},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, fares.Fare(tt.from, tt.to))
+			assert.Equal(t, tt.expected, fares.Fare(tt.to, tt.from))
+		})
+	}
+}
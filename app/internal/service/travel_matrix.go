@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// maxMatrixLocations is the most stops looked up in one travel time matrix.
+// The Distance Matrix API allows 100 elements per request, so larger trips
+// look up each leg on its own instead.
+const maxMatrixLocations = 10
+
+// WithTravelMatrix sets whether a plan looks up the driving times between all
+// its stops in one matrix request up front rather than leg by leg as stop
+// orders are built. It is on by default.
+func WithTravelMatrix(enabled bool) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.useTravelMatrix = enabled
+	}
+}
+
+// travelMatrix holds the driving minutes between each pair of a plan's stops,
+// keyed by stop ID
+type travelMatrix struct {
+	index   map[string]int
+	minutes [][]int
+}
+
+// newTravelMatrix looks up the driving times between every pair of stops at
+// the departure time. Times are looked up without traffic, so they hold for
+// legs later in the trip too; transit times don't, and transit plans look each
+// leg up at its own departure instead. It returns nil when there are too many
+// stops for one request or the lookup fails, leaving every leg to be looked up
+// on its own.
+func (s *DefaultRoutingService) newTravelMatrix(stops []*domain.Stop, departure time.Time) *travelMatrix {
+	if len(stops) < 2 || len(stops) > maxMatrixLocations {
+		return nil
+	}
+
+	index := make(map[string]int, len(stops))
+	locations := make([]*domain.Location, len(stops))
+	for i, stop := range stops {
+		index[stop.ID] = i
+		locations[i] = &domain.Location{Lat: stop.Lat, Lng: stop.Lng}
+	}
+
+	minutes, err := s.mapsService.GetTravelTimeMatrix(locations, departure)
+	if err != nil {
+		fmt.Printf("[DEBUG] Travel time matrix failed, looking up legs one at a time: %v\n", err)
+		return nil
+	}
+	if len(minutes) != len(stops) {
+		fmt.Printf("[DEBUG] Travel time matrix has %d rows for %d stops, looking up legs one at a time\n", len(minutes), len(stops))
+		return nil
+	}
+	fmt.Printf("[DEBUG] Looked up a %dx%d travel time matrix\n", len(stops), len(stops))
+
+	return &travelMatrix{index: index, minutes: minutes}
+}
+
+// lookup returns the driving minutes between two stops, or false when the
+// matrix has no route between them
+func (m *travelMatrix) lookup(from, to *domain.Stop) (int, bool) {
+	if m == nil {
+		return 0, false
+	}
+	i, ok := m.index[from.ID]
+	if !ok {
+		return 0, false
+	}
+	j, ok := m.index[to.ID]
+	if !ok || j >= len(m.minutes[i]) || m.minutes[i][j] < 0 {
+		return 0, false
+	}
+	return m.minutes[i][j], true
+}
+
+// legTravelTime returns the driving minutes between two stops from the plan's
+// matrix, looking the leg up on its own when the matrix has no route for it
+func (s *DefaultRoutingService) legTravelTime(from, to *domain.Stop, departure time.Time) (int, error) {
+	if minutes, ok := s.matrix.lookup(from, to); ok {
+		return minutes, nil
+	}
+	return s.mapsService.GetTravelTime(
+		&domain.Location{Lat: from.Lat, Lng: from.Lng},
+		&domain.Location{Lat: to.Lat, Lng: to.Lng},
+		departure,
+	)
+}
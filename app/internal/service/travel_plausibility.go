@@ -0,0 +1,172 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// ErrImplausibleTravelTime is returned for driving times rejected as implausible
+var ErrImplausibleTravelTime = errors.New("implausible travel time")
+
+// ImplausibleTravelPolicy decides what happens to a driving time whose implied
+// speed over the straight-line distance is outside the plausible bounds
+type ImplausibleTravelPolicy int
+
+const (
+	// ImplausibleTravelFlag keeps the time but warns about it (the default)
+	ImplausibleTravelFlag ImplausibleTravelPolicy = iota
+	// ImplausibleTravelEstimate replaces the time with a straight-line estimate
+	ImplausibleTravelEstimate
+	// ImplausibleTravelReject treats the leg as having no route
+	ImplausibleTravelReject
+)
+
+// ParseImplausibleTravelPolicy returns the policy with the given configuration name
+func ParseImplausibleTravelPolicy(name string) (ImplausibleTravelPolicy, error) {
+	switch name {
+	case "flag":
+		return ImplausibleTravelFlag, nil
+	case "estimate":
+		return ImplausibleTravelEstimate, nil
+	case "reject":
+		return ImplausibleTravelReject, nil
+	}
+	return ImplausibleTravelFlag, fmt.Errorf("unknown implausible travel time policy: %s", name)
+}
+
+// TravelTimeBounds are the slowest and fastest speeds, in km/h over the
+// straight-line distance, that a driving time may imply before it is treated
+// as a routing glitch
+type TravelTimeBounds struct {
+	MinSpeedKmh float64
+	MaxSpeedKmh float64
+	Policy      ImplausibleTravelPolicy
+}
+
+// DefaultTravelTimeBounds allow anything from a crawl around one-way streets to
+// highway speeds
+var DefaultTravelTimeBounds = TravelTimeBounds{MinSpeedKmh: 3, MaxSpeedKmh: 130}
+
+// plausibilityMinDistanceKm is the shortest leg checked. Durations come back
+// in whole minutes and short hops can loop around blocks, so their implied
+// speeds say little.
+const plausibilityMinDistanceKm = 1.0
+
+// WithTravelTimeBounds checks every driving time against bounds, flagging,
+// estimating or rejecting the implausible ones as the bounds' policy says.
+// Driving times are not checked by default.
+func WithTravelTimeBounds(bounds TravelTimeBounds) RoutingOption {
+	return func(s *DefaultRoutingService) {
+		s.travelBounds = &bounds
+	}
+}
+
+// plausibleMapsService checks the driving times of a single plan against
+// TravelTimeBounds, remembering a warning for each implausible leg
+type plausibleMapsService struct {
+	next   maps.MapsService
+	bounds TravelTimeBounds
+	earth  maps.Earth
+
+	mu       sync.Mutex
+	flagged  map[string]bool
+	warnings []string
+}
+
+func newPlausibleMapsService(next maps.MapsService, bounds TravelTimeBounds, earth maps.Earth) *plausibleMapsService {
+	return &plausibleMapsService{
+		next:    next,
+		bounds:  bounds,
+		earth:   earth,
+		flagged: make(map[string]bool),
+	}
+}
+
+// Warnings describes each implausible leg seen, in the order they were first seen
+func (p *plausibleMapsService) Warnings() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.warnings...)
+}
+
+// check returns minutes, or what the policy puts in place of them when the
+// speed they imply is implausible. ok is false for a rejected leg.
+func (p *plausibleMapsService) check(from, to *domain.Location, minutes int) (int, bool) {
+	distanceKm := p.earth.Distance(from, to)
+	if distanceKm < plausibilityMinDistanceKm {
+		return minutes, true
+	}
+	speed := math.Inf(1)
+	if minutes > 0 {
+		speed = distanceKm / (float64(minutes) / 60)
+	}
+	if speed >= p.bounds.MinSpeedKmh && speed <= p.bounds.MaxSpeedKmh {
+		return minutes, true
+	}
+
+	warning := fmt.Sprintf("a %d-minute drive over %.1f km looks implausible", minutes, distanceKm)
+	switch p.bounds.Policy {
+	case ImplausibleTravelEstimate:
+		estimate := p.earth.DrivingTime(from, to)
+		warning += fmt.Sprintf("; estimated %d minutes instead", estimate)
+		minutes = estimate
+	case ImplausibleTravelReject:
+		warning += "; the leg was left out"
+	}
+
+	key := travelKey(from, to)
+	p.mu.Lock()
+	if !p.flagged[key] {
+		p.flagged[key] = true
+		p.warnings = append(p.warnings, warning)
+	}
+	p.mu.Unlock()
+	fmt.Printf("[DEBUG] %s\n", warning)
+
+	return minutes, p.bounds.Policy != ImplausibleTravelReject
+}
+
+// GetTravelTime returns the upstream travel time once it passes the bounds
+func (p *plausibleMapsService) GetTravelTime(from, to *domain.Location, departureTime time.Time) (int, error) {
+	minutes, err := p.next.GetTravelTime(from, to, departureTime)
+	if err != nil {
+		return 0, err
+	}
+	checked, ok := p.check(from, to, minutes)
+	if !ok {
+		return 0, fmt.Errorf("%w: %d minutes over %.1f km", ErrImplausibleTravelTime, minutes, p.earth.Distance(from, to))
+	}
+	return checked, nil
+}
+
+// GetTravelTimeMatrix checks each entry, marking rejected legs as having no route
+func (p *plausibleMapsService) GetTravelTimeMatrix(locations []*domain.Location, departureTime time.Time) ([][]int, error) {
+	matrix, err := p.next.GetTravelTimeMatrix(locations, departureTime)
+	if err != nil {
+		return nil, err
+	}
+	for i := range matrix {
+		for j := range matrix[i] {
+			if i == j || matrix[i][j] < 0 {
+				continue
+			}
+			checked, ok := p.check(locations[i], locations[j], matrix[i][j])
+			if !ok {
+				checked = -1
+			}
+			matrix[i][j] = checked
+		}
+	}
+	return matrix, nil
+}
+
+// GeocodeAddress is passed through
+func (p *plausibleMapsService) GeocodeAddress(address string) (*domain.Location, error) {
+	return p.next.GeocodeAddress(address)
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"fmt"
+
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/repository"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// WarmupConfig lists what to fetch ahead of the first plans
+type WarmupConfig struct {
+	// Cells are points in popular areas whose nearby meters are pre-fetched
+	Cells []domain.Location
+
+	// Addresses are common stop addresses to pre-geocode
+	Addresses []string
+
+	// RadiusKm is the meter search radius to warm, DefaultParkingSearchRadiusKm if zero
+	RadiusKm float64
+}
+
+// WarmupResult counts what a warmup fetched and what failed
+type WarmupResult struct {
+	Cells     int
+	Addresses int
+	Errors    []error
+}
+
+// Warmup fetches the configured cells' meters and geocodes the configured
+// addresses so they land in the caches behind repo and geocoder. Failures are
+// collected rather than stopping the warmup. It blocks until done; run it in a
+// goroutine to keep startup quick.
+func Warmup(repo repository.ParkingRepository, geocoder maps.Geocoder, config WarmupConfig) WarmupResult {
+	radiusKm := config.RadiusKm
+	if radiusKm <= 0 {
+		radiusKm = DefaultParkingSearchRadiusKm
+	}
+
+	var result WarmupResult
+	for _, cell := range config.Cells {
+		if _, err := repo.GetParkingMetersNear(cell.Lat, cell.Lng, radiusKm); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to warm meters near (%.6f, %.6f): %w", cell.Lat, cell.Lng, err))
+			continue
+		}
+		result.Cells++
+	}
+	for _, address := range config.Addresses {
+		if _, err := geocoder.GeocodeAddress(address); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to warm geocode for %s: %w", address, err))
+			continue
+		}
+		result.Addresses++
+	}
+
+	fmt.Printf("[DEBUG] Warmup fetched meters for %d cells and geocoded %d addresses with %d errors\n",
+		result.Cells, result.Addresses, len(result.Errors))
+	return result
+}
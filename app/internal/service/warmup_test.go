@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+	"vancouver-trip-planner/internal/repository"
+	"vancouver-trip-planner/pkg/maps"
+)
+
+// countingParkingRepository counts lookups that reach the wrapped repository,
+// failing them with err when set
+type countingParkingRepository struct {
+	repository.ParkingRepository
+	calls int
+	err   error
+}
+
+func (r *countingParkingRepository) GetParkingMetersNear(lat, lng, radiusKm float64) ([]*domain.ParkingMeter, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.ParkingRepository.GetParkingMetersNear(lat, lng, radiusKm)
+}
+
+func TestWarmup(t *testing.T) {
+	upstream := &countingParkingRepository{ParkingRepository: &fakeParkingRepository{
+		meters: []*domain.ParkingMeter{
+			{MeterID: "ROBSON", Lat: 49.2828, Lng: -123.1207, RateMF9A6P: 3.00, TimeLimitMF9A6P: 3},
+			{MeterID: "CANADA_PL", Lat: 49.2889, Lng: -123.1111, RateMF9A6P: 4.00, TimeLimitMF9A6P: 3},
+		},
+	}}
+	repo := repository.NewCachedParkingRepository(upstream, repository.DefaultParkingCacheTTL)
+
+	mapsService := &fakeMapsService{locations: map[string]*domain.Location{
+		"800 Robson St":  {Lat: 49.2827, Lng: -123.1207},
+		"1055 Canada Pl": {Lat: 49.2888, Lng: -123.1111},
+	}}
+	geocoder := maps.WithGeocodeCache(mapsService, 100)
+
+	result := Warmup(repo, geocoder, WarmupConfig{
+		Cells:     []domain.Location{{Lat: 49.2827, Lng: -123.1207}, {Lat: 49.2888, Lng: -123.1111}},
+		Addresses: []string{"800 Robson St", "1055 Canada Pl", "1 Nowhere Rd"},
+	})
+
+	assert.Equal(t, 2, result.Cells)
+	assert.Equal(t, 2, result.Addresses)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0].Error(), "1 Nowhere Rd")
+
+	// Both cells are cached at the default search radius
+	assert.True(t, repo.Cached(49.2827, -123.1207, DefaultParkingSearchRadiusKm))
+	assert.True(t, repo.Cached(49.2888, -123.1111, DefaultParkingSearchRadiusKm))
+	assert.False(t, repo.Cached(49.2700, -123.1000, DefaultParkingSearchRadiusKm))
+	assert.Equal(t, 2, upstream.calls)
+	assert.Equal(t, 3, mapsService.geocodeCalls)
+
+	// Planning between the warmed addresses needs no further lookups
+	routing := NewRoutingService(repo, geocoder, NewPricingService())
+	plans, err := routing.PlanTrip(&domain.TripRequest{
+		StartTime:   mustParseTime(t, "2024-01-15T10:00:00-08:00"),
+		Preferences: domain.Preferences{CostWeight: 0.5, TimeWeight: 0.5},
+		Stops: []domain.Stop{
+			{ID: "a", Address: "800 Robson St", Duration: 60},
+			{ID: "b", Address: "1055 Canada Pl", Duration: 45},
+		},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, plans)
+	assert.Equal(t, 2, upstream.calls)
+	assert.Equal(t, 3, mapsService.geocodeCalls)
+}
+
+func TestWarmup_RepositoryErrors(t *testing.T) {
+	failing := &countingParkingRepository{ParkingRepository: &fakeParkingRepository{}, err: errors.New("dataset unavailable")}
+
+	result := Warmup(failing, &fakeMapsService{}, WarmupConfig{Cells: []domain.Location{{Lat: 49.2827, Lng: -123.1207}}})
+	assert.Equal(t, 0, result.Cells)
+	require.Len(t, result.Errors, 1)
+	assert.ErrorIs(t, result.Errors[0], failing.err)
+}
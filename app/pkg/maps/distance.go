@@ -0,0 +1,136 @@
+package maps
+
+import (
+	"fmt"
+	"math"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// DistanceModel selects the Earth model used for straight-line distances
+type DistanceModel int32
+
+const (
+	// DistanceSpherical uses the haversine formula on a sphere (the default).
+	// It is fast and within about 0.5% of the true distance.
+	DistanceSpherical DistanceModel = iota
+
+	// DistanceEllipsoidal uses Vincenty's inverse formula on the WGS84
+	// ellipsoid, accurate to within a millimetre
+	DistanceEllipsoidal
+)
+
+// String returns the model's configuration name
+func (m DistanceModel) String() string {
+	switch m {
+	case DistanceEllipsoidal:
+		return "ellipsoidal"
+	default:
+		return "spherical"
+	}
+}
+
+// ParseDistanceModel returns the model with the given configuration name
+func ParseDistanceModel(name string) (DistanceModel, error) {
+	switch name {
+	case "spherical":
+		return DistanceSpherical, nil
+	case "ellipsoidal", "vincenty":
+		return DistanceEllipsoidal, nil
+	}
+	return DistanceSpherical, fmt.Errorf("unknown distance model: %s", name)
+}
+
+// EarthRadiusKm is the mean radius of the Earth, the sphere's radius unless an
+// Earth says otherwise
+const EarthRadiusKm = 6371.0
+
+// Earth is the model straight-line distances, and the walking, driving and
+// transit estimates built on them, are computed with. The zero value is the
+// spherical model with a radius of EarthRadiusKm.
+type Earth struct {
+	Model DistanceModel
+
+	// RadiusKm is the sphere's radius for the spherical model; zero or less
+	// means EarthRadiusKm. The ellipsoidal model always uses WGS84.
+	RadiusKm float64
+}
+
+// radius returns the sphere's radius in kilometres
+func (e Earth) radius() float64 {
+	if e.RadiusKm <= 0 {
+		return EarthRadiusKm
+	}
+	return e.RadiusKm
+}
+
+// Distance calculates the distance in kilometres between two points
+func (e Earth) Distance(from, to *domain.Location) float64 {
+	return e.distance(from.Lat, from.Lng, to.Lat, to.Lng)
+}
+
+// distance returns the kilometres between two points under the model
+func (e Earth) distance(lat1, lng1, lat2, lng2 float64) float64 {
+	if e.Model == DistanceEllipsoidal {
+		return vincentyDistance(lat1, lng1, lat2, lng2)
+	}
+	return haversineDistance(lat1, lng1, lat2, lng2, e.radius())
+}
+
+// WGS84 ellipsoid parameters
+const (
+	wgs84SemiMajorM  = 6378137.0
+	wgs84Flattening  = 1 / 298.257223563
+	wgs84SemiMinorM  = wgs84SemiMajorM * (1 - wgs84Flattening)
+	vincentyMaxSteps = 200
+)
+
+// vincentyDistance calculates the distance in kilometres between two points on
+// the WGS84 ellipsoid using Vincenty's inverse formula. Nearly antipodal points,
+// where the iteration fails to converge, fall back to the spherical distance.
+func vincentyDistance(lat1, lng1, lat2, lng2 float64) float64 {
+	const f = wgs84Flattening
+
+	L := (lng2 - lng1) * math.Pi / 180
+	U1 := math.Atan((1 - f) * math.Tan(lat1*math.Pi/180))
+	U2 := math.Atan((1 - f) * math.Tan(lat2*math.Pi/180))
+	sinU1, cosU1 := math.Sincos(U1)
+	sinU2, cosU2 := math.Sincos(U2)
+
+	lambda := L
+	for i := 0; i < vincentyMaxSteps; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma := math.Sqrt(math.Pow(cosU2*sinLambda, 2) +
+			math.Pow(cosU1*sinU2-sinU1*cosU2*cosLambda, 2))
+		if sinSigma == 0 {
+			return 0 // coincident points
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha := 1 - sinAlpha*sinAlpha
+		cos2SigmaM := 0.0
+		if cosSqAlpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha // zero on the equator
+		}
+
+		C := f / 16 * cosSqAlpha * (4 + f*(4-3*cosSqAlpha))
+		previous := lambda
+		lambda = L + (1-C)*f*sinAlpha*
+			(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+
+		if math.Abs(lambda-previous) < 1e-12 {
+			uSq := cosSqAlpha * (wgs84SemiMajorM*wgs84SemiMajorM - wgs84SemiMinorM*wgs84SemiMinorM) /
+				(wgs84SemiMinorM * wgs84SemiMinorM)
+			A := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+			B := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+			deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+				B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+
+			return wgs84SemiMinorM * A * (sigma - deltaSigma) / 1000
+		}
+	}
+
+	return haversineDistance(lat1, lng1, lat2, lng2, EarthRadiusKm)
+}
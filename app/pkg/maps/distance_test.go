@@ -0,0 +1,62 @@
+package maps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+)
+
+func TestVincentyDistance(t *testing.T) {
+	// Vincenty's (1975) published test line: Flinders Peak to Buninyong, 54972.271m
+	flindersPeak := &domain.Location{Lat: -(37 + 57.0/60 + 3.72030/3600), Lng: 144 + 25.0/60 + 29.52440/3600}
+	buninyong := &domain.Location{Lat: -(37 + 39.0/60 + 10.15610/3600), Lng: 143 + 55.0/60 + 35.38390/3600}
+
+	ellipsoidal := vincentyDistance(flindersPeak.Lat, flindersPeak.Lng, buninyong.Lat, buninyong.Lng)
+	assert.InDelta(t, 54.972271, ellipsoidal, 0.000001) // within a millimetre
+
+	// The sphere is within 0.5% over the same line
+	spherical := haversineDistance(flindersPeak.Lat, flindersPeak.Lng, buninyong.Lat, buninyong.Lng, EarthRadiusKm)
+	assert.InEpsilon(t, ellipsoidal, spherical, 0.005)
+
+	assert.Equal(t, 0.0, vincentyDistance(49.2827, -123.1207, 49.2827, -123.1207))
+}
+
+func TestEarth(t *testing.T) {
+	vancouver := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	burnaby := &domain.Location{Lat: 49.2488, Lng: -122.9805}
+
+	t.Run("Spherical by default", func(t *testing.T) {
+		var earth Earth
+		assert.Equal(t, DistanceSpherical, earth.Model)
+		spherical := haversineDistance(vancouver.Lat, vancouver.Lng, burnaby.Lat, burnaby.Lng, EarthRadiusKm)
+		assert.Equal(t, spherical, earth.Distance(vancouver, burnaby))
+		assert.Equal(t, spherical, CalculateDistance(vancouver, burnaby))
+	})
+
+	t.Run("Ellipsoidal", func(t *testing.T) {
+		model, err := ParseDistanceModel("ellipsoidal")
+		require.NoError(t, err)
+		earth := Earth{Model: model}
+		assert.Equal(t, "ellipsoidal", earth.Model.String())
+		assert.Equal(t, vincentyDistance(vancouver.Lat, vancouver.Lng, burnaby.Lat, burnaby.Lng), earth.Distance(vancouver, burnaby))
+
+		// Walking estimates follow the model
+		assert.Equal(t, int(earth.Distance(vancouver, burnaby)/5.0*60), earth.WalkingTime(vancouver, burnaby))
+
+		// The radius only shapes the sphere
+		assert.Equal(t, earth.Distance(vancouver, burnaby), Earth{Model: model, RadiusKm: 1}.Distance(vancouver, burnaby))
+	})
+
+	t.Run("Radius", func(t *testing.T) {
+		// Distances on a sphere scale with its radius
+		doubled := Earth{RadiusKm: 2 * EarthRadiusKm}
+		assert.InDelta(t, 2*CalculateDistance(vancouver, burnaby), doubled.Distance(vancouver, burnaby), 1e-9)
+		assert.Greater(t, doubled.DrivingTime(vancouver, burnaby), EstimateDrivingTime(vancouver, burnaby))
+		assert.Equal(t, CalculateDistance(vancouver, burnaby), Earth{RadiusKm: -1}.Distance(vancouver, burnaby))
+	})
+
+	_, err := ParseDistanceModel("flat")
+	assert.Error(t, err)
+}
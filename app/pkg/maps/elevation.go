@@ -0,0 +1,51 @@
+package maps
+
+import (
+	"math"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// climbMetresPerMinute is how much height adds a minute of walking, after
+// Naismith's rule of an hour per 600 m climbed
+const climbMetresPerMinute = 10.0
+
+// ElevationProvider reports the ground elevation at a location in metres
+type ElevationProvider interface {
+	Elevation(location *domain.Location) (float64, error)
+}
+
+// FlatElevation treats everywhere as the same height, so walking times are
+// unaffected by hills. It is the default.
+type FlatElevation struct{}
+
+// Elevation always returns zero
+func (FlatElevation) Elevation(location *domain.Location) (float64, error) {
+	return 0, nil
+}
+
+// CalculateWalkingTimeWithElevation is CalculateWalkingTime plus a minute for
+// every 10 m climbed between the two points. Walking downhill is not faster.
+func CalculateWalkingTimeWithElevation(from, to *domain.Location, elevation ElevationProvider) (int, error) {
+	return Earth{}.WalkingTimeWithElevation(from, to, elevation)
+}
+
+// WalkingTimeWithElevation is WalkingTime plus a minute for every 10 m climbed
+// between the two points
+func (e Earth) WalkingTimeWithElevation(from, to *domain.Location, elevation ElevationProvider) (int, error) {
+	minutes := e.WalkingTime(from, to)
+
+	start, err := elevation.Elevation(from)
+	if err != nil {
+		return minutes, err
+	}
+	end, err := elevation.Elevation(to)
+	if err != nil {
+		return minutes, err
+	}
+
+	if climb := end - start; climb > 0 {
+		minutes += int(math.Round(climb / climbMetresPerMinute))
+	}
+	return minutes, nil
+}
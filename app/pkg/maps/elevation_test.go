@@ -0,0 +1,55 @@
+package maps
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+)
+
+// gradeElevation rises steadily northward at the given metres per degree of latitude
+type gradeElevation struct {
+	metresPerDegree float64
+	err             error
+}
+
+func (g gradeElevation) Elevation(location *domain.Location) (float64, error) {
+	return (location.Lat - 49) * g.metresPerDegree, g.err
+}
+
+func TestCalculateWalkingTimeWithElevation(t *testing.T) {
+	// About 400 m apart, the second point north of the first
+	south := &domain.Location{Lat: 49.2600, Lng: -123.1200}
+	north := &domain.Location{Lat: 49.2636, Lng: -123.1200}
+	flat := CalculateWalkingTime(south, north)
+
+	// A 10% grade: 40 m of climb over the 400 m
+	steep := gradeElevation{metresPerDegree: 40 / 0.0036}
+
+	tests := []struct {
+		name      string
+		from, to  *domain.Location
+		elevation ElevationProvider
+		expected  int
+	}{
+		{"Flat by default", south, north, FlatElevation{}, flat},
+		{"Uphill adds a minute per 10 m climbed", south, north, steep, flat + 4},
+		{"Downhill is no faster", north, south, steep, flat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minutes, err := CalculateWalkingTimeWithElevation(tt.from, tt.to, tt.elevation)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, minutes)
+		})
+	}
+
+	t.Run("Falls back to the flat estimate on error", func(t *testing.T) {
+		minutes, err := CalculateWalkingTimeWithElevation(south, north, gradeElevation{err: errors.New("unavailable")})
+		assert.Error(t, err)
+		assert.Equal(t, flat, minutes)
+	})
+}
@@ -0,0 +1,356 @@
+package maps
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// ErrNoResults is returned when a geocoder finds no match for an address
+var ErrNoResults = errors.New("no results found")
+
+// ErrRateLimited is returned when a geocoder refused the request for exceeding
+// its quota. Unlike ErrNoResults, retrying later may succeed.
+var ErrRateLimited = errors.New("geocoder rate limit exceeded")
+
+// Geocoder resolves an address to coordinates
+type Geocoder interface {
+	GeocodeAddress(address string) (*domain.Location, error)
+}
+
+// GeocodeResult is a geocoder's answer for an address
+type GeocodeResult struct {
+	FormattedAddress string  `json:"formatted_address"`
+	Lat              float64 `json:"lat"`
+	Lng              float64 `json:"lng"`
+
+	// Confidence ranges from 0 (a rough guess) to 1 (an exact match)
+	Confidence float64 `json:"confidence"`
+}
+
+// DetailedGeocoder is implemented by geocoders that can return the normalized
+// address and a confidence alongside the coordinates
+type DetailedGeocoder interface {
+	GeocodeDetails(address string) (*GeocodeResult, error)
+}
+
+// GeocoderBackend is a named entry in a GeocoderChain
+type GeocoderBackend struct {
+	Name     string
+	Geocoder Geocoder
+}
+
+// GeocoderChain tries each backend in order, returning the first that finds the address
+type GeocoderChain struct {
+	backends []GeocoderBackend
+}
+
+// NewGeocoderChain creates a chain that consults backends in the given order
+func NewGeocoderChain(backends ...GeocoderBackend) *GeocoderChain {
+	return &GeocoderChain{backends: backends}
+}
+
+// Resolve geocodes an address, returning the location and the name of the
+// backend that answered. A backend that errors or returns no location is skipped.
+func (c *GeocoderChain) Resolve(address string) (*domain.Location, string, error) {
+	result, source, err := c.resolve(address, func(geocoder Geocoder) (*GeocodeResult, error) {
+		location, err := geocoder.GeocodeAddress(address)
+		if err != nil || location == nil {
+			return nil, err
+		}
+		return &GeocodeResult{Lat: location.Lat, Lng: location.Lng}, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &domain.Location{Lat: result.Lat, Lng: result.Lng}, source, nil
+}
+
+// GeocodeAddress implements Geocoder
+func (c *GeocoderChain) GeocodeAddress(address string) (*domain.Location, error) {
+	location, source, err := c.Resolve(address)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("[DEBUG] Geocoded %s via %s\n", address, source)
+	return location, nil
+}
+
+// GeocodeDetails implements DetailedGeocoder. Backends without detailed results
+// answer with the address as given and no confidence.
+func (c *GeocoderChain) GeocodeDetails(address string) (*GeocodeResult, error) {
+	result, source, err := c.resolve(address, func(geocoder Geocoder) (*GeocodeResult, error) {
+		if detailed, ok := geocoder.(DetailedGeocoder); ok {
+			return detailed.GeocodeDetails(address)
+		}
+
+		location, err := geocoder.GeocodeAddress(address)
+		if err != nil || location == nil {
+			return nil, err
+		}
+		return &GeocodeResult{FormattedAddress: address, Lat: location.Lat, Lng: location.Lng}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("[DEBUG] Geocoded %s via %s\n", address, source)
+	return result, nil
+}
+
+// resolve asks each backend in turn through lookup, returning the first result
+// and the name of the backend that gave it
+func (c *GeocoderChain) resolve(address string, lookup func(Geocoder) (*GeocodeResult, error)) (*GeocodeResult, string, error) {
+	var failures []string
+	notFound := true
+
+	for _, backend := range c.backends {
+		result, err := lookup(backend.Geocoder)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", backend.Name, err))
+			notFound = notFound && errors.Is(err, ErrNoResults)
+			continue
+		}
+		if result == nil {
+			failures = append(failures, fmt.Sprintf("%s: no results", backend.Name))
+			continue
+		}
+
+		return result, backend.Name, nil
+	}
+
+	// Only report "no results" when every backend actually looked and found nothing
+	if notFound {
+		return nil, "", fmt.Errorf("%w: no geocoder could resolve address %s (%s)", ErrNoResults, address, strings.Join(failures, "; "))
+	}
+	return nil, "", fmt.Errorf("no geocoder could resolve address %s (%s)", address, strings.Join(failures, "; "))
+}
+
+// chainedMapsService geocodes through a GeocoderChain and delegates everything else
+type chainedMapsService struct {
+	MapsService
+	chain *GeocoderChain
+}
+
+// WithGeocoderChain returns a MapsService that geocodes through chain while
+// delegating travel times to next
+func WithGeocoderChain(next MapsService, chain *GeocoderChain) MapsService {
+	return &chainedMapsService{MapsService: next, chain: chain}
+}
+
+// GeocodeAddress resolves the address through the chain
+func (s *chainedMapsService) GeocodeAddress(address string) (*domain.Location, error) {
+	return s.chain.GeocodeAddress(address)
+}
+
+// GeocodeDetails resolves the address through the chain
+func (s *chainedMapsService) GeocodeDetails(address string) (*GeocodeResult, error) {
+	return s.chain.GeocodeDetails(address)
+}
+
+// WithAvoid shapes the routes legs are timed on, still geocoding through the
+// chain
+func (s *chainedMapsService) WithAvoid(features []string) (MapsService, error) {
+	shaped, err := avoidThrough(s.MapsService, features)
+	if err != nil {
+		return nil, err
+	}
+	return &chainedMapsService{MapsService: shaped, chain: s.chain}, nil
+}
+
+// WithTravelMode changes the travel mode legs are timed in, still geocoding
+// through the chain
+func (s *chainedMapsService) WithTravelMode(mode string) (MapsService, error) {
+	moded, err := travelModeThrough(s.MapsService, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &chainedMapsService{MapsService: moded, chain: s.chain}, nil
+}
+
+// GetTransitTime times a transit trip with the wrapped service
+func (s *chainedMapsService) GetTransitTime(from, to *domain.Location, departureTime time.Time) (int, error) {
+	return transitTimeThrough(s.MapsService, from, to, departureTime)
+}
+
+// CachedGeocoder remembers successful detailed lookups so repeated validation of
+// the same address doesn't call the upstream geocoder again
+type CachedGeocoder struct {
+	next       DetailedGeocoder
+	maxEntries int
+
+	mu      sync.Mutex
+	results map[string]*GeocodeResult
+}
+
+// NewCachedGeocoder wraps next with a cache holding up to maxEntries addresses
+func NewCachedGeocoder(next DetailedGeocoder, maxEntries int) *CachedGeocoder {
+	return &CachedGeocoder{
+		next:       next,
+		maxEntries: maxEntries,
+		results:    make(map[string]*GeocodeResult),
+	}
+}
+
+// GeocodeDetails returns the cached result for the address, geocoding it on a miss
+func (c *CachedGeocoder) GeocodeDetails(address string) (*GeocodeResult, error) {
+	key := strings.ToLower(strings.TrimSpace(address))
+
+	c.mu.Lock()
+	result, ok := c.results[key]
+	c.mu.Unlock()
+	if ok {
+		return result, nil
+	}
+
+	result, err := c.next.GeocodeDetails(address)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.results) >= c.maxEntries {
+		// Start over rather than track recency; validation traffic is bursty per address
+		c.results = make(map[string]*GeocodeResult)
+	}
+	c.results[key] = result
+
+	return result, nil
+}
+
+// ReverseGeocoder looks up a display address for coordinates
+type ReverseGeocoder interface {
+	ReverseGeocode(location *domain.Location) (string, error)
+}
+
+// CachedReverseGeocoder remembers addresses found for coordinates, rounded to
+// about a metre, so repeated stops don't call the upstream geocoder again
+type CachedReverseGeocoder struct {
+	next       ReverseGeocoder
+	maxEntries int
+
+	mu        sync.Mutex
+	addresses map[string]string
+}
+
+// NewCachedReverseGeocoder wraps next with a cache holding up to maxEntries locations
+func NewCachedReverseGeocoder(next ReverseGeocoder, maxEntries int) *CachedReverseGeocoder {
+	return &CachedReverseGeocoder{
+		next:       next,
+		maxEntries: maxEntries,
+		addresses:  make(map[string]string),
+	}
+}
+
+// ReverseGeocode returns the cached address for the location, looking it up on a miss
+func (c *CachedReverseGeocoder) ReverseGeocode(location *domain.Location) (string, error) {
+	key := fmt.Sprintf("%.5f,%.5f", location.Lat, location.Lng)
+
+	c.mu.Lock()
+	address, ok := c.addresses[key]
+	c.mu.Unlock()
+	if ok {
+		return address, nil
+	}
+
+	address, err := c.next.ReverseGeocode(location)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.addresses) >= c.maxEntries {
+		c.addresses = make(map[string]string)
+	}
+	c.addresses[key] = address
+
+	return address, nil
+}
+
+// geocodeCachingMapsService remembers the locations addresses geocode to while
+// delegating travel times to the wrapped service
+type geocodeCachingMapsService struct {
+	MapsService
+	cache *addressCache
+}
+
+// WithGeocodeCache returns a MapsService that remembers up to maxEntries
+// geocoded addresses. Route shaping and travel modes are kept when next
+// supports them, and report ErrUnsupported otherwise.
+func WithGeocodeCache(next MapsService, maxEntries int) MapsService {
+	return &geocodeCachingMapsService{
+		MapsService: next,
+		cache:       &addressCache{maxEntries: maxEntries, locations: make(map[string]*domain.Location)},
+	}
+}
+
+// GeocodeAddress returns the cached location for the address, geocoding it on a miss
+func (s *geocodeCachingMapsService) GeocodeAddress(address string) (*domain.Location, error) {
+	if location, ok := s.cache.get(address); ok {
+		return location, nil
+	}
+
+	location, err := s.MapsService.GeocodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(address, location)
+
+	return location, nil
+}
+
+// WithAvoid shapes the wrapped service, sharing this one's cached geocodes
+func (s *geocodeCachingMapsService) WithAvoid(features []string) (MapsService, error) {
+	shaped, err := avoidThrough(s.MapsService, features)
+	if err != nil {
+		return nil, err
+	}
+	return &geocodeCachingMapsService{MapsService: shaped, cache: s.cache}, nil
+}
+
+// WithTravelMode changes the wrapped service's mode, sharing this one's cached geocodes
+func (s *geocodeCachingMapsService) WithTravelMode(mode string) (MapsService, error) {
+	moded, err := travelModeThrough(s.MapsService, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &geocodeCachingMapsService{MapsService: moded, cache: s.cache}, nil
+}
+
+// GetTransitTime times a transit trip with the wrapped service
+func (s *geocodeCachingMapsService) GetTransitTime(from, to *domain.Location, departureTime time.Time) (int, error) {
+	return transitTimeThrough(s.MapsService, from, to, departureTime)
+}
+
+// addressCache holds geocoded locations by normalized address, starting over
+// when full like the other geocode caches
+type addressCache struct {
+	maxEntries int
+
+	mu        sync.Mutex
+	locations map[string]*domain.Location
+}
+
+func (c *addressCache) get(address string) (*domain.Location, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	location, ok := c.locations[strings.ToLower(strings.TrimSpace(address))]
+	return location, ok
+}
+
+func (c *addressCache) put(address string, location *domain.Location) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.locations) >= c.maxEntries {
+		c.locations = make(map[string]*domain.Location)
+	}
+	c.locations[strings.ToLower(strings.TrimSpace(address))] = location
+}
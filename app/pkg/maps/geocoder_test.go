@@ -0,0 +1,95 @@
+package maps
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+)
+
+// fakeGeocoder returns a fixed location (or none) and counts calls
+type fakeGeocoder struct {
+	location *domain.Location
+	err      error
+	calls    int
+}
+
+func (g *fakeGeocoder) GeocodeAddress(address string) (*domain.Location, error) {
+	g.calls++
+	return g.location, g.err
+}
+
+func TestGeocoderChain(t *testing.T) {
+	vancouver := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+
+	t.Run("Falls back when the primary returns nothing", func(t *testing.T) {
+		primary := &fakeGeocoder{}
+		secondary := &fakeGeocoder{location: vancouver}
+		chain := NewGeocoderChain(
+			GeocoderBackend{Name: "google", Geocoder: primary},
+			GeocoderBackend{Name: "nominatim", Geocoder: secondary},
+		)
+
+		location, source, err := chain.Resolve("800 Robson St")
+
+		require.NoError(t, err)
+		assert.Equal(t, vancouver, location)
+		assert.Equal(t, "nominatim", source)
+		assert.Equal(t, 1, primary.calls)
+		assert.Equal(t, 1, secondary.calls)
+	})
+
+	t.Run("Stops at the first success", func(t *testing.T) {
+		primary := &fakeGeocoder{location: vancouver}
+		secondary := &fakeGeocoder{location: &domain.Location{Lat: 1, Lng: 1}}
+		chain := NewGeocoderChain(
+			GeocoderBackend{Name: "google", Geocoder: primary},
+			GeocoderBackend{Name: "nominatim", Geocoder: secondary},
+		)
+
+		_, source, err := chain.Resolve("800 Robson St")
+
+		require.NoError(t, err)
+		assert.Equal(t, "google", source)
+		assert.Equal(t, 0, secondary.calls)
+	})
+
+	t.Run("Reports every failure when nothing answers", func(t *testing.T) {
+		chain := NewGeocoderChain(
+			GeocoderBackend{Name: "google", Geocoder: &fakeGeocoder{err: fmt.Errorf("over quota")}},
+			GeocoderBackend{Name: "nominatim", Geocoder: &fakeGeocoder{}},
+		)
+
+		_, err := chain.GeocodeAddress("nowhere")
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "google: over quota")
+		assert.Contains(t, err.Error(), "nominatim: no results")
+	})
+}
+
+func TestNominatimGeocoder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "trip-planner-test", r.UserAgent())
+		if r.URL.Query().Get("q") == "nowhere" {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`[{"lat": "49.2827", "lon": "-123.1207"}]`))
+	}))
+	defer server.Close()
+
+	geocoder := NewNominatimGeocoder(server.URL, "trip-planner-test")
+
+	location, err := geocoder.GeocodeAddress("800 Robson St")
+	require.NoError(t, err)
+	assert.Equal(t, 49.2827, location.Lat)
+	assert.Equal(t, -123.1207, location.Lng)
+
+	_, err = geocoder.GeocodeAddress("nowhere")
+	assert.Error(t, err)
+}
@@ -2,8 +2,10 @@ package maps
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"strings"
 	"time"
 
 	"googlemaps.github.io/maps"
@@ -17,9 +19,117 @@ type MapsService interface {
 	GeocodeAddress(address string) (*domain.Location, error)
 }
 
+// RouteShaper is implemented by maps services that can avoid route features
+// such as tolls or highways when timing driving legs
+type RouteShaper interface {
+	// WithAvoid returns a service whose travel times avoid the given features
+	WithAvoid(features []string) (MapsService, error)
+}
+
+// Route features that driving legs can avoid
+const (
+	AvoidTolls    = "tolls"
+	AvoidHighways = "highways"
+	AvoidFerries  = "ferries"
+)
+
+// ValidateAvoid checks that every feature is one the maps provider can avoid
+func ValidateAvoid(features []string) error {
+	for _, feature := range features {
+		switch feature {
+		case AvoidTolls, AvoidHighways, AvoidFerries:
+		default:
+			return fmt.Errorf("cannot avoid %q: must be one of %s, %s or %s", feature, AvoidTolls, AvoidHighways, AvoidFerries)
+		}
+	}
+	return nil
+}
+
+// Travel modes legs can be timed in
+const (
+	TravelModeDriving   = "driving"
+	TravelModeBicycling = "bicycling"
+	TravelModeTransit   = "transit"
+)
+
+// ModeRouter is implemented by maps services that can time legs in travel
+// modes other than driving
+type ModeRouter interface {
+	// WithTravelMode returns a service whose travel times are for the given mode
+	WithTravelMode(mode string) (MapsService, error)
+}
+
+// ErrUnsupported is returned by services wrapping another when asked to avoid
+// features, change travel mode or time transit and the wrapped service can't
+var ErrUnsupported = errors.New("not supported by the maps provider")
+
+// avoidThrough shapes next's routes on behalf of a service wrapping it
+func avoidThrough(next MapsService, features []string) (MapsService, error) {
+	shaper, ok := next.(RouteShaper)
+	if !ok {
+		return nil, fmt.Errorf("%w: can't avoid route features", ErrUnsupported)
+	}
+	return shaper.WithAvoid(features)
+}
+
+// travelModeThrough changes next's travel mode on behalf of a service wrapping it
+func travelModeThrough(next MapsService, mode string) (MapsService, error) {
+	router, ok := next.(ModeRouter)
+	if !ok {
+		return nil, fmt.Errorf("%w: can only time driving", ErrUnsupported)
+	}
+	return router.WithTravelMode(mode)
+}
+
+// transitTimeThrough times a transit trip with next on behalf of a service wrapping it
+func transitTimeThrough(next MapsService, from, to *domain.Location, departureTime time.Time) (int, error) {
+	router, ok := next.(TransitRouter)
+	if !ok {
+		return 0, fmt.Errorf("%w: can't time transit", ErrUnsupported)
+	}
+	return router.GetTransitTime(from, to, departureTime)
+}
+
+// ValidateTravelMode checks that mode is one legs can be timed in
+func ValidateTravelMode(mode string) error {
+	switch mode {
+	case TravelModeDriving, TravelModeBicycling, TravelModeTransit:
+		return nil
+	}
+	return fmt.Errorf("unknown travel mode %q: must be one of %s, %s or %s", mode, TravelModeDriving, TravelModeBicycling, TravelModeTransit)
+}
+
+// googleClient is the subset of the Google Maps client the service uses
+type googleClient interface {
+	DistanceMatrix(ctx context.Context, r *maps.DistanceMatrixRequest) (*maps.DistanceMatrixResponse, error)
+	Geocode(ctx context.Context, r *maps.GeocodingRequest) ([]maps.GeocodingResult, error)
+	ReverseGeocode(ctx context.Context, r *maps.GeocodingRequest) ([]maps.GeocodingResult, error)
+	Directions(ctx context.Context, r *maps.DirectionsRequest) ([]maps.Route, []maps.GeocodedWaypoint, error)
+	NearestRoads(ctx context.Context, r *maps.NearestRoadsRequest) (*maps.NearestRoadsResponse, error)
+}
+
+// Geocoding requests refused for exceeding the quota are retried, waiting
+// geocodeRetryBackoff and then twice as long before each further attempt
+const (
+	geocodeMaxAttempts  = 3
+	geocodeRetryBackoff = 500 * time.Millisecond
+)
+
 // GoogleMapsService implements MapsService using Google Maps API
 type GoogleMapsService struct {
-	client *maps.Client
+	client googleClient
+	avoid  maps.Avoid
+
+	// mode is what legs are timed for; empty means driving
+	mode maps.Mode
+
+	// sleep waits between geocoding retries; tests replace it
+	sleep func(time.Duration)
+
+	// travel, when set, remembers travel times so repeated legs skip the API.
+	// Copies made by WithAvoid and WithTravelMode share it; the avoided
+	// features and the mode are part of the key.
+	travel *travelCache
 }
 
 // NewGoogleMapsService creates a new Google Maps service
@@ -31,20 +141,100 @@ func NewGoogleMapsService(apiKey string) (*GoogleMapsService, error) {
 
 	return &GoogleMapsService{
 		client: client,
+		sleep:  time.Sleep,
 	}, nil
 }
 
-// GetTravelTime calculates travel time between two locations
-func (s *GoogleMapsService) GetTravelTime(from, to *domain.Location, departureTime time.Time) (int, error) {
-	ctx := context.Background()
+// NewGoogleMapsServiceWithCache creates a Google Maps service that remembers up
+// to maxEntries driving times, keyed by the leg and its departure to the
+// nearest 15 minutes, evicting the least recently used
+func NewGoogleMapsServiceWithCache(apiKey string, maxEntries int) (*GoogleMapsService, error) {
+	service, err := NewGoogleMapsService(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if maxEntries > 0 {
+		service.travel = newTravelCache(maxEntries)
+	}
+	return service, nil
+}
+
+// WithAvoid returns a copy of the service whose distance matrix requests avoid
+// the given features
+func (s *GoogleMapsService) WithAvoid(features []string) (MapsService, error) {
+	if err := ValidateAvoid(features); err != nil {
+		return nil, err
+	}
+
+	shaped := *s
+	shaped.avoid = maps.Avoid(strings.Join(features, "|"))
+	return &shaped, nil
+}
+
+// WithTravelMode returns a copy of the service whose distance matrix requests
+// time legs for the given mode
+func (s *GoogleMapsService) WithTravelMode(mode string) (MapsService, error) {
+	if err := ValidateTravelMode(mode); err != nil {
+		return nil, err
+	}
 
+	shaped := *s
+	shaped.mode = maps.Mode(mode)
+	return &shaped, nil
+}
+
+// travelMode returns the mode legs are timed for
+func (s *GoogleMapsService) travelMode() maps.Mode {
+	if s.mode == "" {
+		return maps.TravelModeDriving
+	}
+	return s.mode
+}
+
+// matrixRequest builds a distance matrix request for the service's mode.
+// Transit times depend on the timetable, so transit requests say when they leave.
+func (s *GoogleMapsService) matrixRequest(origins, destinations []string, departureTime time.Time) *maps.DistanceMatrixRequest {
 	req := &maps.DistanceMatrixRequest{
-		Origins:      []string{fmt.Sprintf("%f,%f", from.Lat, from.Lng)},
-		Destinations: []string{fmt.Sprintf("%f,%f", to.Lat, to.Lng)},
-		Mode:         maps.TravelModeDriving,
+		Origins:      origins,
+		Destinations: destinations,
+		Mode:         s.travelMode(),
 		Units:        maps.UnitsMetric,
+		Avoid:        s.avoid,
 		// Remove traffic parameters that require premium APIs
 	}
+	if req.Mode == maps.TravelModeTransit {
+		req.DepartureTime = fmt.Sprintf("%d", departureTime.Unix())
+	}
+	return req
+}
+
+// Attribution credits Google Maps under its terms of service
+func (s *GoogleMapsService) Attribution() domain.DataSource {
+	return domain.DataSource{
+		Name:    "Google Maps",
+		License: "Google Maps Platform Terms of Service",
+		URL:     "https://cloud.google.com/maps-platform/terms",
+	}
+}
+
+// GetTravelTime calculates travel time between two locations, from the cache
+// when the service has one and the leg was looked up recently
+func (s *GoogleMapsService) GetTravelTime(from, to *domain.Location, departureTime time.Time) (int, error) {
+	var key travelCacheKey
+	if s.travel != nil {
+		key = newTravelCacheKey(from, to, departureTime, s.travelMode(), s.avoid)
+		if minutes, ok := s.travel.get(key); ok {
+			return minutes, nil
+		}
+	}
+
+	ctx := context.Background()
+
+	req := s.matrixRequest(
+		[]string{fmt.Sprintf("%f,%f", from.Lat, from.Lng)},
+		[]string{fmt.Sprintf("%f,%f", to.Lat, to.Lng)},
+		departureTime,
+	)
 
 	resp, err := s.client.DistanceMatrix(ctx, req)
 	if err != nil {
@@ -61,11 +251,21 @@ func (s *GoogleMapsService) GetTravelTime(from, to *domain.Location, departureTi
 	}
 
 	// Return duration in minutes (use regular duration since we're not using traffic)
-	return int(element.Duration.Minutes()), nil
+	minutes := int(element.Duration.Minutes())
+	if s.travel != nil {
+		s.travel.put(key, minutes)
+	}
+	return minutes, nil
 }
 
-// GetTravelTimeMatrix calculates travel times between all pairs of locations
+// GetTravelTimeMatrix calculates travel times between all pairs of locations.
+// With a cache, legs are looked up and remembered as GetTravelTime does, and
+// the API is only called when some leg isn't cached.
 func (s *GoogleMapsService) GetTravelTimeMatrix(locations []*domain.Location, departureTime time.Time) ([][]int, error) {
+	if matrix, ok := s.cachedMatrix(locations, departureTime); ok {
+		return matrix, nil
+	}
+
 	ctx := context.Background()
 	n := len(locations)
 
@@ -75,13 +275,7 @@ func (s *GoogleMapsService) GetTravelTimeMatrix(locations []*domain.Location, de
 		coords[i] = fmt.Sprintf("%f,%f", loc.Lat, loc.Lng)
 	}
 
-	req := &maps.DistanceMatrixRequest{
-		Origins:      coords,
-		Destinations: coords,
-		Mode:         maps.TravelModeDriving,
-		Units:        maps.UnitsMetric,
-		// Remove traffic parameters that require premium APIs
-	}
+	req := s.matrixRequest(coords, coords, departureTime)
 
 	resp, err := s.client.DistanceMatrix(ctx, req)
 	if err != nil {
@@ -109,49 +303,270 @@ func (s *GoogleMapsService) GetTravelTimeMatrix(locations []*domain.Location, de
 				continue
 			}
 
-			// Use duration in traffic if available, otherwise use regular duration
-			duration := element.DurationInTraffic
-			if duration == 0 {
-				duration = element.Duration
+			// The same duration GetTravelTime returns, so a leg takes as long
+			// whichever way it is looked up
+			matrix[i][j] = int(element.Duration.Minutes())
+			if s.travel != nil {
+				s.travel.put(newTravelCacheKey(locations[i], locations[j], departureTime, s.travelMode(), s.avoid), matrix[i][j])
 			}
-
-			matrix[i][j] = int(duration.Minutes())
 		}
 	}
 
 	return matrix, nil
 }
 
+// cachedMatrix returns the travel time matrix from the cache, or false unless
+// every leg in it is cached
+func (s *GoogleMapsService) cachedMatrix(locations []*domain.Location, departureTime time.Time) ([][]int, bool) {
+	if s.travel == nil {
+		return nil, false
+	}
+
+	matrix := make([][]int, len(locations))
+	for i := range locations {
+		matrix[i] = make([]int, len(locations))
+		for j := range locations {
+			if i == j {
+				continue
+			}
+			minutes, ok := s.travel.get(newTravelCacheKey(locations[i], locations[j], departureTime, s.travelMode(), s.avoid))
+			if !ok {
+				return nil, false
+			}
+			matrix[i][j] = minutes
+		}
+	}
+	return matrix, true
+}
+
 // GeocodeAddress converts an address to coordinates
 func (s *GoogleMapsService) GeocodeAddress(address string) (*domain.Location, error) {
+	result, err := s.GeocodeDetails(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.Location{Lat: result.Lat, Lng: result.Lng}, nil
+}
+
+// GeocodeDetails geocodes an address, also returning Google's formatted address
+// and a confidence derived from the result's location type
+func (s *GoogleMapsService) GeocodeDetails(address string) (*GeocodeResult, error) {
 	ctx := context.Background()
 
 	req := &maps.GeocodingRequest{
 		Address: address,
 	}
 
-	resp, err := s.client.Geocode(ctx, req)
+	resp, err := s.geocodeWithRetry(func() ([]maps.GeocodingResult, error) {
+		return s.client.Geocode(ctx, req)
+	})
+	if errors.Is(err, ErrNoResults) {
+		return nil, fmt.Errorf("%w for address: %s", ErrNoResults, address)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to geocode address: %w", err)
 	}
 
 	if len(resp) == 0 {
-		return nil, fmt.Errorf("no results found for address: %s", address)
+		return nil, fmt.Errorf("%w for address: %s", ErrNoResults, address)
 	}
 
 	// Take the first result
 	result := resp[0]
-	location := &domain.Location{
-		Lat: result.Geometry.Location.Lat,
-		Lng: result.Geometry.Location.Lng,
+
+	confidence, ok := googleLocationConfidence[result.Geometry.LocationType]
+	if !ok {
+		confidence = 0.4
+	}
+	if result.PartialMatch {
+		confidence *= 0.75
+	}
+
+	return &GeocodeResult{
+		FormattedAddress: result.FormattedAddress,
+		Lat:              result.Geometry.Location.Lat,
+		Lng:              result.Geometry.Location.Lng,
+		Confidence:       confidence,
+	}, nil
+}
+
+// ReverseGeocode returns Google's formatted address for the given coordinates
+func (s *GoogleMapsService) ReverseGeocode(location *domain.Location) (string, error) {
+	ctx := context.Background()
+
+	req := &maps.GeocodingRequest{
+		LatLng: &maps.LatLng{Lat: location.Lat, Lng: location.Lng},
+	}
+
+	resp, err := s.geocodeWithRetry(func() ([]maps.GeocodingResult, error) {
+		return s.client.ReverseGeocode(ctx, req)
+	})
+	if errors.Is(err, ErrNoResults) {
+		return "", fmt.Errorf("%w for location: %.6f, %.6f", ErrNoResults, location.Lat, location.Lng)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to reverse geocode location: %w", err)
+	}
+
+	if len(resp) == 0 {
+		return "", fmt.Errorf("%w for location: %.6f, %.6f", ErrNoResults, location.Lat, location.Lng)
+	}
+
+	return resp[0].FormattedAddress, nil
+}
+
+// geocodeWithRetry runs a geocoding request, retrying with backoff while Google
+// reports the quota exceeded. Errors are classified by the response status:
+// OVER_QUERY_LIMIT becomes ErrRateLimited and ZERO_RESULTS ErrNoResults.
+func (s *GoogleMapsService) geocodeWithRetry(request func() ([]maps.GeocodingResult, error)) ([]maps.GeocodingResult, error) {
+	sleep := s.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	backoff := geocodeRetryBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := request()
+		err = classifyGeocodeError(err)
+		if !errors.Is(err, ErrRateLimited) || attempt == geocodeMaxAttempts {
+			return resp, err
+		}
+
+		fmt.Printf("[DEBUG] Geocoding rate limited, retrying in %s\n", backoff)
+		sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// classifyGeocodeError wraps the Google client's status errors, which are only
+// distinguishable by their text, in the matching typed error
+func classifyGeocodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch message := err.Error(); {
+	case strings.Contains(message, "OVER_QUERY_LIMIT"), strings.Contains(message, "OVER_DAILY_LIMIT"):
+		return fmt.Errorf("%w: %v", ErrRateLimited, err)
+	case strings.Contains(message, "ZERO_RESULTS"):
+		return fmt.Errorf("%w: %v", ErrNoResults, err)
+	}
+	return err
+}
+
+// googleLocationConfidence rates Google's location types from exact to approximate
+var googleLocationConfidence = map[string]float64{
+	"ROOFTOP":            1.0,
+	"RANGE_INTERPOLATED": 0.8,
+	"GEOMETRIC_CENTER":   0.6,
+	"APPROXIMATE":        0.4,
+}
+
+// WalkingRouter is implemented by maps services that can trace a walking path,
+// e.g. for drawing the walk from a meter to a stop
+type WalkingRouter interface {
+	// GetWalkingRoute returns the walk as an encoded polyline and its minutes
+	GetWalkingRoute(from, to *domain.Location) (string, int, error)
+}
+
+// GetWalkingRoute traces the walk between two points with the Directions API
+func (s *GoogleMapsService) GetWalkingRoute(from, to *domain.Location) (string, int, error) {
+	routes, _, err := s.client.Directions(context.Background(), &maps.DirectionsRequest{
+		Origin:      fmt.Sprintf("%f,%f", from.Lat, from.Lng),
+		Destination: fmt.Sprintf("%f,%f", to.Lat, to.Lng),
+		Mode:        maps.TravelModeWalking,
+		Units:       maps.UnitsMetric,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get walking directions: %w", err)
 	}
+	if len(routes) == 0 {
+		return "", 0, fmt.Errorf("no walking route found")
+	}
+
+	var duration time.Duration
+	for _, leg := range routes[0].Legs {
+		duration += leg.Duration
+	}
+	return routes[0].OverviewPolyline.Points, int(math.Round(duration.Minutes())), nil
+}
 
-	return location, nil
+// TransitRouter is implemented by maps services that can time trips by public transit
+type TransitRouter interface {
+	// GetTransitTime returns the minutes from leaving from to reaching to by
+	// transit, including walks to and from stations and waits for departures
+	GetTransitTime(from, to *domain.Location, departureTime time.Time) (int, error)
 }
 
-// CalculateWalkingTime calculates walking time between two points using Haversine distance
+// GetTransitTime times a transit trip with the Distance Matrix API
+func (s *GoogleMapsService) GetTransitTime(from, to *domain.Location, departureTime time.Time) (int, error) {
+	resp, err := s.client.DistanceMatrix(context.Background(), &maps.DistanceMatrixRequest{
+		Origins:       []string{fmt.Sprintf("%f,%f", from.Lat, from.Lng)},
+		Destinations:  []string{fmt.Sprintf("%f,%f", to.Lat, to.Lng)},
+		Mode:          maps.TravelModeTransit,
+		Units:         maps.UnitsMetric,
+		DepartureTime: fmt.Sprintf("%d", departureTime.Unix()),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get transit distance matrix: %w", err)
+	}
+
+	if len(resp.Rows) == 0 || len(resp.Rows[0].Elements) == 0 {
+		return 0, fmt.Errorf("no transit route found")
+	}
+
+	element := resp.Rows[0].Elements[0]
+	if element.Status != "OK" {
+		return 0, fmt.Errorf("transit route calculation failed: %s", element.Status)
+	}
+
+	return int(math.Ceil(element.Duration.Minutes())), nil
+}
+
+// RoadSnapper is implemented by maps services that can move a point onto the
+// nearest road, e.g. a GPS fix that landed inside a building
+type RoadSnapper interface {
+	SnapToRoad(location *domain.Location) (*domain.Location, error)
+}
+
+// SnapToRoad moves the location onto the nearest road with the Roads API. It
+// uses the nearest roads lookup, which suits lone points; snapping to roads
+// proper expects a path travelled.
+func (s *GoogleMapsService) SnapToRoad(location *domain.Location) (*domain.Location, error) {
+	resp, err := s.client.NearestRoads(context.Background(), &maps.NearestRoadsRequest{
+		Points: []maps.LatLng{{Lat: location.Lat, Lng: location.Lng}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snap to road: %w", err)
+	}
+	if len(resp.SnappedPoints) == 0 {
+		return nil, fmt.Errorf("%w: no road near %.6f, %.6f", ErrNoResults, location.Lat, location.Lng)
+	}
+
+	snapped := resp.SnappedPoints[0].Location
+	return &domain.Location{Lat: snapped.Lat, Lng: snapped.Lng}, nil
+}
+
+// StraightLinePolyline encodes the direct line between two points, for when
+// no walking route can be traced
+func StraightLinePolyline(from, to *domain.Location) string {
+	return maps.Encode([]maps.LatLng{
+		{Lat: from.Lat, Lng: from.Lng},
+		{Lat: to.Lat, Lng: to.Lng},
+	})
+}
+
+// CalculateWalkingTime calculates walking time between two points from their
+// straight-line distance on the default Earth
 func CalculateWalkingTime(from, to *domain.Location) int {
-	distance := haversineDistance(from.Lat, from.Lng, to.Lat, to.Lng)
+	return Earth{}.WalkingTime(from, to)
+}
+
+// WalkingTime calculates walking time between two points from their
+// straight-line distance
+func (e Earth) WalkingTime(from, to *domain.Location) int {
+	distance := e.Distance(from, to)
 
 	// Assume walking speed of 5 km/h
 	walkingSpeedKmH := 5.0
@@ -161,15 +576,52 @@ func CalculateWalkingTime(from, to *domain.Location) int {
 	return int(timeMinutes)
 }
 
-// CalculateDistance calculates the distance between two points on Earth using Haversine formula
-func CalculateDistance(from, to *domain.Location) float64 {
-	return haversineDistance(from.Lat, from.Lng, to.Lat, to.Lng)
+// EstimateDrivingTime approximates driving time between two points from their
+// straight-line distance on the default Earth
+func EstimateDrivingTime(from, to *domain.Location) int {
+	return Earth{}.DrivingTime(from, to)
+}
+
+// DrivingTime approximates driving time between two points from their
+// straight-line distance, for use when the Distance Matrix API is unavailable
+func (e Earth) DrivingTime(from, to *domain.Location) int {
+	distance := e.Distance(from, to)
+
+	// Assume an average urban driving speed of 30 km/h
+	drivingSpeedKmH := 30.0
+	timeMinutes := distance / drivingSpeedKmH * 60
+
+	return int(math.Ceil(timeMinutes))
+}
+
+// EstimateTransitTime approximates a transit trip between two points from
+// their straight-line distance on the default Earth
+func EstimateTransitTime(from, to *domain.Location) int {
+	return Earth{}.TransitTime(from, to)
+}
+
+// TransitTime approximates a transit trip between two points from their
+// straight-line distance, for use when no transit router is available
+func (e Earth) TransitTime(from, to *domain.Location) int {
+	distance := e.Distance(from, to)
+
+	// Assume buses average 18 km/h once boarded, after 10 minutes of walking
+	// to the stop and waiting
+	transitSpeedKmH := 18.0
+	timeMinutes := 10 + distance/transitSpeedKmH*60
+
+	return int(math.Ceil(timeMinutes))
 }
 
-// haversineDistance calculates the distance between two points on Earth using Haversine formula
-func haversineDistance(lat1, lng1, lat2, lng2 float64) float64 {
-	const R = 6371 // Earth's radius in kilometers
+// CalculateDistance calculates the distance in kilometres between two points
+// on the default Earth, a sphere of radius EarthRadiusKm
+func CalculateDistance(from, to *domain.Location) float64 {
+	return Earth{}.Distance(from, to)
+}
 
+// haversineDistance calculates the distance between two points on a sphere of
+// the given radius in kilometres using Haversine formula
+func haversineDistance(lat1, lng1, lat2, lng2, radiusKm float64) float64 {
 	// Convert degrees to radians
 	lat1Rad := lat1 * (3.14159265359 / 180)
 	lng1Rad := lng1 * (3.14159265359 / 180)
@@ -184,7 +636,7 @@ func haversineDistance(lat1, lng1, lat2, lng2 float64) float64 {
 	a := (1-cos(dlat))/2 + cos(lat1Rad)*cos(lat2Rad)*(1-cos(dlng))/2
 	c := 2 * asin(sqrt(a))
 
-	return R * c
+	return radiusKm * c
 }
 
 // Helper functions for math operations
@@ -1,9 +1,14 @@
 package maps
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"googlemaps.github.io/maps"
 	"vancouver-trip-planner/internal/domain"
 )
 
@@ -81,7 +86,7 @@ func TestHaversineDistance(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := haversineDistance(tt.lat1, tt.lng1, tt.lat2, tt.lng2)
+			result := haversineDistance(tt.lat1, tt.lng1, tt.lat2, tt.lng2, EarthRadiusKm)
 
 			// Allow some tolerance for calculation variations
 			assert.InDelta(t, tt.expected, result, 1.0, "Distance should be approximately correct")
@@ -155,3 +160,354 @@ func TestGoogleMapsServiceCreation(t *testing.T) {
 		}
 	})
 }
+
+func TestEstimateDrivingTime(t *testing.T) {
+	downtown := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	burnaby := &domain.Location{Lat: 49.2488, Lng: -122.9805}
+
+	// About 11 km at 30 km/h
+	assert.InDelta(t, 22, EstimateDrivingTime(downtown, burnaby), 2)
+	assert.Equal(t, 0, EstimateDrivingTime(downtown, downtown))
+}
+
+// fakeGoogleClient records distance matrix requests and answers every element in
+// 10 minutes. Geocoding fails with each of geocodeErrs in turn, then returns
+// geocodeResults. Directions return routes, or fail with directionsErr. Nearest
+// roads returns snappedPoints.
+type fakeGoogleClient struct {
+	requests []*maps.DistanceMatrixRequest
+
+	geocodeErrs    []error
+	geocodeResults []maps.GeocodingResult
+	geocodeCalls   int
+
+	directions    []*maps.DirectionsRequest
+	routes        []maps.Route
+	directionsErr error
+
+	snappedPoints []maps.SnappedPoint
+
+	// trafficDuration, if set, is reported as each leg's duration in traffic
+	trafficDuration time.Duration
+}
+
+func (c *fakeGoogleClient) DistanceMatrix(ctx context.Context, r *maps.DistanceMatrixRequest) (*maps.DistanceMatrixResponse, error) {
+	c.requests = append(c.requests, r)
+
+	resp := &maps.DistanceMatrixResponse{}
+	for range r.Origins {
+		row := maps.DistanceMatrixElementsRow{}
+		for range r.Destinations {
+			row.Elements = append(row.Elements, &maps.DistanceMatrixElement{Status: "OK", Duration: 10 * time.Minute, DurationInTraffic: c.trafficDuration})
+		}
+		resp.Rows = append(resp.Rows, row)
+	}
+	return resp, nil
+}
+
+func (c *fakeGoogleClient) Geocode(ctx context.Context, r *maps.GeocodingRequest) ([]maps.GeocodingResult, error) {
+	c.geocodeCalls++
+	if len(c.geocodeErrs) > 0 {
+		err := c.geocodeErrs[0]
+		c.geocodeErrs = c.geocodeErrs[1:]
+		return nil, err
+	}
+	return c.geocodeResults, nil
+}
+
+func (c *fakeGoogleClient) Directions(ctx context.Context, r *maps.DirectionsRequest) ([]maps.Route, []maps.GeocodedWaypoint, error) {
+	c.directions = append(c.directions, r)
+	if c.directionsErr != nil {
+		return nil, nil, c.directionsErr
+	}
+	return c.routes, nil, nil
+}
+
+func (c *fakeGoogleClient) ReverseGeocode(ctx context.Context, r *maps.GeocodingRequest) ([]maps.GeocodingResult, error) {
+	return c.Geocode(ctx, r)
+}
+
+func (c *fakeGoogleClient) NearestRoads(ctx context.Context, r *maps.NearestRoadsRequest) (*maps.NearestRoadsResponse, error) {
+	return &maps.NearestRoadsResponse{SnappedPoints: c.snappedPoints}, nil
+}
+
+func TestGoogleMapsService_WithAvoid(t *testing.T) {
+	client := &fakeGoogleClient{}
+	service := &GoogleMapsService{client: client}
+	downtown := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	burnaby := &domain.Location{Lat: 49.2488, Lng: -122.9805}
+
+	shaped, err := service.WithAvoid([]string{AvoidTolls, AvoidHighways})
+	require.NoError(t, err)
+
+	_, err = shaped.GetTravelTime(downtown, burnaby, time.Now())
+	require.NoError(t, err)
+	_, err = shaped.GetTravelTimeMatrix([]*domain.Location{downtown, burnaby}, time.Now())
+	require.NoError(t, err)
+
+	// The original service is unchanged
+	_, err = service.GetTravelTime(downtown, burnaby, time.Now())
+	require.NoError(t, err)
+
+	require.Len(t, client.requests, 3)
+	assert.Equal(t, maps.Avoid("tolls|highways"), client.requests[0].Avoid)
+	assert.Equal(t, maps.Avoid("tolls|highways"), client.requests[1].Avoid)
+	assert.Equal(t, maps.Avoid(""), client.requests[2].Avoid)
+
+	_, err = service.WithAvoid([]string{"left_turns"})
+	assert.Error(t, err)
+}
+
+func TestGoogleMapsService_WithTravelMode(t *testing.T) {
+	client := &fakeGoogleClient{}
+	service := &GoogleMapsService{client: client, travel: newTravelCache(10)}
+	downtown := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	kitsilano := &domain.Location{Lat: 49.2684, Lng: -123.1683}
+	departure := time.Date(2025, 1, 15, 18, 0, 0, 0, time.UTC)
+
+	cycling, err := service.WithTravelMode(TravelModeBicycling)
+	require.NoError(t, err)
+	transit, err := service.WithTravelMode(TravelModeTransit)
+	require.NoError(t, err)
+
+	_, err = cycling.GetTravelTime(downtown, kitsilano, departure)
+	require.NoError(t, err)
+	_, err = transit.GetTravelTimeMatrix([]*domain.Location{downtown, kitsilano}, departure)
+	require.NoError(t, err)
+	// Driving the same leg isn't answered from the cycling time
+	_, err = service.GetTravelTime(downtown, kitsilano, departure)
+	require.NoError(t, err)
+
+	require.Len(t, client.requests, 3)
+	assert.Equal(t, maps.TravelModeBicycling, client.requests[0].Mode)
+	assert.Empty(t, client.requests[0].DepartureTime)
+	assert.Equal(t, maps.TravelModeTransit, client.requests[1].Mode)
+	assert.Equal(t, "1736964000", client.requests[1].DepartureTime)
+	assert.Equal(t, maps.TravelModeDriving, client.requests[2].Mode)
+
+	_, err = service.WithTravelMode("teleporting")
+	assert.Error(t, err)
+}
+
+func TestGoogleMapsService_GeocodeStatuses(t *testing.T) {
+	// The Google client reports non-OK statuses only as error text
+	overQueryLimit := errors.New("maps: OVER_QUERY_LIMIT - You have exceeded your rate-limit for this API.")
+	robson := maps.GeocodingResult{FormattedAddress: "800 Robson St, Vancouver, BC, Canada"}
+	robson.Geometry.Location = maps.LatLng{Lat: 49.2827, Lng: -123.1207}
+
+	newService := func(client *fakeGoogleClient) (*GoogleMapsService, *[]time.Duration) {
+		var waits []time.Duration
+		return &GoogleMapsService{client: client, sleep: func(d time.Duration) { waits = append(waits, d) }}, &waits
+	}
+
+	t.Run("Zero results is not found", func(t *testing.T) {
+		client := &fakeGoogleClient{}
+		service, waits := newService(client)
+
+		_, err := service.GeocodeAddress("nowhere")
+		assert.ErrorIs(t, err, ErrNoResults)
+		assert.NotErrorIs(t, err, ErrRateLimited)
+		assert.Equal(t, 1, client.geocodeCalls)
+		assert.Empty(t, *waits)
+	})
+
+	t.Run("Rate limit is retried with backoff", func(t *testing.T) {
+		client := &fakeGoogleClient{
+			geocodeErrs:    []error{overQueryLimit, overQueryLimit},
+			geocodeResults: []maps.GeocodingResult{robson},
+		}
+		service, waits := newService(client)
+
+		location, err := service.GeocodeAddress("800 Robson St")
+		require.NoError(t, err)
+		assert.Equal(t, 49.2827, location.Lat)
+		assert.Equal(t, 3, client.geocodeCalls)
+		assert.Equal(t, []time.Duration{geocodeRetryBackoff, 2 * geocodeRetryBackoff}, *waits)
+	})
+
+	t.Run("Persistent rate limit", func(t *testing.T) {
+		client := &fakeGoogleClient{geocodeErrs: []error{overQueryLimit, overQueryLimit, overQueryLimit, overQueryLimit}}
+		service, _ := newService(client)
+
+		_, err := service.GeocodeAddress("800 Robson St")
+		assert.ErrorIs(t, err, ErrRateLimited)
+		assert.NotErrorIs(t, err, ErrNoResults)
+		assert.Equal(t, geocodeMaxAttempts, client.geocodeCalls)
+	})
+
+	t.Run("Other failures are not retried", func(t *testing.T) {
+		client := &fakeGoogleClient{geocodeErrs: []error{errors.New("maps: REQUEST_DENIED - The provided API key is invalid.")}}
+		service, _ := newService(client)
+
+		_, err := service.GeocodeAddress("800 Robson St")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrRateLimited)
+		assert.NotErrorIs(t, err, ErrNoResults)
+		assert.Equal(t, 1, client.geocodeCalls)
+	})
+}
+
+func TestGoogleMapsService_GetWalkingRoute(t *testing.T) {
+	meter := &domain.Location{Lat: 49.2828, Lng: -123.1207}
+	stop := &domain.Location{Lat: 49.2838, Lng: -123.1190}
+
+	t.Run("Traces the walk", func(t *testing.T) {
+		client := &fakeGoogleClient{routes: []maps.Route{{
+			OverviewPolyline: maps.Polyline{Points: "a~l~Fjk~uOwHJy@P"},
+			Legs:             []*maps.Leg{{Duration: 3*time.Minute + 40*time.Second}},
+		}}}
+		service := &GoogleMapsService{client: client}
+
+		polyline, minutes, err := service.GetWalkingRoute(meter, stop)
+		require.NoError(t, err)
+		assert.Equal(t, "a~l~Fjk~uOwHJy@P", polyline)
+		assert.Equal(t, 4, minutes)
+
+		require.Len(t, client.directions, 1)
+		assert.Equal(t, maps.TravelModeWalking, client.directions[0].Mode)
+	})
+
+	t.Run("No route", func(t *testing.T) {
+		service := &GoogleMapsService{client: &fakeGoogleClient{}}
+		_, _, err := service.GetWalkingRoute(meter, stop)
+		assert.Error(t, err)
+	})
+}
+
+func TestGoogleMapsService_GetTransitTime(t *testing.T) {
+	client := &fakeGoogleClient{}
+	service := &GoogleMapsService{client: client}
+	downtown := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	metrotown := &domain.Location{Lat: 49.2276, Lng: -122.9995}
+	departure := time.Date(2025, 1, 15, 18, 0, 0, 0, time.UTC)
+
+	minutes, err := service.GetTransitTime(downtown, metrotown, departure)
+	require.NoError(t, err)
+	assert.Equal(t, 10, minutes)
+
+	require.Len(t, client.requests, 1)
+	assert.Equal(t, maps.TravelModeTransit, client.requests[0].Mode)
+	assert.Equal(t, "1736964000", client.requests[0].DepartureTime)
+}
+
+func TestGoogleMapsService_SnapToRoad(t *testing.T) {
+	client := &fakeGoogleClient{snappedPoints: []maps.SnappedPoint{{Location: maps.LatLng{Lat: 49.28265, Lng: -123.12085}}}}
+	service := &GoogleMapsService{client: client}
+
+	snapped, err := service.SnapToRoad(&domain.Location{Lat: 49.2827, Lng: -123.1207})
+	require.NoError(t, err)
+	assert.Equal(t, &domain.Location{Lat: 49.28265, Lng: -123.12085}, snapped)
+
+	client.snappedPoints = nil
+	_, err = service.SnapToRoad(&domain.Location{Lat: 49.2827, Lng: -123.1207})
+	assert.ErrorIs(t, err, ErrNoResults)
+}
+
+func TestEstimateTransitTime(t *testing.T) {
+	downtown := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	metrotown := &domain.Location{Lat: 49.2276, Lng: -122.9995}
+
+	assert.Equal(t, 10, EstimateTransitTime(downtown, downtown))
+	assert.Greater(t, EstimateTransitTime(downtown, metrotown), EstimateDrivingTime(downtown, metrotown))
+}
+
+func TestStraightLinePolyline(t *testing.T) {
+	from := &domain.Location{Lat: 49.2828, Lng: -123.1207}
+	to := &domain.Location{Lat: 49.2838, Lng: -123.1190}
+
+	path, err := (&maps.Polyline{Points: StraightLinePolyline(from, to)}).Decode()
+	require.NoError(t, err)
+	require.Len(t, path, 2)
+	assert.InDelta(t, from.Lat, path[0].Lat, 1e-5)
+	assert.InDelta(t, from.Lng, path[0].Lng, 1e-5)
+	assert.InDelta(t, to.Lat, path[1].Lat, 1e-5)
+	assert.InDelta(t, to.Lng, path[1].Lng, 1e-5)
+}
+
+// geocodingWrappers are the wrappers that change how a MapsService geocodes
+var geocodingWrappers = map[string]func(MapsService) MapsService{
+	"Geocode cache": func(next MapsService) MapsService { return WithGeocodeCache(next, 10) },
+	"Geocoder chain": func(next MapsService) MapsService {
+		return WithGeocoderChain(next, NewGeocoderChain(GeocoderBackend{Name: "fake", Geocoder: &fakeGeocoder{}}))
+	},
+}
+
+func TestWrappedMapsService_WithAvoid(t *testing.T) {
+	downtown := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	kitsilano := &domain.Location{Lat: 49.2684, Lng: -123.1683}
+	departure := time.Date(2025, 1, 15, 18, 0, 0, 0, time.UTC)
+
+	for name, wrap := range geocodingWrappers {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeGoogleClient{}
+			wrapped := wrap(&GoogleMapsService{client: client})
+
+			shaper, ok := wrapped.(RouteShaper)
+			require.True(t, ok)
+			shaped, err := shaper.WithAvoid([]string{AvoidTolls, AvoidFerries})
+			require.NoError(t, err)
+			_, err = shaped.GetTravelTime(downtown, kitsilano, departure)
+			require.NoError(t, err)
+			require.Len(t, client.requests, 1)
+			assert.Equal(t, maps.Avoid("tolls|ferries"), client.requests[0].Avoid)
+
+			// The shaped service still geocodes through the wrapper
+			_, ok = shaped.(ModeRouter)
+			assert.True(t, ok)
+
+			// A wrapped service that can't shape routes says so
+			_, err = wrap(struct{ MapsService }{&GoogleMapsService{client: client}}).(RouteShaper).WithAvoid([]string{AvoidTolls})
+			assert.ErrorIs(t, err, ErrUnsupported)
+		})
+	}
+}
+
+func TestWrappedMapsService_GetTransitTime(t *testing.T) {
+	downtown := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	kitsilano := &domain.Location{Lat: 49.2684, Lng: -123.1683}
+	departure := time.Date(2025, 1, 15, 18, 0, 0, 0, time.UTC)
+
+	for name, wrap := range geocodingWrappers {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeGoogleClient{}
+			router, ok := wrap(&GoogleMapsService{client: client}).(TransitRouter)
+			require.True(t, ok)
+
+			minutes, err := router.GetTransitTime(downtown, kitsilano, departure)
+			require.NoError(t, err)
+			assert.Equal(t, 10, minutes)
+			require.Len(t, client.requests, 1)
+			assert.Equal(t, maps.TravelModeTransit, client.requests[0].Mode)
+
+			// A wrapped service that can't time transit says so
+			_, err = wrap(struct{ MapsService }{&GoogleMapsService{client: client}}).(TransitRouter).GetTransitTime(downtown, kitsilano, departure)
+			assert.ErrorIs(t, err, ErrUnsupported)
+		})
+	}
+}
+
+func TestWrappedMapsService_WithTravelMode(t *testing.T) {
+	downtown := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	kitsilano := &domain.Location{Lat: 49.2684, Lng: -123.1683}
+	departure := time.Date(2025, 1, 15, 18, 0, 0, 0, time.UTC)
+
+	for name, wrap := range geocodingWrappers {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeGoogleClient{}
+			wrapped := wrap(&GoogleMapsService{client: client})
+
+			router, ok := wrapped.(ModeRouter)
+			require.True(t, ok)
+			cycling, err := router.WithTravelMode(TravelModeBicycling)
+			require.NoError(t, err)
+			_, err = cycling.GetTravelTime(downtown, kitsilano, departure)
+			require.NoError(t, err)
+			require.Len(t, client.requests, 1)
+			assert.Equal(t, maps.TravelModeBicycling, client.requests[0].Mode)
+
+			// A wrapped service that only drives can't change mode
+			_, err = wrap(struct{ MapsService }{&GoogleMapsService{client: client}}).(ModeRouter).WithTravelMode(TravelModeTransit)
+			assert.ErrorIs(t, err, ErrUnsupported)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package maps
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"vancouver-trip-planner/internal/domain"
+)
+
+// NominatimGeocoder geocodes addresses with OpenStreetMap's free Nominatim service
+type NominatimGeocoder struct {
+	baseURL    string
+	userAgent  string
+	httpClient *http.Client
+}
+
+// NewNominatimGeocoder creates a Nominatim geocoder. Nominatim's usage policy
+// requires an identifying user agent.
+func NewNominatimGeocoder(baseURL, userAgent string) *NominatimGeocoder {
+	if baseURL == "" {
+		baseURL = "https://nominatim.openstreetmap.org/search"
+	}
+	return &NominatimGeocoder{
+		baseURL:    baseURL,
+		userAgent:  userAgent,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Attribution credits OpenStreetMap, whose data Nominatim searches
+func (g *NominatimGeocoder) Attribution() domain.DataSource {
+	return domain.DataSource{
+		Name:    "OpenStreetMap contributors",
+		License: "Open Database License (ODbL)",
+		URL:     "https://www.openstreetmap.org/copyright",
+	}
+}
+
+// nominatimResult is a single search result; coordinates are returned as strings
+type nominatimResult struct {
+	Lat         string  `json:"lat"`
+	Lon         string  `json:"lon"`
+	DisplayName string  `json:"display_name"`
+	Importance  float64 `json:"importance"`
+}
+
+// GeocodeAddress converts an address to coordinates
+func (g *NominatimGeocoder) GeocodeAddress(address string) (*domain.Location, error) {
+	result, err := g.GeocodeDetails(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.Location{Lat: result.Lat, Lng: result.Lng}, nil
+}
+
+// GeocodeDetails geocodes an address, using Nominatim's display name as the
+// formatted address and its importance score as the confidence
+func (g *NominatimGeocoder) GeocodeDetails(address string) (*GeocodeResult, error) {
+	params := url.Values{}
+	params.Add("q", address)
+	params.Add("format", "json")
+	params.Add("limit", "1")
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s?%s", g.baseURL, params.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build geocode request: %w", err)
+	}
+	req.Header.Set("User-Agent", g.userAgent)
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to geocode address: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geocode request failed: %s", resp.Status)
+	}
+
+	var results []nominatimResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("failed to decode geocode response: %w", err)
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%w for address: %s", ErrNoResults, address)
+	}
+
+	lat, err := strconv.ParseFloat(results[0].Lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude in geocode response: %w", err)
+	}
+	lng, err := strconv.ParseFloat(results[0].Lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude in geocode response: %w", err)
+	}
+
+	return &GeocodeResult{
+		FormattedAddress: results[0].DisplayName,
+		Lat:              lat,
+		Lng:              lng,
+		Confidence:       math.Min(math.Max(results[0].Importance, 0), 1),
+	}, nil
+}
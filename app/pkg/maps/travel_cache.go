@@ -0,0 +1,85 @@
+package maps
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"googlemaps.github.io/maps"
+	"vancouver-trip-planner/internal/domain"
+)
+
+// travelCacheBucket is how finely departure times are told apart; traffic
+// barely changes within it
+const travelCacheBucket = 15 * time.Minute
+
+// travelCacheKey identifies a leg by its endpoints, rounded to about a metre,
+// the quarter hour it departs in, its travel mode and the features it avoids
+type travelCacheKey struct {
+	from, to  string
+	departure int64
+	mode      maps.Mode
+	avoid     maps.Avoid
+}
+
+func newTravelCacheKey(from, to *domain.Location, departureTime time.Time, mode maps.Mode, avoid maps.Avoid) travelCacheKey {
+	return travelCacheKey{
+		from:      fmt.Sprintf("%.5f,%.5f", from.Lat, from.Lng),
+		to:        fmt.Sprintf("%.5f,%.5f", to.Lat, to.Lng),
+		departure: departureTime.Round(travelCacheBucket).Unix(),
+		mode:      mode,
+		avoid:     avoid,
+	}
+}
+
+// travelCache holds up to maxEntries travel times, evicting the least recently
+// used. Unlike the geocode caches it tracks recency, since planning revisits
+// the same legs across every stop order.
+type travelCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List // most recently used at the front
+	entries map[travelCacheKey]*list.Element
+}
+
+type travelCacheEntry struct {
+	key     travelCacheKey
+	minutes int
+}
+
+func newTravelCache(maxEntries int) *travelCache {
+	return &travelCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[travelCacheKey]*list.Element),
+	}
+}
+
+func (c *travelCache) get(key travelCacheKey) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return 0, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*travelCacheEntry).minutes, true
+}
+
+func (c *travelCache) put(key travelCacheKey, minutes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*travelCacheEntry).minutes = minutes
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&travelCacheEntry{key: key, minutes: minutes})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*travelCacheEntry).key)
+	}
+}
@@ -0,0 +1,122 @@
+package maps
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"vancouver-trip-planner/internal/domain"
+)
+
+func TestGoogleMapsService_TravelCache(t *testing.T) {
+	downtown := &domain.Location{Lat: 49.2827, Lng: -123.1207}
+	burnaby := &domain.Location{Lat: 49.2488, Lng: -122.9805}
+	kitsilano := &domain.Location{Lat: 49.2684, Lng: -123.1683}
+	departure := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	newService := func(maxEntries int) (*GoogleMapsService, *fakeGoogleClient) {
+		client := &fakeGoogleClient{}
+		return &GoogleMapsService{client: client, travel: newTravelCache(maxEntries)}, client
+	}
+
+	t.Run("Repeated legs skip the API", func(t *testing.T) {
+		service, client := newService(10)
+
+		minutes, err := service.GetTravelTime(downtown, burnaby, departure)
+		require.NoError(t, err)
+		assert.Equal(t, 10, minutes)
+
+		// Same leg a few minutes later falls in the same quarter hour
+		minutes, err = service.GetTravelTime(downtown, burnaby, departure.Add(5*time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, 10, minutes)
+		assert.Len(t, client.requests, 1)
+
+		// The other direction and a later departure are looked up
+		_, err = service.GetTravelTime(burnaby, downtown, departure)
+		require.NoError(t, err)
+		_, err = service.GetTravelTime(downtown, burnaby, departure.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Len(t, client.requests, 3)
+	})
+
+	t.Run("Avoided features are cached apart", func(t *testing.T) {
+		service, client := newService(10)
+		shaped, err := service.WithAvoid([]string{AvoidTolls})
+		require.NoError(t, err)
+
+		_, err = service.GetTravelTime(downtown, burnaby, departure)
+		require.NoError(t, err)
+		_, err = shaped.GetTravelTime(downtown, burnaby, departure)
+		require.NoError(t, err)
+		_, err = shaped.GetTravelTime(downtown, burnaby, departure)
+		require.NoError(t, err)
+		assert.Len(t, client.requests, 2)
+	})
+
+	t.Run("Least recently used legs are evicted", func(t *testing.T) {
+		service, client := newService(2)
+
+		for _, to := range []*domain.Location{burnaby, kitsilano, burnaby} {
+			_, err := service.GetTravelTime(downtown, to, departure)
+			require.NoError(t, err)
+		}
+		require.Len(t, client.requests, 2)
+
+		// Adding a third leg evicts Kitsilano, used less recently than Burnaby
+		_, err := service.GetTravelTime(burnaby, kitsilano, departure)
+		require.NoError(t, err)
+		_, err = service.GetTravelTime(downtown, burnaby, departure)
+		require.NoError(t, err)
+		assert.Len(t, client.requests, 3)
+		_, err = service.GetTravelTime(downtown, kitsilano, departure)
+		require.NoError(t, err)
+		assert.Len(t, client.requests, 4)
+	})
+
+	t.Run("Matrix legs are cached", func(t *testing.T) {
+		service, client := newService(10)
+		locations := []*domain.Location{downtown, burnaby, kitsilano}
+
+		matrix, err := service.GetTravelTimeMatrix(locations, departure)
+		require.NoError(t, err)
+		assert.Equal(t, [][]int{{0, 10, 10}, {10, 0, 10}, {10, 10, 0}}, matrix)
+		require.Len(t, client.requests, 1)
+
+		// Its legs and the matrix itself are answered from the cache
+		minutes, err := service.GetTravelTime(burnaby, kitsilano, departure)
+		require.NoError(t, err)
+		assert.Equal(t, 10, minutes)
+		cached, err := service.GetTravelTimeMatrix(locations, departure.Add(5*time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, matrix, cached)
+		assert.Len(t, client.requests, 1)
+
+		// A matrix with an uncached leg is looked up
+		_, err = service.GetTravelTimeMatrix(locations, departure.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Len(t, client.requests, 2)
+	})
+
+	t.Run("Matrix and single legs agree", func(t *testing.T) {
+		client := &fakeGoogleClient{trafficDuration: 25 * time.Minute}
+		service := &GoogleMapsService{client: client}
+
+		minutes, err := service.GetTravelTime(downtown, burnaby, departure)
+		require.NoError(t, err)
+		matrix, err := service.GetTravelTimeMatrix([]*domain.Location{downtown, burnaby}, departure)
+		require.NoError(t, err)
+		assert.Equal(t, minutes, matrix[0][1])
+	})
+
+	t.Run("No cache by default", func(t *testing.T) {
+		client := &fakeGoogleClient{}
+		service := &GoogleMapsService{client: client}
+		for i := 0; i < 2; i++ {
+			_, err := service.GetTravelTime(downtown, burnaby, departure)
+			require.NoError(t, err)
+		}
+		assert.Len(t, client.requests, 2)
+	})
+}